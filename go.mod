@@ -6,6 +6,8 @@ require (
 	github.com/getkin/kin-openapi v0.127.0
 	github.com/gorilla/mux v1.8.0
 	go.mongodb.org/mongo-driver v1.16.1
+	golang.org/x/mod v0.21.0
+	golang.org/x/tools v0.26.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -26,7 +28,7 @@ require (
 	github.com/xdg-go/scram v1.1.2 // indirect
 	github.com/xdg-go/stringprep v1.0.4 // indirect
 	github.com/youmark/pkcs8 v0.0.0-20181117223130-1be2e3e5546d // indirect
-	golang.org/x/sync v0.7.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
 	golang.org/x/text v0.15.0 // indirect
 )
 
@@ -1,72 +1,268 @@
 package analyzer
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
 	"go/parser"
 	"go/token"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type FunctionInfo struct {
-	Name       string
-	Receiver   string
-	Parameters []ParameterInfo
-	Results    []ParameterInfo
-	IsMethod   bool
-	IsGeneric  bool
+	// Language is LanguageGo or the Language of the LanguageAnalyzer that
+	// read the function.
+	Language   string          `json:"language" yaml:"language"`
+	Name       string          `json:"name" yaml:"name"`
+	Receiver   string          `json:"receiver,omitempty" yaml:"receiver,omitempty"`
+	Parameters []ParameterInfo `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Results    []ParameterInfo `json:"results,omitempty" yaml:"results,omitempty"`
+	IsMethod   bool            `json:"isMethod,omitempty" yaml:"isMethod,omitempty"`
+	IsGeneric  bool            `json:"isGeneric,omitempty" yaml:"isGeneric,omitempty"`
+	// TypeParams lists the type parameters of a generic function, with
+	// their constraints as Type.
+	TypeParams []ParameterInfo `json:"typeParams,omitempty" yaml:"typeParams,omitempty"`
+	// Doc is the function's doc comment without directive lines.
+	Doc        string     `json:"doc,omitempty" yaml:"doc,omitempty"`
+	Directives Directives `json:"directives,omitempty" yaml:"directives,omitempty"`
+	// Package is the package name and PackagePath its import path, or its
+	// directory when no go.mod encloses the file. Module is the path of the
+	// enclosing module, if any.
+	Package     string      `json:"package,omitempty" yaml:"package,omitempty"`
+	PackagePath string      `json:"packagePath,omitempty" yaml:"packagePath,omitempty"`
+	Module      string      `json:"module,omitempty" yaml:"module,omitempty"`
+	Source      SourceRange `json:"source,omitempty" yaml:"source,omitempty"`
+	// BuildConstraint is the //go:build expression of the declaring file.
+	BuildConstraint string `json:"buildConstraint,omitempty" yaml:"buildConstraint,omitempty"`
+	// Risks lists what makes a Go function dangerous to expose, found in its
+	// parameters and body and in the bodies of the functions it calls.
+	// RiskScore sums their weights per category, up to 100.
+	Risks     []Risk `json:"risks,omitempty" yaml:"risks,omitempty"`
+	RiskScore int    `json:"riskScore,omitempty" yaml:"riskScore,omitempty"`
+	// Effect is what calling a Go function does to state, from its body and
+	// the functions it calls, and EffectReason the finding that decided it.
+	// It is empty when the body was not analyzed.
+	Effect       Effect `json:"effect,omitempty" yaml:"effect,omitempty"`
+	EffectReason string `json:"effectReason,omitempty" yaml:"effectReason,omitempty"`
+	// Errors are the named errors a Go function returns, from its body and
+	// those of the functions whose errors it passes on.
+	Errors []ErrorInfo `json:"errors,omitempty" yaml:"errors,omitempty"`
 }
 
 type ParameterInfo struct {
-	Name string
-	Type string
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	Type string `json:"type" yaml:"type"`
+	// Resolved is only set when the function was loaded through
+	// AnalyzePackages and carries the type-checked view of Type.
+	Resolved *TypeInfo `json:"resolved,omitempty" yaml:"resolved,omitempty"`
+	// Role is set for Go parameters and results the transport handles
+	// itself, such as a leading context.Context or a trailing error.
+	Role Role `json:"role,omitempty" yaml:"role,omitempty"`
 }
 
 type FunctionAnalyzer struct {
 	Functions []FunctionInfo
+	// Services groups the recorded methods by the type they belong to,
+	// together with the interfaces declared alongside and the constructors
+	// of each type. It is rebuilt after every analysis.
+	Services []ServiceInfo
+	// Schemas holds the named types reachable from analyzed signatures,
+	// keyed by qualified type name. It is filled by AnalyzePackages.
+	Schemas map[string]*TypeSchema
+	// Options selects what is analyzed; Report summarises the last runs.
+	Options Options
+	Report  Report
+	// Repository is set by AnalyzeRepository to the revision analyzed.
+	Repository *RepositoryInfo
+	// Cache, when set, lets unchanged files and packages reuse the results
+	// of an earlier run.
+	Cache *Cache
+	// Languages holds the analyzers AnalyzeDirectory and AnalyzePackages use
+	// for files other than Go ones. When nil, only Go files are analyzed.
+	Languages *Registry
+	// Workers bounds the number of files AnalyzeDirectory, or the files of
+	// other languages AnalyzePackages, analyzes at once. Zero means
+	// runtime.GOMAXPROCS(0).
+	Workers int
+
+	mu      sync.Mutex
+	modules map[string]*moduleInfo
+	// types holds the Go type declarations Services is built from, bodies
+	// what the functions of the analyzed files do, and errors the sentinels
+	// and error types they declare.
+	types  []ServiceInfo
+	bodies []bodySummary
+	errors []ErrorInfo
 }
 
 func NewFunctionAnalyzer() *FunctionAnalyzer {
 	return &FunctionAnalyzer{
 		Functions: make([]FunctionInfo, 0),
+		Schemas:   make(map[string]*TypeSchema),
 	}
 }
 
+// AnalyzeFile records the functions of one Go file, or of a file handled by
+// fa.Languages.
 func (fa *FunctionAnalyzer) AnalyzeFile(filePath string) error {
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, filePath, nil, parser.ParseComments)
+	result, err := fa.analyzeFile(filePath, filepath.ToSlash(filepath.Dir(filePath)))
 	if err != nil {
 		return err
 	}
+	fa.merge(result)
+	fa.link()
+	return nil
+}
+
+// merge adds the outcome of analyzing one file to fa.
+func (fa *FunctionAnalyzer) merge(result fileResult) {
+	fa.Functions = append(fa.Functions, result.Functions...)
+	fa.types = append(fa.types, result.Types...)
+	fa.bodies = append(fa.bodies, result.Bodies...)
+	fa.errors = append(fa.errors, result.Errors...)
+	fa.Report.FilesAnalyzed += result.FilesAnalyzed
+	fa.Report.FilesSkipped += result.FilesSkipped
+	if result.CacheHit {
+		fa.Report.CacheHits++
+	}
+}
 
-	ast.Inspect(node, func(n ast.Node) bool {
-		switch x := n.(type) {
-		case *ast.FuncDecl:
-			funcInfo := fa.analyzeFuncDecl(x)
-			fa.Functions = append(fa.Functions, funcInfo)
+// analyzeFile analyzes one file selected by fa.Options, going through the
+// cache when there is one. pkgDir identifies the file's package for the
+// package filters. It leaves fa untouched, so files may be analyzed
+// concurrently.
+func (fa *FunctionAnalyzer) analyzeFile(filePath, pkgDir string) (fileResult, error) {
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return fileResult{}, err
+	}
+	analyze := fa.analyzeSource
+	language := LanguageGo
+	if la := fa.Languages.ForFile(filePath); la != nil && !isGoFile(filePath) {
+		analyze = func(filePath string, src []byte, pkgDir string) (fileResult, error) {
+			return fa.analyzeForeignSource(la, filePath, src, pkgDir)
 		}
-		return true
-	})
+		language = la.Language()
+	}
+	if fa.Cache == nil {
+		return analyze(filePath, src, pkgDir)
+	}
 
-	return nil
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fileResult{}, err
+	}
+	var module []byte
+	if mi := fa.moduleFor(filepath.Dir(filePath)); mi != nil {
+		module = []byte(mi.path + " " + mi.root)
+	}
+	key := fa.cacheKey([]byte("file"), []byte(language), []byte(absPath), []byte(pkgDir), module, src)
+
+	var result fileResult
+	if fa.Cache.load(key, &result) {
+		result.CacheHit = true
+		return result, nil
+	}
+
+	result, err = analyze(filePath, src, pkgDir)
+	if err != nil {
+		return fileResult{}, err
+	}
+	// A cache that cannot be written only costs time on the next run.
+	_ = fa.Cache.store(key, result)
+	return result, nil
 }
 
-func (fa *FunctionAnalyzer) analyzeFuncDecl(funcDecl *ast.FuncDecl) FunctionInfo {
+// analyzeSource parses src, the contents of filePath, and collects its
+// functions.
+func (fa *FunctionAnalyzer) analyzeSource(filePath string, src []byte, pkgDir string) (fileResult, error) {
+	fset := token.NewFileSet()
+	node, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
+	if err != nil {
+		return fileResult{}, err
+	}
+
+	ctx := fileContext{
+		fset:            fset,
+		packageName:     node.Name.Name,
+		packagePath:     pkgDir,
+		buildConstraint: buildConstraint(node),
+	}
+	if module := fa.moduleFor(filepath.Dir(filePath)); module != nil {
+		ctx.module = module.path
+		ctx.packagePath = module.importPath(filepath.Dir(filePath))
+	}
+
+	if (fa.Options.SkipGenerated && ast.IsGenerated(node)) || !fa.Options.includePackage(node.Name.Name, pkgDir, ctx.packagePath) {
+		return fileResult{FilesSkipped: 1}, nil
+	}
+
+	result := fileResult{FilesAnalyzed: 1}
+	scanner := newBodyScanner(ctx, node, nil)
+	result.Bodies = scanner.scanFile(node)
+	result.Errors = scanner.declaredErrors(node)
+	for _, decl := range node.Decls {
+		if genDecl, ok := decl.(*ast.GenDecl); ok {
+			declared, err := fa.analyzeTypeDecl(ctx, genDecl, nil, nil)
+			if err != nil {
+				return fileResult{}, err
+			}
+			result.Types = append(result.Types, declared...)
+			continue
+		}
+		funcDecl, ok := decl.(*ast.FuncDecl)
+		if !ok || !fa.Options.includeFunction(funcDecl) {
+			continue
+		}
+		funcInfo, err := fa.analyzeFuncDecl(funcDecl)
+		if err != nil {
+			return fileResult{}, fmt.Errorf("%s: %v", fset.Position(funcDecl.Pos()), err)
+		}
+		ctx.apply(&funcInfo, funcDecl)
+		result.Functions = append(result.Functions, funcInfo)
+	}
+
+	return result, nil
+}
+
+func (fa *FunctionAnalyzer) analyzeFuncDecl(funcDecl *ast.FuncDecl) (FunctionInfo, error) {
 	funcInfo := FunctionInfo{
 		Name:      funcDecl.Name.Name,
 		IsMethod:  funcDecl.Recv != nil,
 		IsGeneric: funcDecl.Type.TypeParams != nil,
 	}
 
+	doc, directives, err := parseDocComment(funcDecl.Doc)
+	if err != nil {
+		return funcInfo, err
+	}
+	funcInfo.Doc = doc
+	funcInfo.Directives = directives
+
 	if funcInfo.IsMethod {
 		funcInfo.Receiver = fa.extractReceiver(funcDecl.Recv)
 	}
 
+	funcInfo.TypeParams = fa.extractFieldList(funcDecl.Type.TypeParams)
 	funcInfo.Parameters = fa.extractFieldList(funcDecl.Type.Params)
 	funcInfo.Results = fa.extractFieldList(funcDecl.Type.Results)
+	assignRoles(&funcInfo)
 
-	return funcInfo
+	return funcInfo, checkParamDirectives(funcInfo)
+}
+
+func hasParameter(params []ParameterInfo, name string) bool {
+	for _, param := range params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
 func (fa *FunctionAnalyzer) extractReceiver(recv *ast.FieldList) string {
@@ -84,45 +280,286 @@ func (fa *FunctionAnalyzer) extractFieldList(fieldList *ast.FieldList) []Paramet
 	for _, field := range fieldList.List {
 		typeStr := fa.typeToString(field.Type)
 		if len(field.Names) == 0 {
-			params = append(params, ParameterInfo{"", typeStr})
+			params = append(params, ParameterInfo{Type: typeStr})
 		} else {
 			for _, name := range field.Names {
-				params = append(params, ParameterInfo{name.Name, typeStr})
+				params = append(params, ParameterInfo{Name: name.Name, Type: typeStr})
 			}
 		}
 	}
 	return params
 }
 
+// typeToString renders a type expression the way it would be written in
+// source, so that the result parses back to an equivalent expression.
 func (fa *FunctionAnalyzer) typeToString(expr ast.Expr) string {
 	switch t := expr.(type) {
 	case *ast.Ident:
 		return t.Name
 	case *ast.StarExpr:
 		return "*" + fa.typeToString(t.X)
+	case *ast.ParenExpr:
+		return "(" + fa.typeToString(t.X) + ")"
 	case *ast.ArrayType:
-		return "[]" + fa.typeToString(t.Elt)
+		if t.Len == nil {
+			return "[]" + fa.typeToString(t.Elt)
+		}
+		return "[" + fa.typeToString(t.Len) + "]" + fa.typeToString(t.Elt)
+	case *ast.Ellipsis:
+		if t.Elt == nil {
+			// The length of an array literal type such as [...]int.
+			return "..."
+		}
+		return "..." + fa.typeToString(t.Elt)
 	case *ast.MapType:
 		return "map[" + fa.typeToString(t.Key) + "]" + fa.typeToString(t.Value)
+	case *ast.ChanType:
+		switch t.Dir {
+		case ast.SEND:
+			return "chan<- " + fa.typeToString(t.Value)
+		case ast.RECV:
+			return "<-chan " + fa.typeToString(t.Value)
+		default:
+			return "chan " + fa.typeToString(t.Value)
+		}
 	case *ast.InterfaceType:
-		return "interface{}"
+		return "interface{" + fa.fieldListToString(t.Methods, "; ", true) + "}"
+	case *ast.StructType:
+		return "struct{" + fa.fieldListToString(t.Fields, "; ", false) + "}"
 	case *ast.FuncType:
-		return "func()"
+		return "func" + fa.signatureToString(t)
 	case *ast.SelectorExpr:
 		return fa.typeToString(t.X) + "." + t.Sel.Name
+	case *ast.IndexExpr:
+		return fa.typeToString(t.X) + "[" + fa.typeToString(t.Index) + "]"
+	case *ast.IndexListExpr:
+		indices := make([]string, len(t.Indices))
+		for i, index := range t.Indices {
+			indices[i] = fa.typeToString(index)
+		}
+		return fa.typeToString(t.X) + "[" + strings.Join(indices, ", ") + "]"
+	case *ast.BasicLit:
+		return t.Value
+	case *ast.UnaryExpr:
+		// ~T in constraints, or a negated constant in an array length.
+		return t.Op.String() + fa.typeToString(t.X)
+	case *ast.BinaryExpr:
+		// T1 | T2 in constraints, or constant arithmetic in an array length.
+		return fa.typeToString(t.X) + " " + t.Op.String() + " " + fa.typeToString(t.Y)
 	default:
 		return "unknown"
 	}
 }
 
+// signatureToString renders the parameters and results of a function type.
+func (fa *FunctionAnalyzer) signatureToString(funcType *ast.FuncType) string {
+	signature := "(" + fa.fieldListToString(funcType.Params, ", ", false) + ")"
+	results := funcType.Results
+	if results == nil || len(results.List) == 0 {
+		return signature
+	}
+	if len(results.List) == 1 && len(results.List[0].Names) == 0 {
+		return signature + " " + fa.typeToString(results.List[0].Type)
+	}
+	return signature + " (" + fa.fieldListToString(results, ", ", false) + ")"
+}
+
+// fieldListToString renders parameters, struct fields or interface elements,
+// keeping names that share a type grouped as in the source.
+func (fa *FunctionAnalyzer) fieldListToString(fieldList *ast.FieldList, sep string, isInterface bool) string {
+	if fieldList == nil {
+		return ""
+	}
+	fields := make([]string, 0, len(fieldList.List))
+	for _, field := range fieldList.List {
+		names := make([]string, len(field.Names))
+		for i, name := range field.Names {
+			names[i] = name.Name
+		}
+
+		var rendered string
+		switch {
+		case isInterface && len(names) > 0:
+			rendered = names[0] + fa.signatureToString(field.Type.(*ast.FuncType))
+		case len(names) > 0:
+			rendered = strings.Join(names, ", ") + " " + fa.typeToString(field.Type)
+		default:
+			rendered = fa.typeToString(field.Type)
+		}
+		if field.Tag != nil {
+			rendered += " " + field.Tag.Value
+		}
+		fields = append(fields, rendered)
+	}
+	return strings.Join(fields, sep)
+}
+
 func (fa *FunctionAnalyzer) AnalyzeDirectory(dir string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	return fa.AnalyzeDirectoryContext(context.Background(), dir)
+}
+
+// AnalyzeDirectoryContext analyzes the Go files below dir across fa.Workers
+// goroutines. Functions found by the run are ordered by package, file and
+// position regardless of which worker analyzed them. Cancelling ctx stops the
+// run and returns ctx.Err(), leaving fa as it was.
+func (fa *FunctionAnalyzer) AnalyzeDirectoryContext(ctx context.Context, dir string) error {
+	jobs, err := fa.collectFiles(ctx, dir, false)
+	if err != nil {
+		return err
+	}
+	if err := fa.analyzeFiles(ctx, jobs); err != nil {
+		return err
+	}
+	fa.link()
+	return nil
+}
+
+// analyzeFiles analyzes jobs across fa.Workers goroutines and records their
+// functions, ordered by package, file and position. Cancelling ctx stops the
+// run and returns ctx.Err(), leaving fa as it was.
+func (fa *FunctionAnalyzer) analyzeFiles(ctx context.Context, jobs []fileJob) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := fa.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				job := &jobs[i]
+				job.result, job.err = fa.analyzeFile(job.path, job.pkgDir)
+				if job.err != nil && !fa.Options.Tolerant {
+					cancel()
+				}
+			}
+		}()
+	}
+feed:
+	for i := range jobs {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	// Report the first failing file in walk order; a failure cancels ctx, so
+	// check the jobs before ctx.
+	if !fa.Options.Tolerant {
+		for _, job := range jobs {
+			if job.err != nil {
+				return job.err
+			}
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	start := len(fa.Functions)
+	for _, job := range jobs {
+		if job.err != nil {
+			fa.Report.Errors = append(fa.Report.Errors, FileError{Path: job.path, Err: job.err})
+			continue
+		}
+		fa.merge(job.result)
+	}
+	sortFunctions(fa.Functions[start:])
+	return nil
+}
+
+// fileJob is one file of a directory run and, once analyzed, its outcome.
+type fileJob struct {
+	path   string
+	pkgDir string
+	result fileResult
+	err    error
+}
+
+// collectFiles walks dir and returns the files selected by fa.Options, in
+// walk order, leaving Go files out when foreignOnly is set. Skipped files
+// and, in tolerant mode, unreadable directories are recorded in fa.Report
+// straight away.
+func (fa *FunctionAnalyzer) collectFiles(ctx context.Context, dir string, foreignOnly bool) ([]fileJob, error) {
+	var jobs []fileJob
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if !fa.Options.Tolerant {
+				return err
+			}
+			fa.Report.Errors = append(fa.Report.Errors, FileError{Path: path, Err: err})
+			if info != nil && info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() {
+			if path != dir && fa.Options.skipDir(info.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if (isGoFile(path) && foreignOnly) || (!isGoFile(path) && fa.Languages.ForFile(path) == nil) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
 		if err != nil {
 			return err
 		}
-		if !info.IsDir() && strings.HasSuffix(path, ".go") {
-			return fa.AnalyzeFile(path)
+		if !fa.Options.includeFile(dir, rel) {
+			fa.Report.FilesSkipped++
+			return nil
 		}
+
+		jobs = append(jobs, fileJob{path: path, pkgDir: filepath.ToSlash(filepath.Dir(rel))})
 		return nil
 	})
+	return jobs, err
+}
+
+// link derives what depends on everything recorded so far: the risks of
+// functions, their effects and errors, which follow calls across files, and
+// the services.
+func (fa *FunctionAnalyzer) link() {
+	fa.linkRisks()
+	fa.linkEffects()
+	fa.linkErrors()
+	fa.linkServices()
+}
+
+func isGoFile(path string) bool {
+	return strings.HasSuffix(path, ".go")
+}
+
+// sortFunctions orders functions by package path, file and position.
+func sortFunctions(functions []FunctionInfo) {
+	sort.SliceStable(functions, func(i, j int) bool {
+		a, b := functions[i], functions[j]
+		if a.PackagePath != b.PackagePath {
+			return a.PackagePath < b.PackagePath
+		}
+		if a.Source.File != b.Source.File {
+			return a.Source.File < b.Source.File
+		}
+		if a.Source.Start.Line != b.Source.Start.Line {
+			return a.Source.Start.Line < b.Source.Start.Line
+		}
+		return a.Source.Start.Column < b.Source.Start.Column
+	})
 }
@@ -1,6 +1,9 @@
 package analyzer
 
 import (
+	"context"
+	"fmt"
+	"go/parser"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -10,6 +13,29 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+// withoutLocation clears the language, package and source metadata, which
+// depends on where the temporary files end up, and the risks, effects and
+// errors, which are tested on their own, so that tests can compare
+// signatures.
+func withoutLocation(functions []FunctionInfo) []FunctionInfo {
+	stripped := make([]FunctionInfo, len(functions))
+	for i, fn := range functions {
+		fn.Language = ""
+		fn.Package = ""
+		fn.PackagePath = ""
+		fn.Module = ""
+		fn.Source = SourceRange{}
+		fn.BuildConstraint = ""
+		fn.Risks = nil
+		fn.RiskScore = 0
+		fn.Effect = ""
+		fn.EffectReason = ""
+		fn.Errors = nil
+		stripped[i] = fn
+	}
+	return stripped
+}
+
 func TestFunctionAnalyzer(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -73,6 +99,9 @@ func TestFunctionAnalyzer(t *testing.T) {
 				{
 					Name:      "identity",
 					IsGeneric: true,
+					TypeParams: []ParameterInfo{
+						{Name: "T", Type: "any"},
+					},
 					Parameters: []ParameterInfo{
 						{Name: "value", Type: "T"},
 					},
@@ -99,7 +128,51 @@ func TestFunctionAnalyzer(t *testing.T) {
 					},
 					Results: []ParameterInfo{
 						{Name: "result", Type: "*string"},
-						{Name: "err", Type: "error"},
+						{Name: "err", Type: "error", Role: RoleError},
+					},
+				},
+			},
+		},
+		{
+			name: "Generic function with constraints",
+			code: `
+				package main
+				func Sum[K comparable, V ~int | ~float64](m map[K]V, extra ...V) (total V) {
+					return total
+				}
+			`,
+			expected: []FunctionInfo{
+				{
+					Name:      "Sum",
+					IsGeneric: true,
+					TypeParams: []ParameterInfo{
+						{Name: "K", Type: "comparable"},
+						{Name: "V", Type: "~int | ~float64"},
+					},
+					Parameters: []ParameterInfo{
+						{Name: "m", Type: "map[K]V"},
+						{Name: "extra", Type: "...V"},
+					},
+					Results: []ParameterInfo{
+						{Name: "total", Type: "V"},
+					},
+				},
+			},
+		},
+		{
+			name: "Method on generic type",
+			code: `
+				package main
+				type Stack[T any] struct{ items []T }
+				func (s *Stack[T]) Drain(out chan<- T) {}
+			`,
+			expected: []FunctionInfo{
+				{
+					Name:     "Drain",
+					Receiver: "*Stack[T]",
+					IsMethod: true,
+					Parameters: []ParameterInfo{
+						{Name: "out", Type: "chan<- T"},
 					},
 				},
 			},
@@ -134,7 +207,7 @@ func TestFunctionAnalyzer(t *testing.T) {
 					},
 					Results: []ParameterInfo{
 						{Type: "bool"},
-						{Type: "error"},
+						{Type: "error", Role: RoleError},
 					},
 				},
 			},
@@ -154,7 +227,50 @@ func TestFunctionAnalyzer(t *testing.T) {
 			analyzer := NewFunctionAnalyzer()
 			err = analyzer.AnalyzeFile(tempFile.Name())
 			assert.NoError(t, err)
-			assert.Equal(t, tc.expected, analyzer.Functions)
+			assert.Equal(t, tc.expected, withoutLocation(analyzer.Functions))
+		})
+	}
+}
+
+func TestTypeToString(t *testing.T) {
+	testCases := []struct {
+		name string
+		src  string
+	}{
+		{"identifier", "int"},
+		{"qualified", "models.SoftwareInfo"},
+		{"pointer", "*models.SoftwareInfo"},
+		{"slice", "[]byte"},
+		{"array", "[4]int"},
+		{"array with constant length", "[size * 2]int"},
+		{"array literal length", "[...]string"},
+		{"map", "map[string][]*int"},
+		{"channel", "chan int"},
+		{"send channel", "chan<- error"},
+		{"receive channel", "<-chan struct{}"},
+		{"channel of receive channel", "chan (<-chan int)"},
+		{"parenthesized", "(*int)"},
+		{"empty interface", "interface{}"},
+		{"interface with methods", "interface{io.Reader; Close() error; Len() (n int)}"},
+		{"constraint union", "interface{~int | ~string}"},
+		{"empty struct", "struct{}"},
+		{"struct with tags", "struct{Name string `json:\"name\"`; X, Y int; io.Writer}"},
+		{"func without results", "func()"},
+		{"func with single result", "func(int) bool"},
+		{"func with named parameters", "func(ctx context.Context, a, b int) (int, error)"},
+		{"func with named results", "func() (n int, err error)"},
+		{"variadic func", "func(format string, args ...any)"},
+		{"func returning func", "func(int) func(string) error"},
+		{"generic instantiation", "List[int]"},
+		{"generic instantiation with several arguments", "cache.Map[string, []*models.User]"},
+	}
+
+	fa := NewFunctionAnalyzer()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tc.src)
+			require.NoError(t, err)
+			assert.Equal(t, tc.src, fa.typeToString(expr))
 		})
 	}
 }
@@ -212,10 +328,71 @@ func TestAnalyzeDirectory(t *testing.T) {
 			},
 			Results: []ParameterInfo{
 				{Type: "bool"},
-				{Type: "error"},
+				{Type: "error", Role: RoleError},
 			},
 		},
 	}
 
-	assert.ElementsMatch(t, expected, analyzer.Functions)
+	assert.ElementsMatch(t, expected, withoutLocation(analyzer.Functions))
+}
+
+func TestAnalyzeDirectoryConcurrent(t *testing.T) {
+	files := make(map[string]string)
+	for i := 0; i < 40; i++ {
+		files[fmt.Sprintf("pkg%d/file%d.go", i%4, i)] = fmt.Sprintf(
+			"package pkg%d\n\nfunc First%d() {}\n\nfunc Second%d(x int) int { return x }\n", i%4, i, i)
+	}
+	dir := writeModule(t, files)
+
+	sequential := NewFunctionAnalyzer()
+	sequential.Workers = 1
+	require.NoError(t, sequential.AnalyzeDirectory(dir))
+	require.Len(t, sequential.Functions, 80)
+
+	for _, workers := range []int{0, 3, 16} {
+		concurrent := NewFunctionAnalyzer()
+		concurrent.Workers = workers
+		require.NoError(t, concurrent.AnalyzeDirectory(dir))
+		assert.Equal(t, sequential.Functions, concurrent.Functions, "%d workers", workers)
+		assert.Equal(t, sequential.Report, concurrent.Report, "%d workers", workers)
+	}
+
+	for i := 1; i < len(sequential.Functions); i++ {
+		prev, fn := sequential.Functions[i-1], sequential.Functions[i]
+		if prev.PackagePath == fn.PackagePath && prev.Source.File == fn.Source.File {
+			assert.Less(t, prev.Source.Start.Line, fn.Source.Start.Line)
+		} else {
+			assert.LessOrEqual(t, prev.PackagePath+prev.Source.File, fn.PackagePath+fn.Source.File)
+		}
+	}
+}
+
+func TestAnalyzeDirectoryContextCancelled(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a.go": "package main\n\nfunc A() {}\n",
+		"b.go": "package main\n\nfunc B() {}\n",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	analyzer := NewFunctionAnalyzer()
+	err := analyzer.AnalyzeDirectoryContext(ctx, dir)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, analyzer.Functions)
+}
+
+func TestAnalyzeDirectoryReportsFirstError(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a.go": "package main\n\nfunc A( {}\n",
+		"b.go": "package main\n\nfunc B() {}\n",
+		"c.go": "package main\n\nfunc C( {}\n",
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Workers = 4
+	err := analyzer.AnalyzeDirectory(dir)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "a.go")
+	assert.Empty(t, analyzer.Functions)
 }
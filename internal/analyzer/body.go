@@ -0,0 +1,478 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// bodySummary records what a function body does, for every function
+// declared in an analyzed file, recorded or not, so that risks and effects
+// can be followed through unexported helpers.
+type bodySummary struct {
+	// Function is the qualified name of the function.
+	Function string
+	Risks    []Risk
+	// Effect is the strongest effect of the body itself, leaving out what
+	// the functions it calls do, and EffectReason the first finding of it.
+	Effect       Effect `json:",omitempty"`
+	EffectReason string `json:",omitempty"`
+	Calls        []bodyCall
+	// Errors are the named errors the body returns itself, and Forwards
+	// the functions whose errors it returns.
+	Errors   []ErrorInfo `json:",omitempty"`
+	Forwards []string    `json:",omitempty"`
+}
+
+// bodyCall is a call of a function body to another function, or a reference
+// to it. Only the first one of each function is recorded.
+type bodyCall struct {
+	Function string
+	Position Position
+	// Guess is the effect assumed when Function was not analyzed, inferred
+	// from its name. It is empty for references that are not calls.
+	Guess Effect `json:",omitempty"`
+}
+
+// bodyScanner walks function bodies. With info set, calls are resolved
+// through type information; otherwise through the file's imports, which
+// misses calls through variables and most method calls.
+type bodyScanner struct {
+	fset        *token.FileSet
+	packagePath string
+	imports     map[string]string
+	// globals holds the package variables declared in the file, which the
+	// parser resolves like locals.
+	globals map[*ast.Object]bool
+	info    *types.Info
+}
+
+func newBodyScanner(ctx fileContext, file *ast.File, info *types.Info) bodyScanner {
+	bs := bodyScanner{fset: ctx.fset, packagePath: ctx.packagePath, info: info}
+	if info != nil {
+		return bs
+	}
+	bs.imports = make(map[string]string)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		bs.imports[name] = path
+	}
+	bs.globals = make(map[*ast.Object]bool)
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			for _, name := range spec.(*ast.ValueSpec).Names {
+				if name.Obj != nil {
+					bs.globals[name.Obj] = true
+				}
+			}
+		}
+	}
+	return bs
+}
+
+// scanFile summarizes the body of every function declared in file.
+func (bs bodyScanner) scanFile(file *ast.File) []bodySummary {
+	var summaries []bodySummary
+	for _, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Body != nil {
+			summaries = append(summaries, bs.scan(funcDecl))
+		}
+	}
+	return summaries
+}
+
+// funcScope describes the receiver of the function being scanned.
+type funcScope struct {
+	receiver     string
+	receiverType string
+	// pointer is set for pointer receivers, whose fields outlive a call.
+	pointer bool
+}
+
+func (bs bodyScanner) scan(funcDecl *ast.FuncDecl) bodySummary {
+	name := funcDecl.Name.Name
+	var scope funcScope
+	if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+		field := funcDecl.Recv.List[0]
+		if len(field.Names) > 0 {
+			scope.receiver = field.Names[0].Name
+		}
+		_, scope.pointer = field.Type.(*ast.StarExpr)
+		if ident := embeddedIdent(field.Type); ident != nil {
+			scope.receiverType = ident.Name
+			name = scope.receiverType + "." + name
+		}
+	}
+	summary := bodySummary{Function: qualify(bs.packagePath, name), Effect: EffectPure}
+
+	seenRisks := make(map[string]bool)
+	addRisk := func(risk Risk) {
+		if key := string(risk.Category) + " " + risk.Reason; !seenRisks[key] {
+			seenRisks[key] = true
+			summary.Risks = append(summary.Risks, risk)
+		}
+	}
+	addEffect := func(effect Effect, reason string) {
+		if effect.stronger(summary.Effect) {
+			summary.Effect, summary.EffectReason = effect, reason
+		}
+	}
+	calls := make(map[string]int)
+	addCall := func(pkg, name string, pos token.Pos, guess Effect) {
+		function := qualify(pkg, name)
+		position := bs.position(pos)
+		if category, ok := classifyCall(pkg, name); ok {
+			addRisk(Risk{Category: category, Reason: "calls " + function, Position: position})
+		}
+		if effect, ok := classifyEffect(pkg, name); ok {
+			addEffect(effect, "calls "+function)
+			guess = ""
+		}
+		if i, ok := calls[function]; ok {
+			if guess.stronger(summary.Calls[i].Guess) {
+				summary.Calls[i].Guess = guess
+			}
+			return
+		}
+		calls[function] = len(summary.Calls)
+		summary.Calls = append(summary.Calls, bodyCall{Function: function, Position: position, Guess: guess})
+	}
+
+	// handled holds the callees of calls already recorded, so that they are
+	// not recorded again as mere references.
+	handled := make(map[ast.Expr]bool)
+	var stack []ast.Node
+	ast.Inspect(funcDecl.Body, func(node ast.Node) bool {
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, node)
+
+		switch node := node.(type) {
+		case *ast.GoStmt:
+			reason := "starts a goroutine"
+			for _, outer := range stack {
+				switch outer.(type) {
+				case *ast.ForStmt, *ast.RangeStmt:
+					reason = "starts goroutines in a loop"
+				}
+			}
+			addRisk(Risk{Category: RiskGoroutine, Reason: reason, Position: bs.position(node.Pos())})
+			addEffect(EffectNonIdempotent, reason)
+		case *ast.SendStmt:
+			addEffect(EffectNonIdempotent, "sends on a channel")
+		case *ast.IncDecStmt:
+			if state, ok := bs.state(node.X, scope); ok {
+				addEffect(EffectNonIdempotent, "increments "+state)
+			}
+		case *ast.AssignStmt:
+			if node.Tok == token.DEFINE {
+				break
+			}
+			for i, lhs := range node.Lhs {
+				state, ok := bs.state(lhs, scope)
+				switch {
+				case !ok:
+				case node.Tok != token.ASSIGN:
+					addEffect(EffectNonIdempotent, "updates "+state)
+				case len(node.Rhs) == len(node.Lhs) && isAppendTo(node.Rhs[i], lhs):
+					addEffect(EffectNonIdempotent, "appends to "+state)
+				default:
+					addEffect(EffectIdempotent, "sets "+state)
+				}
+			}
+		case *ast.CallExpr:
+			fun := ast.Unparen(node.Fun)
+			if index, ok := fun.(*ast.IndexExpr); ok {
+				fun = index.X
+			} else if index, ok := fun.(*ast.IndexListExpr); ok {
+				fun = index.X
+			}
+			if builtin := bs.builtin(fun); builtin != "" {
+				if (builtin == "delete" || builtin == "clear") && len(node.Args) > 0 {
+					if state, ok := bs.state(node.Args[0], scope); ok {
+						addEffect(EffectIdempotent, "deletes from "+state)
+					}
+				}
+				break
+			}
+			pkg, name, ok := bs.resolveCallee(fun, scope)
+			if ok {
+				handled[fun] = true
+				addCall(pkg, name, fun.Pos(), effectFromName(name))
+				break
+			}
+			// An unresolved method called on long-lived state, or on a
+			// parameter that may be a handle to some, is judged by its name.
+			if sel, isSel := fun.(*ast.SelectorExpr); isSel && bs.info == nil && !bs.isLocal(sel.X, funcDecl) {
+				handled[fun] = true
+				addCall("", types.ExprString(sel), fun.Pos(), effectFromName(sel.Sel.Name))
+			}
+		case *ast.SelectorExpr:
+			if handled[node] {
+				break
+			}
+			if pkg, name, ok := bs.resolveSelector(node, scope); ok {
+				addCall(pkg, name, node.Pos(), "")
+			}
+			if bs.info != nil {
+				if v, ok := bs.info.Uses[node.Sel].(*types.Var); ok && isPackageVar(v) {
+					addEffect(EffectReadOnly, "reads "+types.ExprString(node))
+				}
+			}
+		case *ast.Ident:
+			if scope.pointer && node.Name == scope.receiver {
+				addEffect(EffectReadOnly, "reads the receiver")
+			}
+			if bs.info == nil {
+				if node.Obj != nil && bs.globals[node.Obj] {
+					addEffect(EffectReadOnly, "reads "+node.Name)
+				}
+				break
+			}
+			switch obj := bs.info.Uses[node].(type) {
+			case *types.Func:
+				if !handled[node] && obj.Pkg() != nil && !isMethod(obj) {
+					addCall(obj.Pkg().Path(), obj.Name(), node.Pos(), "")
+				}
+			case *types.Var:
+				if isPackageVar(obj) {
+					addEffect(EffectReadOnly, "reads "+node.Name)
+				}
+			}
+		}
+		return true
+	})
+	bs.scanErrors(funcDecl, scope, &summary)
+	return summary
+}
+
+// resolveCallee resolves the function called through fun.
+func (bs bodyScanner) resolveCallee(fun ast.Expr, scope funcScope) (pkg, name string, ok bool) {
+	switch fun := fun.(type) {
+	case *ast.SelectorExpr:
+		return bs.resolveSelector(fun, scope)
+	case *ast.Ident:
+		if bs.info != nil {
+			fn, ok := bs.info.Uses[fun].(*types.Func)
+			if !ok || fn.Pkg() == nil {
+				return "", "", false
+			}
+			return fn.Pkg().Path(), fn.Name(), true
+		}
+		// Without type information, a plain identifier that is not local
+		// is taken for a function of the package.
+		if fun.Obj == nil || fun.Obj.Kind == ast.Fun {
+			return bs.packagePath, fun.Name, true
+		}
+	}
+	return "", "", false
+}
+
+// resolveSelector resolves x.Sel to the package and name of the function,
+// method or other package member it refers to.
+func (bs bodyScanner) resolveSelector(sel *ast.SelectorExpr, scope funcScope) (pkg, name string, ok bool) {
+	if bs.info != nil {
+		if selection, ok := bs.info.Selections[sel]; ok {
+			fn, ok := selection.Obj().(*types.Func)
+			if !ok || fn.Pkg() == nil {
+				return "", "", false
+			}
+			return fn.Pkg().Path(), methodName(fn), true
+		}
+		obj := bs.info.Uses[sel.Sel]
+		if obj == nil || obj.Pkg() == nil {
+			return "", "", false
+		}
+		// Members of other packages; the use of unsafe.Pointer counts as
+		// much as a call.
+		if _, isPkg := bs.info.Uses[identOf(sel.X)].(*types.PkgName); isPkg {
+			return obj.Pkg().Path(), obj.Name(), true
+		}
+		return "", "", false
+	}
+
+	x := identOf(sel.X)
+	if x == nil {
+		return "", "", false
+	}
+	if path, ok := bs.imports[x.Name]; ok && x.Obj == nil {
+		return path, sel.Sel.Name, true
+	}
+	if scope.receiver != "" && x.Name == scope.receiver && scope.receiverType != "" {
+		return bs.packagePath, scope.receiverType + "." + sel.Sel.Name, true
+	}
+	return "", "", false
+}
+
+// builtin returns the name of the predeclared function fun refers to, if
+// any.
+func (bs bodyScanner) builtin(fun ast.Expr) string {
+	ident := identOf(fun)
+	if ident == nil {
+		return ""
+	}
+	if bs.info != nil {
+		if _, ok := bs.info.Uses[ident].(*types.Builtin); ok {
+			return ident.Name
+		}
+		return ""
+	}
+	if ident.Obj == nil && types.Universe.Lookup(ident.Name) != nil {
+		return ident.Name
+	}
+	return ""
+}
+
+// state reports whether expr refers to state that outlives a call: a package
+// variable, or the receiver of a method when it is a pointer or reached
+// through one. It returns expr as written for explanations. Parameters are
+// not state, since every request decodes its own.
+func (bs bodyScanner) state(expr ast.Expr, scope funcScope) (string, bool) {
+	written := types.ExprString(expr)
+	throughPointer := false
+	for {
+		switch e := expr.(type) {
+		case *ast.ParenExpr:
+			expr = e.X
+			continue
+		case *ast.StarExpr:
+			throughPointer = true
+			expr = e.X
+			continue
+		case *ast.IndexExpr:
+			throughPointer = true
+			expr = e.X
+			continue
+		case *ast.SelectorExpr:
+			if bs.info != nil {
+				if v, ok := bs.info.Uses[e.Sel].(*types.Var); ok && isPackageVar(v) {
+					return written, true
+				}
+			} else if x := identOf(e.X); x != nil && x.Obj == nil && bs.imports[x.Name] != "" {
+				return written, true
+			}
+			expr = e.X
+			continue
+		case *ast.Ident:
+			if e.Name == "_" {
+				return "", false
+			}
+			if scope.receiver != "" && e.Name == scope.receiver {
+				return written, scope.pointer || throughPointer
+			}
+			if bs.info != nil {
+				v, ok := bs.info.Uses[e].(*types.Var)
+				return written, ok && isPackageVar(v)
+			}
+			// Variables of other files of the package are not resolved.
+			return written, e.Obj == nil || bs.globals[e.Obj]
+		}
+		return "", false
+	}
+}
+
+// isLocal reports whether expr is rooted in a variable declared in the body
+// of funcDecl, as opposed to a parameter, the receiver or a package member.
+func (bs bodyScanner) isLocal(expr ast.Expr, funcDecl *ast.FuncDecl) bool {
+	for {
+		switch e := expr.(type) {
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.SelectorExpr:
+			expr = e.X
+		case *ast.CallExpr:
+			// Results of calls are fresh values.
+			return true
+		case *ast.Ident:
+			return e.Obj != nil && e.Obj.Pos() > funcDecl.Body.Lbrace && e.Obj.Pos() < funcDecl.Body.Rbrace
+		default:
+			return true
+		}
+	}
+}
+
+// isAppendTo reports whether rhs is append(lhs, ...).
+func isAppendTo(rhs, lhs ast.Expr) bool {
+	call, ok := ast.Unparen(rhs).(*ast.CallExpr)
+	if !ok || len(call.Args) == 0 {
+		return false
+	}
+	fun := identOf(call.Fun)
+	return fun != nil && fun.Name == "append" && types.ExprString(call.Args[0]) == types.ExprString(lhs)
+}
+
+func isPackageVar(v *types.Var) bool {
+	return v.Pkg() != nil && v.Parent() == v.Pkg().Scope()
+}
+
+func (bs bodyScanner) position(pos token.Pos) Position {
+	p := bs.fset.Position(pos)
+	return Position{Line: p.Line, Column: p.Column}
+}
+
+// qualify joins a package path and a member name the way QualifiedName does.
+func qualify(pkg, name string) string {
+	if pkg == "" {
+		return name
+	}
+	return pkg + "." + name
+}
+
+func identOf(expr ast.Expr) *ast.Ident {
+	ident, _ := ast.Unparen(expr).(*ast.Ident)
+	return ident
+}
+
+func isMethod(fn *types.Func) bool {
+	return fn.Type().(*types.Signature).Recv() != nil
+}
+
+// methodName names fn the way riskRules and QualifiedName do: "Type.Method"
+// for methods.
+func methodName(fn *types.Func) string {
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return fn.Name()
+	}
+	t := recv.Type()
+	if pointer, ok := t.(*types.Pointer); ok {
+		t = pointer.Elem()
+	}
+	if named, ok := t.(*types.Named); ok {
+		return named.Obj().Name() + "." + fn.Name()
+	}
+	return fn.Name()
+}
+
+// matchNames reports whether name is matched by patterns: an empty list
+// matches every name, and a pattern ending in "*" any name it prefixes.
+func matchNames(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); (ok && strings.HasPrefix(name, prefix)) || pattern == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package analyzer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// AnalyzerVersion is part of every cache key. Bump it whenever the analyzer
+// starts recording something new, so that stale entries are not reused.
+const AnalyzerVersion = "9"
+
+// DefaultCacheDir is where the CLI keeps its cache, relative to the analyzed
+// directory.
+const DefaultCacheDir = ".soft-crusher/cache"
+
+// Cache stores analysis results on disk, keyed by a hash of the analyzed
+// source, the analyzer version and the options in effect.
+type Cache struct {
+	Dir string
+}
+
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir}
+}
+
+// fileResult is what analyzing one file contributes to a run. It is also
+// the entry cached for the file.
+type fileResult struct {
+	Functions     []FunctionInfo
+	Types         []ServiceInfo
+	Bodies        []bodySummary
+	Errors        []ErrorInfo
+	FilesAnalyzed int
+	FilesSkipped  int
+	CacheHit      bool `json:"-"`
+}
+
+// packageCacheEntry is what AnalyzePackages recorded for one package,
+// together with the schemas its functions refer to.
+type packageCacheEntry struct {
+	Functions     []FunctionInfo
+	Types         []ServiceInfo
+	Bodies        []bodySummary
+	Errors        []ErrorInfo
+	Schemas       map[string]*TypeSchema
+	FilesAnalyzed int
+	FilesSkipped  int
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".json")
+}
+
+// load decodes the entry stored under key into v and reports whether there
+// was a usable one.
+func (c *Cache) load(key string, v interface{}) bool {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// store writes v under key. The entry is written to a temporary file first so
+// that concurrent runs never read a partial entry.
+func (c *Cache) store(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// cacheKey hashes the analyzer version, the options and parts.
+func (fa *FunctionAnalyzer) cacheKey(parts ...[]byte) string {
+	options, _ := json.Marshal(fa.Options)
+
+	h := sha256.New()
+	for _, part := range append([][]byte{[]byte(AnalyzerVersion), options}, parts...) {
+		// Length-prefix every part so that boundaries cannot shift.
+		h.Write([]byte{byte(len(part) >> 24), byte(len(part) >> 16), byte(len(part) >> 8), byte(len(part))})
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// packageKeys computes a cache key for every package in the import graph of
+// pkgs. A key covers the package's own files and the keys of its imports, so
+// editing a dependency invalidates everything built on it. Packages of
+// versioned modules are immutable and are keyed by module version instead.
+func (fa *FunctionAnalyzer) packageKeys(pkgs []*packages.Package) map[string]string {
+	keys := make(map[string]string)
+	var visit func(pkg *packages.Package) string
+	visit = func(pkg *packages.Package) string {
+		if key, ok := keys[pkg.ID]; ok {
+			return key
+		}
+
+		parts := [][]byte{[]byte(pkg.ID)}
+		if pkg.Module != nil && pkg.Module.Version != "" && pkg.Module.Replace == nil {
+			parts = append(parts, []byte(pkg.Module.Path+"@"+pkg.Module.Version))
+		} else {
+			for _, file := range pkg.GoFiles {
+				data, err := os.ReadFile(file)
+				if err != nil {
+					// Force a miss; the real load will report the error.
+					data = []byte(err.Error())
+				}
+				parts = append(parts, []byte(file), data)
+			}
+		}
+
+		importPaths := make([]string, 0, len(pkg.Imports))
+		for path := range pkg.Imports {
+			importPaths = append(importPaths, path)
+		}
+		sort.Strings(importPaths)
+		for _, path := range importPaths {
+			parts = append(parts, []byte(visit(pkg.Imports[path])))
+		}
+
+		keys[pkg.ID] = fa.cacheKey(parts...)
+		return keys[pkg.ID]
+	}
+
+	for _, pkg := range pkgs {
+		visit(pkg)
+	}
+	return keys
+}
+
+// reachableSchemas collects the schemas referred to by functions and by the
+// methods of interfaces, following struct fields and the components of named
+// types.
+func (fa *FunctionAnalyzer) reachableSchemas(functions []FunctionInfo, interfaces []ServiceInfo) map[string]*TypeSchema {
+	reachable := make(map[string]*TypeSchema)
+	var visit func(ti *TypeInfo)
+	visit = func(ti *TypeInfo) {
+		if ti == nil {
+			return
+		}
+		visit(ti.Elem)
+		visit(ti.Key)
+		schema, ok := fa.Schemas[ti.QualifiedName]
+		if !ok || reachable[schema.Name] != nil {
+			return
+		}
+		reachable[schema.Name] = schema
+		visit(schema.Elem)
+		visit(schema.Key)
+		for _, field := range schema.Fields {
+			visit(field.Type)
+		}
+	}
+
+	for _, iface := range interfaces {
+		functions = append(functions[:len(functions):len(functions)], iface.Methods...)
+	}
+	for _, fn := range functions {
+		for _, params := range [][]ParameterInfo{fn.Parameters, fn.Results} {
+			for _, param := range params {
+				visit(param.Resolved)
+			}
+		}
+	}
+	return reachable
+}
@@ -0,0 +1,119 @@
+package analyzer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCachedAnalyzer(t *testing.T, cacheDir string) *FunctionAnalyzer {
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Options = DefaultOptions()
+	analyzer.Cache = NewCache(cacheDir)
+	return analyzer
+}
+
+func TestAnalyzeDirectoryCache(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a.go":        "package main\n\nfunc A(x int) int { return x }\n",
+		"b.go":        "package main\n\n// B is documented.\nfunc B() {}\n",
+		"zz_gen.go":   "// Code generated by hand. DO NOT EDIT.\n\npackage main\n\nfunc Generated() {}\n",
+		"nested/c.go": "package nested\n\nfunc C(values ...string) {}\n",
+	})
+	cacheDir := filepath.Join(dir, DefaultCacheDir)
+
+	first := newCachedAnalyzer(t, cacheDir)
+	require.NoError(t, first.AnalyzeDirectory(dir))
+	assert.Equal(t, 0, first.Report.CacheHits)
+	assert.Equal(t, []string{"A", "B", "C"}, functionNames(first.Functions))
+
+	second := newCachedAnalyzer(t, cacheDir)
+	require.NoError(t, second.AnalyzeDirectory(dir))
+	assert.Equal(t, 4, second.Report.CacheHits)
+	assert.Equal(t, first.Functions, second.Functions)
+	assert.Equal(t, first.Report.FilesAnalyzed, second.Report.FilesAnalyzed)
+	assert.Equal(t, first.Report.FilesSkipped, second.Report.FilesSkipped)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package main\n\nfunc A2() {}\n"), 0644))
+	third := newCachedAnalyzer(t, cacheDir)
+	require.NoError(t, third.AnalyzeDirectory(dir))
+	assert.Equal(t, 3, third.Report.CacheHits)
+	assert.Equal(t, []string{"A2", "B", "C"}, functionNames(third.Functions))
+
+	// Different options must not reuse entries recorded under others.
+	all := newCachedAnalyzer(t, cacheDir)
+	all.Options.SkipGenerated = false
+	require.NoError(t, all.AnalyzeDirectory(dir))
+	assert.Equal(t, 0, all.Report.CacheHits)
+	assert.Equal(t, []string{"A2", "B", "C", "Generated"}, functionNames(all.Functions))
+}
+
+func TestAnalyzePackagesCache(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod": "module example.com/cached\n\ngo 1.22\n",
+		"models/models.go": `package models
+
+// User is a user.
+type User struct {
+	Name string ` + "`json:\"name\"`" + `
+}
+
+func NewUser(name string) *User { return &User{Name: name} }
+`,
+		"service/service.go": `package service
+
+import "example.com/cached/models"
+
+func Rename(user *models.User, name string) *models.User { return user }
+`,
+	})
+	cacheDir, err := ioutil.TempDir("", "test_cache")
+	require.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	first := newCachedAnalyzer(t, cacheDir)
+	require.NoError(t, first.AnalyzePackages(dir))
+	assert.Equal(t, 0, first.Report.CacheHits)
+	assert.Equal(t, []string{"NewUser", "Rename"}, functionNames(first.Functions))
+
+	second := newCachedAnalyzer(t, cacheDir)
+	require.NoError(t, second.AnalyzePackages(dir))
+	assert.Equal(t, 2, second.Report.CacheHits)
+	assert.ElementsMatch(t, first.Functions, second.Functions)
+	assert.Equal(t, first.Schemas, second.Schemas)
+
+	// Editing only the service leaves the models package cached.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "service", "service.go"), []byte(`package service
+
+import "example.com/cached/models"
+
+func Rename(user *models.User, name string) *models.User { return user }
+
+func Delete(user *models.User) error { return nil }
+`), 0644))
+	third := newCachedAnalyzer(t, cacheDir)
+	require.NoError(t, third.AnalyzePackages(dir))
+	assert.Equal(t, 1, third.Report.CacheHits)
+	assert.Equal(t, []string{"Delete", "NewUser", "Rename"}, functionNames(third.Functions))
+
+	// Editing the models package invalidates the service built on it.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "models", "models.go"), []byte(`package models
+
+type User struct {
+	Name  string
+	Email string
+}
+
+func NewUser(name string) *User { return &User{Name: name} }
+`), 0644))
+	fourth := newCachedAnalyzer(t, cacheDir)
+	require.NoError(t, fourth.AnalyzePackages(dir))
+	assert.Equal(t, 0, fourth.Report.CacheHits)
+	user := fourth.Schemas["example.com/cached/models.User"]
+	require.NotNil(t, user)
+	assert.Len(t, user.Fields, 2)
+}
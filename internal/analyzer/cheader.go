@@ -0,0 +1,404 @@
+package analyzer
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// CHeaderAnalyzer reads function prototypes, and inline function
+// definitions, from C header files. The comment directly above a declaration
+// is its doc comment and may carry directives:
+//
+//	/* soft-crusher:method GET */
+//	int counter_value(const struct counter *c);
+//
+// Types are recorded as written, with "*" attached to the type: "const
+// char*". A variadic "..." parameter has the type "...". Preprocessor lines
+// are skipped, so declarations hidden behind macros are not seen.
+type CHeaderAnalyzer struct{}
+
+func (CHeaderAnalyzer) Language() string { return "c" }
+
+func (CHeaderAnalyzer) Extensions() []string { return []string{".h"} }
+
+var (
+	cTokenPattern = regexp.MustCompile(`[A-Za-z_]\w*|\d\w*|\.\.\.|\S`)
+	// Attributes and similar compiler extensions, removed before parsing.
+	cExtensionPattern = regexp.MustCompile(`\b(?:__attribute__|__declspec|__asm__|__asm|asm)\s*\(`)
+)
+
+// Specifiers that do not contribute to a function's return type.
+var cSpecifiers = map[string]bool{
+	"extern":        true,
+	"static":        true,
+	"inline":        true,
+	"__inline":      true,
+	"__inline__":    true,
+	"__extension__": true,
+	"_Noreturn":     true,
+}
+
+// Keywords that can end a parameter type, so that they are never taken for
+// the parameter name.
+var cTypeKeywords = map[string]bool{
+	"void": true, "char": true, "short": true, "int": true, "long": true,
+	"float": true, "double": true, "signed": true, "unsigned": true,
+	"_Bool": true, "_Complex": true, "const": true, "volatile": true,
+	"restrict": true,
+}
+
+func (ca CHeaderAnalyzer) AnalyzeSource(path string, src []byte, options Options) ([]FunctionInfo, error) {
+	declarations, err := scanC(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	header := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var functions []FunctionInfo
+	for _, decl := range declarations {
+		funcInfo, static, ok := parseCPrototype(decl.text)
+		if !ok || (static && options.ExportedOnly) {
+			continue
+		}
+		funcInfo.Doc, funcInfo.Directives, err = parseCommentLines(decl.doc)
+		if err == nil {
+			err = checkParamDirectives(funcInfo)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, decl.start.Line, err)
+		}
+		funcInfo.Package = header
+		funcInfo.Source = SourceRange{File: path, Start: decl.start, End: decl.end}
+		functions = append(functions, funcInfo)
+	}
+	return functions, nil
+}
+
+// parseCPrototype parses a top-level declaration. ok is false when decl does
+// not declare a function.
+func parseCPrototype(decl string) (funcInfo FunctionInfo, static bool, ok bool) {
+	decl = stripCExtensions(decl)
+	if strings.HasPrefix(decl, "typedef") {
+		return funcInfo, false, false
+	}
+	open := strings.Index(decl, "(")
+	if open < 0 {
+		return funcInfo, false, false
+	}
+	// "int (*handler)(int)" declares a variable, not a function.
+	if strings.HasPrefix(strings.TrimSpace(decl[open+1:]), "*") {
+		return funcInfo, false, false
+	}
+	closing := closingBracket(decl, open)
+	if closing < 0 {
+		return funcInfo, false, false
+	}
+
+	tokens := cTokenPattern.FindAllString(decl[:open], -1)
+	if len(tokens) < 2 || !isCIdentifier(tokens[len(tokens)-1]) {
+		// Macro invocations such as DECLARE_HANDLE(x) have no return type.
+		return funcInfo, false, false
+	}
+	funcInfo.Name = tokens[len(tokens)-1]
+
+	var returns []string
+	for _, token := range tokens[:len(tokens)-1] {
+		if cSpecifiers[token] {
+			static = static || token == "static"
+			continue
+		}
+		returns = append(returns, token)
+	}
+	if len(returns) == 0 {
+		return funcInfo, false, false
+	}
+	if returnType := joinCType(returns); returnType != "void" {
+		funcInfo.Results = []ParameterInfo{{Type: returnType}}
+	}
+
+	params := splitTopLevel(decl[open+1:closing], ',')
+	if len(params) == 1 && params[0] == "void" {
+		params = nil
+	}
+	for _, param := range params {
+		funcInfo.Parameters = append(funcInfo.Parameters, parseCParameter(param))
+	}
+	return funcInfo, static, true
+}
+
+// parseCParameter splits a parameter declaration into its name, if any, and
+// its type.
+func parseCParameter(param string) ParameterInfo {
+	if param == "..." {
+		return ParameterInfo{Type: "..."}
+	}
+
+	// Function pointers: "void (*callback)(int, void *)" becomes
+	// "void (*)(int, void*)".
+	if i := strings.Index(param, "(*"); i >= 0 {
+		end := closingBracket(param, i)
+		open := strings.Index(param[max(end, 0):], "(")
+		if end >= 0 && open >= 0 {
+			open += end
+			var args []string
+			if closing := closingBracket(param, open); closing >= 0 {
+				for _, arg := range splitTopLevel(param[open+1:closing], ',') {
+					args = append(args, parseCParameter(arg).Type)
+				}
+			}
+			name := strings.TrimSpace(param[i+2 : end])
+			returns := joinCType(cTokenPattern.FindAllString(param[:i], -1))
+			return ParameterInfo{Name: name, Type: returns + " (*)(" + strings.Join(args, ", ") + ")"}
+		}
+	}
+
+	// Array parameters: "int values[16]".
+	suffix := ""
+	if i := strings.Index(param, "["); i >= 0 {
+		suffix = joinCType(cTokenPattern.FindAllString(param[i:], -1))
+		param = param[:i]
+	}
+
+	tokens := cTokenPattern.FindAllString(param, -1)
+	n := len(tokens)
+	if n >= 2 && isCIdentifier(tokens[n-1]) && !cTypeKeywords[tokens[n-1]] &&
+		tokens[n-2] != "struct" && tokens[n-2] != "union" && tokens[n-2] != "enum" {
+		return ParameterInfo{Name: tokens[n-1], Type: joinCType(tokens[:n-1]) + suffix}
+	}
+	return ParameterInfo{Type: joinCType(tokens) + suffix}
+}
+
+// joinCType renders type tokens with single spaces between words and "*"
+// attached to what precedes it.
+func joinCType(tokens []string) string {
+	var b strings.Builder
+	for i, token := range tokens {
+		if i > 0 && isCIdentifier(token) && isCIdentifier(tokens[i-1]) {
+			b.WriteByte(' ')
+		} else if i > 0 && isCIdentifier(token) && tokens[i-1] == "*" {
+			b.WriteByte(' ')
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+func isCIdentifier(token string) bool {
+	if token == "" {
+		return false
+	}
+	c := token[0]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// stripCExtensions removes __attribute__((...)) and similar annotations.
+func stripCExtensions(decl string) string {
+	for {
+		loc := cExtensionPattern.FindStringIndex(decl)
+		if loc == nil {
+			return strings.TrimSpace(decl)
+		}
+		end := closingBracket(decl, loc[1]-1)
+		if end < 0 {
+			return strings.TrimSpace(decl[:loc[0]])
+		}
+		decl = decl[:loc[0]] + " " + decl[end+1:]
+	}
+}
+
+// cDeclaration is a top-level declaration of a C header, with comments and
+// any function body removed.
+type cDeclaration struct {
+	text       string
+	doc        []string
+	start, end Position
+}
+
+// scanC splits src into top-level declarations. Preprocessor lines are
+// skipped, and the contents of extern "C" blocks are treated as top level.
+func scanC(src []byte) ([]cDeclaration, error) {
+	var declarations []cDeclaration
+	var text strings.Builder
+	var doc []string
+	docEnd := -1 // line of the end of the last comment in doc
+	var start Position
+	line, column := 1, 1
+	depth, externBlocks := 0, 0
+	atLineStart := true
+	// definition is set while skipping the body of a function definition.
+	definition := false
+	// lastEnd is the line the last declaration ended on; comments starting
+	// there trail it rather than document the next one.
+	lastEnd := 0
+
+	advance := func(n int, s []byte) {
+		for _, c := range s[:n] {
+			if c == '\n' {
+				line++
+				column = 1
+			} else {
+				column++
+			}
+		}
+	}
+	emit := func() {
+		if decl := strings.TrimSpace(text.String()); decl != "" {
+			d := cDeclaration{text: decl, start: start, end: Position{Line: line, Column: column}}
+			if docEnd >= start.Line-1 {
+				d.doc = doc
+			}
+			declarations = append(declarations, d)
+			lastEnd = line
+		}
+		text.Reset()
+		doc, docEnd = nil, -1
+	}
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			atLineStart = true
+			advance(1, src[i:])
+			i++
+			if text.Len() > 0 {
+				text.WriteByte(' ')
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			advance(1, src[i:])
+			i++
+			if text.Len() > 0 {
+				text.WriteByte(' ')
+			}
+			continue
+		case c == '#' && atLineStart:
+			end := i
+			for end < len(src) && src[end] != '\n' {
+				if src[end] == '\\' && end+1 < len(src) && src[end+1] == '\n' {
+					end++
+				}
+				end++
+			}
+			advance(end-i, src[i:])
+			i = end
+			doc, docEnd = nil, -1
+			continue
+		}
+		atLineStart = false
+
+		switch {
+		case c == '/' && i+1 < len(src) && (src[i+1] == '/' || src[i+1] == '*'):
+			var end int
+			var comment string
+			if src[i+1] == '/' {
+				end = i
+				for end < len(src) && src[end] != '\n' {
+					end++
+				}
+				comment = strings.TrimLeft(string(src[i+2:end]), "/!")
+			} else {
+				close := strings.Index(string(src[i+2:]), "*/")
+				if close < 0 {
+					return nil, fmt.Errorf("line %d: unterminated comment", line)
+				}
+				end = i + 2 + close + 2
+				comment = strings.TrimLeft(string(src[i+2:end-2]), "*!")
+			}
+			commentLine := line
+			advance(end-i, src[i:])
+			i = end
+			if depth > 0 || text.Len() > 0 {
+				text.WriteByte(' ')
+				continue
+			}
+			if commentLine == lastEnd {
+				continue
+			}
+			if commentLine > docEnd+1 {
+				doc = nil
+			}
+			doc = append(doc, cCommentLines(comment)...)
+			docEnd = line
+		case c == '"' || c == '\'':
+			end := skipQuoted(string(src), i) + 1
+			if end > len(src) {
+				end = len(src)
+			}
+			if depth == 0 {
+				text.Write(src[i:end])
+			}
+			advance(end-i, src[i:])
+			i = end
+		case c == '{':
+			if depth == 0 {
+				decl := strings.TrimSpace(text.String())
+				if strings.HasSuffix(decl, `extern "C"`) {
+					externBlocks++
+					text.Reset()
+					doc, docEnd = nil, -1
+					advance(1, src[i:])
+					i++
+					continue
+				}
+				definition = strings.HasSuffix(decl, ")")
+				if !definition {
+					text.WriteString("{}")
+				}
+			}
+			depth++
+			advance(1, src[i:])
+			i++
+		case c == '}':
+			advance(1, src[i:])
+			i++
+			if depth == 0 {
+				if externBlocks > 0 {
+					externBlocks--
+				}
+				text.Reset()
+				continue
+			}
+			depth--
+			// A function definition ends with its body.
+			if depth == 0 && definition {
+				definition = false
+				emit()
+			}
+		case c == ';' && depth == 0:
+			advance(1, src[i:])
+			i++
+			emit()
+		default:
+			if depth == 0 {
+				if text.Len() == 0 {
+					start = Position{Line: line, Column: column}
+				}
+				text.WriteByte(c)
+			}
+			advance(1, src[i:])
+			i++
+		}
+	}
+	return declarations, nil
+}
+
+// cCommentLines strips the decoration of a comment's lines, such as the
+// leading "*" of block comments.
+func cCommentLines(comment string) []string {
+	var lines []string
+	for _, line := range strings.Split(comment, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimSpace(strings.TrimPrefix(line, "*"))
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
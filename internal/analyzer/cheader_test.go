@@ -0,0 +1,113 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const cHeaderSource = `#ifndef COUNTER_H
+#define COUNTER_H
+
+#include <stddef.h>
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+struct counter {
+    int value;
+    void (*on_change)(int);
+};
+
+typedef int (*counter_fn)(struct counter *c);
+
+/**
+ * Creates a counter starting at start.
+ * soft-crusher:method POST
+ */
+struct counter *counter_new(int start);
+
+// Returns the current value.
+int counter_value(const struct counter *c);
+
+void counter_free(struct counter *c); /* trailing comment */
+size_t counter_format(char buf[64], const char *fmt, ...)
+    __attribute__((format(printf, 2, 3)));
+
+extern void counter_each(struct counter *c, void (*fn)(int value, void *data), void *data);
+
+static inline int counter_double(int x) { return x * 2; }
+
+int (*counter_hook)(int);
+DECLARE_COUNTER(global);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
+`
+
+func TestCHeaderAnalyzer(t *testing.T) {
+	functions, err := CHeaderAnalyzer{}.AnalyzeSource("include/counter.h", []byte(cHeaderSource), DefaultOptions())
+	require.NoError(t, err)
+	require.Equal(t, []string{"counter_each", "counter_format", "counter_free", "counter_new", "counter_value"}, functionNames(functions))
+
+	counterNew := findFunction(t, functions, "counter_new")
+	assert.Equal(t, []ParameterInfo{{Name: "start", Type: "int"}}, counterNew.Parameters)
+	assert.Equal(t, []ParameterInfo{{Type: "struct counter*"}}, counterNew.Results)
+	assert.Equal(t, "Creates a counter starting at start.", counterNew.Doc)
+	assert.Equal(t, "POST", counterNew.Directives.Method)
+	assert.Equal(t, "counter", counterNew.Package)
+	assert.Equal(t, SourceRange{File: "include/counter.h", Start: Position{Line: 21, Column: 1}, End: Position{Line: 21, Column: 40}}, counterNew.Source)
+
+	value := findFunction(t, functions, "counter_value")
+	assert.Equal(t, "Returns the current value.", value.Doc)
+	assert.Equal(t, []ParameterInfo{{Name: "c", Type: "const struct counter*"}}, value.Parameters)
+
+	free := findFunction(t, functions, "counter_free")
+	assert.Empty(t, free.Doc)
+	assert.Empty(t, free.Results)
+
+	format := findFunction(t, functions, "counter_format")
+	assert.Equal(t, []ParameterInfo{
+		{Name: "buf", Type: "char[64]"},
+		{Name: "fmt", Type: "const char*"},
+		{Type: "..."},
+	}, format.Parameters)
+	assert.Empty(t, format.Doc)
+	assert.Equal(t, 28, format.Source.End.Line)
+
+	each := findFunction(t, functions, "counter_each")
+	assert.Equal(t, ParameterInfo{Name: "fn", Type: "void (*)(int, void*)"}, each.Parameters[1])
+
+	functions, err = CHeaderAnalyzer{}.AnalyzeSource("include/counter.h", []byte(cHeaderSource), Options{})
+	require.NoError(t, err)
+	double := findFunction(t, functions, "counter_double")
+	assert.Equal(t, []ParameterInfo{{Name: "x", Type: "int"}}, double.Parameters)
+	assert.Equal(t, 32, double.Source.Start.Line)
+}
+
+func TestParseCParameter(t *testing.T) {
+	testCases := []struct {
+		param    string
+		expected ParameterInfo
+	}{
+		{"int", ParameterInfo{Type: "int"}},
+		{"unsigned long", ParameterInfo{Type: "unsigned long"}},
+		{"unsigned long n", ParameterInfo{Name: "n", Type: "unsigned long"}},
+		{"struct point", ParameterInfo{Type: "struct point"}},
+		{"struct point p", ParameterInfo{Name: "p", Type: "struct point"}},
+		{"char **argv", ParameterInfo{Name: "argv", Type: "char**"}},
+		{"const char * const name", ParameterInfo{Name: "name", Type: "const char* const"}},
+		{"int values[]", ParameterInfo{Name: "values", Type: "int[]"}},
+		{"int (*compare)(const void *a, const void *b)", ParameterInfo{Name: "compare", Type: "int (*)(const void*, const void*)"}},
+		{"...", ParameterInfo{Type: "..."}},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, parseCParameter(tc.param), tc.param)
+	}
+}
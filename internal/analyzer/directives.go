@@ -0,0 +1,179 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// DirectivePrefix starts every soft-crusher directive comment, e.g.
+//
+//	//soft-crusher:method GET
+//	//soft-crusher:path /users/{id}
+//	//soft-crusher:param id path
+//	//soft-crusher:stream websocket
+const DirectivePrefix = "//soft-crusher:"
+
+// HTTPMethods are the methods accepted by the method directive and by the
+// overrides of the designer.
+var HTTPMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// Parameter locations accepted by the param directive.
+var directiveParamLocations = map[string]bool{
+	"path":   true,
+	"query":  true,
+	"header": true,
+	"body":   true,
+}
+
+// Transports accepted by the stream directive.
+var directiveStreamTransports = map[string]bool{
+	"sse":       true,
+	"websocket": true,
+	"chunked":   true,
+}
+
+// Directives holds the soft-crusher directives found in a function's doc
+// comment. The zero value means no directive was given.
+type Directives struct {
+	// Expose and Ignore force a function in or out of the generated API.
+	Expose bool     `json:"expose,omitempty" yaml:"expose,omitempty"`
+	Ignore bool     `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+	Method string   `json:"method,omitempty" yaml:"method,omitempty"`
+	Path   string   `json:"path,omitempty" yaml:"path,omitempty"`
+	Tags   []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// Auth names the authentication scheme required by the endpoint;
+	// "none" explicitly marks it as public.
+	Auth string `json:"auth,omitempty" yaml:"auth,omitempty"`
+	// ParamLocations maps parameter names to "path", "query", "header" or
+	// "body".
+	ParamLocations map[string]string `json:"paramLocations,omitempty" yaml:"paramLocations,omitempty"`
+	// AllowRisk opts a high-risk function into the generated API.
+	AllowRisk bool `json:"allowRisk,omitempty" yaml:"allowRisk,omitempty"`
+	// Stream is the transport streaming the response: "sse", "websocket"
+	// or "chunked".
+	Stream string `json:"stream,omitempty" yaml:"stream,omitempty"`
+}
+
+// parseDocComment splits a doc comment into its text, with directive lines
+// removed, and the directives it carries.
+func parseDocComment(doc *ast.CommentGroup) (string, Directives, error) {
+	var directives Directives
+	if doc == nil {
+		return "", directives, nil
+	}
+
+	text := &ast.CommentGroup{}
+	for _, comment := range doc.List {
+		if !strings.HasPrefix(comment.Text, DirectivePrefix) {
+			text.List = append(text.List, comment)
+			continue
+		}
+		if err := directives.parse(strings.TrimPrefix(comment.Text, DirectivePrefix)); err != nil {
+			return "", directives, err
+		}
+	}
+
+	return strings.TrimSpace(text.Text()), directives, nil
+}
+
+// parseCommentLines is parseDocComment for languages other than Go. lines
+// hold comment text with the comment markers stripped; directive lines read
+// "soft-crusher:name args".
+func parseCommentLines(lines []string) (string, Directives, error) {
+	var directives Directives
+	var text []string
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "soft-crusher:") {
+			text = append(text, line)
+			continue
+		}
+		if err := directives.parse(strings.TrimPrefix(trimmed, "soft-crusher:")); err != nil {
+			return "", directives, err
+		}
+	}
+	return strings.TrimSpace(strings.Join(text, "\n")), directives, nil
+}
+
+// checkParamDirectives rejects param directives naming parameters the
+// function does not have.
+func checkParamDirectives(funcInfo FunctionInfo) error {
+	for name := range funcInfo.Directives.ParamLocations {
+		if !hasParameter(funcInfo.Parameters, name) {
+			return fmt.Errorf("soft-crusher:param refers to unknown parameter %q", name)
+		}
+	}
+	return nil
+}
+
+func (d *Directives) parse(directive string) error {
+	fields := strings.Fields(directive)
+	if len(fields) == 0 {
+		return fmt.Errorf("empty soft-crusher directive")
+	}
+	name, args := fields[0], fields[1:]
+
+	switch name {
+	case "expose", "ignore", "allow-risk":
+		if len(args) != 0 {
+			return fmt.Errorf("soft-crusher:%s takes no arguments", name)
+		}
+		switch name {
+		case "expose":
+			d.Expose = true
+		case "ignore":
+			d.Ignore = true
+		default:
+			d.AllowRisk = true
+		}
+	case "method":
+		if len(args) != 1 || !HTTPMethods[strings.ToUpper(args[0])] {
+			return fmt.Errorf("soft-crusher:method expects one of GET, HEAD, POST, PUT, PATCH, DELETE or OPTIONS")
+		}
+		d.Method = strings.ToUpper(args[0])
+	case "path":
+		if len(args) != 1 || !strings.HasPrefix(args[0], "/") {
+			return fmt.Errorf("soft-crusher:path expects one path starting with /")
+		}
+		d.Path = args[0]
+	case "tags":
+		for _, arg := range args {
+			for _, tag := range strings.Split(arg, ",") {
+				if tag != "" {
+					d.Tags = append(d.Tags, tag)
+				}
+			}
+		}
+		if len(d.Tags) == 0 {
+			return fmt.Errorf("soft-crusher:tags expects at least one tag")
+		}
+	case "auth":
+		if len(args) != 1 {
+			return fmt.Errorf("soft-crusher:auth expects one scheme")
+		}
+		d.Auth = args[0]
+	case "param":
+		if len(args) != 2 || !directiveParamLocations[args[1]] {
+			return fmt.Errorf("soft-crusher:param expects a name and one of path, query, header or body")
+		}
+		if d.ParamLocations == nil {
+			d.ParamLocations = make(map[string]string)
+		}
+		d.ParamLocations[args[0]] = args[1]
+	case "stream":
+		if len(args) != 1 || !directiveStreamTransports[args[0]] {
+			return fmt.Errorf("soft-crusher:stream expects one of sse, websocket or chunked")
+		}
+		d.Stream = args[0]
+	default:
+		return fmt.Errorf("unknown soft-crusher directive %q", name)
+	}
+
+	if d.Expose && d.Ignore {
+		return fmt.Errorf("soft-crusher:expose and soft-crusher:ignore are mutually exclusive")
+	}
+	return nil
+}
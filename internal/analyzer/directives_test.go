@@ -0,0 +1,110 @@
+package analyzer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func analyzeSource(t *testing.T, code string) (*FunctionAnalyzer, error) {
+	tempFile, err := ioutil.TempFile("", "test_*.go")
+	require.NoError(t, err)
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write([]byte(code))
+	require.NoError(t, err)
+	tempFile.Close()
+
+	analyzer := NewFunctionAnalyzer()
+	return analyzer, analyzer.AnalyzeFile(tempFile.Name())
+}
+
+func TestDocCommentsAndDirectives(t *testing.T) {
+	analyzer, err := analyzeSource(t, `
+		package main
+
+		// GetUser looks up a user.
+		//
+		// It returns an error when the user does not exist.
+		//soft-crusher:method GET
+		//soft-crusher:path /users/{id}
+		//soft-crusher:tags users,accounts
+		//soft-crusher:tags admin
+		//soft-crusher:auth bearer
+		//soft-crusher:param id path
+		//soft-crusher:param token header
+		//soft-crusher:stream chunked
+		func GetUser(id string, token string) (string, error) { return "", nil }
+
+		//soft-crusher:ignore
+		//soft-crusher:allow-risk
+		func helper() {}
+
+		// Ping answers health checks.
+		//soft-crusher:expose
+		//soft-crusher:auth none
+		func Ping() {}
+
+		func undocumented() {}
+	`)
+	require.NoError(t, err)
+	require.Len(t, analyzer.Functions, 4)
+
+	getUser := analyzer.Functions[0]
+	assert.Equal(t, "GetUser looks up a user.\n\nIt returns an error when the user does not exist.", getUser.Doc)
+	assert.Equal(t, Directives{
+		Method: "GET",
+		Path:   "/users/{id}",
+		Tags:   []string{"users", "accounts", "admin"},
+		Auth:   "bearer",
+		ParamLocations: map[string]string{
+			"id":    "path",
+			"token": "header",
+		},
+		Stream: "chunked",
+	}, getUser.Directives)
+
+	helper := analyzer.Functions[1]
+	assert.Empty(t, helper.Doc)
+	assert.Equal(t, Directives{Ignore: true, AllowRisk: true}, helper.Directives)
+
+	ping := analyzer.Functions[2]
+	assert.Equal(t, "Ping answers health checks.", ping.Doc)
+	assert.Equal(t, Directives{Expose: true, Auth: "none"}, ping.Directives)
+
+	assert.Equal(t, Directives{}, analyzer.Functions[3].Directives)
+}
+
+func TestInvalidDirectives(t *testing.T) {
+	testCases := []struct {
+		name      string
+		directive string
+		expected  string
+	}{
+		{"unknown directive", "//soft-crusher:publish", `unknown soft-crusher directive "publish"`},
+		{"unknown method", "//soft-crusher:method FETCH", "expects one of GET, HEAD, POST, PUT, PATCH, DELETE or OPTIONS"},
+		{"two methods", "//soft-crusher:method GET POST", "expects one of GET"},
+		{"path without slash", "//soft-crusher:path users", "expects one path starting with /"},
+		{"bad location", "//soft-crusher:param id cookie", "one of path, query, header or body"},
+		{"unknown parameter", "//soft-crusher:param name query", `unknown parameter "name"`},
+		{"conflicting exposure", "//soft-crusher:expose\n//soft-crusher:ignore", "mutually exclusive"},
+		{"arguments to flag", "//soft-crusher:ignore please", "takes no arguments"},
+		{"unknown transport", "//soft-crusher:stream grpc", "one of sse, websocket or chunked"},
+		{"arguments to allow-risk", "//soft-crusher:allow-risk exec", "takes no arguments"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := analyzeSource(t, "package main\n\n"+tc.directive+"\nfunc Get(id string) {}\n")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expected)
+			line := strings.Count(tc.directive, "\n") + 4
+			assert.Contains(t, err.Error(), fmt.Sprintf(".go:%d:1", line))
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Effect classifies what calling a function does to the world, from the
+// weakest to the strongest.
+type Effect string
+
+const (
+	// EffectPure functions only compute their results from their
+	// arguments.
+	EffectPure Effect = "pure"
+	// EffectReadOnly functions also read state, such as package variables,
+	// the receiver, files or the clock, but change none.
+	EffectReadOnly Effect = "read-only"
+	// EffectIdempotent functions change state, but calling them again with
+	// the same arguments changes nothing more.
+	EffectIdempotent Effect = "idempotent"
+	// EffectNonIdempotent functions change state on every call.
+	EffectNonIdempotent Effect = "non-idempotent"
+)
+
+var effectRanks = map[Effect]int{
+	EffectPure:          1,
+	EffectReadOnly:      2,
+	EffectIdempotent:    3,
+	EffectNonIdempotent: 4,
+}
+
+// stronger reports whether e says more than other; the empty Effect says
+// nothing.
+func (e Effect) stronger(other Effect) bool {
+	return effectRanks[e] > effectRanks[other]
+}
+
+// effectRule gives the effect of calls into pkg, matching names like
+// riskRule.
+type effectRule struct {
+	pkg    string
+	names  []string
+	effect Effect
+}
+
+// effectRules describe well-known functions of the standard library. They
+// are checked in order and the first match wins. Calls into other packages
+// that were not analyzed are judged by effectFromName.
+var effectRules = []effectRule{
+	{"os/exec", nil, EffectNonIdempotent},
+	{"os", []string{
+		"Getenv", "LookupEnv", "Environ", "Getwd", "Hostname", "Executable", "Get*",
+		"ReadFile", "ReadDir", "Stat", "Lstat", "Open", "DirFS", "File.Read*", "File.Stat", "File.Name",
+	}, EffectReadOnly},
+	{"os", []string{
+		"WriteFile", "Create", "Remove", "RemoveAll", "MkdirAll", "Chmod", "Chown", "Lchown",
+		"Chtimes", "Truncate", "Setenv", "Unsetenv", "File.Close", "File.Sync",
+	}, EffectIdempotent},
+	{"os", nil, EffectNonIdempotent},
+	{"io/ioutil", []string{"ReadFile", "ReadDir", "ReadAll", "NopCloser"}, EffectReadOnly},
+	{"io/ioutil", []string{"WriteFile"}, EffectIdempotent},
+	{"io/ioutil", nil, EffectNonIdempotent},
+	{"path/filepath", []string{"Walk", "WalkDir", "Glob", "EvalSymlinks", "Abs"}, EffectReadOnly},
+	{"time", []string{"Now", "Since", "Until", "Sleep", "After*", "Tick", "NewTimer", "NewTicker"}, EffectReadOnly},
+	{"math/rand", nil, EffectReadOnly},
+	{"math/rand/v2", nil, EffectReadOnly},
+	{"crypto/rand", nil, EffectReadOnly},
+	{"net", []string{"Lookup*", "Resolver.*"}, EffectReadOnly},
+	{"net", nil, EffectNonIdempotent},
+	{"net/http", []string{"Get", "Head", "Client.Get", "Client.Head"}, EffectReadOnly},
+	{"net/http", []string{"Post", "PostForm", "Client.*", "ListenAndServe*", "Serve*", "Server.*"}, EffectNonIdempotent},
+	{"database/sql", []string{
+		"DB.Query*", "DB.Ping*", "DB.Stats", "Conn.Query*", "Conn.Ping*", "Tx.Query*", "Stmt.Query*", "Row.*", "Rows.*",
+	}, EffectReadOnly},
+	{"database/sql", []string{"DB.*", "Conn.*", "Tx.*", "Stmt.*", "Open"}, EffectNonIdempotent},
+	{"sync/atomic", []string{"Load*", "*.Load"}, EffectReadOnly},
+	{"sync/atomic", []string{"Store*", "*.Store"}, EffectIdempotent},
+	{"sync/atomic", nil, EffectNonIdempotent},
+	{"sync", []string{"Map.Load", "Map.Range"}, EffectReadOnly},
+	{"sync", []string{"Map.Store", "Map.Delete", "Map.LoadOrStore", "Map.LoadAndDelete"}, EffectIdempotent},
+	{"sync", []string{"Map.*"}, EffectNonIdempotent},
+	{"syscall", nil, EffectNonIdempotent},
+	{"plugin", nil, EffectNonIdempotent},
+	{"unsafe", nil, EffectPure},
+	{"strings", nil, EffectPure},
+	{"strconv", nil, EffectPure},
+	{"bytes", nil, EffectPure},
+	{"unicode", nil, EffectPure},
+	{"unicode/utf8", nil, EffectPure},
+	{"unicode/utf16", nil, EffectPure},
+	{"math", nil, EffectPure},
+	{"math/bits", nil, EffectPure},
+	{"math/big", nil, EffectPure},
+	{"errors", nil, EffectPure},
+	{"sort", nil, EffectPure},
+	{"slices", nil, EffectPure},
+	{"maps", nil, EffectPure},
+	{"cmp", nil, EffectPure},
+	{"regexp", nil, EffectPure},
+	{"path", nil, EffectPure},
+	{"path/filepath", nil, EffectPure},
+	{"context", nil, EffectPure},
+	{"fmt", nil, EffectPure},
+	{"log", nil, EffectPure},
+	{"log/slog", nil, EffectPure},
+	{"sync", nil, EffectPure},
+	{"time", nil, EffectPure},
+	{"encoding/json", nil, EffectPure},
+	{"encoding/xml", nil, EffectPure},
+	{"encoding/base64", nil, EffectPure},
+	{"encoding/hex", nil, EffectPure},
+	{"net/url", nil, EffectPure},
+	{"html", nil, EffectPure},
+	{"crypto/sha1", nil, EffectPure},
+	{"crypto/sha256", nil, EffectPure},
+	{"crypto/sha512", nil, EffectPure},
+	{"crypto/md5", nil, EffectPure},
+	{"hash/crc32", nil, EffectPure},
+	{"hash/fnv", nil, EffectPure},
+}
+
+// classifyEffect returns the effect of calling name in package pkg.
+func classifyEffect(pkg, name string) (Effect, bool) {
+	for _, rule := range effectRules {
+		if rule.pkg == pkg && matchNames(rule.names, name) {
+			return rule.effect, true
+		}
+	}
+	return "", false
+}
+
+// Verbs that name what a function does, by the effect they suggest.
+var effectVerbs = []struct {
+	effect Effect
+	verbs  []string
+}{
+	{EffectReadOnly, []string{"get", "find", "list", "load", "read", "query", "count", "lookup", "fetch", "search", "has", "is", "exists", "contains"}},
+	{EffectIdempotent, []string{"put", "set", "update", "upsert", "replace", "delete", "remove", "clear", "reset", "store", "save", "enable", "disable"}},
+	{EffectNonIdempotent, []string{"create", "add", "insert", "append", "push", "pop", "send", "post", "publish", "enqueue", "exec", "run", "write", "inc", "increment", "incr", "generate", "start"}},
+}
+
+// effectFromName guesses the effect of a function that was not analyzed from
+// the verb its name, or the method part of it, starts with.
+func effectFromName(name string) Effect {
+	name = name[strings.LastIndex(name, ".")+1:]
+	lower := strings.ToLower(name)
+	for _, group := range effectVerbs {
+		for _, verb := range group.verbs {
+			// The verb must be a whole word: "Settle" is not "Set".
+			if strings.HasPrefix(lower, verb) && (len(name) == len(verb) || !unicode.IsLower(rune(name[len(verb)]))) {
+				return group.effect
+			}
+		}
+	}
+	return ""
+}
+
+// effectFinding is the strongest known effect of a function and where it
+// comes from.
+type effectFinding struct {
+	effect Effect
+	reason string
+	via    string
+}
+
+// linkEffects sets the Effect and EffectReason of every Go function
+// recorded, from its own body and, transitively, those of the functions it
+// calls. Calls to functions that were not analyzed count with the effect
+// guessed from their names.
+func (fa *FunctionAnalyzer) linkEffects() {
+	summaries := make(map[string]*bodySummary)
+	var names []string
+	for i := range fa.bodies {
+		body := &fa.bodies[i]
+		summary := summaries[body.Function]
+		if summary == nil {
+			copied := *body
+			copied.Calls = append([]bodyCall(nil), body.Calls...)
+			summaries[body.Function] = &copied
+			names = append(names, body.Function)
+			continue
+		}
+		// Variants of a function for different build constraints add up.
+		if body.Effect.stronger(summary.Effect) {
+			summary.Effect, summary.EffectReason = body.Effect, body.EffectReason
+		}
+		summary.Calls = append(summary.Calls, body.Calls...)
+	}
+	sort.Strings(names)
+
+	findings := make(map[string]effectFinding, len(names))
+	for _, name := range names {
+		summary := summaries[name]
+		findings[name] = effectFinding{effect: summary.Effect, reason: summary.EffectReason}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, name := range names {
+			finding := findings[name]
+			for _, call := range summaries[name].Calls {
+				candidate := effectFinding{via: call.Function}
+				if callee, ok := findings[call.Function]; ok {
+					candidate.effect, candidate.reason = callee.effect, callee.reason
+				} else if call.Guess != "" {
+					candidate.effect = call.Guess
+					candidate.reason = fmt.Sprintf("calls %s, assumed %s from its name", call.Function, call.Guess)
+					candidate.via = ""
+				}
+				if candidate.effect.stronger(finding.effect) {
+					finding = candidate
+					changed = true
+				}
+			}
+			findings[name] = finding
+		}
+	}
+
+	for i := range fa.Functions {
+		fn := &fa.Functions[i]
+		finding, ok := findings[fn.QualifiedName()]
+		if fn.Language != LanguageGo || !ok {
+			continue
+		}
+		fn.Effect, fn.EffectReason = finding.effect, finding.reason
+		if finding.via != "" {
+			fn.EffectReason += " via " + finding.via
+		}
+	}
+}
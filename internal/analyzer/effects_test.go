@@ -0,0 +1,166 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var effectModule = map[string]string{
+	"go.mod": "module example.com/counter\n\ngo 1.22\n",
+	"counter/counter.go": `
+		package counter
+
+		import (
+			"os"
+			"strings"
+		)
+
+		var hits int
+
+		type Counter struct {
+			values map[string]int
+			log    []string
+		}
+
+		func Normalize(name string) string {
+			return strings.ToLower(name)
+		}
+
+		func (c *Counter) Get(name string) int {
+			return c.values[Normalize(name)]
+		}
+
+		func (c *Counter) Set(name string, value int) {
+			c.values[name] = value
+		}
+
+		func (c *Counter) Reset(name string) {
+			delete(c.values, name)
+		}
+
+		func (c *Counter) Incr(name string) {
+			c.values[name]++
+		}
+
+		func (c *Counter) Record(entry string) {
+			c.log = append(c.log, entry)
+		}
+
+		// Track counts through Incr.
+		func (c *Counter) Track(name string) {
+			c.Incr(name)
+		}
+
+		func Hits() int {
+			return hits
+		}
+
+		func Home() string {
+			return os.Getenv("HOME")
+		}
+
+		// Scratch only changes locals and its value receiver.
+		func (c Counter) Scratch(n int) int {
+			total := 0
+			for i := 0; i < n; i++ {
+				total += i
+			}
+			c.log = nil
+			return total
+		}
+	`,
+	"counter/remote.go": `
+		package counter
+
+		type Client interface {
+			CreateOrder(id string) error
+		}
+
+		// Order calls a method that was not analyzed.
+		func Order(client Client, id string) error {
+			return client.CreateOrder(id)
+		}
+	`,
+}
+
+func functionEffects(functions []FunctionInfo) map[string]Effect {
+	effects := make(map[string]Effect)
+	for _, fn := range functions {
+		effects[fn.Name] = fn.Effect
+	}
+	return effects
+}
+
+func TestAnalyzeDirectoryEffects(t *testing.T) {
+	dir := writeModule(t, effectModule)
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+
+	assert.Equal(t, map[string]Effect{
+		"Normalize": EffectPure,
+		"Get":       EffectReadOnly,
+		"Set":       EffectIdempotent,
+		"Reset":     EffectIdempotent,
+		"Incr":      EffectNonIdempotent,
+		"Record":    EffectNonIdempotent,
+		"Track":     EffectNonIdempotent,
+		"Hits":      EffectReadOnly,
+		"Home":      EffectReadOnly,
+		"Scratch":   EffectPure,
+		"Order":     EffectNonIdempotent,
+	}, functionEffects(analyzer.Functions))
+
+	assert.Equal(t, "sets c.values[name]", findFunction(t, analyzer.Functions, "Set").EffectReason)
+	assert.Equal(t, "deletes from c.values", findFunction(t, analyzer.Functions, "Reset").EffectReason)
+	assert.Equal(t, "appends to c.log", findFunction(t, analyzer.Functions, "Record").EffectReason)
+	assert.Equal(t, "increments c.values[name] via example.com/counter/counter.Counter.Incr",
+		findFunction(t, analyzer.Functions, "Track").EffectReason)
+	assert.Equal(t, "calls os.Getenv", findFunction(t, analyzer.Functions, "Home").EffectReason)
+	assert.Equal(t, "calls client.CreateOrder, assumed non-idempotent from its name",
+		findFunction(t, analyzer.Functions, "Order").EffectReason)
+}
+
+func TestAnalyzePackagesEffects(t *testing.T) {
+	dir := writeModule(t, effectModule)
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Cache = NewCache(t.TempDir())
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+
+	effects := functionEffects(analyzer.Functions)
+	assert.Equal(t, EffectReadOnly, effects["Get"])
+	assert.Equal(t, EffectIdempotent, effects["Set"])
+	assert.Equal(t, EffectNonIdempotent, effects["Track"])
+	assert.Equal(t, EffectReadOnly, effects["Hits"])
+	assert.Equal(t, EffectPure, effects["Scratch"])
+	// Interface methods have no body, so Order is judged by the name of the
+	// method it calls.
+	assert.Equal(t, EffectNonIdempotent, effects["Order"])
+
+	// Effects survive the cache.
+	cached := NewFunctionAnalyzer()
+	cached.Cache = analyzer.Cache
+	require.NoError(t, cached.AnalyzePackages(dir))
+	assert.Equal(t, analyzer.Functions, cached.Functions)
+}
+
+func TestEffectFromName(t *testing.T) {
+	for name, expected := range map[string]Effect{
+		"GetUser":          EffectReadOnly,
+		"store.List":       EffectReadOnly,
+		"SetName":          EffectIdempotent,
+		"Settle":           "",
+		"DeleteOrder":      EffectIdempotent,
+		"CreateOrder":      EffectNonIdempotent,
+		"isValid":          EffectReadOnly,
+		"Issue":            "",
+		"tmpl.Execute":     "",
+		"Compute":          "",
+		"client.SendEmail": EffectNonIdempotent,
+	} {
+		assert.Equal(t, expected, effectFromName(name), name)
+	}
+}
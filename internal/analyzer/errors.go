@@ -0,0 +1,386 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrorKind tells how callers recognize an error: sentinel values with
+// errors.Is, error types with errors.As.
+type ErrorKind string
+
+const (
+	ErrorSentinel ErrorKind = "sentinel"
+	ErrorType     ErrorKind = "type"
+)
+
+// ErrorInfo is an error a Go function can return, found in its body or in
+// the bodies of the functions whose errors it returns.
+type ErrorInfo struct {
+	// Name is the qualified name of the sentinel variable, such as
+	// "example.com/shop.ErrNotFound", or of the error type.
+	Name string    `json:"name" yaml:"name"`
+	Kind ErrorKind `json:"kind" yaml:"kind"`
+	// Message is the text a sentinel was created with, if known.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+	// Pointer is set for error types returned as pointers, which
+	// errors.As has to look for as such.
+	Pointer bool `json:"pointer,omitempty" yaml:"pointer,omitempty"`
+}
+
+// LocalName returns the name of the error within its package: "ErrNotFound"
+// or "NotFoundError".
+func (e ErrorInfo) LocalName() string {
+	return e.Name[strings.LastIndex(e.Name, ".")+1:]
+}
+
+// knownErrors are the sentinels of the standard library that functions
+// commonly pass on, with their messages.
+var knownErrors = map[string]string{
+	"context.Canceled":         "context canceled",
+	"context.DeadlineExceeded": "context deadline exceeded",
+	"database/sql.ErrNoRows":   "sql: no rows in result set",
+	"io.EOF":                   "EOF",
+	"io.ErrUnexpectedEOF":      "unexpected EOF",
+	"io/fs.ErrExist":           "file already exists",
+	"io/fs.ErrNotExist":        "file does not exist",
+	"io/fs.ErrPermission":      "permission denied",
+	"os.ErrDeadlineExceeded":   "i/o timeout",
+	"os.ErrExist":              "file already exists",
+	"os.ErrNotExist":           "file does not exist",
+	"os.ErrPermission":         "permission denied",
+}
+
+// declaredErrors returns the sentinels and error types declared in file:
+// package variables set with errors.New or fmt.Errorf, or declared as
+// error, and types with an Error() string method.
+func (bs bodyScanner) declaredErrors(file *ast.File) []ErrorInfo {
+	var errs []ErrorInfo
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.GenDecl:
+			if decl.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.ValueSpec)
+				for i, name := range spec.Names {
+					if name.Name == "_" {
+						continue
+					}
+					var value ast.Expr
+					if i < len(spec.Values) && len(spec.Values) == len(spec.Names) {
+						value = spec.Values[i]
+					}
+					message, isNew := bs.newError(value)
+					if !isNew && !bs.declaredAsError(name, spec.Type) {
+						continue
+					}
+					errs = append(errs, ErrorInfo{Name: qualify(bs.packagePath, name.Name), Kind: ErrorSentinel, Message: message})
+				}
+			}
+		case *ast.FuncDecl:
+			if decl.Name.Name != "Error" || decl.Recv == nil || len(decl.Recv.List) == 0 ||
+				decl.Type.Params.NumFields() != 0 || decl.Type.Results.NumFields() != 1 {
+				continue
+			}
+			if result := identOf(decl.Type.Results.List[0].Type); result == nil || result.Name != "string" {
+				continue
+			}
+			field := decl.Recv.List[0]
+			if ident := embeddedIdent(field.Type); ident != nil {
+				_, pointer := field.Type.(*ast.StarExpr)
+				errs = append(errs, ErrorInfo{Name: qualify(bs.packagePath, ident.Name), Kind: ErrorType, Pointer: pointer})
+			}
+		}
+	}
+	return errs
+}
+
+// newError reports whether value is a call of errors.New or fmt.Errorf,
+// and returns the text it is called with.
+func (bs bodyScanner) newError(value ast.Expr) (string, bool) {
+	call, ok := ast.Unparen(value).(*ast.CallExpr)
+	if !ok {
+		return "", false
+	}
+	pkg, name, ok := bs.resolveCallee(ast.Unparen(call.Fun), funcScope{})
+	if !ok || !(pkg == "errors" && name == "New") && !(pkg == "fmt" && name == "Errorf") {
+		return "", false
+	}
+	if len(call.Args) > 0 {
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			message, _ := strconv.Unquote(lit.Value)
+			return message, true
+		}
+	}
+	return "", true
+}
+
+func (bs bodyScanner) declaredAsError(name *ast.Ident, typ ast.Expr) bool {
+	if bs.info != nil {
+		obj := bs.info.Defs[name]
+		return obj != nil && types.Identical(obj.Type(), types.Universe.Lookup("error").Type())
+	}
+	ident := identOf(typ)
+	return ident != nil && ident.Name == "error"
+}
+
+// errorResult returns the index of the error result of a function, or -1.
+func errorResult(funcType *ast.FuncType) int {
+	index, found := 0, -1
+	for _, field := range funcType.Results.List {
+		n := max(len(field.Names), 1)
+		if ident := identOf(field.Type); ident != nil && ident.Name == "error" {
+			found = index + n - 1
+		}
+		index += n
+	}
+	return found
+}
+
+// scanErrors records in summary the errors funcDecl returns itself and the
+// functions whose errors it returns, following error variables back to the
+// calls they were last assigned from.
+func (bs bodyScanner) scanErrors(funcDecl *ast.FuncDecl, scope funcScope, summary *bodySummary) {
+	if funcDecl.Type.Results == nil {
+		return
+	}
+	results := funcDecl.Type.Results.NumFields()
+	index := errorResult(funcDecl.Type)
+	if index < 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	addError := func(err ErrorInfo) {
+		if !seen["error "+err.Name] {
+			seen["error "+err.Name] = true
+			summary.Errors = append(summary.Errors, err)
+		}
+	}
+	addForward := func(function string) {
+		if !seen["forward "+function] {
+			seen["forward "+function] = true
+			summary.Forwards = append(summary.Forwards, function)
+		}
+	}
+	// sources holds the function each variable was last assigned from.
+	sources := make(map[string]string)
+
+	var add func(expr ast.Expr)
+	add = func(expr ast.Expr) {
+		switch expr := ast.Unparen(expr).(type) {
+		case *ast.UnaryExpr:
+			if expr.Op == token.AND {
+				if lit, ok := ast.Unparen(expr.X).(*ast.CompositeLit); ok {
+					if name := bs.typeName(lit.Type); name != "" {
+						addError(ErrorInfo{Name: name, Kind: ErrorType, Pointer: true})
+					}
+				}
+			}
+		case *ast.CompositeLit:
+			if name := bs.typeName(expr.Type); name != "" {
+				addError(ErrorInfo{Name: name, Kind: ErrorType})
+			}
+		case *ast.Ident:
+			if function, ok := sources[expr.Name]; ok {
+				addForward(function)
+			} else if name := bs.packageVar(expr); name != "" {
+				addError(ErrorInfo{Name: name, Kind: ErrorSentinel})
+			}
+		case *ast.SelectorExpr:
+			if name := bs.packageVar(expr); name != "" {
+				addError(ErrorInfo{Name: name, Kind: ErrorSentinel})
+			}
+		case *ast.CallExpr:
+			pkg, name, ok := bs.resolveCallee(ast.Unparen(expr.Fun), scope)
+			switch {
+			case !ok:
+			case pkg == "fmt" && name == "Errorf":
+				// Only %w keeps the wrapped errors recognizable.
+				if len(expr.Args) == 0 || !wraps(expr.Args[0]) {
+					break
+				}
+				for _, arg := range expr.Args[1:] {
+					add(arg)
+				}
+			case pkg == "errors" && name == "Join":
+				for _, arg := range expr.Args {
+					add(arg)
+				}
+			case pkg == "errors":
+			default:
+				addForward(qualify(pkg, name))
+			}
+		}
+	}
+
+	ast.Inspect(funcDecl.Body, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			// Returns of function literals are theirs.
+			return false
+		case *ast.AssignStmt:
+			if len(node.Rhs) != 1 {
+				break
+			}
+			call, ok := ast.Unparen(node.Rhs[0]).(*ast.CallExpr)
+			if !ok {
+				break
+			}
+			pkg, name, ok := bs.resolveCallee(ast.Unparen(call.Fun), scope)
+			for _, lhs := range node.Lhs {
+				ident := identOf(lhs)
+				if ident == nil || ident.Name == "_" {
+					continue
+				}
+				if ok && pkg != "errors" {
+					sources[ident.Name] = qualify(pkg, name)
+				} else {
+					delete(sources, ident.Name)
+				}
+			}
+		case *ast.ReturnStmt:
+			switch len(node.Results) {
+			case results:
+				add(node.Results[index])
+			case 1:
+				// return f() passes on all the results of f.
+				if call, ok := ast.Unparen(node.Results[0]).(*ast.CallExpr); ok {
+					if pkg, name, ok := bs.resolveCallee(ast.Unparen(call.Fun), scope); ok {
+						addForward(qualify(pkg, name))
+					}
+				}
+			}
+		}
+		return true
+	})
+}
+
+// wraps reports whether format, the first argument of fmt.Errorf, may wrap
+// errors with %w.
+func wraps(format ast.Expr) bool {
+	lit, ok := ast.Unparen(format).(*ast.BasicLit)
+	return !ok || strings.Contains(lit.Value, "%w")
+}
+
+// packageVar returns the qualified name of the package variable expr refers
+// to, or "" for anything else.
+func (bs bodyScanner) packageVar(expr ast.Expr) string {
+	if bs.info != nil {
+		ident := identOf(expr)
+		if sel, ok := expr.(*ast.SelectorExpr); ok {
+			ident = sel.Sel
+		}
+		if ident == nil {
+			return ""
+		}
+		if v, ok := bs.info.Uses[ident].(*types.Var); ok && isPackageVar(v) {
+			return qualify(v.Pkg().Path(), v.Name())
+		}
+		return ""
+	}
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		// Variables of other files of the package are not resolved.
+		if expr.Name != "nil" && (expr.Obj == nil && types.Universe.Lookup(expr.Name) == nil || bs.globals[expr.Obj]) {
+			return qualify(bs.packagePath, expr.Name)
+		}
+	case *ast.SelectorExpr:
+		if x := identOf(expr.X); x != nil && x.Obj == nil && bs.imports[x.Name] != "" {
+			return qualify(bs.imports[x.Name], expr.Sel.Name)
+		}
+	}
+	return ""
+}
+
+// typeName returns the qualified name of the named type typ refers to, or
+// "".
+func (bs bodyScanner) typeName(typ ast.Expr) string {
+	if bs.info != nil {
+		if named, ok := bs.info.TypeOf(typ).(*types.Named); ok && named.Obj().Pkg() != nil {
+			return qualify(named.Obj().Pkg().Path(), named.Obj().Name())
+		}
+		return ""
+	}
+	switch typ := typ.(type) {
+	case *ast.Ident:
+		return qualify(bs.packagePath, typ.Name)
+	case *ast.SelectorExpr:
+		if x := identOf(typ.X); x != nil && bs.imports[x.Name] != "" {
+			return qualify(bs.imports[x.Name], typ.Sel.Name)
+		}
+	}
+	return ""
+}
+
+// linkErrors sets the Errors of every Go function recorded, from its own
+// body and, transitively, those of the functions whose errors it returns.
+// Only errors that are named, as sentinels or types, are recorded: the
+// others can only be told apart by their text.
+func (fa *FunctionAnalyzer) linkErrors() {
+	declared := make(map[string]ErrorInfo)
+	for name, message := range knownErrors {
+		declared[name] = ErrorInfo{Name: name, Kind: ErrorSentinel, Message: message}
+	}
+	for _, err := range fa.errors {
+		declared[err.Name] = err
+	}
+
+	found := make(map[string]map[string]ErrorInfo)
+	forwards := make(map[string][]string)
+	var names []string
+	for _, body := range fa.bodies {
+		if _, ok := found[body.Function]; !ok {
+			found[body.Function] = make(map[string]ErrorInfo)
+			names = append(names, body.Function)
+		}
+		for _, err := range body.Errors {
+			// A variable that is neither a known sentinel nor declared in
+			// an analyzed file may not be an error at all.
+			if decl, ok := declared[err.Name]; ok || err.Kind == ErrorType {
+				if err.Kind == ErrorSentinel {
+					err = decl
+				} else if ok {
+					err.Message = decl.Message
+				}
+				found[body.Function][err.Name] = err
+			}
+		}
+		forwards[body.Function] = append(forwards[body.Function], body.Forwards...)
+	}
+	sort.Strings(names)
+
+	for changed := true; changed; {
+		changed = false
+		for _, name := range names {
+			errs := found[name]
+			for _, callee := range forwards[name] {
+				for errName, err := range found[callee] {
+					if _, ok := errs[errName]; !ok {
+						errs[errName] = err
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for i := range fa.Functions {
+		fn := &fa.Functions[i]
+		errs := found[fn.QualifiedName()]
+		if fn.Language != LanguageGo || len(errs) == 0 {
+			continue
+		}
+		fn.Errors = make([]ErrorInfo, 0, len(errs))
+		for _, err := range errs {
+			fn.Errors = append(fn.Errors, err)
+		}
+		sort.Slice(fn.Errors, func(i, j int) bool { return fn.Errors[i].Name < fn.Errors[j].Name })
+	}
+}
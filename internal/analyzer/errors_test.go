@@ -0,0 +1,152 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errorModule = map[string]string{
+	"go.mod": "module example.com/shop\n\ngo 1.22\n",
+	"users/errors.go": `
+		package users
+
+		import (
+			"errors"
+			"fmt"
+		)
+
+		var (
+			ErrNotFound = errors.New("user not found")
+			ErrExists   = fmt.Errorf("user already exists")
+		)
+
+		type ValidationError struct {
+			Field string
+		}
+
+		func (e *ValidationError) Error() string {
+			return "invalid " + e.Field
+		}
+	`,
+	"users/users.go": `
+		package users
+
+		import (
+			"database/sql"
+			"errors"
+			"fmt"
+		)
+
+		type User struct {
+			ID   string
+			Name string
+		}
+
+		var users = map[string]User{}
+
+		func find(id string) (User, error) {
+			user, ok := users[id]
+			if !ok {
+				return User{}, ErrNotFound
+			}
+			return user, nil
+		}
+
+		func GetUser(id string) (User, error) {
+			user, err := find(id)
+			if err != nil {
+				return User{}, fmt.Errorf("get user %s: %w", id, err)
+			}
+			return user, nil
+		}
+
+		func CreateUser(user User) error {
+			if user.Name == "" {
+				return &ValidationError{Field: "name"}
+			}
+			if _, err := find(user.ID); err == nil {
+				return ErrExists
+			}
+			users[user.ID] = user
+			return nil
+		}
+
+		func RenameUser(id, name string) (User, error) {
+			if err := CreateUser(User{ID: id, Name: name}); err != nil {
+				return User{}, err
+			}
+			return GetUser(id)
+		}
+
+		func Load(db *sql.DB, id string) error {
+			return db.QueryRow("SELECT 1").Scan(&id)
+		}
+
+		func Missing() error {
+			return sql.ErrNoRows
+		}
+
+		// Opaque errors are only known by their text.
+		func Opaque() error {
+			return errors.New("something went wrong")
+		}
+
+		func Later() func() error {
+			return func() error { return ErrNotFound }
+		}
+	`,
+}
+
+func functionErrors(functions []FunctionInfo) map[string][]string {
+	errs := make(map[string][]string)
+	for _, fn := range functions {
+		for _, err := range fn.Errors {
+			errs[fn.Name] = append(errs[fn.Name], err.LocalName())
+		}
+	}
+	return errs
+}
+
+func testFunctionErrors(t *testing.T, functions []FunctionInfo) {
+	t.Helper()
+	assert.Equal(t, map[string][]string{
+		"GetUser":    {"ErrNotFound"},
+		"CreateUser": {"ErrExists", "ValidationError"},
+		"RenameUser": {"ErrExists", "ErrNotFound", "ValidationError"},
+		"Missing":    {"ErrNoRows"},
+		"find":       {"ErrNotFound"},
+	}, functionErrors(functions))
+
+	assert.Equal(t, []ErrorInfo{
+		{Name: "example.com/shop/users.ErrExists", Kind: ErrorSentinel, Message: "user already exists"},
+		{Name: "example.com/shop/users.ValidationError", Kind: ErrorType, Pointer: true},
+	}, findFunction(t, functions, "CreateUser").Errors)
+	assert.Equal(t, []ErrorInfo{
+		{Name: "database/sql.ErrNoRows", Kind: ErrorSentinel, Message: "sql: no rows in result set"},
+	}, findFunction(t, functions, "Missing").Errors)
+}
+
+func TestAnalyzeDirectoryErrors(t *testing.T) {
+	dir := writeModule(t, errorModule)
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+	testFunctionErrors(t, analyzer.Functions)
+}
+
+func TestAnalyzePackagesErrors(t *testing.T) {
+	dir := writeModule(t, errorModule)
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Cache = NewCache(t.TempDir())
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+	testFunctionErrors(t, analyzer.Functions)
+
+	// Errors survive the cache.
+	cached := NewFunctionAnalyzer()
+	cached.Cache = analyzer.Cache
+	require.NoError(t, cached.AnalyzePackages(dir))
+	assert.Equal(t, analyzer.Functions, cached.Functions)
+}
@@ -0,0 +1,266 @@
+package analyzer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+// AnalysisVersion is the version of the Analysis document layout. It changes
+// only when a field is renamed or removed; new fields are added compatibly.
+const AnalysisVersion = 1
+
+// Output formats accepted by Analysis.Write. Only JSON and YAML can be read
+// back with ReadAnalysis.
+const (
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatTable = "table"
+)
+
+// Analysis is the exported result of an analysis run, for other tools and
+// for later soft-crusher commands.
+type Analysis struct {
+	Version         int                    `json:"version" yaml:"version"`
+	AnalyzerVersion string                 `json:"analyzerVersion" yaml:"analyzerVersion"`
+	Repository      *RepositoryInfo        `json:"repository,omitempty" yaml:"repository,omitempty"`
+	Functions       []FunctionInfo         `json:"functions" yaml:"functions"`
+	Services        []ServiceInfo          `json:"services,omitempty" yaml:"services,omitempty"`
+	Schemas         map[string]*TypeSchema `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+	Report          Report                 `json:"report" yaml:"report"`
+}
+
+// Analysis returns what fa has recorded so far as an Analysis document.
+func (fa *FunctionAnalyzer) Analysis() *Analysis {
+	return &Analysis{
+		Version:         AnalysisVersion,
+		AnalyzerVersion: AnalyzerVersion,
+		Repository:      fa.Repository,
+		Functions:       fa.Functions,
+		Services:        fa.Services,
+		Schemas:         fa.Schemas,
+		Report:          fa.Report,
+	}
+}
+
+// FormatForPath picks the format for an output file from its extension,
+// defaulting to JSON.
+func FormatForPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".txt":
+		return FormatTable
+	default:
+		return FormatJSON
+	}
+}
+
+// Write encodes the analysis to w in format.
+func (a *Analysis) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(a)
+	case FormatYAML:
+		data, err := yaml.Marshal(a)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case FormatTable:
+		return a.writeTable(w)
+	default:
+		return fmt.Errorf("unknown format %q, expected %s, %s or %s", format, FormatJSON, FormatYAML, FormatTable)
+	}
+}
+
+// writeTable lists one function per line, followed by the services and the
+// schemas.
+func (a *Analysis) writeTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FUNCTION\tSIGNATURE\tSOURCE")
+	for _, fn := range a.Functions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", fn.QualifiedName(), fn.Signature(), fn.Source)
+	}
+	if len(a.Services) > 0 {
+		fmt.Fprintln(tw, "\nSERVICE\tMETHODS\tCONSTRUCTORS")
+		for _, service := range a.Services {
+			methods := make([]string, len(service.Methods))
+			for i, method := range service.Methods {
+				methods[i] = method.Name
+			}
+			constructors := make([]string, len(service.Constructors))
+			for i, constructor := range service.Constructors {
+				constructors[i] = constructor.Name
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", service.QualifiedName(), strings.Join(methods, ", "), strings.Join(constructors, ", "))
+		}
+	}
+	if len(a.Schemas) > 0 {
+		names := make([]string, 0, len(a.Schemas))
+		for name := range a.Schemas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintln(tw, "\nTYPE\tKIND\tFIELDS")
+		for _, name := range names {
+			schema := a.Schemas[name]
+			fields := make([]string, len(schema.Fields))
+			for i, field := range schema.Fields {
+				fields[i] = field.Name
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", name, schema.Kind, strings.Join(fields, ", "))
+		}
+	}
+	return tw.Flush()
+}
+
+// WriteSecurityReport lists the functions with risks, riskiest first, with
+// the findings behind each score.
+func (a *Analysis) WriteSecurityReport(w io.Writer) error {
+	var risky []FunctionInfo
+	high := 0
+	for _, fn := range a.Functions {
+		if len(fn.Risks) == 0 {
+			continue
+		}
+		risky = append(risky, fn)
+		if fn.RiskScore >= HighRiskScore {
+			high++
+		}
+	}
+	sort.SliceStable(risky, func(i, j int) bool {
+		return risky[i].RiskScore > risky[j].RiskScore
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d of %d functions have risks, %d of them high.\n", len(risky), len(a.Functions), high)
+	if len(risky) > 0 {
+		fmt.Fprintln(tw, "\nLEVEL\tSCORE\tFUNCTION\tCATEGORIES")
+	}
+	for _, fn := range risky {
+		var categories []string
+		seen := make(map[RiskCategory]bool)
+		for _, risk := range fn.Risks {
+			if !seen[risk.Category] {
+				seen[risk.Category] = true
+				categories = append(categories, string(risk.Category))
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", RiskLevel(fn.RiskScore), fn.RiskScore, fn.QualifiedName(), strings.Join(categories, ", "))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, fn := range risky {
+		heading := fn.QualifiedName()
+		if fn.Source.File != "" {
+			heading += " (" + fn.Source.String() + ")"
+		}
+		fmt.Fprintf(w, "\n%s\n", heading)
+		for _, risk := range fn.Risks {
+			line := fmt.Sprintf("  %s: %s", risk.Category, risk.Reason)
+			if risk.Via != "" {
+				line += " via " + risk.Via
+			}
+			if risk.Position.Line > 0 {
+				line += fmt.Sprintf(" at line %d", risk.Position.Line)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ReadAnalysis decodes an Analysis written in JSON or YAML.
+func ReadAnalysis(r io.Reader) (*Analysis, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var analysis Analysis
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(data, &analysis)
+	} else {
+		err = yaml.Unmarshal(data, &analysis)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding analysis: %v", err)
+	}
+
+	switch {
+	case analysis.Version == 0:
+		return nil, fmt.Errorf("not a soft-crusher analysis: missing version")
+	case analysis.Version > AnalysisVersion:
+		return nil, fmt.Errorf("analysis version %d is newer than the supported version %d", analysis.Version, AnalysisVersion)
+	}
+	return &analysis, nil
+}
+
+// LoadAnalysis reads an Analysis from a file written by Analysis.Write.
+func LoadAnalysis(path string) (*Analysis, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadAnalysis(f)
+}
+
+// fileErrorDocument is how a FileError is written, since error values do not
+// survive encoding.
+type fileErrorDocument struct {
+	Path  string `json:"path" yaml:"path"`
+	Error string `json:"error" yaml:"error"`
+}
+
+func (fe FileError) document() fileErrorDocument {
+	doc := fileErrorDocument{Path: fe.Path}
+	if fe.Err != nil {
+		doc.Error = fe.Err.Error()
+	}
+	return doc
+}
+
+func (fe FileError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fe.document())
+}
+
+func (fe *FileError) UnmarshalJSON(data []byte) error {
+	var doc fileErrorDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	fe.Path, fe.Err = doc.Path, errors.New(doc.Error)
+	return nil
+}
+
+func (fe FileError) MarshalYAML() (interface{}, error) {
+	return fe.document(), nil
+}
+
+func (fe *FileError) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var doc fileErrorDocument
+	if err := unmarshal(&doc); err != nil {
+		return err
+	}
+	fe.Path, fe.Err = doc.Path, errors.New(doc.Error)
+	return nil
+}
@@ -0,0 +1,154 @@
+package analyzer
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exportFixture(t *testing.T) *FunctionAnalyzer {
+	dir := writeModule(t, map[string]string{
+		"go.mod": "module example.com/export\n\ngo 1.22\n",
+		"users.go": `package export
+
+// User is a stored user.
+type User struct {
+	ID   string ` + "`json:\"id\" validate:\"required\"`" + `
+	Tags []string ` + "`json:\"tags,omitempty\"`" + `
+}
+
+// GetUser loads a user.
+//
+//soft-crusher:method GET
+//soft-crusher:param id path
+func GetUser(id string) (*User, error) { return nil, nil }
+
+func Map[K comparable, V any](m map[K]V, keys ...K) []V { return nil }
+`,
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Options = DefaultOptions()
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+	analyzer.Repository = &RepositoryInfo{URL: "file:///src/export", Commit: "0123abcd"}
+	analyzer.Report.Errors = []FileError{{Path: "broken.go", Err: errors.New("expected ')'")}}
+	return analyzer
+}
+
+func TestAnalysisRoundTrip(t *testing.T) {
+	analyzer := exportFixture(t)
+	analysis := analyzer.Analysis()
+	assert.Equal(t, AnalysisVersion, analysis.Version)
+
+	for _, format := range []string{FormatJSON, FormatYAML} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, analysis.Write(&buf, format))
+
+			decoded, err := ReadAnalysis(&buf)
+			require.NoError(t, err)
+			assert.Equal(t, analysis.Functions, decoded.Functions)
+			assert.Equal(t, analysis.Schemas, decoded.Schemas)
+			assert.Equal(t, analysis.Repository, decoded.Repository)
+			assert.Equal(t, analysis.Report.FilesAnalyzed, decoded.Report.FilesAnalyzed)
+			require.Len(t, decoded.Report.Errors, 1)
+			assert.Equal(t, "broken.go: expected ')'", decoded.Report.Errors[0].Error())
+		})
+	}
+}
+
+func TestAnalysisJSONLayout(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, exportFixture(t).Analysis().Write(&buf, FormatJSON))
+
+	out := buf.String()
+	for _, fragment := range []string{
+		`"version": 1`,
+		`"name": "GetUser"`,
+		`"packagePath": "example.com/export"`,
+		`"paramLocations": {`,
+		`"qualifiedName": "*example.com/export.User"`,
+		`"jsonName": "id"`,
+		`"commit": "0123abcd"`,
+		`"error": "expected ')'"`,
+	} {
+		assert.Contains(t, out, fragment)
+	}
+}
+
+func TestAnalysisTable(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, exportFixture(t).Analysis().Write(&buf, FormatTable))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 6)
+	assert.Regexp(t, `^FUNCTION\s+SIGNATURE\s+SOURCE$`, lines[0])
+	assert.Regexp(t, `^example.com/export.GetUser\s+\(id string\) \(\*User, error\)\s+\S+users.go:13:1$`, lines[1])
+	assert.Regexp(t, `^example.com/export.Map\s+\[K comparable, V any\]\(m map\[K\]V, keys \.\.\.K\) \[\]V\s`, lines[2])
+	assert.Regexp(t, `^example.com/export.User\s+struct\s+ID, Tags$`, lines[5])
+
+	assert.Error(t, exportFixture(t).Analysis().Write(&buf, "xml"))
+}
+
+func TestReadAnalysisErrors(t *testing.T) {
+	testCases := map[string]string{
+		"missing version": `{"functions": []}`,
+		"newer version":   "version: 99\nfunctions: []\n",
+		"malformed":       `{"version": 1, "functions": {`,
+	}
+
+	for name, input := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := ReadAnalysis(strings.NewReader(input))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	assert.Equal(t, FormatYAML, FormatForPath("out/analysis.YML"))
+	assert.Equal(t, FormatYAML, FormatForPath("analysis.yaml"))
+	assert.Equal(t, FormatTable, FormatForPath("analysis.txt"))
+	assert.Equal(t, FormatJSON, FormatForPath(filepath.Join("out", "analysis.json")))
+	assert.Equal(t, FormatJSON, FormatForPath("analysis"))
+}
+
+func TestSecurityReport(t *testing.T) {
+	analysis := &Analysis{Functions: []FunctionInfo{
+		{Name: "Add", PackagePath: "example.com/tools"},
+		{
+			Name:        "Copy",
+			PackagePath: "example.com/tools",
+			Risks:       []Risk{{Category: RiskStream, Reason: "parameter r is a io.Reader"}},
+			RiskScore:   15,
+		},
+		{
+			Name:        "Run",
+			PackagePath: "example.com/tools",
+			Source:      SourceRange{File: "run.go", Start: Position{Line: 3, Column: 1}},
+			Risks: []Risk{
+				{Category: RiskExec, Reason: "calls os/exec.Command", Position: Position{Line: 4, Column: 2}, Via: "example.com/tools.start"},
+				{Category: RiskGoroutine, Reason: "starts a goroutine", Position: Position{Line: 5, Column: 2}},
+			},
+			RiskScore: 80,
+		},
+	}}
+
+	var buf bytes.Buffer
+	require.NoError(t, analysis.WriteSecurityReport(&buf))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 12)
+	assert.Equal(t, "2 of 3 functions have risks, 1 of them high.", lines[0])
+	assert.Regexp(t, `^LEVEL\s+SCORE\s+FUNCTION\s+CATEGORIES$`, lines[2])
+	assert.Regexp(t, `^high\s+80\s+example.com/tools.Run\s+exec, goroutine$`, lines[3])
+	assert.Regexp(t, `^low\s+15\s+example.com/tools.Copy\s+stream$`, lines[4])
+	assert.Equal(t, "example.com/tools.Run (run.go:3:1)", lines[6])
+	assert.Equal(t, "  exec: calls os/exec.Command via example.com/tools.start at line 4", lines[7])
+	assert.Equal(t, "example.com/tools.Copy", lines[10])
+	assert.Equal(t, "  stream: parameter r is a io.Reader", lines[11])
+}
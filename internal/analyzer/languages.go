@@ -0,0 +1,195 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LanguageGo is the Language recorded for functions read from Go source.
+const LanguageGo = "go"
+
+// LanguageAnalyzer reads the functions declared in source files of a language
+// other than Go, which FunctionAnalyzer understands natively. Implementations
+// describe functions with the same FunctionInfo used for Go, writing types as
+// they appear in the source language, so that the designer and generators
+// need not know where a function came from.
+type LanguageAnalyzer interface {
+	// Language names the language, e.g. "python".
+	Language() string
+	// Extensions lists the file extensions handled, including the dot.
+	Extensions() []string
+	// AnalyzeSource returns the functions of src, the contents of path,
+	// selected by options. It fills in Name, Receiver, Parameters, Results,
+	// TypeParams, Doc, Directives, Package and Source; FunctionAnalyzer sets
+	// the rest.
+	AnalyzeSource(path string, src []byte, options Options) ([]FunctionInfo, error)
+}
+
+// Registry maps file extensions to the analyzers for them.
+type Registry struct {
+	analyzers map[string]LanguageAnalyzer
+}
+
+func NewRegistry(analyzers ...LanguageAnalyzer) *Registry {
+	registry := &Registry{analyzers: make(map[string]LanguageAnalyzer)}
+	for _, la := range analyzers {
+		registry.Register(la)
+	}
+	return registry
+}
+
+// DefaultRegistry returns a registry of every language analyzer shipped with
+// soft-crusher.
+func DefaultRegistry() *Registry {
+	return NewRegistry(PythonAnalyzer{}, CHeaderAnalyzer{})
+}
+
+// Register adds la for its extensions, replacing any analyzer registered for
+// the same extension before.
+func (r *Registry) Register(la LanguageAnalyzer) {
+	for _, ext := range la.Extensions() {
+		r.analyzers[strings.ToLower(ext)] = la
+	}
+}
+
+// ForFile returns the analyzer for path's extension, or nil.
+func (r *Registry) ForFile(path string) LanguageAnalyzer {
+	if r == nil {
+		return nil
+	}
+	return r.analyzers[strings.ToLower(filepath.Ext(path))]
+}
+
+// Lookup returns the analyzer registered for language, or nil.
+func (r *Registry) Lookup(language string) LanguageAnalyzer {
+	if r == nil {
+		return nil
+	}
+	for _, la := range r.analyzers {
+		if la.Language() == language {
+			return la
+		}
+	}
+	return nil
+}
+
+// Languages lists the registered languages in alphabetical order.
+func (r *Registry) Languages() []string {
+	if r == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var languages []string
+	for _, la := range r.analyzers {
+		if !seen[la.Language()] {
+			seen[la.Language()] = true
+			languages = append(languages, la.Language())
+		}
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// analyzeForeignSource runs la over src and completes what it recorded the
+// way analyzeSource does for Go. For these languages PackagePath is the file's
+// slash-separated path relative to the analyzed root, without its extension.
+func (fa *FunctionAnalyzer) analyzeForeignSource(la LanguageAnalyzer, filePath string, src []byte, pkgDir string) (fileResult, error) {
+	functions, err := la.AnalyzeSource(filePath, src, fa.Options)
+	if err != nil {
+		return fileResult{}, err
+	}
+
+	base := filepath.Base(filePath)
+	packagePath := strings.TrimSuffix(base, filepath.Ext(base))
+	if pkgDir != "." {
+		packagePath = pkgDir + "/" + packagePath
+	}
+	packageName := ""
+	if len(functions) > 0 {
+		packageName = functions[0].Package
+	}
+	if !fa.Options.includePackage(packageName, pkgDir, packagePath) {
+		return fileResult{FilesSkipped: 1}, nil
+	}
+
+	for i := range functions {
+		functions[i].Language = la.Language()
+		functions[i].PackagePath = packagePath
+	}
+	return fileResult{Functions: functions, FilesAnalyzed: 1}, nil
+}
+
+// closingBracket returns the index of the bracket closing the one at open,
+// skipping string literals, or -1.
+func closingBracket(s string, open int) int {
+	depth := 0
+	for i := open; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\'':
+			i = skipQuoted(s, i)
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// skipQuoted returns the index of the quote closing the string literal
+// starting at i.
+func skipQuoted(s string, i int) int {
+	quote := s[i]
+	for i++; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case quote:
+			return i
+		}
+	}
+	return len(s)
+}
+
+// indexTopLevel returns the index of the first sep outside brackets and
+// string literals, or -1.
+func indexTopLevel(s string, sep byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\'':
+			i = skipQuoted(s, i)
+		case c == '(' || c == '[' || c == '{':
+			depth++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+		case c == sep && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitTopLevel splits s on sep outside brackets and string literals,
+// trimming the parts and dropping empty ones.
+func splitTopLevel(s string, sep byte) []string {
+	var parts []string
+	for {
+		i := indexTopLevel(s, sep)
+		part := s
+		if i >= 0 {
+			part = s[:i]
+		}
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+		if i < 0 {
+			return parts
+		}
+		s = s[i+1:]
+	}
+}
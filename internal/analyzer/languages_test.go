@@ -0,0 +1,62 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := DefaultRegistry()
+	assert.Equal(t, []string{"c", "python"}, registry.Languages())
+	assert.Equal(t, "python", registry.ForFile("lib/users.PY").Language())
+	assert.Equal(t, "c", registry.ForFile("counter.h").Language())
+	assert.Nil(t, registry.ForFile("main.go"))
+	assert.Equal(t, "python", registry.Lookup("python").Language())
+	assert.Nil(t, registry.Lookup("rust"))
+
+	var none *Registry
+	assert.Nil(t, none.ForFile("users.py"))
+}
+
+func TestAnalyzeDirectoryLanguages(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":            "module example.com/mixed\n\ngo 1.22\n",
+		"main.go":           "package main\n\nfunc Serve() {}\n",
+		"lib/users.py":      "def get_user(user_id: int) -> dict:\n    return {}\n",
+		"lib/test_users.py": "def test_get_user():\n    pass\n",
+		"include/counter.h": "int counter_value(void);\n",
+		"README.md":         "# mixed\n",
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Options = DefaultOptions()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+	assert.Equal(t, []string{"Serve"}, functionNames(analyzer.Functions))
+
+	analyzer = NewFunctionAnalyzer()
+	analyzer.Options = DefaultOptions()
+	analyzer.Languages = DefaultRegistry()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+	require.Equal(t, []string{"Serve", "counter_value", "get_user"}, functionNames(analyzer.Functions))
+	assert.Equal(t, 3, analyzer.Report.FilesAnalyzed)
+	assert.Equal(t, 1, analyzer.Report.FilesSkipped)
+
+	languages := make(map[string]string)
+	packagePaths := make(map[string]string)
+	for _, fn := range analyzer.Functions {
+		languages[fn.Name] = fn.Language
+		packagePaths[fn.Name] = fn.PackagePath
+	}
+	assert.Equal(t, map[string]string{"Serve": "go", "counter_value": "c", "get_user": "python"}, languages)
+	assert.Equal(t, "lib/users", packagePaths["get_user"])
+	assert.Equal(t, "include/counter", packagePaths["counter_value"])
+
+	analyzer = NewFunctionAnalyzer()
+	analyzer.Options = DefaultOptions()
+	analyzer.Options.ExcludePackages = []string{"lib/..."}
+	analyzer.Languages = DefaultRegistry()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+	assert.Equal(t, []string{"Serve", "counter_value"}, functionNames(analyzer.Functions))
+}
@@ -0,0 +1,215 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/build"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Options selects the files and functions the analyzer records. The zero
+// value analyzes everything, as NewFunctionAnalyzer always has; use
+// DefaultOptions to get the selection the CLI applies.
+type Options struct {
+	// ExportedOnly drops unexported functions, and methods whose receiver
+	// type is unexported.
+	ExportedOnly bool
+	// SkipTests ignores _test.go files, and Python test_*.py and *_test.py
+	// modules.
+	SkipTests bool
+	// SkipVendor ignores vendor directories.
+	SkipVendor bool
+	// SkipIgnoredDirs ignores the directories the go command ignores:
+	// testdata and names starting with "." or "_".
+	SkipIgnoredDirs bool
+	// SkipGenerated ignores files carrying a "Code generated ... DO NOT EDIT."
+	// header.
+	SkipGenerated bool
+	// BuildConstraints drops files whose //go:build lines or GOOS/GOARCH
+	// file name suffixes exclude them for the current platform and BuildTags.
+	BuildConstraints bool
+	BuildTags        []string
+	// Packages and ExcludePackages filter on package name, import path or
+	// slash-separated directory relative to the analyzed root. Entries may be
+	// path.Match patterns or end in "/..." to match a whole subtree.
+	Packages        []string
+	ExcludePackages []string
+	// Include and ExcludeFiles filter on the slash-separated file path
+	// relative to the analyzed root. "**" matches any number of directories,
+	// and patterns without a slash match the base name.
+	Include      []string
+	ExcludeFiles []string
+	// Tolerant records files or packages that fail to parse or load in
+	// Report.Errors and carries on, instead of aborting the run.
+	Tolerant bool
+}
+
+// DefaultOptions returns the selection suited to exposing a real code base:
+// exported, hand-written, non-test code for the current platform.
+func DefaultOptions() Options {
+	return Options{
+		ExportedOnly:     true,
+		SkipTests:        true,
+		SkipVendor:       true,
+		SkipIgnoredDirs:  true,
+		SkipGenerated:    true,
+		BuildConstraints: true,
+	}
+}
+
+// FileError is a failure to analyze one file or package.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (fe FileError) Error() string {
+	return fe.Path + ": " + fe.Err.Error()
+}
+
+// Report summarises what an analysis run looked at.
+type Report struct {
+	FilesAnalyzed int `json:"filesAnalyzed" yaml:"filesAnalyzed"`
+	FilesSkipped  int `json:"filesSkipped" yaml:"filesSkipped"`
+	// CacheHits counts the files or packages whose results came from the
+	// cache.
+	CacheHits int         `json:"cacheHits,omitempty" yaml:"cacheHits,omitempty"`
+	Errors    []FileError `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// skipDir reports whether a directory, given by base name, is left out of
+// AnalyzeDirectory.
+func (o Options) skipDir(name string) bool {
+	if o.SkipVendor && name == "vendor" {
+		return true
+	}
+	if o.SkipIgnoredDirs && (name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+		return true
+	}
+	return false
+}
+
+// includeFile applies the path-based rules to a file, given by its path
+// relative to the analyzed root.
+func (o Options) includeFile(root, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if o.SkipTests && isTestFile(rel) {
+		return false
+	}
+	if len(o.Include) > 0 && !matchAnyGlob(o.Include, rel) {
+		return false
+	}
+	if matchAnyGlob(o.ExcludeFiles, rel) {
+		return false
+	}
+	if o.BuildConstraints && isGoFile(rel) {
+		ctx := build.Default
+		ctx.BuildTags = o.BuildTags
+		dir, name := filepath.Split(filepath.Join(root, filepath.FromSlash(rel)))
+		match, err := ctx.MatchFile(dir, name)
+		if err == nil && !match {
+			return false
+		}
+	}
+	return true
+}
+
+func isTestFile(rel string) bool {
+	name := path.Base(rel)
+	switch {
+	case strings.HasSuffix(name, "_test.go"):
+		return true
+	case strings.HasSuffix(name, ".py"):
+		return strings.HasPrefix(name, "test_") || strings.HasSuffix(name, "_test.py")
+	}
+	return false
+}
+
+// includePackage applies the package allow and deny lists. A package is
+// identified by its name and by one or more paths.
+func (o Options) includePackage(name string, paths ...string) bool {
+	candidates := append([]string{name}, paths...)
+	if len(o.Packages) > 0 && !matchAnyPackage(o.Packages, candidates) {
+		return false
+	}
+	return !matchAnyPackage(o.ExcludePackages, candidates)
+}
+
+// includeFunction applies ExportedOnly to a declaration.
+func (o Options) includeFunction(funcDecl *ast.FuncDecl) bool {
+	if !o.ExportedOnly {
+		return true
+	}
+	if !funcDecl.Name.IsExported() {
+		return false
+	}
+	if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+		if ident := embeddedIdent(funcDecl.Recv.List[0].Type); ident != nil && !ident.IsExported() {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAnyPackage(patterns, candidates []string) bool {
+	for _, pattern := range patterns {
+		for _, candidate := range candidates {
+			if candidate == "" {
+				continue
+			}
+			if prefix, ok := strings.CutSuffix(pattern, "/..."); ok {
+				if candidate == prefix || strings.HasPrefix(candidate, prefix+"/") {
+					return true
+				}
+				continue
+			}
+			if matched, _ := path.Match(pattern, candidate); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchAnyGlob(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(rel)
+		}
+		if globToRegexp(pattern).MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// globToRegexp translates a slash-separated glob into an anchored regular
+// expression. "*" and "?" stay within one path element, "**/" matches zero or
+// more directories and a trailing "**" matches everything below.
+func globToRegexp(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				expr.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
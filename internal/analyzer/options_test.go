@@ -0,0 +1,186 @@
+package analyzer
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func functionNames(functions []FunctionInfo) []string {
+	names := make([]string, 0, len(functions))
+	for _, fn := range functions {
+		names = append(names, fn.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var selectionTree = map[string]string{
+	"main.go": `
+		package main
+		func main() {}
+		func init() {}
+		func Serve() {}
+		type server struct{}
+		func (s *server) Handle() {}
+		type Server struct{}
+		func (s *Server) Start() {}
+		func (s *Server) stop() {}
+	`,
+	"main_test.go": `
+		package main
+		import "testing"
+		func TestServe(t *testing.T) {}
+	`,
+	"zz_generated.go": "// Code generated by stringer. DO NOT EDIT.\n\npackage main\n\nfunc Generated() {}\n",
+	"enterprise.go":   "//go:build enterprise\n\npackage main\n\nfunc Enterprise() {}\n",
+	"vendor/lib/lib.go": `
+		package lib
+		func Vendored() {}
+	`,
+	"testdata/fixture.go": `
+		package fixture
+		func Fixture() {}
+	`,
+	"internal/store/store.go": `
+		package store
+		import "time"
+		func Save(at time.Time) {}
+	`,
+	"internal/store/store_mock.go": `
+		package store
+		func MockSave() {}
+	`,
+	"api/api.go": `
+		package api
+		func List() {}
+	`,
+}
+
+func TestAnalyzeDirectoryOptions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		options  func(*Options)
+		expected []string
+	}{
+		{
+			name:     "defaults",
+			options:  func(*Options) {},
+			expected: []string{"List", "MockSave", "Save", "Serve", "Start"},
+		},
+		{
+			name:     "build tags",
+			options:  func(o *Options) { o.BuildTags = []string{"enterprise"} },
+			expected: []string{"Enterprise", "List", "MockSave", "Save", "Serve", "Start"},
+		},
+		{
+			name:     "package allow list",
+			options:  func(o *Options) { o.Packages = []string{"internal/..."} },
+			expected: []string{"MockSave", "Save"},
+		},
+		{
+			name:     "package deny list by name",
+			options:  func(o *Options) { o.ExcludePackages = []string{"store", "main"} },
+			expected: []string{"List"},
+		},
+		{
+			name:     "file globs",
+			options:  func(o *Options) { o.ExcludeFiles = []string{"*_mock.go", "api/**"} },
+			expected: []string{"Save", "Serve", "Start"},
+		},
+		{
+			name:     "include globs",
+			options:  func(o *Options) { o.Include = []string{"**/store*.go"} },
+			expected: []string{"MockSave", "Save"},
+		},
+		{
+			name: "everything but vendor",
+			options: func(o *Options) {
+				*o = Options{SkipVendor: true, SkipIgnoredDirs: true}
+			},
+			expected: []string{
+				"Enterprise", "Generated", "Handle", "List", "MockSave", "Save",
+				"Serve", "Start", "TestServe", "init", "main", "stop",
+			},
+		},
+	}
+
+	dir := writeModule(t, selectionTree)
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			analyzer := NewFunctionAnalyzer()
+			analyzer.Options = DefaultOptions()
+			tc.options(&analyzer.Options)
+
+			require.NoError(t, analyzer.AnalyzeDirectory(dir))
+			assert.Equal(t, tc.expected, functionNames(analyzer.Functions))
+		})
+	}
+}
+
+func TestAnalyzeDirectoryTolerant(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"good.go":   "package main\n\nfunc Good() {}\n",
+		"broken.go": "package main\n\nfunc Broken( {}\n",
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	assert.Error(t, analyzer.AnalyzeDirectory(dir))
+
+	analyzer = NewFunctionAnalyzer()
+	analyzer.Options.Tolerant = true
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+	assert.Equal(t, []string{"Good"}, functionNames(analyzer.Functions))
+	assert.Equal(t, 1, analyzer.Report.FilesAnalyzed)
+	require.Len(t, analyzer.Report.Errors, 1)
+	assert.Contains(t, analyzer.Report.Errors[0].Path, "broken.go")
+}
+
+func TestAnalyzePackagesOptions(t *testing.T) {
+	files := map[string]string{
+		"go.mod": "module example.com/sel\n\ngo 1.22\n",
+	}
+	for name, content := range selectionTree {
+		files[name] = content
+	}
+	delete(files, "vendor/lib/lib.go")
+	dir := writeModule(t, files)
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Options = DefaultOptions()
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+	assert.Equal(t, []string{"List", "MockSave", "Save", "Serve", "Start"}, functionNames(analyzer.Functions))
+
+	analyzer = NewFunctionAnalyzer()
+	analyzer.Options = DefaultOptions()
+	analyzer.Options.SkipTests = false
+	analyzer.Options.ExcludePackages = []string{"example.com/sel/internal/..."}
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+	assert.Equal(t, []string{"List", "Serve", "Start", "TestServe"}, functionNames(analyzer.Functions))
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "dir/main.go", false},
+		{"internal/*/store.go", "internal/db/store.go", true},
+		{"internal/*/store.go", "internal/a/b/store.go", false},
+		{"**/store.go", "store.go", true},
+		{"**/store.go", "internal/a/b/store.go", true},
+		{"internal/**", "internal/a/b.go", true},
+		{"internal/**", "api/b.go", false},
+		{"file?.go", "file1.go", true},
+		{"file?.go", "file10.go", false},
+		{"a+b.go", "a+b.go", true},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.match, globToRegexp(tc.pattern).MatchString(tc.name), "%s vs %s", tc.pattern, tc.name)
+	}
+}
@@ -0,0 +1,348 @@
+package analyzer
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// packagesLoadMode type-checks dependencies from source rather than from the
+// go command's export data, whose format changes between Go releases.
+const packagesLoadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedSyntax |
+	packages.NeedTypes |
+	packages.NeedTypesInfo |
+	packages.NeedImports |
+	packages.NeedDeps |
+	packages.NeedModule
+
+// packagesMetadataMode lists packages and their files without parsing them,
+// which is enough to tell which cached results are still valid.
+const packagesMetadataMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedImports |
+	packages.NeedDeps |
+	packages.NeedModule
+
+// AnalyzePackages loads the packages matching patterns, relative to dir, with
+// full type information. Unlike AnalyzeFile, every parameter and result of the
+// functions it records carries a Resolved type. With no patterns, every
+// package under dir is loaded.
+//
+// When fa.Cache is set, only packages whose files or dependencies changed
+// since they were cached are loaded and type-checked. Like AnalyzeDirectory,
+// the functions found are ordered by package, file and position.
+func (fa *FunctionAnalyzer) AnalyzePackages(dir string, patterns ...string) error {
+	return fa.AnalyzePackagesContext(context.Background(), dir, patterns...)
+}
+
+// AnalyzePackagesContext is AnalyzePackages, stopping when ctx is cancelled.
+// The files below dir that fa.Languages handles are analyzed as well, across
+// fa.Workers goroutines as AnalyzeDirectoryContext does.
+func (fa *FunctionAnalyzer) AnalyzePackagesContext(ctx context.Context, dir string, patterns ...string) error {
+	start := len(fa.Functions)
+	err := fa.analyzePackages(ctx, dir, patterns)
+	sortFunctions(fa.Functions[start:])
+	if err == nil && fa.Languages != nil {
+		var jobs []fileJob
+		if jobs, err = fa.collectFiles(ctx, dir, true); err == nil {
+			err = fa.analyzeFiles(ctx, jobs)
+		}
+	}
+	fa.link()
+	return err
+}
+
+func (fa *FunctionAnalyzer) analyzePackages(ctx context.Context, dir string, patterns []string) error {
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Errorf("error resolving directory: %v", err)
+	}
+
+	cfg := &packages.Config{
+		Context: ctx,
+		Mode:    packagesLoadMode,
+		Dir:     root,
+		Tests:   !fa.Options.SkipTests,
+	}
+	if len(fa.Options.BuildTags) > 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(fa.Options.BuildTags, ",")}
+	}
+
+	if fa.Cache == nil {
+		return fa.loadPackages(cfg, root, patterns, nil)
+	}
+
+	metadataCfg := *cfg
+	metadataCfg.Mode = packagesMetadataMode
+	pkgs, err := packages.Load(&metadataCfg, patterns...)
+	if err != nil || hasLoadErrors(pkgs) {
+		// Let the full load report whatever is wrong.
+		return fa.loadPackages(cfg, root, patterns, nil)
+	}
+
+	keys := fa.packageKeys(pkgs)
+	stale := make(map[string]string)
+	stalePaths := make(map[string]bool)
+	var stalePatterns []string
+	for _, pkg := range pkgs {
+		if isTestMain(pkg) {
+			continue
+		}
+		var entry packageCacheEntry
+		if fa.Cache.load(keys[pkg.ID], &entry) {
+			fa.restorePackage(entry)
+			continue
+		}
+		stale[pkg.ID] = keys[pkg.ID]
+		if pattern := loadPattern(pkg); !stalePaths[pattern] {
+			stalePaths[pattern] = true
+			stalePatterns = append(stalePatterns, pattern)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return fa.loadPackages(cfg, root, stalePatterns, stale)
+}
+
+// loadPattern returns the pattern that loads pkg. Test variants, whose IDs
+// look like "p_test [p.test]", are loaded through the package they test.
+func loadPattern(pkg *packages.Package) string {
+	if i := strings.Index(pkg.ID, " ["); i >= 0 {
+		return strings.TrimSuffix(strings.TrimSuffix(pkg.ID[i+2:], "]"), ".test")
+	}
+	return pkg.PkgPath
+}
+
+func hasLoadErrors(pkgs []*packages.Package) bool {
+	failed := false
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		if len(pkg.Errors) > 0 {
+			failed = true
+		}
+	})
+	return failed
+}
+
+// loadPackages type-checks the packages matching patterns and records their
+// functions. When stale is not nil, only the packages it lists are recorded,
+// and their results are cached under the keys it maps their IDs to.
+func (fa *FunctionAnalyzer) loadPackages(cfg *packages.Config, root string, patterns []string, stale map[string]string) error {
+	pkgs, err := packages.Load(cfg, patterns...)
+	if ctxErr := cfg.Context.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err != nil {
+		return fmt.Errorf("error loading packages: %v", err)
+	}
+
+	if !fa.Options.Tolerant {
+		var loadErrors []string
+		packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+			for _, pkgErr := range pkg.Errors {
+				loadErrors = append(loadErrors, pkgErr.Error())
+			}
+		})
+		if len(loadErrors) > 0 {
+			return fmt.Errorf("error loading packages: %s", strings.Join(loadErrors, "; "))
+		}
+	}
+
+	var selected []*packages.Package
+	for _, pkg := range pkgs {
+		if isTestMain(pkg) {
+			continue
+		}
+		if _, ok := stale[pkg.ID]; stale != nil && !ok {
+			continue
+		}
+		if len(pkg.Errors) > 0 {
+			for _, pkgErr := range pkg.Errors {
+				fa.Report.Errors = append(fa.Report.Errors, FileError{Path: pkg.PkgPath, Err: pkgErr})
+			}
+			continue
+		}
+		if !fa.Options.includePackage(pkg.Name, pkg.PkgPath, packageDir(root, pkg)) {
+			fa.Report.FilesSkipped += len(pkg.Syntax)
+			fa.storePackage(stale[pkg.ID], packageCacheEntry{FilesSkipped: len(pkg.Syntax)})
+			continue
+		}
+		selected = append(selected, pkg)
+	}
+
+	schemas := newSchemaBuilder(fa.Schemas, selected)
+	for _, pkg := range selected {
+		functions, declared, bodies, errs := len(fa.Functions), len(fa.types), len(fa.bodies), len(fa.errors)
+		analyzed, skipped := fa.Report.FilesAnalyzed, fa.Report.FilesSkipped
+		if err := fa.analyzePackage(root, pkg, schemas); err != nil {
+			if !fa.Options.Tolerant {
+				return err
+			}
+			fa.Report.Errors = append(fa.Report.Errors, FileError{Path: pkg.PkgPath, Err: err})
+			continue
+		}
+		fa.storePackage(stale[pkg.ID], packageCacheEntry{
+			Functions:     fa.Functions[functions:],
+			Types:         fa.types[declared:],
+			Bodies:        fa.bodies[bodies:],
+			Errors:        fa.errors[errs:],
+			Schemas:       fa.reachableSchemas(fa.Functions[functions:], fa.types[declared:]),
+			FilesAnalyzed: fa.Report.FilesAnalyzed - analyzed,
+			FilesSkipped:  fa.Report.FilesSkipped - skipped,
+		})
+	}
+
+	return nil
+}
+
+func (fa *FunctionAnalyzer) restorePackage(entry packageCacheEntry) {
+	fa.Functions = append(fa.Functions, entry.Functions...)
+	fa.types = append(fa.types, entry.Types...)
+	fa.bodies = append(fa.bodies, entry.Bodies...)
+	fa.errors = append(fa.errors, entry.Errors...)
+	for name, schema := range entry.Schemas {
+		if _, ok := fa.Schemas[name]; !ok {
+			fa.Schemas[name] = schema
+		}
+	}
+	fa.Report.FilesAnalyzed += entry.FilesAnalyzed
+	fa.Report.FilesSkipped += entry.FilesSkipped
+	fa.Report.CacheHits++
+}
+
+func (fa *FunctionAnalyzer) storePackage(key string, entry packageCacheEntry) {
+	if fa.Cache == nil || key == "" {
+		return
+	}
+	// A cache that cannot be written only costs time on the next run.
+	_ = fa.Cache.store(key, entry)
+}
+
+func (fa *FunctionAnalyzer) analyzePackage(root string, pkg *packages.Package, schemas *schemaBuilder) error {
+	// Test variants ("p [p.test]") repeat the files of the package they
+	// extend, so only their _test.go files are new.
+	testVariant := strings.HasSuffix(pkg.ID, ".test]")
+
+	for _, file := range pkg.Syntax {
+		filename := pkg.Fset.File(file.Pos()).Name()
+		if testVariant && !strings.HasSuffix(filename, "_test.go") {
+			continue
+		}
+		rel, err := filepath.Rel(root, filename)
+		if err != nil {
+			rel = filename
+		}
+		if !fa.Options.includeFile(root, rel) || (fa.Options.SkipGenerated && ast.IsGenerated(file)) {
+			fa.Report.FilesSkipped++
+			continue
+		}
+		fa.Report.FilesAnalyzed++
+
+		ctx := fileContext{
+			fset:            pkg.Fset,
+			packageName:     pkg.Name,
+			packagePath:     pkg.PkgPath,
+			buildConstraint: buildConstraint(file),
+		}
+		if pkg.Module != nil {
+			ctx.module = pkg.Module.Path
+		}
+		scanner := newBodyScanner(ctx, file, pkg.TypesInfo)
+		fa.bodies = append(fa.bodies, scanner.scanFile(file)...)
+		fa.errors = append(fa.errors, scanner.declaredErrors(file)...)
+
+		for _, decl := range file.Decls {
+			if genDecl, ok := decl.(*ast.GenDecl); ok {
+				declared, err := fa.analyzeTypeDecl(ctx, genDecl, pkg.TypesInfo, schemas)
+				if err != nil {
+					return err
+				}
+				fa.types = append(fa.types, declared...)
+				continue
+			}
+			funcDecl, ok := decl.(*ast.FuncDecl)
+			if !ok || !fa.Options.includeFunction(funcDecl) {
+				continue
+			}
+
+			funcInfo, err := fa.analyzeFuncDecl(funcDecl)
+			if err != nil {
+				return fmt.Errorf("%s: %v", pkg.Fset.Position(funcDecl.Pos()), err)
+			}
+			if fn, ok := pkg.TypesInfo.Defs[funcDecl.Name].(*types.Func); ok {
+				sig := fn.Type().(*types.Signature)
+				resolveParameters(funcInfo.Parameters, funcDecl.Type.Params, sig.Params(), pkg.TypesInfo, schemas)
+				resolveParameters(funcInfo.Results, funcDecl.Type.Results, sig.Results(), pkg.TypesInfo, schemas)
+				assignRoles(&funcInfo)
+			}
+			ctx.apply(&funcInfo, funcDecl)
+			fa.Functions = append(fa.Functions, funcInfo)
+		}
+	}
+	return nil
+}
+
+// isTestMain reports whether pkg is the synthesized main package of a test
+// binary, which only exists when loading with Tests enabled.
+func isTestMain(pkg *packages.Package) bool {
+	return strings.HasSuffix(pkg.ID, ".test") && pkg.Name == "main"
+}
+
+// packageDir returns the slash-separated directory of pkg relative to root.
+func packageDir(root string, pkg *packages.Package) string {
+	if len(pkg.GoFiles) == 0 {
+		return ""
+	}
+	rel, err := filepath.Rel(root, filepath.Dir(pkg.GoFiles[0]))
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(rel)
+}
+
+// resolveParameters attaches type information to params, which must have been
+// produced by extractFieldList from fieldList, and registers the schemas of
+// the types they refer to.
+func resolveParameters(params []ParameterInfo, fieldList *ast.FieldList, tuple *types.Tuple, info *types.Info, schemas *schemaBuilder) {
+	exprs := fieldTypeExprs(fieldList)
+	for i := range params {
+		if i >= tuple.Len() {
+			return
+		}
+		params[i].Resolved = newTypeInfo(tuple.At(i).Type())
+		schemas.register(tuple.At(i).Type())
+		if i < len(exprs) {
+			markAlias(params[i].Resolved, exprs[i], info)
+		}
+	}
+}
+
+// fieldTypeExprs returns the type expression of every entry of fieldList,
+// repeating shared types so that the result lines up with extractFieldList.
+func fieldTypeExprs(fieldList *ast.FieldList) []ast.Expr {
+	var exprs []ast.Expr
+	if fieldList == nil {
+		return exprs
+	}
+	for _, field := range fieldList.List {
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			exprs = append(exprs, field.Type)
+		}
+	}
+	return exprs
+}
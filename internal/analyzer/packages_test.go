@@ -0,0 +1,142 @@
+package analyzer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeModule lays out files, keyed by slash-separated relative path, in a new
+// temporary directory and returns its path.
+func writeModule(t *testing.T, files map[string]string) string {
+	tempDir, err := ioutil.TempDir("", "test_module")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(tempDir) })
+
+	for name, content := range files {
+		path := filepath.Join(tempDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	return tempDir
+}
+
+func findFunction(t *testing.T, functions []FunctionInfo, name string) FunctionInfo {
+	for _, fn := range functions {
+		if fn.Name == name {
+			return fn
+		}
+	}
+	require.Failf(t, "function not found", "no function named %s", name)
+	return FunctionInfo{}
+}
+
+func TestAnalyzePackages(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod": "module example.com/demo\n\ngo 1.22\n",
+		"models/models.go": `
+			package models
+
+			type User struct {
+				Name string
+			}
+
+			type ID = string
+
+			type Tags []string
+		`,
+		"service.go": `
+			package demo
+
+			import "example.com/demo/models"
+
+			func GetUser(id models.ID) (*models.User, error) {
+				return nil, nil
+			}
+
+			func Index(users map[string][]models.User, tags models.Tags) int {
+				return 0
+			}
+		`,
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+
+	getUser := findFunction(t, analyzer.Functions, "GetUser")
+	require.Len(t, getUser.Parameters, 1)
+	require.Len(t, getUser.Results, 2)
+
+	id := getUser.Parameters[0]
+	assert.Equal(t, "models.ID", id.Type)
+	assert.Equal(t, "string", id.Resolved.QualifiedName)
+	assert.Equal(t, KindBasic, id.Resolved.Kind)
+	assert.True(t, id.Resolved.IsAlias)
+	assert.Equal(t, "example.com/demo/models.ID", id.Resolved.AliasName)
+
+	user := getUser.Results[0].Resolved
+	assert.Equal(t, "*example.com/demo/models.User", user.QualifiedName)
+	assert.Equal(t, KindPointer, user.Kind)
+	require.NotNil(t, user.Elem)
+	assert.True(t, user.Elem.IsNamed)
+	assert.Equal(t, "User", user.Elem.Name)
+	assert.Equal(t, "example.com/demo/models", user.Elem.PkgPath)
+	assert.Equal(t, KindStruct, user.Elem.Kind)
+	assert.Equal(t, "struct{Name string}", user.Elem.Underlying)
+
+	errResult := getUser.Results[1].Resolved
+	assert.True(t, errResult.IsNamed)
+	assert.Equal(t, "error", errResult.Name)
+	assert.Empty(t, errResult.PkgPath)
+	assert.Equal(t, KindInterface, errResult.Kind)
+
+	index := findFunction(t, analyzer.Functions, "Index")
+	users := index.Parameters[0].Resolved
+	assert.Equal(t, KindMap, users.Kind)
+	assert.Equal(t, KindBasic, users.Key.Kind)
+	assert.Equal(t, KindSlice, users.Elem.Kind)
+	assert.Equal(t, "example.com/demo/models.User", users.Elem.Elem.QualifiedName)
+
+	tags := index.Parameters[1].Resolved
+	assert.True(t, tags.IsNamed)
+	assert.Equal(t, KindSlice, tags.Kind)
+	assert.Nil(t, tags.Elem)
+}
+
+func TestAnalyzePackagesReportsLoadErrors(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":    "module example.com/broken\n\ngo 1.22\n",
+		"broken.go": "package broken\n\nfunc Broken() undefinedType { return nil }\n",
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	err := analyzer.AnalyzePackages(dir)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "undefinedType")
+}
+
+func TestAnalyzePackagesContext(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod":       "module example.com/mixed\n\ngo 1.22\n",
+		"server.go":    "package mixed\n\nfunc Serve(addr string) error { return nil }\n",
+		"lib/users.py": "def get_user(user_id: int) -> dict:\n    return {}\n",
+	})
+
+	// The files of other languages are analyzed along with the packages.
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Options = DefaultOptions()
+	analyzer.Languages = DefaultRegistry()
+	require.NoError(t, analyzer.AnalyzePackagesContext(context.Background(), dir))
+	assert.Equal(t, []string{"Serve", "get_user"}, functionNames(analyzer.Functions))
+	assert.NotNil(t, analyzer.Functions[0].Parameters[0].Resolved)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	analyzer = NewFunctionAnalyzer()
+	assert.ErrorIs(t, analyzer.AnalyzePackagesContext(ctx, dir), context.Canceled)
+}
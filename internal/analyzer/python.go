@@ -0,0 +1,383 @@
+package analyzer
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// PythonAnalyzer reads def statements, with their type hints and docstrings,
+// from Python source. It reports module-level functions and the methods of
+// module-level classes; definitions nested in other blocks are left out.
+//
+// Directives go in the comment lines directly above a def or its
+// decorators:
+//
+//	# soft-crusher:method POST
+//	def create_user(name: str) -> User:
+//
+// Unannotated parameters get the type "Any". *args is recorded as "...T"
+// and **kwargs as "dict[str, T]". A function without a return annotation,
+// or annotated "-> None", has no results.
+type PythonAnalyzer struct{}
+
+func (PythonAnalyzer) Language() string { return "python" }
+
+func (PythonAnalyzer) Extensions() []string { return []string{".py", ".pyi"} }
+
+var (
+	pythonDefPattern   = regexp.MustCompile(`^(?:async\s+)?def\s+([A-Za-z_]\w*)\s*`)
+	pythonClassPattern = regexp.MustCompile(`^class\s+([A-Za-z_]\w*)`)
+)
+
+// Decorators whose functions are not callable endpoints.
+var pythonSkippedDecorators = regexp.MustCompile(`^(?:property|(?:typing\.)?overload|\w+\.(?:setter|getter|deleter))$`)
+
+func (pa PythonAnalyzer) AnalyzeSource(path string, src []byte, options Options) ([]FunctionInfo, error) {
+	statements, err := scanPython(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	lines := strings.Split(string(src), "\n")
+
+	module := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if module == "__init__" {
+		module = filepath.Base(filepath.Dir(path))
+	}
+
+	var functions []FunctionInfo
+	var class string
+	classBody := -1
+	var decorators []pythonStatement
+	// open is the index in functions of the def whose body is being read.
+	open, openIndent := -1, 0
+
+	for i, stmt := range statements {
+		if open >= 0 {
+			if stmt.indent > openIndent {
+				functions[open].Source.End = pythonEnd(lines, stmt.end)
+				continue
+			}
+			open = -1
+		}
+
+		switch {
+		case stmt.indent == 0:
+			class, classBody = "", -1
+			if match := pythonClassPattern.FindStringSubmatch(stmt.text); match != nil {
+				class = match[1]
+			}
+		case class != "" && classBody < 0:
+			classBody = stmt.indent
+		}
+
+		if strings.HasPrefix(stmt.text, "@") {
+			decorators = append(decorators, stmt)
+			continue
+		}
+		stmtDecorators := decorators
+		decorators = nil
+
+		match := pythonDefPattern.FindStringSubmatchIndex(stmt.text)
+		if match == nil {
+			continue
+		}
+		inClass := class != "" && stmt.indent == classBody
+		if stmt.indent != 0 && !inClass {
+			continue
+		}
+
+		name := stmt.text[match[2]:match[3]]
+		if options.ExportedOnly && (strings.HasPrefix(name, "_") || (inClass && strings.HasPrefix(class, "_"))) {
+			continue
+		}
+		static, skip := false, false
+		comments := stmt.comments
+		if len(stmtDecorators) > 0 {
+			comments = stmtDecorators[0].comments
+		}
+		for _, decorator := range stmtDecorators {
+			decoratorName := strings.TrimSpace(strings.TrimPrefix(decorator.text, "@"))
+			if i := strings.Index(decoratorName, "("); i >= 0 {
+				decoratorName = decoratorName[:i]
+			}
+			static = static || decoratorName == "staticmethod"
+			skip = skip || pythonSkippedDecorators.MatchString(decoratorName)
+		}
+		if skip {
+			continue
+		}
+
+		funcInfo, body, err := parsePythonDef(name, stmt.text[match[1]:])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, stmt.start, err)
+		}
+		if inClass {
+			funcInfo.IsMethod = true
+			funcInfo.Receiver = class
+			if !static && len(funcInfo.Parameters) > 0 {
+				funcInfo.Parameters = funcInfo.Parameters[1:]
+			}
+		}
+
+		docstring := body
+		if docstring == "" && i+1 < len(statements) && statements[i+1].indent > stmt.indent {
+			docstring = statements[i+1].text
+		}
+		funcInfo.Doc = pythonDocstring(docstring)
+		_, funcInfo.Directives, err = parseCommentLines(comments)
+		if err == nil {
+			err = checkParamDirectives(funcInfo)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, stmt.start, err)
+		}
+
+		funcInfo.Package = module
+		funcInfo.Source = SourceRange{
+			File:  path,
+			Start: Position{Line: stmt.start, Column: stmt.indent + 1},
+			End:   pythonEnd(lines, stmt.end),
+		}
+		functions = append(functions, funcInfo)
+		open, openIndent = len(functions)-1, stmt.indent
+	}
+
+	return functions, nil
+}
+
+// parsePythonDef parses what follows the name in a def statement: type
+// parameters, parameters, the return annotation and the colon. body is any
+// code following the colon on the same logical line.
+func parsePythonDef(name, rest string) (FunctionInfo, string, error) {
+	funcInfo := FunctionInfo{Name: name}
+
+	if strings.HasPrefix(rest, "[") {
+		end := closingBracket(rest, 0)
+		if end < 0 {
+			return funcInfo, "", fmt.Errorf("unterminated type parameters of %s", name)
+		}
+		funcInfo.IsGeneric = true
+		for _, param := range splitTopLevel(rest[1:end], ',') {
+			typeParam := ParameterInfo{Name: param, Type: "Any"}
+			if i := indexTopLevel(param, ':'); i >= 0 {
+				typeParam = ParameterInfo{Name: strings.TrimSpace(param[:i]), Type: strings.TrimSpace(param[i+1:])}
+			}
+			funcInfo.TypeParams = append(funcInfo.TypeParams, typeParam)
+		}
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+
+	if !strings.HasPrefix(rest, "(") {
+		return funcInfo, "", fmt.Errorf("expected ( after def %s", name)
+	}
+	end := closingBracket(rest, 0)
+	if end < 0 {
+		return funcInfo, "", fmt.Errorf("unterminated parameters of %s", name)
+	}
+	for _, param := range splitTopLevel(rest[1:end], ',') {
+		if param == "/" || param == "*" {
+			continue
+		}
+		if i := indexTopLevel(param, '='); i >= 0 {
+			param = strings.TrimSpace(param[:i])
+		}
+		paramName, paramType := param, "Any"
+		if i := indexTopLevel(param, ':'); i >= 0 {
+			paramName, paramType = strings.TrimSpace(param[:i]), strings.TrimSpace(param[i+1:])
+		}
+		switch {
+		case strings.HasPrefix(paramName, "**"):
+			paramName, paramType = paramName[2:], "dict[str, "+paramType+"]"
+		case strings.HasPrefix(paramName, "*"):
+			paramName, paramType = paramName[1:], "..."+paramType
+		}
+		funcInfo.Parameters = append(funcInfo.Parameters, ParameterInfo{Name: paramName, Type: paramType})
+	}
+
+	rest = strings.TrimSpace(rest[end+1:])
+	colon := indexTopLevel(rest, ':')
+	if colon < 0 {
+		return funcInfo, "", fmt.Errorf("expected : after the parameters of %s", name)
+	}
+	if returns, ok := strings.CutPrefix(strings.TrimSpace(rest[:colon]), "->"); ok {
+		if returns = strings.TrimSpace(returns); returns != "None" {
+			funcInfo.Results = []ParameterInfo{{Type: returns}}
+		}
+	}
+	return funcInfo, strings.TrimSpace(rest[colon+1:]), nil
+}
+
+// pythonDocstring returns the text of a string literal statement, cleaned up
+// like inspect.cleandoc, or "" if stmt is not a string literal.
+func pythonDocstring(stmt string) string {
+	literal := strings.TrimLeft(stmt, "rRuU")
+	var quote string
+	for _, q := range []string{`"""`, `'''`, `"`, `'`} {
+		if strings.HasPrefix(literal, q) && strings.HasSuffix(literal, q) && len(literal) >= 2*len(q) {
+			quote = q
+			break
+		}
+	}
+	if quote == "" {
+		return ""
+	}
+
+	lines := strings.Split(literal[len(quote):len(literal)-len(quote)], "\n")
+	indent := -1
+	for _, line := range lines[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" {
+			if n := len(line) - len(trimmed); indent < 0 || n < indent {
+				indent = n
+			}
+		}
+	}
+	lines[0] = strings.TrimSpace(lines[0])
+	for i := 1; i < len(lines); i++ {
+		if len(lines[i]) >= indent && indent > 0 {
+			lines[i] = lines[i][indent:]
+		}
+		lines[i] = strings.TrimRight(lines[i], " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// pythonEnd is the position just after the last character of line, which is
+// 1-based.
+func pythonEnd(lines []string, line int) Position {
+	text := ""
+	if line-1 < len(lines) {
+		text = strings.TrimRight(lines[line-1], " \t\r")
+	}
+	return Position{Line: line, Column: len(text) + 1}
+}
+
+// pythonStatement is one logical line of Python source: continuation lines
+// are joined and comments removed, but string literals are kept verbatim.
+type pythonStatement struct {
+	text   string
+	indent int
+	// start and end are the 1-based lines the statement spans.
+	start, end int
+	// comments holds the text of the comment lines directly above the
+	// statement, without the leading "#".
+	comments []string
+}
+
+// scanPython splits src into logical lines.
+func scanPython(src []byte) ([]pythonStatement, error) {
+	var statements []pythonStatement
+	var comments []string
+	line := 1
+	i := 0
+	for i < len(src) {
+		// Measure the indentation of a new logical line.
+		indent := 0
+		for i < len(src) && (src[i] == ' ' || src[i] == '\t') {
+			if src[i] == '\t' {
+				indent += 8 - indent%8
+			} else {
+				indent++
+			}
+			i++
+		}
+		if i >= len(src) {
+			break
+		}
+		switch src[i] {
+		case '\n':
+			comments = nil
+			line++
+			i++
+			continue
+		case '\r':
+			i++
+			continue
+		case '#':
+			end := i
+			for end < len(src) && src[end] != '\n' {
+				end++
+			}
+			comments = append(comments, strings.TrimRight(string(src[i+1:end]), "\r"))
+			line++
+			i = end + 1
+			continue
+		}
+
+		stmt := pythonStatement{indent: indent, start: line, comments: comments}
+		comments = nil
+		var text strings.Builder
+		depth := 0
+	statement:
+		for i < len(src) {
+			c := src[i]
+			switch {
+			case c == '"' || c == '\'':
+				quote := string(c)
+				if i+2 < len(src) && src[i+1] == c && src[i+2] == c {
+					quote = strings.Repeat(quote, 3)
+				}
+				end := i + len(quote)
+				for {
+					if end >= len(src) {
+						return nil, fmt.Errorf("line %d: unterminated string", stmt.start)
+					}
+					if src[end] == '\\' {
+						end += 2
+						continue
+					}
+					if len(quote) == 1 && src[end] == '\n' {
+						return nil, fmt.Errorf("line %d: unterminated string", line)
+					}
+					if strings.HasPrefix(string(src[end:min(end+len(quote), len(src))]), quote) {
+						end += len(quote)
+						break
+					}
+					end++
+				}
+				literal := string(src[i:end])
+				line += strings.Count(literal, "\n")
+				text.WriteString(literal)
+				i = end
+			case c == '#':
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+			case c == '\\' && i+1 < len(src) && (src[i+1] == '\n' || src[i+1] == '\r'):
+				for i < len(src) && src[i] != '\n' {
+					i++
+				}
+				text.WriteByte(' ')
+				line++
+				i++
+			case c == '\n':
+				if depth == 0 {
+					i++
+					break statement
+				}
+				text.WriteByte(c)
+				line++
+				i++
+			case c == '\r':
+				i++
+			default:
+				switch c {
+				case '(', '[', '{':
+					depth++
+				case ')', ']', '}':
+					depth--
+				}
+				text.WriteByte(c)
+				i++
+			}
+		}
+		stmt.end = line
+		line++
+		stmt.text = strings.TrimSpace(text.String())
+		if stmt.text != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements, nil
+}
@@ -0,0 +1,130 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const pythonSource = `"""Users module."""
+import typing
+
+
+# soft-crusher:method POST
+# soft-crusher:param name query
+def create_user(name: str, age: int = 0, *tags: str, **extra) -> "User":
+    """Create a user.
+
+    The user is stored right away.
+    """
+    if age < 0:
+        raise ValueError("age")
+    return User(name)
+
+
+def _helper(x):
+    return x
+
+
+async def fetch(
+    url: str,  # the address
+    timeout: float = 1.5,
+    *, headers: dict[str, str] = {"a": "(b"},
+) -> bytes: ...
+
+
+def first[T: int](values: list[T]) -> T:
+    return values[0]
+
+
+class User:
+    """A user."""
+
+    def __init__(self, name):
+        self.name = name
+
+    @property
+    def display(self) -> str:
+        return self.name
+
+    @staticmethod
+    def parse(text: str) -> "User":
+        def inner():
+            pass
+        return User(text)
+
+    def rename(self, name: str) -> None:
+        self.name = name
+
+
+class _Private:
+    def method(self):
+        pass
+`
+
+func TestPythonAnalyzer(t *testing.T) {
+	functions, err := PythonAnalyzer{}.AnalyzeSource("pkg/users.py", []byte(pythonSource), DefaultOptions())
+	require.NoError(t, err)
+	require.Equal(t, []string{"create_user", "fetch", "first", "parse", "rename"}, functionNames(functions))
+
+	create := findFunction(t, functions, "create_user")
+	assert.Equal(t, []ParameterInfo{
+		{Name: "name", Type: "str"},
+		{Name: "age", Type: "int"},
+		{Name: "tags", Type: "...str"},
+		{Name: "extra", Type: "dict[str, Any]"},
+	}, create.Parameters)
+	assert.Equal(t, []ParameterInfo{{Type: `"User"`}}, create.Results)
+	assert.Equal(t, "Create a user.\n\nThe user is stored right away.", create.Doc)
+	assert.Equal(t, "POST", create.Directives.Method)
+	assert.Equal(t, map[string]string{"name": "query"}, create.Directives.ParamLocations)
+	assert.Equal(t, "users", create.Package)
+	assert.Equal(t, SourceRange{File: "pkg/users.py", Start: Position{Line: 7, Column: 1}, End: Position{Line: 14, Column: 22}}, create.Source)
+
+	fetch := findFunction(t, functions, "fetch")
+	assert.Equal(t, []ParameterInfo{
+		{Name: "url", Type: "str"},
+		{Name: "timeout", Type: "float"},
+		{Name: "headers", Type: "dict[str, str]"},
+	}, fetch.Parameters)
+	assert.Equal(t, []ParameterInfo{{Type: "bytes"}}, fetch.Results)
+	assert.Equal(t, 21, fetch.Source.Start.Line)
+	assert.Equal(t, 25, fetch.Source.End.Line)
+
+	first := findFunction(t, functions, "first")
+	assert.True(t, first.IsGeneric)
+	assert.Equal(t, []ParameterInfo{{Name: "T", Type: "int"}}, first.TypeParams)
+
+	parse := findFunction(t, functions, "parse")
+	assert.True(t, parse.IsMethod)
+	assert.Equal(t, "User", parse.Receiver)
+	assert.Equal(t, []ParameterInfo{{Name: "text", Type: "str"}}, parse.Parameters)
+	assert.Equal(t, 43, parse.Source.Start.Line)
+	assert.Equal(t, 46, parse.Source.End.Line)
+
+	rename := findFunction(t, functions, "rename")
+	assert.Equal(t, []ParameterInfo{{Name: "name", Type: "str"}}, rename.Parameters)
+	assert.Empty(t, rename.Results)
+
+	functions, err = PythonAnalyzer{}.AnalyzeSource("pkg/users.py", []byte(pythonSource), Options{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"__init__", "_helper", "create_user", "fetch", "first", "method", "parse", "rename"}, functionNames(functions))
+	helper := findFunction(t, functions, "_helper")
+	assert.Equal(t, []ParameterInfo{{Name: "x", Type: "Any"}}, helper.Parameters)
+}
+
+func TestPythonAnalyzerErrors(t *testing.T) {
+	testCases := map[string]string{
+		"unterminated string": "def f():\n    return \"abc\n",
+		"unknown directive":   "# soft-crusher:frobnicate\ndef f():\n    pass\n",
+		"unknown parameter":   "# soft-crusher:param id path\ndef f(name):\n    pass\n",
+	}
+
+	for name, src := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := PythonAnalyzer{}.AnalyzeSource("mod.py", []byte(src), DefaultOptions())
+			assert.Error(t, err)
+		})
+	}
+}
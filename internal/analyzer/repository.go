@@ -0,0 +1,227 @@
+package analyzer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Repository names source code to analyze in a git repository.
+type Repository struct {
+	// URL is anything git clone accepts: a remote URL, a file:// URL or the
+	// path of a local repository, bare or not.
+	URL string
+	// Ref is the branch, tag or commit SHA to check out. Empty means the
+	// repository's default branch.
+	Ref string
+	// Subdir restricts the analysis to a slash-separated directory of the
+	// repository.
+	Subdir string
+}
+
+// RepositoryInfo records which revision of a repository was analyzed.
+type RepositoryInfo struct {
+	URL    string `json:"url" yaml:"url"`
+	Ref    string `json:"ref,omitempty" yaml:"ref,omitempty"`
+	Subdir string `json:"subdir,omitempty" yaml:"subdir,omitempty"`
+	// Commit is the full SHA that Ref resolved to.
+	Commit string `json:"commit" yaml:"commit"`
+}
+
+// AnalyzeRepository clones repo into a temporary workspace, analyzes the
+// checked out files like AnalyzeDirectory and removes the workspace again.
+// Source paths of the functions found are relative to the repository root,
+// and fa.Repository records the commit that was analyzed.
+//
+// git runs without prompting for credentials, without hooks and with
+// symbolic links checked out as plain files, so that nothing in the
+// repository can reach outside the workspace.
+func (fa *FunctionAnalyzer) AnalyzeRepository(ctx context.Context, repo Repository) error {
+	subdir, err := cleanSubdir(repo.Subdir)
+	if err != nil {
+		return err
+	}
+	if err := checkRef(ctx, repo.Ref); err != nil {
+		return err
+	}
+
+	workspace, err := os.MkdirTemp("", "soft-crusher-repo-*")
+	if err != nil {
+		return fmt.Errorf("error creating workspace: %v", err)
+	}
+	defer os.RemoveAll(workspace)
+
+	checkout := filepath.Join(workspace, "src")
+	if err := cloneRepository(ctx, repo, checkout); err != nil {
+		return err
+	}
+	commit, err := runGit(ctx, checkout, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(checkout, filepath.FromSlash(subdir))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("subdirectory %q not found in %s at %s", repo.Subdir, repo.URL, commit)
+	}
+
+	start, declared := len(fa.Functions), len(fa.types)
+	if err := fa.AnalyzeDirectoryContext(ctx, dir); err != nil {
+		return err
+	}
+	relativize := func(source *SourceRange) {
+		if rel, err := filepath.Rel(checkout, source.File); err == nil {
+			source.File = filepath.ToSlash(rel)
+		}
+	}
+	for i := start; i < len(fa.Functions); i++ {
+		relativize(&fa.Functions[i].Source)
+	}
+	for i := declared; i < len(fa.types); i++ {
+		decl := &fa.types[i]
+		relativize(&decl.Source)
+		for j := range decl.Methods {
+			relativize(&decl.Methods[j].Source)
+		}
+	}
+	for i := range fa.Report.Errors {
+		if rel, err := filepath.Rel(checkout, fa.Report.Errors[i].Path); err == nil {
+			fa.Report.Errors[i].Path = filepath.ToSlash(rel)
+		}
+	}
+	fa.link()
+
+	fa.Repository = &RepositoryInfo{
+		URL:    repo.URL,
+		Ref:    repo.Ref,
+		Subdir: subdir,
+		Commit: commit,
+	}
+	return nil
+}
+
+// cleanSubdir validates a repository subdirectory, which must stay inside
+// the repository.
+func cleanSubdir(subdir string) (string, error) {
+	if subdir == "" {
+		return ".", nil
+	}
+	cleaned := filepath.ToSlash(filepath.Clean(filepath.FromSlash(subdir)))
+	if filepath.IsAbs(subdir) || strings.HasPrefix(subdir, "/") || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("subdirectory %q is outside the repository", subdir)
+	}
+	return cleaned, nil
+}
+
+// DefaultRepositoryHosts are the code hosts CheckRepositoryURL accepts when
+// given none.
+var DefaultRepositoryHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// CheckRepositoryURL accepts the https URLs of repositories on hosts, or on
+// DefaultRepositoryHosts when hosts is empty. Servers analyzing the
+// repositories their clients name check them first: git clone also takes
+// local paths and file://, ssh and ext:: URLs, which would let clients read
+// the server's files or run commands.
+func CheckRepositoryURL(raw string, hosts []string) error {
+	if len(hosts) == 0 {
+		hosts = DefaultRepositoryHosts
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Opaque != "" {
+		return fmt.Errorf("repository URL %q is not an https URL", raw)
+	}
+	if u.User != nil {
+		return fmt.Errorf("repository URL %q must not carry credentials", raw)
+	}
+	if u.Port() == "" {
+		for _, host := range hosts {
+			if strings.EqualFold(u.Hostname(), host) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("repository host %s is not allowed, expected one of %s", u.Host, strings.Join(hosts, ", "))
+}
+
+// commitSHA matches full and abbreviated commit SHAs.
+var commitSHA = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+
+// checkRef validates a ref to check out: a commit SHA, or a branch or tag
+// name git accepts. Options such as --upload-pack are rejected.
+func checkRef(ctx context.Context, ref string) error {
+	if ref == "" || commitSHA.MatchString(ref) {
+		return nil
+	}
+	if !strings.HasPrefix(ref, "-") {
+		if _, err := runGit(ctx, "", "check-ref-format", "--allow-onelevel", ref); err == nil {
+			return nil
+		} else if ctx.Err() != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("invalid ref %q", ref)
+}
+
+// cloneRepository checks repo out into dir. Branches and tags, and the
+// default branch, are fetched shallowly; a commit SHA needs the full
+// history.
+func cloneRepository(ctx context.Context, repo Repository, dir string) error {
+	if strings.HasPrefix(repo.URL, "-") {
+		return fmt.Errorf("invalid repository URL %q", repo.URL)
+	}
+
+	shallow := []string{"clone", "--quiet", "--depth", "1", "--no-local"}
+	if repo.Ref != "" {
+		shallow = append(shallow, "--branch", repo.Ref)
+	}
+	if _, err := runGit(ctx, "", append(shallow, "--", repo.URL, dir)...); err == nil {
+		return nil
+	} else if !commitSHA.MatchString(repo.Ref) || ctx.Err() != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if _, err := runGit(ctx, "", "clone", "--quiet", "--no-checkout", "--", repo.URL, dir); err != nil {
+		return err
+	}
+	// git checkout misreads --end-of-options, so the commit is resolved first.
+	commit, err := runGit(ctx, dir, "rev-parse", "--verify", "--quiet", "--end-of-options", repo.Ref+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("unknown commit %q", repo.Ref)
+	}
+	_, err = runGit(ctx, dir, "checkout", "--quiet", "--detach", commit, "--")
+	return err
+}
+
+// runGit runs git with the given arguments in dir and returns its trimmed
+// output.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	config := []string{
+		"-c", "core.symlinks=false",
+		"-c", "core.hooksPath=" + os.DevNull,
+		"-c", "protocol.ext.allow=never",
+		"-c", "advice.detachedHead=false",
+	}
+	cmd := exec.CommandContext(ctx, "git", append(config, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_TEMPLATE_DIR=")
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return "", ctxErr
+		}
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,164 @@
+package analyzer
+
+import "strings"
+
+// Role marks a parameter or result that is not plain data: the transport
+// supplies or consumes it rather than the request or response body.
+type Role string
+
+const (
+	// RoleContext is a leading context.Context parameter, to be filled from
+	// the request.
+	RoleContext Role = "context"
+	// RoleError is a trailing error result, to be mapped to a status code.
+	RoleError Role = "error"
+	// RoleReader is a parameter streaming the request body in.
+	RoleReader Role = "reader"
+	// RoleWriter is a parameter streaming the response body out.
+	RoleWriter Role = "writer"
+	// RoleOptions is a trailing options struct, or variadic functional
+	// options, whose fields are all optional.
+	RoleOptions Role = "options"
+	// RoleStream is a leading channel or iter.Seq result, whose values are
+	// sent to the client one by one as the function yields them.
+	RoleStream Role = "stream"
+)
+
+var readerTypes = map[string]bool{
+	"io.Reader":           true,
+	"io.ReadCloser":       true,
+	"io.ReadSeeker":       true,
+	"io.ReadSeekCloser":   true,
+	"io.ReaderAt":         true,
+	"mime/multipart.File": true,
+}
+
+var writerTypes = map[string]bool{
+	"io.Writer":               true,
+	"io.WriteCloser":          true,
+	"io.WriterAt":             true,
+	"net/http.ResponseWriter": true,
+}
+
+// assignRoles sets the Role of the parameters and results of fn from their
+// types, preferring the resolved ones, which see through import names and
+// aliases.
+func assignRoles(fn *FunctionInfo) {
+	for i := range fn.Parameters {
+		param := &fn.Parameters[i]
+		param.Role = ""
+		typeName := roleTypeName(*param)
+		switch {
+		case i == 0 && typeName == "context.Context":
+			param.Role = RoleContext
+		case readerTypes[typeName]:
+			param.Role = RoleReader
+		case writerTypes[typeName]:
+			param.Role = RoleWriter
+		case i == len(fn.Parameters)-1 && isOptions(*param):
+			param.Role = RoleOptions
+		}
+	}
+	for i := range fn.Results {
+		result := &fn.Results[i]
+		result.Role = ""
+		switch {
+		case i == len(fn.Results)-1 && roleTypeName(*result) == "error":
+			result.Role = RoleError
+		case i == 0 && StreamElem(*result) != "":
+			result.Role = RoleStream
+		}
+	}
+}
+
+// roleTypeName returns the qualified type of param when it was resolved,
+// and otherwise its type as written, where the package name of the standard
+// packages involved is usually also their path.
+func roleTypeName(param ParameterInfo) string {
+	if param.Resolved != nil {
+		return param.Resolved.QualifiedName
+	}
+	if param.Type == "http.ResponseWriter" {
+		return "net/http.ResponseWriter"
+	}
+	if param.Type == "multipart.File" {
+		return "mime/multipart.File"
+	}
+	return param.Type
+}
+
+// StreamElem returns the type of the values streamed by result, as written,
+// when result is a channel that can be received from or an iter.Seq, and
+// otherwise "". The resolved type, when known, must agree: it sees through
+// import names, and tells a named channel type apart from its written name.
+func StreamElem(result ParameterInfo) string {
+	elem := ""
+	if rest, ok := strings.CutPrefix(result.Type, "<-chan "); ok {
+		elem = rest
+	} else if rest, ok := strings.CutPrefix(result.Type, "chan "); ok {
+		elem = rest
+	} else if open := strings.Index(result.Type, ".Seq["); open > 0 && strings.HasSuffix(result.Type, "]") {
+		// A comma at the top level would make it an iter.Seq2.
+		elem = result.Type[open+len(".Seq[") : len(result.Type)-1]
+		if topLevelComma(elem) || (result.Resolved == nil && result.Type[:open] != "iter") {
+			elem = ""
+		}
+	}
+	if elem == "" || result.Resolved == nil {
+		return elem
+	}
+	resolved := result.Resolved
+	switch {
+	case resolved.PkgPath == "iter" && resolved.Name == "Seq":
+		if strings.Contains(result.Type, "chan ") {
+			return ""
+		}
+	case resolved.Kind == KindChan && !resolved.IsNamed:
+		if strings.HasPrefix(resolved.QualifiedName, "chan<-") || strings.Contains(result.Type, ".Seq[") {
+			return ""
+		}
+	default:
+		return ""
+	}
+	return elem
+}
+
+// topLevelComma reports whether typeName has a comma outside of brackets,
+// parentheses and braces.
+func topLevelComma(typeName string) bool {
+	depth := 0
+	for _, r := range typeName {
+		switch r {
+		case '[', '(', '{':
+			depth++
+		case ']', ')', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isOptions reports whether param is an options struct, by the convention
+// of naming them FooOptions or FooOpts, or variadic functional options.
+func isOptions(param ParameterInfo) bool {
+	typeName := param.Type
+	if variadic, ok := strings.CutPrefix(typeName, "..."); ok {
+		return strings.HasSuffix(variadic, "Option") || strings.HasSuffix(variadic, "Opt")
+	}
+	typeName = strings.TrimPrefix(typeName, "*")
+	if !strings.HasSuffix(typeName, "Options") && !strings.HasSuffix(typeName, "Opts") {
+		return false
+	}
+	// Type information tells structs apart from, say, a bit set.
+	if resolved := param.Resolved; resolved != nil {
+		if resolved.Elem != nil {
+			resolved = resolved.Elem
+		}
+		return resolved.Kind == KindStruct
+	}
+	return true
+}
@@ -0,0 +1,154 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var roleModule = map[string]string{
+	"go.mod": "module example.com/files\n\ngo 1.23\n",
+	"files/files.go": `
+		package files
+
+		import (
+			stdctx "context"
+			"context"
+			"io"
+			"iter"
+			it "iter"
+			"net/http"
+		)
+
+		type UploadOptions struct {
+			Overwrite bool
+		}
+
+		// Mode is a bit set, not an options struct.
+		type Mode uint8
+
+		type ModeOptions = Mode
+
+		type Option func(*UploadOptions)
+
+		func Upload(ctx context.Context, name string, body io.Reader, opts *UploadOptions) (int64, error) {
+			return 0, nil
+		}
+
+		func Download(ctx stdctx.Context, name string, w http.ResponseWriter) error {
+			return nil
+		}
+
+		func Configure(name string, opts ...Option) {}
+
+		func Chmod(name string, mode ModeOptions) {}
+
+		type Event struct {
+			Name string
+		}
+
+		// Feed is a named channel, not written as one.
+		type Feed <-chan Event
+
+		func Watch(ctx context.Context, prefix string) (<-chan Event, error) {
+			return nil, nil
+		}
+
+		func Replay(since int) it.Seq[Event] {
+			return nil
+		}
+
+		func History() iter.Seq[map[string]int] {
+			return nil
+		}
+
+		func Subscribe() Feed {
+			return nil
+		}
+
+		func Pairs() iter.Seq2[string, int] {
+			return nil
+		}
+
+		func Sink() (error, chan<- Event) {
+			return nil, nil
+		}
+
+		// Later only treats a leading context as the request's.
+		func Later(name string, ctx context.Context) (error, bool) {
+			return nil, false
+		}
+	`,
+}
+
+func parameterRoles(params []ParameterInfo) []Role {
+	roles := make([]Role, len(params))
+	for i, param := range params {
+		roles[i] = param.Role
+	}
+	return roles
+}
+
+func TestAnalyzeDirectoryRoles(t *testing.T) {
+	dir := writeModule(t, roleModule)
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+
+	upload := findFunction(t, analyzer.Functions, "Upload")
+	assert.Equal(t, []Role{RoleContext, "", RoleReader, RoleOptions}, parameterRoles(upload.Parameters))
+	assert.Equal(t, []Role{"", RoleError}, parameterRoles(upload.Results))
+
+	configure := findFunction(t, analyzer.Functions, "Configure")
+	assert.Equal(t, []Role{"", RoleOptions}, parameterRoles(configure.Parameters))
+
+	later := findFunction(t, analyzer.Functions, "Later")
+	assert.Equal(t, []Role{"", ""}, parameterRoles(later.Parameters))
+	assert.Equal(t, []Role{"", ""}, parameterRoles(later.Results))
+
+	// Without type information, a renamed import hides the context, and the
+	// name of ModeOptions passes for an options struct.
+	download := findFunction(t, analyzer.Functions, "Download")
+	assert.Equal(t, []Role{"", "", RoleWriter}, parameterRoles(download.Parameters))
+	chmod := findFunction(t, analyzer.Functions, "Chmod")
+	assert.Equal(t, []Role{"", RoleOptions}, parameterRoles(chmod.Parameters))
+
+	// Nor is an iter.Seq under another import name recognised.
+	watch := findFunction(t, analyzer.Functions, "Watch")
+	assert.Equal(t, []Role{RoleStream, RoleError}, parameterRoles(watch.Results))
+	assert.Equal(t, "Event", StreamElem(watch.Results[0]))
+	history := findFunction(t, analyzer.Functions, "History")
+	assert.Equal(t, "map[string]int", StreamElem(history.Results[0]))
+	for _, name := range []string{"Replay", "Subscribe", "Pairs", "Sink"} {
+		fn := findFunction(t, analyzer.Functions, name)
+		assert.NotContains(t, parameterRoles(fn.Results), RoleStream, name)
+	}
+}
+
+func TestAnalyzePackagesRoles(t *testing.T) {
+	dir := writeModule(t, roleModule)
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+
+	upload := findFunction(t, analyzer.Functions, "Upload")
+	assert.Equal(t, []Role{RoleContext, "", RoleReader, RoleOptions}, parameterRoles(upload.Parameters))
+
+	download := findFunction(t, analyzer.Functions, "Download")
+	assert.Equal(t, []Role{RoleContext, "", RoleWriter}, parameterRoles(download.Parameters))
+	assert.Equal(t, []Role{RoleError}, parameterRoles(download.Results))
+
+	chmod := findFunction(t, analyzer.Functions, "Chmod")
+	assert.Equal(t, []Role{"", ""}, parameterRoles(chmod.Parameters))
+
+	watch := findFunction(t, analyzer.Functions, "Watch")
+	assert.Equal(t, []Role{RoleStream, RoleError}, parameterRoles(watch.Results))
+	replay := findFunction(t, analyzer.Functions, "Replay")
+	assert.Equal(t, []Role{RoleStream}, parameterRoles(replay.Results))
+	assert.Equal(t, "Event", StreamElem(replay.Results[0]))
+	for _, name := range []string{"Subscribe", "Pairs", "Sink"} {
+		fn := findFunction(t, analyzer.Functions, name)
+		assert.NotContains(t, parameterRoles(fn.Results), RoleStream, name)
+	}
+}
@@ -0,0 +1,224 @@
+package analyzer
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RiskCategory names a kind of behaviour that makes a function dangerous to
+// expose over the network.
+type RiskCategory string
+
+const (
+	RiskExec       RiskCategory = "exec"       // runs other programs
+	RiskProcess    RiskCategory = "process"    // exits or alters the process, or makes system calls
+	RiskUnsafe     RiskCategory = "unsafe"     // uses unsafe or cgo
+	RiskFilesystem RiskCategory = "filesystem" // reads or writes files
+	RiskNetwork    RiskCategory = "network"    // opens connections or listens
+	RiskGoroutine  RiskCategory = "goroutine"  // starts goroutines
+	RiskStream     RiskCategory = "stream"     // takes an io.Reader or io.Writer
+	RiskCallback   RiskCategory = "callback"   // takes a function or a channel
+)
+
+// riskWeights is what each category adds to a function's RiskScore.
+var riskWeights = map[RiskCategory]int{
+	RiskExec:       60,
+	RiskProcess:    40,
+	RiskUnsafe:     40,
+	RiskFilesystem: 30,
+	RiskNetwork:    25,
+	RiskGoroutine:  20,
+	RiskCallback:   20,
+	RiskStream:     15,
+}
+
+// HighRiskScore is the RiskScore from which a function is only exposed
+// after an explicit opt-in.
+const HighRiskScore = 50
+
+// Risk is one reason for a function to be considered dangerous.
+type Risk struct {
+	Category RiskCategory `json:"category" yaml:"category"`
+	// Reason describes the finding, e.g. "calls os/exec.Command".
+	Reason string `json:"reason" yaml:"reason"`
+	// Position is where in the function's file the finding was made; it is
+	// zero for findings about parameters.
+	Position Position `json:"position,omitempty" yaml:"position,omitempty"`
+	// Via is the qualified name of the function called at Position that the
+	// risk was inherited from, if any.
+	Via string `json:"via,omitempty" yaml:"via,omitempty"`
+}
+
+// RiskLevel buckets a RiskScore into "none", "low", "medium" or "high".
+func RiskLevel(score int) string {
+	switch {
+	case score <= 0:
+		return "none"
+	case score < 25:
+		return "low"
+	case score < HighRiskScore:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// riskRule maps calls into pkg to a category. names lists the functions, and
+// methods written "Type.Method", concerned; a trailing "*" matches any
+// suffix, and an empty list every name.
+type riskRule struct {
+	pkg      string
+	names    []string
+	category RiskCategory
+}
+
+// riskRules are checked in order and the first match wins.
+var riskRules = []riskRule{
+	{"os/exec", nil, RiskExec},
+	{"os", []string{"StartProcess", "Process.*"}, RiskExec},
+	{"syscall", []string{"Exec", "ForkExec", "StartProcess"}, RiskExec},
+	{"plugin", nil, RiskExec},
+	{"os", []string{"Exit", "Setenv", "Unsetenv", "Clearenv", "Chdir"}, RiskProcess},
+	{"log", []string{"Fatal*", "Logger.Fatal*"}, RiskProcess},
+	{"syscall", nil, RiskProcess},
+	{"golang.org/x/sys/unix", nil, RiskProcess},
+	{"golang.org/x/sys/windows", nil, RiskProcess},
+	{"unsafe", nil, RiskUnsafe},
+	{"C", nil, RiskUnsafe},
+	{"os", []string{
+		"Open", "OpenFile", "Create", "CreateTemp", "MkdirTemp", "Mkdir", "MkdirAll",
+		"Remove", "RemoveAll", "Rename", "ReadFile", "WriteFile", "ReadDir",
+		"Chmod", "Chown", "Lchown", "Chtimes", "Link", "Symlink", "Truncate",
+		"DirFS", "CopyFS", "File.*",
+	}, RiskFilesystem},
+	{"io/ioutil", []string{"ReadFile", "WriteFile", "ReadDir", "TempFile", "TempDir"}, RiskFilesystem},
+	{"path/filepath", []string{"Walk", "WalkDir", "Glob", "EvalSymlinks"}, RiskFilesystem},
+	{"net", []string{"Dial*", "Listen*", "Lookup*", "Dialer.*", "ListenConfig.*", "Resolver.*"}, RiskNetwork},
+	{"net/http", []string{"Get", "Head", "Post", "PostForm", "ListenAndServe*", "Serve*", "Client.*", "Server.*"}, RiskNetwork},
+	{"net/rpc", nil, RiskNetwork},
+	{"net/smtp", nil, RiskNetwork},
+}
+
+// Parameter types that stream data rather than carry a value.
+var streamTypes = map[string]bool{
+	"io.Reader":      true,
+	"io.ReadCloser":  true,
+	"io.ReadSeeker":  true,
+	"io.ReaderAt":    true,
+	"io.ReadWriter":  true,
+	"io.Writer":      true,
+	"io.WriteCloser": true,
+	"io.WriterAt":    true,
+	"*os.File":       true,
+	"net.Conn":       true,
+}
+
+// classifyCall returns the category of calling name in package pkg.
+func classifyCall(pkg, name string) (RiskCategory, bool) {
+	for _, rule := range riskRules {
+		if rule.pkg == pkg && matchNames(rule.names, name) {
+			return rule.category, true
+		}
+	}
+	return "", false
+}
+
+// parameterRisks flags parameters that cannot be sent over the network as
+// plain values.
+func parameterRisks(fn FunctionInfo) []Risk {
+	var risks []Risk
+	for _, param := range fn.Parameters {
+		paramType := strings.TrimPrefix(param.Type, "...")
+		switch {
+		case streamTypes[paramType]:
+			risks = append(risks, Risk{Category: RiskStream, Reason: fmt.Sprintf("parameter %s is a %s", param.Name, paramType)})
+		case strings.HasPrefix(paramType, "func("):
+			risks = append(risks, Risk{Category: RiskCallback, Reason: fmt.Sprintf("parameter %s is a function", param.Name)})
+		case strings.HasPrefix(paramType, "chan ") || strings.HasPrefix(paramType, "<-chan ") || strings.HasPrefix(paramType, "chan<- "):
+			risks = append(risks, Risk{Category: RiskCallback, Reason: fmt.Sprintf("parameter %s is a channel", param.Name)})
+		}
+	}
+	return risks
+}
+
+// riskScore adds up the weights of the distinct categories of risks, up to
+// 100.
+func riskScore(risks []Risk) int {
+	seen := make(map[RiskCategory]bool)
+	score := 0
+	for _, risk := range risks {
+		if !seen[risk.Category] {
+			seen[risk.Category] = true
+			score += riskWeights[risk.Category]
+		}
+	}
+	return min(score, 100)
+}
+
+// linkRisks sets the Risks and RiskScore of every Go function recorded, from
+// its own body, the bodies of the functions it calls, transitively, and its
+// parameters.
+func (fa *FunctionAnalyzer) linkRisks() {
+	if len(fa.bodies) == 0 {
+		return
+	}
+	summaries := make(map[string]*bodySummary)
+	var names []string
+	for _, body := range fa.bodies {
+		summary := summaries[body.Function]
+		if summary == nil {
+			summary = &bodySummary{Function: body.Function}
+			summaries[body.Function] = summary
+			names = append(names, body.Function)
+		}
+		// Variants of a function for different build constraints add up.
+		summary.Risks = append(summary.Risks, body.Risks...)
+		summary.Calls = append(summary.Calls, body.Calls...)
+	}
+	sort.Strings(names)
+
+	risks := make(map[string][]Risk)
+	seen := make(map[string]map[string]bool)
+	add := func(function string, risk Risk) bool {
+		if seen[function] == nil {
+			seen[function] = make(map[string]bool)
+		}
+		key := string(risk.Category) + " " + risk.Reason
+		if seen[function][key] {
+			return false
+		}
+		seen[function][key] = true
+		risks[function] = append(risks[function], risk)
+		return true
+	}
+	for _, name := range names {
+		for _, risk := range summaries[name].Risks {
+			add(name, risk)
+		}
+	}
+	// Propagate to callers until nothing changes; cycles end because every
+	// risk is added to a function at most once.
+	for changed := true; changed; {
+		changed = false
+		for _, name := range names {
+			for _, call := range summaries[name].Calls {
+				for _, risk := range risks[call.Function] {
+					inherited := Risk{Category: risk.Category, Reason: risk.Reason, Position: call.Position, Via: call.Function}
+					if add(name, inherited) {
+						changed = true
+					}
+				}
+			}
+		}
+	}
+
+	for i := range fa.Functions {
+		fn := &fa.Functions[i]
+		if fn.Language != LanguageGo {
+			continue
+		}
+		fn.Risks = append(parameterRisks(*fn), risks[fn.QualifiedName()]...)
+		fn.RiskScore = riskScore(fn.Risks)
+	}
+}
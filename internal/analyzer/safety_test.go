@@ -0,0 +1,167 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var riskyModule = map[string]string{
+	"go.mod": "module example.com/tools\n\ngo 1.22\n",
+	"run/run.go": `
+		package run
+
+		import (
+			"io"
+			osexec "os/exec"
+		)
+
+		// Run runs a command through a helper.
+		func Run(name string) error {
+			return start(name)
+		}
+
+		func start(name string) error {
+			return osexec.Command(name).Run()
+		}
+
+		// Copy streams r to w.
+		func Copy(w io.Writer, r io.Reader) error {
+			_, err := io.Copy(w, r)
+			return err
+		}
+
+		// Fan starts a goroutine per item.
+		func Fan(items []string) {
+			for range items {
+				go func() {}()
+			}
+		}
+
+		// Shadowed calls a local variable named like a package.
+		func Shadowed() {
+			os := struct{ Exit func(int) }{Exit: func(int) {}}
+			os.Exit(1)
+		}
+
+		func Add(a, b int) int {
+			return a + b
+		}
+	`,
+	"run/files.go": `
+		package run
+
+		import "os"
+
+		// Save writes a file and calls Run from another file.
+		func Save(path string, data []byte) error {
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				return err
+			}
+			return Run("sync")
+		}
+	`,
+}
+
+func TestAnalyzeDirectoryRisks(t *testing.T) {
+	dir := writeModule(t, riskyModule)
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+
+	run := findFunction(t, analyzer.Functions, "Run")
+	assert.Equal(t, []Risk{{
+		Category: RiskExec,
+		Reason:   "calls os/exec.Command",
+		Position: Position{Line: 11, Column: 11},
+		Via:      "example.com/tools/run.start",
+	}}, run.Risks)
+	assert.Equal(t, 60, run.RiskScore)
+	assert.Equal(t, "high", RiskLevel(run.RiskScore))
+
+	save := findFunction(t, analyzer.Functions, "Save")
+	assert.Equal(t, []RiskCategory{RiskFilesystem, RiskExec}, riskCategories(save.Risks))
+	assert.Equal(t, "example.com/tools/run.Run", save.Risks[1].Via)
+	assert.Equal(t, 90, save.RiskScore)
+
+	copy := findFunction(t, analyzer.Functions, "Copy")
+	assert.Equal(t, []RiskCategory{RiskStream, RiskStream}, riskCategories(copy.Risks))
+	assert.Equal(t, "parameter w is a io.Writer", copy.Risks[0].Reason)
+	assert.Equal(t, 15, copy.RiskScore)
+	assert.Equal(t, "low", RiskLevel(copy.RiskScore))
+
+	fan := findFunction(t, analyzer.Functions, "Fan")
+	require.Len(t, fan.Risks, 1)
+	assert.Equal(t, "starts goroutines in a loop", fan.Risks[0].Reason)
+
+	assert.Empty(t, findFunction(t, analyzer.Functions, "Shadowed").Risks)
+	assert.Empty(t, findFunction(t, analyzer.Functions, "Add").Risks)
+}
+
+func TestAnalyzePackagesRisks(t *testing.T) {
+	files := map[string]string{
+		"store/store.go": `
+			package store
+
+			import (
+				"os"
+				"unsafe"
+			)
+
+			type Store struct {
+				file *os.File
+			}
+
+			// Append writes through a method of *os.File, which only type
+			// information reveals.
+			func (s *Store) Append(data []byte) error {
+				_, err := s.file.Write(data)
+				return err
+			}
+
+			func Size(v int) uintptr {
+				return unsafe.Sizeof(v)
+			}
+		`,
+	}
+	for name, content := range riskyModule {
+		files[name] = content
+	}
+	dir := writeModule(t, files)
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Cache = NewCache(t.TempDir())
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+
+	appendFn := findFunction(t, analyzer.Functions, "Append")
+	require.Len(t, appendFn.Risks, 1)
+	assert.Equal(t, "calls os.File.Write", appendFn.Risks[0].Reason)
+	assert.Equal(t, []RiskCategory{RiskUnsafe}, riskCategories(findFunction(t, analyzer.Functions, "Size").Risks))
+	assert.Equal(t, 60, findFunction(t, analyzer.Functions, "Run").RiskScore)
+
+	// Risks survive the cache.
+	cached := NewFunctionAnalyzer()
+	cached.Cache = analyzer.Cache
+	require.NoError(t, cached.AnalyzePackages(dir))
+	assert.Equal(t, analyzer.Functions, cached.Functions)
+}
+
+func TestParameterRisks(t *testing.T) {
+	risks := parameterRisks(FunctionInfo{Parameters: []ParameterInfo{
+		{Name: "done", Type: "<-chan struct{}"},
+		{Name: "visit", Type: "func(string) error"},
+		{Name: "files", Type: "...*os.File"},
+		{Name: "name", Type: "string"},
+	}})
+	assert.Equal(t, []RiskCategory{RiskCallback, RiskCallback, RiskStream}, riskCategories(risks))
+	assert.Equal(t, 35, riskScore(risks))
+}
+
+func riskCategories(risks []Risk) []RiskCategory {
+	categories := make([]RiskCategory, len(risks))
+	for i, risk := range risks {
+		categories[i] = risk.Category
+	}
+	return categories
+}
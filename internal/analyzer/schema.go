@@ -0,0 +1,251 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// TypeSchema describes a named type reachable from an analyzed signature.
+// Schemas are stored in FunctionAnalyzer.Schemas keyed by Name, which matches
+// the QualifiedName of every TypeInfo referring to the type.
+type TypeSchema struct {
+	Name     string `json:"name" yaml:"name"`
+	TypeName string `json:"typeName,omitempty" yaml:"typeName,omitempty"`
+	PkgPath  string `json:"pkgPath,omitempty" yaml:"pkgPath,omitempty"`
+	Kind     string `json:"kind" yaml:"kind"`
+	Doc      string `json:"doc,omitempty" yaml:"doc,omitempty"`
+	// Fields lists the JSON-visible fields of a struct, in declaration order.
+	Fields []FieldSchema `json:"fields,omitempty" yaml:"fields,omitempty"`
+	// Elem and Key describe the components of named slice, array, map,
+	// channel and pointer types.
+	Elem *TypeInfo `json:"elem,omitempty" yaml:"elem,omitempty"`
+	Key  *TypeInfo `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// FieldSchema describes one struct field. Unexported fields and fields
+// tagged `json:"-"` are not recorded, except for embedded structs whose
+// exported fields are promoted.
+type FieldSchema struct {
+	Name      string    `json:"name" yaml:"name"`
+	Type      *TypeInfo `json:"type" yaml:"type"`
+	Embedded  bool      `json:"embedded,omitempty" yaml:"embedded,omitempty"`
+	JSONName  string    `json:"jsonName,omitempty" yaml:"jsonName,omitempty"`
+	OmitEmpty bool      `json:"omitEmpty,omitempty" yaml:"omitEmpty,omitempty"`
+	Validate  string    `json:"validate,omitempty" yaml:"validate,omitempty"`
+	Tag       string    `json:"tag,omitempty" yaml:"tag,omitempty"`
+	Doc       string    `json:"doc,omitempty" yaml:"doc,omitempty"`
+}
+
+// Required reports whether the field carries a `validate:"required"` rule.
+func (f FieldSchema) Required() bool {
+	for _, rule := range strings.Split(f.Validate, ",") {
+		if rule == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+// SchemaFor returns the schema of the named type ti refers to, looking through
+// pointers, or nil if there is none.
+func (fa *FunctionAnalyzer) SchemaFor(ti *TypeInfo) *TypeSchema {
+	for ti != nil && !ti.IsNamed && ti.Kind == KindPointer {
+		ti = ti.Elem
+	}
+	if ti == nil || !ti.IsNamed {
+		return nil
+	}
+	return fa.Schemas[ti.QualifiedName]
+}
+
+// schemaBuilder walks types reachable from signatures and records a schema
+// for every named type it meets.
+type schemaBuilder struct {
+	schemas map[string]*TypeSchema
+	docs    map[token.Pos]string
+}
+
+func newSchemaBuilder(schemas map[string]*TypeSchema, pkgs []*packages.Package) *schemaBuilder {
+	sb := &schemaBuilder{
+		schemas: schemas,
+		docs:    make(map[token.Pos]string),
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		for _, file := range pkg.Syntax {
+			sb.indexDocs(file)
+		}
+	})
+	return sb
+}
+
+// indexDocs records the doc comments of type declarations and struct fields
+// by the position go/types reports for the corresponding object.
+func (sb *schemaBuilder) indexDocs(file *ast.File) {
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.GenDecl:
+			if x.Tok != token.TYPE {
+				return true
+			}
+			for _, spec := range x.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				doc := typeSpec.Doc
+				if doc == nil && len(x.Specs) == 1 {
+					doc = x.Doc
+				}
+				if doc != nil {
+					sb.docs[typeSpec.Name.Pos()] = strings.TrimSpace(doc.Text())
+				}
+			}
+		case *ast.StructType:
+			for _, field := range x.Fields.List {
+				doc := field.Doc
+				if doc == nil {
+					doc = field.Comment
+				}
+				if doc == nil {
+					continue
+				}
+				text := strings.TrimSpace(doc.Text())
+				if len(field.Names) == 0 {
+					if ident := embeddedIdent(field.Type); ident != nil {
+						sb.docs[ident.Pos()] = text
+					}
+				}
+				for _, name := range field.Names {
+					sb.docs[name.Pos()] = text
+				}
+			}
+		}
+		return true
+	})
+}
+
+func embeddedIdent(expr ast.Expr) *ast.Ident {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e
+	case *ast.StarExpr:
+		return embeddedIdent(e.X)
+	case *ast.SelectorExpr:
+		return e.Sel
+	case *ast.IndexExpr:
+		return embeddedIdent(e.X)
+	case *ast.IndexListExpr:
+		return embeddedIdent(e.X)
+	}
+	return nil
+}
+
+// register records schemas for t and every named type reachable from it.
+func (sb *schemaBuilder) register(t types.Type) {
+	t = types.Unalias(t)
+	switch t := t.(type) {
+	case *types.Named:
+		sb.registerNamed(t)
+	case *types.Pointer:
+		sb.register(t.Elem())
+	case *types.Slice:
+		sb.register(t.Elem())
+	case *types.Array:
+		sb.register(t.Elem())
+	case *types.Chan:
+		sb.register(t.Elem())
+	case *types.Map:
+		sb.register(t.Key())
+		sb.register(t.Elem())
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			sb.register(t.Field(i).Type())
+		}
+	}
+}
+
+func (sb *schemaBuilder) registerNamed(named *types.Named) {
+	obj := named.Obj()
+	if obj.Pkg() == nil {
+		// Predeclared types such as error have nothing to describe.
+		return
+	}
+
+	name := types.TypeString(named, nil)
+	if _, ok := sb.schemas[name]; ok {
+		return
+	}
+
+	schema := &TypeSchema{
+		Name:     name,
+		TypeName: obj.Name(),
+		PkgPath:  obj.Pkg().Path(),
+		Kind:     kindOf(named.Underlying()),
+		Doc:      sb.docs[obj.Pos()],
+	}
+	// Register before descending so that recursive types terminate.
+	sb.schemas[name] = schema
+
+	switch u := named.Underlying().(type) {
+	case *types.Struct:
+		schema.Fields = sb.structFields(u)
+	case *types.Pointer:
+		schema.Elem = newTypeInfo(u.Elem())
+		sb.register(u.Elem())
+	case *types.Slice:
+		schema.Elem = newTypeInfo(u.Elem())
+		sb.register(u.Elem())
+	case *types.Array:
+		schema.Elem = newTypeInfo(u.Elem())
+		sb.register(u.Elem())
+	case *types.Chan:
+		schema.Elem = newTypeInfo(u.Elem())
+		sb.register(u.Elem())
+	case *types.Map:
+		schema.Key = newTypeInfo(u.Key())
+		schema.Elem = newTypeInfo(u.Elem())
+		sb.register(u.Key())
+		sb.register(u.Elem())
+	}
+}
+
+func (sb *schemaBuilder) structFields(st *types.Struct) []FieldSchema {
+	var fields []FieldSchema
+	for i := 0; i < st.NumFields(); i++ {
+		v := st.Field(i)
+		if !v.Exported() && !v.Embedded() {
+			continue
+		}
+
+		tag := reflect.StructTag(st.Tag(i))
+		field := FieldSchema{
+			Name:     v.Name(),
+			Type:     newTypeInfo(v.Type()),
+			Embedded: v.Embedded(),
+			JSONName: v.Name(),
+			Validate: tag.Get("validate"),
+			Tag:      st.Tag(i),
+			Doc:      sb.docs[v.Pos()],
+		}
+		if jsonTag, ok := tag.Lookup("json"); ok {
+			parts := strings.Split(jsonTag, ",")
+			if parts[0] == "-" && len(parts) == 1 {
+				continue
+			}
+			if parts[0] != "" {
+				field.JSONName = parts[0]
+			}
+			for _, option := range parts[1:] {
+				if option == "omitempty" {
+					field.OmitEmpty = true
+				}
+			}
+		}
+
+		fields = append(fields, field)
+		sb.register(v.Type())
+	}
+	return fields
+}
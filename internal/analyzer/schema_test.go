@@ -0,0 +1,104 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyzePackagesSchemas(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"go.mod": "module example.com/shop\n\ngo 1.22\n",
+		"models/models.go": `
+			package models
+
+			// Base carries fields shared by every stored entity.
+			type Base struct {
+				ID string ` + "`json:\"id\" validate:\"required\"`" + `
+			}
+
+			// Order is a customer order.
+			type Order struct {
+				Base
+
+				// Items lists the ordered products.
+				Items    []Item            ` + "`json:\"items\" validate:\"required,min=1\"`" + `
+				Note     string            ` + "`json:\"note,omitempty\"`" + ` // free-form note
+				Parent   *Order            ` + "`json:\"parent,omitempty\"`" + `
+				Labels   map[string]Label
+				internal int
+				Secret   string ` + "`json:\"-\"`" + `
+			}
+
+			type Item struct {
+				SKU      string
+				Quantity int
+			}
+
+			type Label string
+		`,
+		"shop.go": `
+			package shop
+
+			import "example.com/shop/models"
+
+			func PlaceOrder(order *models.Order) error {
+				return nil
+			}
+		`,
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+
+	placeOrder := findFunction(t, analyzer.Functions, "PlaceOrder")
+	order := analyzer.SchemaFor(placeOrder.Parameters[0].Resolved)
+	require.NotNil(t, order)
+	assert.Equal(t, "example.com/shop/models.Order", order.Name)
+	assert.Equal(t, "Order is a customer order.", order.Doc)
+	assert.Equal(t, KindStruct, order.Kind)
+
+	names := make([]string, len(order.Fields))
+	for i, field := range order.Fields {
+		names[i] = field.Name
+	}
+	assert.Equal(t, []string{"Base", "Items", "Note", "Parent", "Labels"}, names)
+
+	base := order.Fields[0]
+	assert.True(t, base.Embedded)
+	assert.Equal(t, "example.com/shop/models.Base", base.Type.QualifiedName)
+
+	items := order.Fields[1]
+	assert.Equal(t, "items", items.JSONName)
+	assert.Equal(t, "required,min=1", items.Validate)
+	assert.True(t, items.Required())
+	assert.Equal(t, "Items lists the ordered products.", items.Doc)
+	assert.Equal(t, KindSlice, items.Type.Kind)
+
+	note := order.Fields[2]
+	assert.Equal(t, "note", note.JSONName)
+	assert.True(t, note.OmitEmpty)
+	assert.False(t, note.Required())
+	assert.Equal(t, "free-form note", note.Doc)
+
+	assert.Equal(t, "Labels", order.Fields[4].JSONName)
+
+	for _, name := range []string{
+		"example.com/shop/models.Base",
+		"example.com/shop/models.Item",
+		"example.com/shop/models.Label",
+	} {
+		assert.Contains(t, analyzer.Schemas, name)
+	}
+	assert.NotContains(t, analyzer.Schemas, "error")
+
+	baseSchema := analyzer.Schemas["example.com/shop/models.Base"]
+	assert.Equal(t, "Base carries fields shared by every stored entity.", baseSchema.Doc)
+	require.Len(t, baseSchema.Fields, 1)
+	assert.Equal(t, "id", baseSchema.Fields[0].JSONName)
+
+	label := analyzer.Schemas["example.com/shop/models.Label"]
+	assert.Equal(t, KindBasic, label.Kind)
+	assert.Empty(t, label.Fields)
+}
@@ -0,0 +1,223 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+)
+
+// ServiceInfo describes a named type whose methods can be exposed together
+// as one service: an interface, or a concrete type with methods.
+type ServiceInfo struct {
+	Name        string      `json:"name" yaml:"name"`
+	Language    string      `json:"language" yaml:"language"`
+	Package     string      `json:"package,omitempty" yaml:"package,omitempty"`
+	PackagePath string      `json:"packagePath,omitempty" yaml:"packagePath,omitempty"`
+	IsInterface bool        `json:"isInterface,omitempty" yaml:"isInterface,omitempty"`
+	Doc         string      `json:"doc,omitempty" yaml:"doc,omitempty"`
+	Source      SourceRange `json:"source,omitempty" yaml:"source,omitempty"`
+	// Methods holds the methods an interface declares, without those of
+	// embedded interfaces, or the analyzed methods of a concrete type,
+	// whether declared on the value or the pointer receiver.
+	Methods []FunctionInfo `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// Constructors holds the package's NewX functions whose first result is
+	// the type or a pointer to it.
+	Constructors []FunctionInfo `json:"constructors,omitempty" yaml:"constructors,omitempty"`
+	// Implements lists the qualified names of the analyzed interfaces of the
+	// same package whose methods a concrete type has.
+	Implements []string `json:"implements,omitempty" yaml:"implements,omitempty"`
+}
+
+// QualifiedName identifies the type across packages, e.g.
+// "example.com/shop/orders.Service".
+func (si ServiceInfo) QualifiedName() string {
+	if si.PackagePath == "" {
+		return si.Name
+	}
+	return si.PackagePath + "." + si.Name
+}
+
+// Method returns the method called name, or nil.
+func (si *ServiceInfo) Method(name string) *FunctionInfo {
+	for i := range si.Methods {
+		if si.Methods[i].Name == name {
+			return &si.Methods[i]
+		}
+	}
+	return nil
+}
+
+// analyzeTypeDecl describes the types declared by decl, for linkServices to
+// turn into services. The methods of interfaces are described like
+// functions; when info is set, their types are resolved too.
+func (fa *FunctionAnalyzer) analyzeTypeDecl(ctx fileContext, decl *ast.GenDecl, info *types.Info, schemas *schemaBuilder) ([]ServiceInfo, error) {
+	if decl.Tok != token.TYPE {
+		return nil, nil
+	}
+
+	var services []ServiceInfo
+	for _, spec := range decl.Specs {
+		typeSpec := spec.(*ast.TypeSpec)
+		if fa.Options.ExportedOnly && !typeSpec.Name.IsExported() {
+			continue
+		}
+		doc := typeSpec.Doc
+		if doc == nil && len(decl.Specs) == 1 {
+			doc = decl.Doc
+		}
+		text, _, err := parseDocComment(doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ctx.fset.Position(typeSpec.Pos()), err)
+		}
+
+		service := ServiceInfo{
+			Name:        typeSpec.Name.Name,
+			Language:    LanguageGo,
+			Package:     ctx.packageName,
+			PackagePath: ctx.packagePath,
+			Doc:         text,
+			Source:      ctx.source(typeSpec),
+		}
+		if iface, ok := typeSpec.Type.(*ast.InterfaceType); ok {
+			service.IsInterface = true
+			methods, err := fa.analyzeInterfaceMethods(ctx, typeSpec.Name, iface, info, schemas)
+			if err != nil {
+				return nil, err
+			}
+			service.Methods = methods
+		}
+		services = append(services, service)
+	}
+	return services, nil
+}
+
+func (fa *FunctionAnalyzer) analyzeInterfaceMethods(ctx fileContext, name *ast.Ident, iface *ast.InterfaceType, info *types.Info, schemas *schemaBuilder) ([]FunctionInfo, error) {
+	var methods []FunctionInfo
+	for _, field := range iface.Methods.List {
+		funcType, ok := field.Type.(*ast.FuncType)
+		// Embedded interfaces and type set terms have no names.
+		if !ok || len(field.Names) == 0 {
+			continue
+		}
+		methodName := field.Names[0]
+		if fa.Options.ExportedOnly && !methodName.IsExported() {
+			continue
+		}
+
+		funcDecl := &ast.FuncDecl{
+			Doc:  field.Doc,
+			Recv: &ast.FieldList{List: []*ast.Field{{Type: name}}},
+			Name: methodName,
+			Type: funcType,
+		}
+		method, err := fa.analyzeFuncDecl(funcDecl)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", ctx.fset.Position(field.Pos()), err)
+		}
+		if info != nil {
+			if fn, ok := info.Defs[methodName].(*types.Func); ok {
+				sig := fn.Type().(*types.Signature)
+				resolveParameters(method.Parameters, funcType.Params, sig.Params(), info, schemas)
+				resolveParameters(method.Results, funcType.Results, sig.Results(), info, schemas)
+				assignRoles(&method)
+			}
+		}
+		ctx.apply(&method, field)
+		methods = append(methods, method)
+	}
+	return methods, nil
+}
+
+// linkServices rebuilds fa.Services from the type declarations and functions
+// recorded so far. Types of other languages, which have no declarations,
+// become services through their methods.
+func (fa *FunctionAnalyzer) linkServices() {
+	services := make(map[string]*ServiceInfo)
+	for _, decl := range fa.types {
+		service := decl
+		service.Methods = append([]FunctionInfo(nil), decl.Methods...)
+		services[service.QualifiedName()] = &service
+	}
+
+	for _, fn := range fa.Functions {
+		if !fn.IsMethod {
+			continue
+		}
+		key := ServiceInfo{Name: receiverTypeName(fn.Receiver), PackagePath: fn.PackagePath}
+		service := services[key.QualifiedName()]
+		if service == nil {
+			service = &ServiceInfo{
+				Name:        key.Name,
+				Language:    fn.Language,
+				Package:     fn.Package,
+				PackagePath: fn.PackagePath,
+			}
+			services[key.QualifiedName()] = service
+		}
+		if !service.IsInterface {
+			service.Methods = append(service.Methods, fn)
+		}
+	}
+
+	for _, fn := range fa.Functions {
+		if fn.IsMethod || !strings.HasPrefix(fn.Name, "New") || len(fn.Results) == 0 {
+			continue
+		}
+		key := ServiceInfo{Name: receiverTypeName(fn.Results[0].Type), PackagePath: fn.PackagePath}
+		if service := services[key.QualifiedName()]; service != nil {
+			service.Constructors = append(service.Constructors, fn)
+		}
+	}
+
+	fa.Services = nil
+	for _, service := range services {
+		if len(service.Methods) == 0 {
+			continue
+		}
+		if !service.IsInterface {
+			for _, iface := range services {
+				if iface.IsInterface && iface.PackagePath == service.PackagePath && len(iface.Methods) > 0 && implements(service, iface) {
+					service.Implements = append(service.Implements, iface.QualifiedName())
+				}
+			}
+			sort.Strings(service.Implements)
+		}
+		fa.Services = append(fa.Services, *service)
+	}
+	sort.Slice(fa.Services, func(i, j int) bool {
+		if fa.Services[i].PackagePath != fa.Services[j].PackagePath {
+			return fa.Services[i].PackagePath < fa.Services[j].PackagePath
+		}
+		return fa.Services[i].Name < fa.Services[j].Name
+	})
+}
+
+// implements reports whether service has every method of iface, with the
+// same parameter and result types as written in the source. Names do not
+// matter, as in Go.
+func implements(service, iface *ServiceInfo) bool {
+	for _, want := range iface.Methods {
+		have := service.Method(want.Name)
+		if have == nil || !sameTypes(have.Parameters, want.Parameters) || !sameTypes(have.Results, want.Results) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameTypes reports whether two parameter lists have the same types, a
+// variadic "..." included.
+func sameTypes(a, b []ParameterInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Type != b[i].Type {
+			return false
+		}
+	}
+	return true
+}
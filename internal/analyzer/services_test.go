@@ -0,0 +1,163 @@
+package analyzer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var serviceModule = map[string]string{
+	"go.mod": "module example.com/shop\n\ngo 1.22\n",
+	"users/users.go": `
+		package users
+
+		type User struct {
+			Name string
+		}
+
+		// Store keeps users.
+		type Store interface {
+			// Get looks a user up.
+			Get(id string) (*User, error)
+			Put(user *User) error
+		}
+
+		// Service manages users.
+		type Service struct {
+			store Store
+		}
+
+		func NewService(store Store) *Service {
+			return &Service{store: store}
+		}
+
+		func (s *Service) Get(key string) (user *User, err error) {
+			return s.store.Get(key)
+		}
+
+		func (s *Service) Put(user *User) error {
+			return s.store.Put(user)
+		}
+
+		func (s Service) Count() int {
+			return 0
+		}
+
+		type memory struct{}
+
+		func (memory) Get(id string) (*User, error) {
+			return nil, nil
+		}
+
+		// Config has no methods and is not a service.
+		type Config struct{}
+
+		func NewConfig() Config {
+			return Config{}
+		}
+	`,
+}
+
+func findService(t *testing.T, services []ServiceInfo, name string) ServiceInfo {
+	for _, service := range services {
+		if service.Name == name {
+			return service
+		}
+	}
+	require.Failf(t, "service not found", "no service named %s", name)
+	return ServiceInfo{}
+}
+
+func serviceNames(services []ServiceInfo) []string {
+	names := make([]string, len(services))
+	for i, service := range services {
+		names[i] = service.Name
+	}
+	return names
+}
+
+func TestAnalyzeDirectoryServices(t *testing.T) {
+	dir := writeModule(t, serviceModule)
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+
+	assert.Equal(t, []string{"Service", "Store", "memory"}, serviceNames(analyzer.Services))
+
+	store := findService(t, analyzer.Services, "Store")
+	assert.True(t, store.IsInterface)
+	assert.Equal(t, "example.com/shop/users.Store", store.QualifiedName())
+	assert.Equal(t, "Store keeps users.", store.Doc)
+	assert.Equal(t, 9, store.Source.Start.Line)
+	require.Len(t, store.Methods, 2)
+	get := store.Methods[0]
+	assert.Equal(t, "Get", get.Name)
+	assert.Equal(t, "Store", get.Receiver)
+	assert.True(t, get.IsMethod)
+	assert.Equal(t, "Get looks a user up.", get.Doc)
+	assert.Equal(t, "(id string) (*User, error)", get.Signature())
+	assert.Equal(t, 11, get.Source.Start.Line)
+	assert.Equal(t, "example.com/shop/users", get.PackagePath)
+
+	service := findService(t, analyzer.Services, "Service")
+	assert.False(t, service.IsInterface)
+	assert.Equal(t, "Service manages users.", service.Doc)
+	assert.Equal(t, []string{"Count", "Get", "Put"}, functionNames(service.Methods))
+	require.Len(t, service.Constructors, 1)
+	assert.Equal(t, "NewService", service.Constructors[0].Name)
+	// Parameter and result names need not match those of the interface.
+	assert.Equal(t, []string{"example.com/shop/users.Store"}, service.Implements)
+
+	// memory lacks Put, so it does not implement Store.
+	assert.Empty(t, findService(t, analyzer.Services, "memory").Implements)
+}
+
+func TestAnalyzeDirectoryServicesExportedOnly(t *testing.T) {
+	dir := writeModule(t, serviceModule)
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Options.ExportedOnly = true
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+
+	assert.Equal(t, []string{"Service", "Store"}, serviceNames(analyzer.Services))
+}
+
+func TestAnalyzePackagesServices(t *testing.T) {
+	dir := writeModule(t, serviceModule)
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Cache = NewCache(t.TempDir())
+	require.NoError(t, analyzer.AnalyzePackages(dir))
+
+	store := findService(t, analyzer.Services, "Store")
+	require.Len(t, store.Methods, 2)
+	user := store.Methods[0].Results[0].Resolved
+	require.NotNil(t, user)
+	assert.Equal(t, "*example.com/shop/users.User", user.QualifiedName)
+	assert.Contains(t, analyzer.Schemas, "example.com/shop/users.User")
+
+	// The cached packages restore the same services.
+	cached := NewFunctionAnalyzer()
+	cached.Cache = analyzer.Cache
+	require.NoError(t, cached.AnalyzePackages(dir))
+	assert.Equal(t, 1, cached.Report.CacheHits)
+	assert.Equal(t, analyzer.Services, cached.Services)
+}
+
+func TestPythonClassServices(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"shop/cart.py": "class Cart:\n    def add(self, item: str) -> None:\n        pass\n\n\ndef total() -> int:\n    return 0\n",
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	analyzer.Languages = DefaultRegistry()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+
+	require.Len(t, analyzer.Services, 1)
+	cart := analyzer.Services[0]
+	assert.Equal(t, "Cart", cart.Name)
+	assert.Equal(t, "python", cart.Language)
+	assert.Equal(t, "shop/cart.Cart", cart.QualifiedName())
+	assert.Equal(t, []string{"add"}, functionNames(cart.Methods))
+}
@@ -0,0 +1,185 @@
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+)
+
+// Position is a 1-based line and column in a source file.
+type Position struct {
+	Line   int `json:"line" yaml:"line"`
+	Column int `json:"column" yaml:"column"`
+}
+
+// SourceRange locates a declaration in its file.
+type SourceRange struct {
+	File  string   `json:"file" yaml:"file"`
+	Start Position `json:"start,omitempty" yaml:"start,omitempty"`
+	End   Position `json:"end,omitempty" yaml:"end,omitempty"`
+}
+
+func (sr SourceRange) String() string {
+	if sr.File == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d:%d", sr.File, sr.Start.Line, sr.Start.Column)
+}
+
+// QualifiedName identifies the function across packages, e.g.
+// "example.com/shop/orders.Service.Get" for a method on *Service.
+func (fi FunctionInfo) QualifiedName() string {
+	name := fi.Name
+	if fi.IsMethod {
+		name = receiverTypeName(fi.Receiver) + "." + name
+	}
+	if fi.PackagePath == "" {
+		return name
+	}
+	return fi.PackagePath + "." + name
+}
+
+// Signature renders the function's type parameters, parameters and results
+// the way they were declared, e.g. "(id string) (*User, error)".
+func (fi FunctionInfo) Signature() string {
+	signature := "(" + joinParameters(fi.Parameters) + ")"
+	if len(fi.TypeParams) > 0 {
+		signature = "[" + joinParameters(fi.TypeParams) + "]" + signature
+	}
+	switch {
+	case len(fi.Results) == 1 && fi.Results[0].Name == "":
+		signature += " " + fi.Results[0].Type
+	case len(fi.Results) > 0:
+		signature += " (" + joinParameters(fi.Results) + ")"
+	}
+	return signature
+}
+
+func joinParameters(params []ParameterInfo) string {
+	rendered := make([]string, len(params))
+	for i, param := range params {
+		rendered[i] = strings.TrimSpace(param.Name + " " + param.Type)
+	}
+	return strings.Join(rendered, ", ")
+}
+
+// receiverTypeName strips the pointer and type arguments from a receiver,
+// turning "*Stack[T]" into "Stack".
+func receiverTypeName(receiver string) string {
+	name := strings.TrimPrefix(receiver, "*")
+	if i := strings.Index(name, "["); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// fileContext holds the metadata shared by every function of a file.
+type fileContext struct {
+	fset            *token.FileSet
+	packageName     string
+	packagePath     string
+	module          string
+	buildConstraint string
+}
+
+// apply fills in the metadata of funcInfo, which was declared by decl: a
+// function declaration or an interface method.
+func (fc fileContext) apply(funcInfo *FunctionInfo, decl ast.Node) {
+	funcInfo.Language = LanguageGo
+	funcInfo.Package = fc.packageName
+	funcInfo.PackagePath = fc.packagePath
+	funcInfo.Module = fc.module
+	funcInfo.BuildConstraint = fc.buildConstraint
+	funcInfo.Source = fc.source(decl)
+}
+
+// source locates node in its file.
+func (fc fileContext) source(node ast.Node) SourceRange {
+	start := fc.fset.Position(node.Pos())
+	end := fc.fset.Position(node.End())
+	return SourceRange{
+		File:  start.Filename,
+		Start: Position{Line: start.Line, Column: start.Column},
+		End:   Position{Line: end.Line, Column: end.Column},
+	}
+}
+
+// buildConstraint returns the //go:build expression of file, if any.
+func buildConstraint(file *ast.File) string {
+	for _, group := range file.Comments {
+		if group.Pos() >= file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+			if expr, err := constraint.Parse(comment.Text); err == nil {
+				return expr.String()
+			}
+		}
+	}
+	return ""
+}
+
+// moduleInfo describes the module enclosing a directory.
+type moduleInfo struct {
+	path string
+	root string
+}
+
+// moduleFor finds the go.mod enclosing dir. Lookups are cached per directory
+// since every file of a walk asks about its own.
+func (fa *FunctionAnalyzer) moduleFor(dir string) *moduleInfo {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	fa.mu.Lock()
+	defer fa.mu.Unlock()
+	return fa.lookupModule(dir)
+}
+
+// lookupModule does the work of moduleFor with fa.mu held.
+func (fa *FunctionAnalyzer) lookupModule(dir string) *moduleInfo {
+	if fa.modules == nil {
+		fa.modules = make(map[string]*moduleInfo)
+	}
+	if module, ok := fa.modules[dir]; ok {
+		return module
+	}
+
+	var module *moduleInfo
+	if data, err := os.ReadFile(filepath.Join(dir, "go.mod")); err == nil {
+		if path := modfile.ModulePath(data); path != "" {
+			module = &moduleInfo{path: path, root: dir}
+		}
+	} else if parent := filepath.Dir(dir); parent != dir {
+		module = fa.lookupModule(parent)
+	}
+
+	fa.modules[dir] = module
+	return module
+}
+
+// importPath derives the import path of the package in dir from its module.
+func (mi *moduleInfo) importPath(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	rel, err := filepath.Rel(mi.root, dir)
+	if err != nil {
+		return ""
+	}
+	if rel == "." {
+		return mi.path
+	}
+	return mi.path + "/" + filepath.ToSlash(rel)
+}
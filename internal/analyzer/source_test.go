@@ -0,0 +1,79 @@
+package analyzer
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sourceTree = map[string]string{
+	"go.mod": "module example.com/multi\n\ngo 1.22\n",
+	"users/users.go": `package users
+
+type Service struct{}
+
+// Get returns a user.
+func (s *Service) Get(id string) string {
+	return id
+}
+`,
+	"orders/orders.go": `//go:build linux || darwin
+
+package orders
+
+func Get(id string) string { return id }
+`,
+}
+
+func TestSourceMetadata(t *testing.T) {
+	dir := writeModule(t, sourceTree)
+
+	for _, mode := range []string{"directory", "packages"} {
+		t.Run(mode, func(t *testing.T) {
+			analyzer := NewFunctionAnalyzer()
+			if mode == "directory" {
+				require.NoError(t, analyzer.AnalyzeDirectory(dir))
+			} else {
+				require.NoError(t, analyzer.AnalyzePackages(dir))
+			}
+			require.Len(t, analyzer.Functions, 2)
+
+			byPackage := make(map[string]FunctionInfo)
+			for _, fn := range analyzer.Functions {
+				byPackage[fn.Package] = fn
+			}
+
+			users := byPackage["users"]
+			assert.Equal(t, "example.com/multi/users", users.PackagePath)
+			assert.Equal(t, "example.com/multi", users.Module)
+			assert.Equal(t, "example.com/multi/users.Service.Get", users.QualifiedName())
+			assert.Equal(t, filepath.Join(dir, "users", "users.go"), users.Source.File)
+			assert.Equal(t, Position{Line: 6, Column: 1}, users.Source.Start)
+			assert.Equal(t, Position{Line: 8, Column: 2}, users.Source.End)
+			assert.Empty(t, users.BuildConstraint)
+
+			orders := byPackage["orders"]
+			assert.Equal(t, "example.com/multi/orders.Get", orders.QualifiedName())
+			assert.Equal(t, "linux || darwin", orders.BuildConstraint)
+			assert.Equal(t, filepath.Join(dir, "orders", "orders.go")+":5:1", orders.Source.String())
+		})
+	}
+}
+
+func TestSourceMetadataWithoutModule(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"tools/tools.go": "package tools\n\nfunc Run() {}\n",
+	})
+
+	analyzer := NewFunctionAnalyzer()
+	require.NoError(t, analyzer.AnalyzeDirectory(dir))
+	require.Len(t, analyzer.Functions, 1)
+
+	run := analyzer.Functions[0]
+	assert.Equal(t, "tools", run.Package)
+	assert.Equal(t, "tools", run.PackagePath)
+	assert.Empty(t, run.Module)
+	assert.Equal(t, "tools.Run", run.QualifiedName())
+}
@@ -0,0 +1,152 @@
+package analyzer
+
+import (
+	"go/ast"
+	"go/types"
+)
+
+// Kinds reported in TypeInfo.Kind. They describe the underlying type, so a
+// named struct such as models.User has the kind "struct".
+const (
+	KindBasic     = "basic"
+	KindPointer   = "pointer"
+	KindSlice     = "slice"
+	KindArray     = "array"
+	KindMap       = "map"
+	KindChan      = "chan"
+	KindStruct    = "struct"
+	KindInterface = "interface"
+	KindFunc      = "func"
+	KindTypeParam = "typeparam"
+	KindUnknown   = "unknown"
+)
+
+// TypeInfo is the type-checked description of a parameter or result type.
+type TypeInfo struct {
+	// QualifiedName is the type rendered with full import paths,
+	// e.g. "*github.com/chenxingqiang/soft-crusher/internal/models.User".
+	QualifiedName string `json:"qualifiedName" yaml:"qualifiedName"`
+	// Name and PkgPath identify a named type; both are empty for unnamed
+	// types, and PkgPath is empty for predeclared types such as error.
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
+	PkgPath string `json:"pkgPath,omitempty" yaml:"pkgPath,omitempty"`
+	// Kind and Underlying describe the underlying type.
+	Kind       string `json:"kind" yaml:"kind"`
+	Underlying string `json:"underlying,omitempty" yaml:"underlying,omitempty"`
+	IsNamed    bool   `json:"isNamed,omitempty" yaml:"isNamed,omitempty"`
+	// IsAlias reports whether the type was written using an alias, in which
+	// case AliasName is the qualified name of that alias.
+	IsAlias   bool   `json:"isAlias,omitempty" yaml:"isAlias,omitempty"`
+	AliasName string `json:"aliasName,omitempty" yaml:"aliasName,omitempty"`
+	// Elem and Key describe the components of unnamed pointer, slice,
+	// array, map and channel types.
+	Elem *TypeInfo `json:"elem,omitempty" yaml:"elem,omitempty"`
+	Key  *TypeInfo `json:"key,omitempty" yaml:"key,omitempty"`
+}
+
+// newTypeInfo describes t. Components of named types are not expanded, which
+// keeps recursive types such as `type List []List` finite.
+func newTypeInfo(t types.Type) *TypeInfo {
+	ti := &TypeInfo{QualifiedName: types.TypeString(t, nil)}
+
+	if alias, ok := t.(*types.Alias); ok {
+		ti.IsAlias = true
+		ti.AliasName = qualifiedObjectName(alias.Obj())
+		t = types.Unalias(alias)
+		ti.QualifiedName = types.TypeString(t, nil)
+	}
+
+	switch t := t.(type) {
+	case *types.Named:
+		ti.IsNamed = true
+		ti.Name = t.Obj().Name()
+		if pkg := t.Obj().Pkg(); pkg != nil {
+			ti.PkgPath = pkg.Path()
+		}
+	case *types.TypeParam:
+		ti.Name = t.Obj().Name()
+		ti.Kind = KindTypeParam
+		ti.Underlying = types.TypeString(t.Constraint(), nil)
+		return ti
+	}
+
+	underlying := t.Underlying()
+	ti.Underlying = types.TypeString(underlying, nil)
+	ti.Kind = kindOf(underlying)
+
+	if ti.IsNamed {
+		return ti
+	}
+
+	switch u := underlying.(type) {
+	case *types.Pointer:
+		ti.Elem = newTypeInfo(u.Elem())
+	case *types.Slice:
+		ti.Elem = newTypeInfo(u.Elem())
+	case *types.Array:
+		ti.Elem = newTypeInfo(u.Elem())
+	case *types.Chan:
+		ti.Elem = newTypeInfo(u.Elem())
+	case *types.Map:
+		ti.Key = newTypeInfo(u.Key())
+		ti.Elem = newTypeInfo(u.Elem())
+	}
+
+	return ti
+}
+
+func kindOf(t types.Type) string {
+	switch t.(type) {
+	case *types.Basic:
+		return KindBasic
+	case *types.Pointer:
+		return KindPointer
+	case *types.Slice:
+		return KindSlice
+	case *types.Array:
+		return KindArray
+	case *types.Map:
+		return KindMap
+	case *types.Chan:
+		return KindChan
+	case *types.Struct:
+		return KindStruct
+	case *types.Interface:
+		return KindInterface
+	case *types.Signature:
+		return KindFunc
+	default:
+		return KindUnknown
+	}
+}
+
+// markAlias records alias usage that go/types does not materialise. Without
+// gotypesalias=1 the checker resolves aliases eagerly, so the only trace of
+// the alias left is the identifier in the source.
+func markAlias(ti *TypeInfo, expr ast.Expr, info *types.Info) {
+	if ti == nil || ti.IsAlias || info == nil {
+		return
+	}
+
+	var ident *ast.Ident
+	switch e := expr.(type) {
+	case *ast.Ident:
+		ident = e
+	case *ast.SelectorExpr:
+		ident = e.Sel
+	default:
+		return
+	}
+
+	if obj, ok := info.Uses[ident].(*types.TypeName); ok && obj.IsAlias() {
+		ti.IsAlias = true
+		ti.AliasName = qualifiedObjectName(obj)
+	}
+}
+
+func qualifiedObjectName(obj types.Object) string {
+	if obj.Pkg() == nil {
+		return obj.Name()
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
 	"github.com/chenxingqiang/soft-crusher/internal/database"
 	"github.com/chenxingqiang/soft-crusher/internal/models"
 	"github.com/gorilla/mux"
@@ -14,6 +15,9 @@ import (
 
 type Service struct {
 	DB database.Database
+	// RepositoryHosts are the hosts AnalyzeRepository clones from, over
+	// https only: analyzer.DefaultRepositoryHosts when empty.
+	RepositoryHosts []string
 }
 
 func NewService(db database.Database) *Service {
@@ -49,6 +53,9 @@ func (s *Service) RegisterRoutes(r *mux.Router) {
 	r.HandleFunc("/api-services/{id}", s.UpdateAPIService).Methods("PUT")
 	r.HandleFunc("/api-services/{id}", s.DeleteAPIService).Methods("DELETE")
 	r.HandleFunc("/api-services", s.ListAPIServices).Methods("GET")
+
+	// Analysis routes
+	r.HandleFunc("/analyze", s.AnalyzeRepository).Methods("POST")
 }
 
 // Software Info handlers
@@ -135,6 +142,46 @@ func (s *Service) GetSoftwareInfoByCodeRepository(w http.ResponseWriter, r *http
 	json.NewEncoder(w).Encode(info)
 }
 
+// Analysis handlers
+
+// AnalyzeRequest names the repository revision to analyze.
+type AnalyzeRequest struct {
+	RepoURL string `json:"repoUrl"`
+	Ref     string `json:"ref"`
+	Subdir  string `json:"subdir"`
+}
+
+func (s *Service) AnalyzeRepository(w http.ResponseWriter, r *http.Request) {
+	var req AnalyzeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RepoURL == "" {
+		http.Error(w, "Repository URL is required", http.StatusBadRequest)
+		return
+	}
+	if err := analyzer.CheckRepositoryURL(req.RepoURL, s.RepositoryHosts); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fa := analyzer.NewFunctionAnalyzer()
+	fa.Options = analyzer.DefaultOptions()
+	fa.Options.Tolerant = true
+	err := fa.AnalyzeRepository(r.Context(), analyzer.Repository{
+		URL:    req.RepoURL,
+		Ref:    req.Ref,
+		Subdir: req.Subdir,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	json.NewEncoder(w).Encode(fa.Analysis())
+}
+
 // User handlers
 // Implement CreateUser, GetUser, UpdateUser, DeleteUser, ListUsers
 
@@ -1,11 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
 
 	"github.com/urfave/cli/v2"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/deployment"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+	"github.com/chenxingqiang/soft-crusher/internal/diff"
+	"github.com/chenxingqiang/soft-crusher/internal/pipeline"
 )
 
 func main() {
@@ -17,13 +28,58 @@ func main() {
 				Name:    "analyze",
 				Aliases: []string{"a"},
 				Usage:   "Analyze Go files in the current directory",
+				Flags: append([]cli.Flag{
+					&cli.BoolFlag{
+						Name:  "list",
+						Usage: "List every analyzed function with its source location",
+					},
+					&cli.StringFlag{
+						Name:    "format",
+						Aliases: []string{"f"},
+						Usage:   "Write the analysis as json, yaml or table (default: from --out, else json)",
+					},
+					&cli.StringFlag{
+						Name:    "out",
+						Aliases: []string{"o"},
+						Usage:   "File to write the analysis to instead of standard output",
+					},
+					&cli.BoolFlag{
+						Name:  "typecheck",
+						Usage: "Load Go packages with full type information and record type schemas",
+					},
+					&cli.BoolFlag{
+						Name:  "security",
+						Usage: "Print a report of the functions that are risky to expose",
+					},
+				}, analysisFlags...),
 				Action: func(c *cli.Context) error {
-					analyzer := NewFunctionAnalyzer()
-					err := analyzer.AnalyzeDirectory("./")
+					fa, err := analyzeDirectory(c)
 					if err != nil {
-						return fmt.Errorf("error analyzing directory: %v", err)
+						return err
 					}
-					fmt.Println("Analysis completed successfully!")
+					if c.Bool("list") {
+						for _, fn := range fa.Functions {
+							fmt.Printf("%s: %s\n", fn.Source, fn.QualifiedName())
+						}
+					}
+					if c.IsSet("format") || c.IsSet("out") {
+						if err := writeAnalysis(fa.Analysis(), c.String("format"), c.String("out")); err != nil {
+							return err
+						}
+					}
+					// Keep standard output clean for an analysis written there.
+					summary := os.Stdout
+					if c.IsSet("format") && !c.IsSet("out") {
+						summary = os.Stderr
+					}
+					if c.Bool("security") {
+						if err := fa.Analysis().WriteSecurityReport(summary); err != nil {
+							return err
+						}
+						fmt.Fprintln(summary)
+					}
+					fmt.Fprintf(summary, "Analysis completed successfully! %d functions in %d files (%d skipped, %d cached)\n",
+						len(fa.Functions), fa.Report.FilesAnalyzed, fa.Report.FilesSkipped, fa.Report.CacheHits)
 					return nil
 				},
 			},
@@ -31,43 +87,120 @@ func main() {
 				Name:    "generate",
 				Aliases: []string{"g"},
 				Usage:   "Generate API code, documentation, and tests",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "analysis",
+						Usage: "Generate from an analysis saved with analyze --out instead of analyzing again",
+					},
+					&cli.BoolFlag{
+						Name:  "allow-risky",
+						Usage: "Expose high-risk functions without a soft-crusher:allow-risk directive",
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Directory to write the generated API to (default: the current directory)",
+					},
+					&cli.StringFlag{
+						Name:  "overrides",
+						Usage: "Merge this design override file over the inferred design (default: " + designer.OverridesFile + " if present)",
+					},
+					&cli.StringFlag{
+						Name:  "style",
+						Value: pipeline.StyleREST,
+						Usage: "Kind of API to generate: " + pipeline.StyleREST + ", " + pipeline.StyleGraphQL + ", " + pipeline.StyleGRPC + " or " + pipeline.StyleJSONRPC,
+					},
+					&cli.BoolFlag{
+						Name:  "typecheck",
+						Value: true,
+						Usage: "Load Go packages with full type information, so that structs get types of their own; on in Go modules",
+					},
+					&cli.StringFlag{
+						Name:  "design-out",
+						Usage: "Also save the API design to this file (json or yaml), to compare releases with diff",
+					},
+				}, analysisFlags...),
 				Action: func(c *cli.Context) error {
-					analyzer := NewFunctionAnalyzer()
-					err := analyzer.AnalyzeDirectory("./")
-					if err != nil {
-						return fmt.Errorf("error analyzing directory: %v", err)
+					var analysis *analyzer.Analysis
+					if path := c.String("analysis"); path != "" {
+						loaded, err := analyzer.LoadAnalysis(path)
+						if err != nil {
+							return fmt.Errorf("error loading analysis: %v", err)
+						}
+						analysis = loaded
+					} else {
+						fa, err := analyzeDirectory(c)
+						if err != nil {
+							return err
+						}
+						analysis = fa.Analysis()
 					}
 
-					designer := NewAPIDesigner()
-					designer.DesignAPI(analyzer.Functions)
-
-					generator := NewCodeGenerator(designer)
-					err = generator.GenerateAPICode()
-					if err != nil {
-						return fmt.Errorf("error generating API code: %v", err)
+					options := pipeline.Options{
+						Style:      c.String("style"),
+						AllowRisky: c.Bool("allow-risky"),
+						OutputDir:  c.String("output"),
+						// Proto field numbers are kept next to the overrides.
+						ProtoNumbers: designer.ProtoNumbersFile,
 					}
-
-					docGenerator := NewDocumentationGenerator(designer)
-					err = docGenerator.GenerateSwaggerDoc()
-					if err != nil {
-						return fmt.Errorf("error generating Swagger documentation: %v", err)
+					if c.String("analysis") == "" && c.String("repo") == "" {
+						// The GraphQL, gRPC and JSON-RPC servers build against the analyzed module.
+						options.Source = "."
+					}
+					var err error
+					if path := c.String("overrides"); path != "" {
+						options.Overrides, err = designer.LoadOverrides(path)
+					} else {
+						options.Overrides, err = pipeline.LoadOverrides(".")
 					}
-
-					testGenerator := NewTestingSuiteGenerator(designer)
-					err = testGenerator.GenerateTests()
 					if err != nil {
-						return fmt.Errorf("error generating test suite: %v", err)
+						return fmt.Errorf("error loading overrides: %v", err)
+					}
+					design, warnings, err := pipeline.Design(analysis, options)
+					for _, warning := range warnings {
+						fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
 					}
-
-					err = testGenerator.UpdateGoModFile()
 					if err != nil {
-						return fmt.Errorf("error updating go.mod file: %v", err)
+						return err
+					}
+					if out := c.String("design-out"); out != "" {
+						var buf bytes.Buffer
+						if err := design.Write(&buf, analyzer.FormatForPath(out)); err != nil {
+							return err
+						}
+						if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil {
+							return fmt.Errorf("error writing design: %v", err)
+						}
+					}
+					if err := pipeline.Generate(design, options); err != nil {
+						return err
 					}
 
 					fmt.Println("API generation completed successfully!")
 					return nil
 				},
 			},
+			{
+				Name:      "diff",
+				Usage:     "Compare two saved analyses or designs and fail on breaking changes",
+				ArgsUsage: "<old> <new>",
+				Action: func(c *cli.Context) error {
+					if c.NArg() != 2 {
+						return fmt.Errorf("diff takes the old and the new analysis or design")
+					}
+					report, err := diff.Files(c.Args().Get(0), c.Args().Get(1))
+					if err != nil {
+						return fmt.Errorf("error comparing designs: %v", err)
+					}
+					if err := report.Write(os.Stdout); err != nil {
+						return err
+					}
+					if breaking := report.Breaking(); len(breaking) > 0 {
+						return fmt.Errorf("%d breaking changes: %s", len(breaking), diff.Summary(breaking))
+					}
+					return nil
+				},
+			},
 			{
 				Name:    "deploy",
 				Aliases: []string{"d"},
@@ -93,7 +226,7 @@ func main() {
 					},
 				},
 				Action: func(c *cli.Context) error {
-					helper := NewDeploymentHelper(
+					helper := deployment.NewDeploymentHelper(
 						c.String("name"),
 						c.String("version"),
 						c.Int("port"),
@@ -121,8 +254,155 @@ func main() {
 		},
 	}
 
-	err := app.Run(os.Args)
+	// Interrupting the process cancels a running analysis.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := app.RunContext(ctx, os.Args)
 	if err != nil {
 		log.Fatal(err)
 	}
-}
\ No newline at end of file
+}
+
+var analysisFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "all",
+		Usage: "Include unexported functions",
+	},
+	&cli.BoolFlag{
+		Name:  "include-tests",
+		Usage: "Include _test.go files",
+	},
+	&cli.BoolFlag{
+		Name:  "include-generated",
+		Usage: "Include generated files",
+	},
+	&cli.StringSliceFlag{
+		Name:  "tags",
+		Usage: "Build tags to satisfy when selecting files",
+	},
+	&cli.StringSliceFlag{
+		Name:  "package",
+		Usage: "Only analyze matching packages (name, path or path/...)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "exclude-package",
+		Usage: "Skip matching packages (name, path or path/...)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "include",
+		Usage: "Only analyze files matching the glob",
+	},
+	&cli.StringSliceFlag{
+		Name:  "exclude",
+		Usage: "Skip files matching the glob",
+	},
+	&cli.BoolFlag{
+		Name:  "tolerant",
+		Usage: "Report files that fail to parse instead of aborting",
+	},
+	&cli.StringSliceFlag{
+		Name:  "languages",
+		Usage: "Also analyze files of these languages besides Go (python, c)",
+	},
+	&cli.IntFlag{
+		Name:    "jobs",
+		Aliases: []string{"j"},
+		Usage:   "Number of files to analyze in parallel (0 uses every CPU)",
+	},
+	&cli.BoolFlag{
+		Name:  "no-cache",
+		Usage: "Analyze every file again instead of reusing " + analyzer.DefaultCacheDir,
+	},
+	&cli.StringFlag{
+		Name:  "repo",
+		Usage: "Analyze a git repository (URL, file:// URL or local path) instead of the current directory",
+	},
+	&cli.StringFlag{
+		Name:  "ref",
+		Usage: "Branch, tag or commit of --repo to analyze",
+	},
+	&cli.StringFlag{
+		Name:  "subdir",
+		Usage: "Directory of --repo to analyze",
+	},
+}
+
+func analysisOptions(c *cli.Context) analyzer.Options {
+	options := analyzer.DefaultOptions()
+	options.ExportedOnly = !c.Bool("all")
+	options.SkipTests = !c.Bool("include-tests")
+	options.SkipGenerated = !c.Bool("include-generated")
+	options.BuildTags = c.StringSlice("tags")
+	options.Packages = c.StringSlice("package")
+	options.ExcludePackages = c.StringSlice("exclude-package")
+	options.Include = c.StringSlice("include")
+	options.ExcludeFiles = c.StringSlice("exclude")
+	options.Tolerant = c.Bool("tolerant")
+	return options
+}
+
+func analyzeDirectory(c *cli.Context) (*analyzer.FunctionAnalyzer, error) {
+	fa := analyzer.NewFunctionAnalyzer()
+	fa.Options = analysisOptions(c)
+	fa.Workers = c.Int("jobs")
+	if languages := c.StringSlice("languages"); len(languages) > 0 {
+		available := analyzer.DefaultRegistry()
+		fa.Languages = analyzer.NewRegistry()
+		for _, language := range languages {
+			la := available.Lookup(language)
+			if la == nil {
+				return nil, fmt.Errorf("unsupported language %q, expected one of %s",
+					language, strings.Join(available.Languages(), ", "))
+			}
+			fa.Languages.Register(la)
+		}
+	}
+	if repo := c.String("repo"); repo != "" {
+		err := fa.AnalyzeRepository(c.Context, analyzer.Repository{
+			URL:    repo,
+			Ref:    c.String("ref"),
+			Subdir: c.String("subdir"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error analyzing repository: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Analyzed %s at commit %s\n", repo, fa.Repository.Commit)
+	} else {
+		if !c.Bool("no-cache") {
+			fa.Cache = analyzer.NewCache(filepath.Join(".", analyzer.DefaultCacheDir))
+		}
+		analyze := func() error { return fa.AnalyzeDirectoryContext(c.Context, "./") }
+		// Outside Go modules, type checking is only done when asked for.
+		if c.Bool("typecheck") && (c.IsSet("typecheck") || pipeline.IsModule(".")) {
+			analyze = func() error { return fa.AnalyzePackagesContext(c.Context, "./") }
+		}
+		if err := analyze(); err != nil {
+			return nil, fmt.Errorf("error analyzing directory: %v", err)
+		}
+	}
+	for _, fileErr := range fa.Report.Errors {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", fileErr)
+	}
+	return fa, nil
+}
+
+// writeAnalysis writes analysis to out, or to standard output when out is
+// empty. Without an explicit format, it is chosen from out's extension.
+func writeAnalysis(analysis *analyzer.Analysis, format, out string) error {
+	if format == "" {
+		format = analyzer.FormatForPath(out)
+	}
+	if out == "" {
+		return analysis.Write(os.Stdout, format)
+	}
+
+	var buf bytes.Buffer
+	if err := analysis.Write(&buf, format); err != nil {
+		return err
+	}
+	if err := os.WriteFile(out, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("error writing analysis: %v", err)
+	}
+	return nil
+}
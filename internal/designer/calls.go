@@ -0,0 +1,96 @@
+package designer
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// GoCall describes the Go function a generated server calls: Service is the
+// APIService Type of the instance a method is called on, or of the instance
+// a constructor builds.
+type GoCall struct {
+	Package    string                   `json:"package" yaml:"package"`
+	Function   string                   `json:"function" yaml:"function"`
+	Service    string                   `json:"service,omitempty" yaml:"service,omitempty"`
+	Parameters []analyzer.ParameterInfo `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Results    []analyzer.ParameterInfo `json:"results,omitempty" yaml:"results,omitempty"`
+}
+
+// findExposed returns the function endpoint exposes.
+func findExposed(functions []analyzer.FunctionInfo, endpoint APIEndpoint) (analyzer.FunctionInfo, bool) {
+	for _, fn := range functions {
+		if exposes(endpoint, fn) {
+			return fn, true
+		}
+	}
+	return analyzer.FunctionInfo{}, false
+}
+
+// unsupportedCall tells why fn cannot be called with values only, if it
+// cannot: GraphQL fields and RPCs take and return values, not streams or
+// callbacks.
+func unsupportedCall(fn analyzer.FunctionInfo) string {
+	for _, param := range fn.Parameters {
+		switch {
+		case param.Role == analyzer.RoleReader:
+			return fmt.Sprintf("parameter %s is read as a stream", param.Name)
+		case param.Role == analyzer.RoleWriter:
+			return fmt.Sprintf("parameter %s is written as a stream", param.Name)
+		case strings.HasPrefix(param.Type, "func(") || strings.Contains(param.Type, "chan "):
+			return fmt.Sprintf("parameter %s is not a value", param.Name)
+		}
+	}
+	for _, result := range fn.Results {
+		if result.Role == analyzer.RoleStream {
+			return fmt.Sprintf("result %s is streamed", result.Type)
+		}
+		if strings.HasPrefix(result.Type, "func(") || strings.Contains(result.Type, "chan ") {
+			return fmt.Sprintf("result %s is not a value", result.Type)
+		}
+	}
+	return ""
+}
+
+// restCall returns the call of fn that the REST server makes on the
+// instance of service, if any, or nil when the server cannot make it: the
+// function must be Go, exported, not generic and outside package main.
+func restCall(fn analyzer.FunctionInfo, service string) *GoCall {
+	if fn.Language != "" && fn.Language != analyzer.LanguageGo {
+		return nil
+	}
+	if !token.IsExported(fn.Name) || fn.IsGeneric || fn.Package == "main" || fn.PackagePath == "" {
+		return nil
+	}
+	return &GoCall{
+		Package:    fn.PackagePath,
+		Function:   fn.Name,
+		Service:    service,
+		Parameters: fn.Parameters,
+		Results:    fn.Results,
+	}
+}
+
+// constructorCalls returns the calls building the instances of the
+// services designed so far.
+func (ad *APIDesigner) constructorCalls(functions []analyzer.FunctionInfo) []GoCall {
+	var calls []GoCall
+	for _, service := range ad.Services {
+		for _, fn := range functions {
+			if !fn.IsMethod && fn.Name == service.Constructor && fn.PackagePath == service.Package {
+				calls = append(calls, GoCall{
+					Package:    fn.PackagePath,
+					Function:   fn.Name,
+					Service:    service.Type,
+					Parameters: fn.Parameters,
+					Results:    fn.Results,
+				})
+				break
+			}
+		}
+	}
+
+	return calls
+}
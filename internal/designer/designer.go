@@ -2,31 +2,114 @@ package designer
 
 import (
 	"fmt"
+	"go/token"
 	"strings"
 	"unicode"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
 )
 
 type APIEndpoint struct {
-	Method       string
-	Path         string
-	FunctionName string
-	Parameters   []Parameter
-	Responses    []Response
+	Method string `json:"method" yaml:"method"`
+	// MethodReason explains why Method was chosen.
+	MethodReason string `json:"methodReason,omitempty" yaml:"methodReason,omitempty"`
+	Path         string `json:"path" yaml:"path"`
+	FunctionName string `json:"function" yaml:"function"`
+	// Name names the operation in documentation when it should not be named
+	// after the function.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Resource is the collection the endpoint belongs to, e.g. "users", when
+	// its path was derived from the resource the function acts on.
+	Resource string `json:"resource,omitempty" yaml:"resource,omitempty"`
+	// Package is the import path of the function and Source its location,
+	// linking the endpoint back to the code it exposes.
+	Package     string               `json:"package,omitempty" yaml:"package,omitempty"`
+	Source      analyzer.SourceRange `json:"source,omitempty" yaml:"source,omitempty"`
+	Description string               `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string             `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Auth        string               `json:"auth,omitempty" yaml:"auth,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Responses   []Response           `json:"responses,omitempty" yaml:"responses,omitempty"`
+	// Service is the Type of the APIService whose instance serves the
+	// endpoint, if any.
+	Service string `json:"service,omitempty" yaml:"service,omitempty"`
+	// Stream is set when the response is streamed.
+	Stream *Stream `json:"stream,omitempty" yaml:"stream,omitempty"`
+	// Call is the function the generated server calls, when it can call
+	// it; otherwise the endpoint answers 501 Not Implemented.
+	Call *GoCall `json:"call,omitempty" yaml:"call,omitempty"`
 }
 
 type Parameter struct {
-	Name     string
-	Type     string
-	Location string // "path", "query", or "body"
+	Name     string `json:"name" yaml:"name"`
+	Type     string `json:"type" yaml:"type"`
+	Location string `json:"location,omitempty" yaml:"location,omitempty"` // "path", "query", "header", "body", or "" when not sent
+	// Role is the special role of the parameter, if any: a context is taken
+	// from the request and a writer streams the response, so neither is sent.
+	Role analyzer.Role `json:"role,omitempty" yaml:"role,omitempty"`
+	// Scalar is the predeclared type underlying Type when the parameter is a
+	// single value that can be sent as text, e.g. "int64" for a UserID
+	// declared as int64, or "time.Duration" and "time.Time". It is empty for
+	// structs, slices, maps and types the analysis could not resolve.
+	Scalar string `json:"scalar,omitempty" yaml:"scalar,omitempty"`
 }
 
 type Response struct {
-	StatusCode int
-	Type       string
+	StatusCode int    `json:"status" yaml:"status"`
+	Type       string `json:"type" yaml:"type"`
+	// Errors are the errors answered with this response, whose Type is
+	// "error".
+	Errors []analyzer.ErrorInfo `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// APIService is a type whose methods are exposed as one resource. The
+// generated server builds a single instance with Constructor, supplying its
+// parameters itself, and serves every endpoint of the service from it.
+type APIService struct {
+	Name string `json:"name" yaml:"name"`
+	// Type is the qualified name of the type, e.g.
+	// "example.com/shop/users.Service".
+	Type        string `json:"type" yaml:"type"`
+	Package     string `json:"package,omitempty" yaml:"package,omitempty"`
+	Path        string `json:"path" yaml:"path"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// Constructor is the function building the instance and Instance the
+	// type it returns, e.g. "*Service". ConstructorParameters have no
+	// Location.
+	Constructor           string      `json:"constructor" yaml:"constructor"`
+	ConstructorParameters []Parameter `json:"constructorParameters,omitempty" yaml:"constructorParameters,omitempty"`
+	Instance              string      `json:"instance" yaml:"instance"`
+	// Call is the call of Constructor, when the generated server can make
+	// it.
+	Call *GoCall `json:"call,omitempty" yaml:"call,omitempty"`
 }
 
 type APIDesigner struct {
 	Endpoints []APIEndpoint
+	Services  []APIService
+	// ExposeOnly restricts the design to functions carrying a
+	// soft-crusher:expose directive.
+	ExposeOnly bool
+	// AllowRisky exposes functions whose RiskScore reaches
+	// analyzer.HighRiskScore. Otherwise only those carrying a
+	// soft-crusher:allow-risk directive are, and the others are recorded in
+	// Rejected instead.
+	AllowRisky bool
+	Rejected   []analyzer.FunctionInfo
+	// Warnings lists the stale entries ApplyOverrides found.
+	Warnings []string
+	// ErrorRules map the errors of functions to the status codes of their
+	// responses, ahead of DefaultErrorRules.
+	ErrorRules []ErrorRule
+	// GraphQL is set by DesignGraphQL, Proto by DesignProto and JSONRPC by
+	// DesignJSONRPC.
+	GraphQL *GraphQLDesign
+	Proto   *ProtoDesign
+	JSONRPC *JSONRPCDesign
+
+	// claimed holds the qualified names of the functions DesignServices
+	// exposed, which DesignAPI then leaves out.
+	claimed map[string]bool
 }
 
 func NewAPIDesigner() *APIDesigner {
@@ -35,32 +118,226 @@ func NewAPIDesigner() *APIDesigner {
 	}
 }
 
-func (ad *APIDesigner) DesignAPI(functions []FunctionInfo) {
+// DesignAPI adds an endpoint for each function. Call DesignServices first so
+// that the methods and constructors of services are not exposed twice.
+func (ad *APIDesigner) DesignAPI(functions []analyzer.FunctionInfo) {
+	var selected []analyzer.FunctionInfo
 	for _, fn := range functions {
+		if ad.claimed[fn.QualifiedName()] || !ad.selected(fn) || !ad.allowed(fn) {
+			continue
+		}
+		selected = append(selected, fn)
+	}
+
+	start := len(ad.Endpoints)
+	for _, fn := range selected {
 		endpoint := APIEndpoint{
-			Method:       ad.inferHTTPMethod(fn.Name),
-			Path:         ad.generatePath(fn.Name),
+			Path:         fn.Directives.Path,
 			FunctionName: fn.Name,
-			Parameters:   ad.generateParameters(fn.Args),
-			Responses:    ad.generateResponses(fn.Returns),
+			Package:      fn.PackagePath,
+			Source:       fn.Source,
+			Description:  fn.Doc,
+			Tags:         fn.Directives.Tags,
+			Auth:         fn.Directives.Auth,
+			Responses:    ad.generateResponses(fn),
+			Stream:       designStream(fn),
+			Call:         restCall(fn, ""),
 		}
+		// Functions have no owner: those named by a verb alone, as Add, are
+		// actions of their own rather than operations on the package.
+		ad.routeEndpoint(&endpoint, fn, nil, ad.generatePath(fn.Name))
 		ad.Endpoints = append(ad.Endpoints, endpoint)
 	}
+
+	// Functions of different packages may still end up on the same route,
+	// as when both declare GetUser.
+	routes := make(map[string]int)
+	for _, endpoint := range ad.Endpoints {
+		routes[routeKey(endpoint)]++
+	}
+	for i, fn := range selected {
+		endpoint := &ad.Endpoints[start+i]
+		if routes[routeKey(*endpoint)] > 1 && fn.Directives.Path == "" && fn.Package != "" {
+			endpoint.Path = "/" + strings.ToLower(fn.Package) + endpoint.Path
+		}
+	}
+}
+
+// routeKey returns the route of endpoint with its path parameters unnamed,
+// so that routes differing only in their names, as /users/{id} and
+// /users/{email}, are the same: the router could not tell them apart.
+func routeKey(endpoint APIEndpoint) string {
+	return endpoint.Method + " " + pathParamPattern.ReplaceAllString(endpoint.Path, "{}")
 }
 
-func (ad *APIDesigner) inferHTTPMethod(funcName string) string {
-	lowercaseName := strings.ToLower(funcName)
+// DesignServices exposes each service that has a constructor as a resource,
+// with one endpoint per method. Methods are routed as operations on the
+// resource the service manages, so that UserService.Get(id) is served at
+// /users/{id}, and the others below the service's path. Interfaces are
+// exposed through the constructors returning them. The constructors of
+// these services are left out of DesignAPI.
+func (ad *APIDesigner) DesignServices(services []analyzer.ServiceInfo) {
+	var designed []analyzer.ServiceInfo
+	nameCounts := make(map[string]int)
+	for _, service := range services {
+		if len(service.Constructors) == 0 {
+			continue
+		}
+		var methods []analyzer.FunctionInfo
+		for _, method := range service.Methods {
+			if ad.selected(method) {
+				methods = append(methods, method)
+			}
+		}
+		if len(methods) == 0 {
+			continue
+		}
+		service.Methods = methods
+		designed = append(designed, service)
+		nameCounts[service.Name]++
+	}
+
+	if ad.claimed == nil {
+		ad.claimed = make(map[string]bool)
+	}
+	for _, service := range designed {
+		// The constructor needing the fewest arguments is the easiest for
+		// the generated server to call.
+		constructor := service.Constructors[0]
+		for _, candidate := range service.Constructors[1:] {
+			if len(candidate.Parameters) < len(constructor.Parameters) {
+				constructor = candidate
+			}
+		}
+
+		apiService := APIService{
+			Name:        service.Name,
+			Type:        service.QualifiedName(),
+			Package:     service.PackagePath,
+			Path:        ad.generatePath(service.Name),
+			Description: service.Doc,
+			Constructor: constructor.Name,
+			Instance:    constructor.Results[0].Type,
+		}
+		if token.IsExported(service.Name) {
+			apiService.Call = restCall(constructor, apiService.Type)
+		}
+		for _, param := range constructor.Parameters {
+			apiService.ConstructorParameters = append(apiService.ConstructorParameters, Parameter{Name: param.Name, Type: param.Type})
+		}
+		if nameCounts[service.Name] > 1 && service.Package != "" {
+			apiService.Path = "/" + strings.ToLower(service.Package) + apiService.Path
+		}
+		ad.Services = append(ad.Services, apiService)
+		for _, fn := range service.Constructors {
+			ad.claimed[fn.QualifiedName()] = true
+		}
+
+		for _, method := range service.Methods {
+			ad.claimed[method.QualifiedName()] = true
+			if !ad.allowed(method) {
+				continue
+			}
+			endpoint := APIEndpoint{
+				Path:         method.Directives.Path,
+				FunctionName: method.Name,
+				Package:      method.PackagePath,
+				Source:       method.Source,
+				Service:      apiService.Type,
+				Description:  method.Doc,
+				Tags:         method.Directives.Tags,
+				Auth:         method.Directives.Auth,
+				Responses:    ad.generateResponses(method),
+				Stream:       designStream(method),
+			}
+			if apiService.Call != nil {
+				endpoint.Call = restCall(method, apiService.Type)
+			}
+			ad.routeEndpoint(&endpoint, method, ownerNoun(service.Name, service.Package), apiService.Path+ad.generatePath(method.Name))
+			if endpoint.Resource != "" && nameCounts[service.Name] > 1 && service.Package != "" {
+				endpoint.Path = "/" + strings.ToLower(service.Package) + endpoint.Path
+			}
+			ad.Endpoints = append(ad.Endpoints, endpoint)
+		}
+	}
+}
+
+// routeEndpoint fills in the method, path and parameters of endpoint, which
+// exposes fn. A path set by a directive is kept; otherwise fn is routed as a
+// resource, acting on owner when its name has no noun, and when it does not
+// fit one it is served at fallback.
+func (ad *APIDesigner) routeEndpoint(endpoint *APIEndpoint, fn analyzer.FunctionInfo, owner []string, fallback string) {
+	if endpoint.Path == "" {
+		if route, ok := routeResource(fn, owner); ok {
+			endpoint.Path = route.Path
+			endpoint.Resource = route.Resource
+			endpoint.Method, endpoint.MethodReason = ad.restMethod(fn, route)
+			endpoint.Parameters = ad.generateParameters(fn, endpoint.Method)
+			placePathParameters(endpoint.Parameters, route)
+			return
+		}
+		endpoint.Path = fallback
+	}
+	endpoint.Method, endpoint.MethodReason = ad.inferHTTPMethod(fn)
+	endpoint.Parameters = ad.generateParameters(fn, endpoint.Method)
+}
+
+// selected reports whether fn may be exposed at all.
+func (ad *APIDesigner) selected(fn analyzer.FunctionInfo) bool {
+	return !fn.Directives.Ignore && (!ad.ExposeOnly || fn.Directives.Expose)
+}
+
+// allowed reports whether fn is safe enough to expose, recording it in
+// Rejected when it is not.
+func (ad *APIDesigner) allowed(fn analyzer.FunctionInfo) bool {
+	if fn.RiskScore < analyzer.HighRiskScore || fn.Directives.AllowRisk || ad.AllowRisky {
+		return true
+	}
+	ad.Rejected = append(ad.Rejected, fn)
+	return false
+}
+
+// inferHTTPMethod chooses the HTTP method of fn from its directive, then from
+// the side effects found by the analyzer, and only when those are unknown
+// from its name. It returns the method and why it was chosen.
+func (ad *APIDesigner) inferHTTPMethod(fn analyzer.FunctionInfo) (string, string) {
+	if fn.Directives.Method != "" {
+		return fn.Directives.Method, "set by the soft-crusher:method directive"
+	}
+	if reason, ok := streamsOverGET(fn); ok {
+		return "GET", reason
+	}
+	because := ""
+	if fn.EffectReason != "" {
+		because = " (" + fn.EffectReason + ")"
+	}
+	lowercaseName := strings.ToLower(fn.Name)
+	switch fn.Effect {
+	case analyzer.EffectPure:
+		return "GET", "has no side effects"
+	case analyzer.EffectReadOnly:
+		return "GET", "only reads state" + because
+	case analyzer.EffectIdempotent:
+		if strings.HasPrefix(lowercaseName, "delete") || strings.HasPrefix(lowercaseName, "remove") {
+			return "DELETE", "removes state idempotently" + because
+		}
+		return "PUT", "changes state idempotently" + because
+	case analyzer.EffectNonIdempotent:
+		return "POST", "changes state on every call" + because
+	}
+
+	const fallback = "side effects unknown, "
 	switch {
 	case strings.HasPrefix(lowercaseName, "get"):
-		return "GET"
+		return "GET", fallback + "name starts with get"
 	case strings.HasPrefix(lowercaseName, "create") || strings.HasPrefix(lowercaseName, "add"):
-		return "POST"
+		return "POST", fallback + "name starts with create or add"
 	case strings.HasPrefix(lowercaseName, "update"):
-		return "PUT"
+		return "PUT", fallback + "name starts with update"
 	case strings.HasPrefix(lowercaseName, "delete"):
-		return "DELETE"
+		return "DELETE", fallback + "name starts with delete"
 	default:
-		return "POST"
+		return "POST", fallback + "POST by default"
 	}
 }
 
@@ -76,41 +353,171 @@ func (ad *APIDesigner) generatePath(funcName string) string {
 	return "/" + result.String()
 }
 
-func (ad *APIDesigner) generateParameters(args []string) []Parameter {
+// generateParameters places the parameters of fn in a request using the
+// given method. Directives come first, then roles: a reader parameter takes
+// the body, leaving the other parameters to the query. Requests without a
+// body, GET, HEAD and DELETE, carry the remaining parameters in the query;
+// the others carry scalars in the query only when a reader takes the body,
+// and everything else in a JSON body. Identifiers are moved to the path by
+// routeEndpoint once the path is known, and headers are only ever chosen by
+// directives.
+func (ad *APIDesigner) generateParameters(fn analyzer.FunctionInfo, method string) []Parameter {
+	bodyless := method == "GET" || method == "HEAD" || method == "DELETE"
+	streamed := hasRole(fn.Parameters, analyzer.RoleReader)
+
 	parameters := make([]Parameter, 0)
-	for _, arg := range args {
-		parts := strings.Split(arg, " ")
-		if len(parts) == 2 {
-			param := Parameter{
-				Name:     parts[0],
-				Type:     parts[1],
-				Location: "body", // Default to body, can be refined later
-			}
-			parameters = append(parameters, param)
+	for i, p := range fn.Parameters {
+		// Unnamed parameters are named as the generated server names their
+		// variables.
+		if p.Name == "" || p.Name == "_" {
+			p.Name = fmt.Sprintf("arg%d", i)
+		}
+		location := fn.Directives.ParamLocations[p.Name]
+		switch {
+		case location != "":
+		case p.Role == analyzer.RoleContext || p.Role == analyzer.RoleWriter:
+		case p.Role == analyzer.RoleReader:
+			location = "body"
+		case bodyless || streamed:
+			location = "query"
+		default:
+			location = "body"
 		}
+		parameters = append(parameters, Parameter{
+			Name:     p.Name,
+			Type:     p.Type,
+			Location: location,
+			Role:     p.Role,
+			Scalar:   scalarType(p),
+		})
 	}
 	return parameters
 }
 
-func (ad *APIDesigner) generateResponses(returns []string) []Response {
+// scalarTypes are the types, besides the predeclared ones, sent as text.
+var scalarTypes = map[string]bool{"time.Duration": true, "time.Time": true}
+
+// scalarType returns the Scalar of p: its type-checked underlying type when
+// it is basic, or else its type when that names a predeclared type.
+func scalarType(p analyzer.ParameterInfo) string {
+	if p.Resolved != nil {
+		switch {
+		case scalarTypes[p.Resolved.QualifiedName]:
+			return p.Resolved.QualifiedName
+		case p.Resolved.Kind == analyzer.KindBasic && p.Resolved.Underlying != "unsafe.Pointer":
+			return p.Resolved.Underlying
+		}
+		return ""
+	}
+	switch p.Type {
+	case "string", "bool", "byte", "rune",
+		"int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"float32", "float64":
+		return p.Type
+	}
+	if scalarTypes[p.Type] {
+		return p.Type
+	}
+	return ""
+}
+
+// generateResponses describes the success response of fn, leaving out its
+// error result, which becomes error responses instead, and streaming when fn
+// writes to a writer parameter or returns a channel or iter.Seq.
+func (ad *APIDesigner) generateResponses(fn analyzer.FunctionInfo) []Response {
 	responses := []Response{{StatusCode: 200, Type: "OK"}}
-	if len(returns) > 0 {
-		responses[0].Type = strings.Join(returns, ", ")
+	var types []string
+	for _, r := range fn.Results {
+		switch r.Role {
+		case analyzer.RoleError:
+			continue
+		case analyzer.RoleStream:
+			types = append(types, "stream of "+analyzer.StreamElem(r))
+			continue
+		}
+		types = append(types, r.Type)
+	}
+	if hasRole(fn.Parameters, analyzer.RoleWriter) {
+		types = append([]string{"stream"}, types...)
+	}
+	if len(types) > 0 {
+		responses[0].Type = strings.Join(types, ", ")
+	}
+	if hasRole(fn.Results, analyzer.RoleError) {
+		responses = append(responses, ad.errorResponses(fn)...)
 	}
 	return responses
 }
 
+func hasRole(params []analyzer.ParameterInfo, role analyzer.Role) bool {
+	for _, p := range params {
+		if p.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
 func (ad *APIDesigner) PrintAPIDesign() {
+	for _, service := range ad.Services {
+		fmt.Printf("Service: %s %s\n", service.Name, service.Path)
+		fmt.Printf("  Type: %s\n", service.Type)
+		fmt.Printf("  Constructor: %s\n", service.Constructor)
+		for _, param := range service.ConstructorParameters {
+			fmt.Printf("    - %s (%s)\n", param.Name, param.Type)
+		}
+		fmt.Println()
+	}
 	for _, endpoint := range ad.Endpoints {
 		fmt.Printf("Endpoint: %s %s\n", endpoint.Method, endpoint.Path)
+		if endpoint.MethodReason != "" {
+			fmt.Printf("  Method: %s\n", endpoint.MethodReason)
+		}
 		fmt.Printf("  Function: %s\n", endpoint.FunctionName)
+		if endpoint.Name != "" {
+			fmt.Printf("  Name: %s\n", endpoint.Name)
+		}
+		if endpoint.Resource != "" {
+			fmt.Printf("  Resource: %s\n", endpoint.Resource)
+		}
+		if endpoint.Service != "" {
+			fmt.Printf("  Service: %s\n", endpoint.Service)
+		}
+		if endpoint.Source.File != "" {
+			fmt.Printf("  Source: %s (%s)\n", endpoint.Source, endpoint.Package)
+		}
+		if len(endpoint.Tags) > 0 {
+			fmt.Printf("  Tags: %s\n", strings.Join(endpoint.Tags, ", "))
+		}
+		if endpoint.Auth != "" {
+			fmt.Printf("  Auth: %s\n", endpoint.Auth)
+		}
+		if endpoint.Stream != nil {
+			fmt.Printf("  Stream: %s over %s\n", endpoint.Stream.Source, endpoint.Stream.Transport)
+		}
 		fmt.Println("  Parameters:")
 		for _, param := range endpoint.Parameters {
-			fmt.Printf("    - %s (%s): %s\n", param.Name, param.Type, param.Location)
+			switch {
+			case param.Location == "":
+				fmt.Printf("    - %s (%s): %s\n", param.Name, param.Type, param.Role)
+			case param.Role != "":
+				fmt.Printf("    - %s (%s): %s, %s\n", param.Name, param.Type, param.Location, param.Role)
+			default:
+				fmt.Printf("    - %s (%s): %s\n", param.Name, param.Type, param.Location)
+			}
 		}
 		fmt.Println("  Responses:")
 		for _, resp := range endpoint.Responses {
-			fmt.Printf("    - %d: %s\n", resp.StatusCode, resp.Type)
+			if len(resp.Errors) == 0 {
+				fmt.Printf("    - %d: %s\n", resp.StatusCode, resp.Type)
+				continue
+			}
+			names := make([]string, len(resp.Errors))
+			for i, err := range resp.Errors {
+				names[i] = err.LocalName()
+			}
+			fmt.Printf("    - %d: %s (%s)\n", resp.StatusCode, resp.Type, strings.Join(names, ", "))
 		}
 		fmt.Println()
 	}
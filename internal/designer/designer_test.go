@@ -0,0 +1,376 @@
+package designer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+func TestDesignAPIDirectives(t *testing.T) {
+	functions := []analyzer.FunctionInfo{
+		{
+			Name: "GetOrCreateUser",
+			Doc:  "GetOrCreateUser returns the named user, creating it if needed.",
+			Parameters: []analyzer.ParameterInfo{
+				{Name: "name", Type: "string"},
+			},
+			Results: []analyzer.ParameterInfo{
+				{Type: "*User"},
+				{Type: "error"},
+			},
+			Directives: analyzer.Directives{
+				Method:         "PUT",
+				Path:           "/users/{name}",
+				Tags:           []string{"users"},
+				Auth:           "bearer",
+				ParamLocations: map[string]string{"name": "path"},
+			},
+		},
+		{
+			Name:       "helper",
+			Directives: analyzer.Directives{Ignore: true},
+		},
+		{
+			Name: "GetStatus",
+		},
+	}
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	require.Len(t, designer.Endpoints, 2)
+
+	assert.Equal(t, APIEndpoint{
+		Method:       "PUT",
+		MethodReason: "set by the soft-crusher:method directive",
+		Path:         "/users/{name}",
+		FunctionName: "GetOrCreateUser",
+		Description:  "GetOrCreateUser returns the named user, creating it if needed.",
+		Tags:         []string{"users"},
+		Auth:         "bearer",
+		Parameters:   []Parameter{{Name: "name", Type: "string", Location: "path", Scalar: "string"}},
+		Responses:    []Response{{StatusCode: 200, Type: "*User, error"}},
+	}, designer.Endpoints[0])
+
+	status := designer.Endpoints[1]
+	assert.Equal(t, "GET", status.Method)
+	assert.Equal(t, "/status", status.Path)
+}
+
+func TestDesignAPIExposeOnly(t *testing.T) {
+	designer := NewAPIDesigner()
+	designer.ExposeOnly = true
+	designer.DesignAPI([]analyzer.FunctionInfo{
+		{Name: "Compute", Directives: analyzer.Directives{Expose: true}},
+		{Name: "internalCompute"},
+	})
+
+	require.Len(t, designer.Endpoints, 1)
+	assert.Equal(t, "Compute", designer.Endpoints[0].FunctionName)
+}
+
+func TestDesignAPISourceMetadata(t *testing.T) {
+	source := analyzer.SourceRange{File: "users/users.go", Start: analyzer.Position{Line: 12, Column: 1}}
+	designer := NewAPIDesigner()
+	designer.DesignAPI([]analyzer.FunctionInfo{
+		{Name: "Get", Package: "users", PackagePath: "example.com/app/users", Source: source},
+		{Name: "Get", Package: "orders", PackagePath: "example.com/app/orders"},
+		{Name: "Ping", Package: "health", PackagePath: "example.com/app/health"},
+	})
+
+	require.Len(t, designer.Endpoints, 3)
+	assert.Equal(t, "/users/get", designer.Endpoints[0].Path)
+	assert.Equal(t, "example.com/app/users", designer.Endpoints[0].Package)
+	assert.Equal(t, source, designer.Endpoints[0].Source)
+	assert.Equal(t, "/orders/get", designer.Endpoints[1].Path)
+	assert.Equal(t, "/ping", designer.Endpoints[2].Path)
+}
+
+func TestDesignAPIRouteCollisions(t *testing.T) {
+	designer := NewAPIDesigner()
+	designer.DesignAPI([]analyzer.FunctionInfo{
+		{Name: "GetCart", Package: "users", Parameters: []analyzer.ParameterInfo{{Name: "id", Type: "string"}}},
+		{Name: "GetCart", Package: "orders", Parameters: []analyzer.ParameterInfo{{Name: "key", Type: "string"}}},
+		{Name: "GetUser", Package: "users", Parameters: []analyzer.ParameterInfo{{Name: "id", Type: "string"}}},
+		{Name: "GetUserByEmail", Package: "users", Parameters: []analyzer.ParameterInfo{{Name: "email", Type: "string"}}},
+	})
+
+	var paths []string
+	for _, endpoint := range designer.Endpoints {
+		paths = append(paths, endpoint.Path)
+	}
+	// Routes differing only in the names of their parameters collide.
+	assert.Equal(t, []string{"/users/carts/{id}", "/orders/carts/{key}", "/users/{id}", "/users/by-email/{email}"}, paths)
+}
+
+func TestDesignServices(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	method := func(name string) analyzer.FunctionInfo {
+		return analyzer.FunctionInfo{Name: name, Receiver: "*UserService", IsMethod: true, Package: "users", PackagePath: pkg}
+	}
+	getUser := method("GetUser")
+	getUser.Parameters = []analyzer.ParameterInfo{{Name: "id", Type: "string"}}
+	getUser.Results = []analyzer.ParameterInfo{{Type: "*User"}, {Type: "error"}}
+	ignored := method("Close")
+	ignored.Directives.Ignore = true
+
+	newService := analyzer.FunctionInfo{
+		Name:        "NewUserService",
+		Package:     "users",
+		PackagePath: pkg,
+		Parameters:  []analyzer.ParameterInfo{{Name: "db", Type: "*DB"}},
+		Results:     []analyzer.ParameterInfo{{Type: "*UserService"}},
+	}
+	newDefault := analyzer.FunctionInfo{
+		Name:        "NewDefaultUserService",
+		Package:     "users",
+		PackagePath: pkg,
+		Results:     []analyzer.ParameterInfo{{Type: "*UserService"}},
+	}
+	helper := analyzer.FunctionInfo{Name: "Validate", Receiver: "Validator", IsMethod: true, Package: "users", PackagePath: pkg}
+
+	services := []analyzer.ServiceInfo{
+		{
+			Name:         "UserService",
+			Package:      "users",
+			PackagePath:  pkg,
+			Doc:          "UserService manages users.",
+			Methods:      []analyzer.FunctionInfo{getUser, ignored},
+			Constructors: []analyzer.FunctionInfo{newService, newDefault},
+		},
+		// Without a constructor, methods are exposed one by one.
+		{Name: "Validator", Package: "users", PackagePath: pkg, Methods: []analyzer.FunctionInfo{helper}},
+	}
+
+	designer := NewAPIDesigner()
+	designer.DesignServices(services)
+	designer.DesignAPI([]analyzer.FunctionInfo{newService, newDefault, getUser, ignored, helper})
+
+	require.Len(t, designer.Services, 1)
+	assert.Equal(t, APIService{
+		Name:        "UserService",
+		Type:        "example.com/shop/users.UserService",
+		Package:     pkg,
+		Path:        "/user-service",
+		Description: "UserService manages users.",
+		Constructor: "NewDefaultUserService",
+		Instance:    "*UserService",
+		Call: &GoCall{Package: pkg, Function: "NewDefaultUserService", Service: "example.com/shop/users.UserService",
+			Results: []analyzer.ParameterInfo{{Type: "*UserService"}}},
+	}, designer.Services[0])
+
+	// Constructors are not endpoints of their own.
+	require.Len(t, designer.Endpoints, 2)
+	get := designer.Endpoints[0]
+	assert.Equal(t, "GET", get.Method)
+	assert.Equal(t, "/users/{id}", get.Path)
+	assert.Equal(t, "path", get.Parameters[0].Location)
+	assert.Equal(t, "example.com/shop/users.UserService", get.Service)
+	require.NotNil(t, get.Call)
+	assert.Equal(t, "example.com/shop/users.UserService", get.Call.Service)
+	assert.Equal(t, "/validate", designer.Endpoints[1].Path)
+	assert.Empty(t, designer.Endpoints[1].Service)
+}
+
+func TestDesignAPIRejectsHighRisk(t *testing.T) {
+	functions := []analyzer.FunctionInfo{
+		{Name: "RunCommand", RiskScore: 60},
+		{Name: "Reindex", RiskScore: 60, Directives: analyzer.Directives{AllowRisk: true}},
+		{Name: "ReadConfig", RiskScore: 30},
+	}
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	require.Len(t, designer.Endpoints, 2)
+	assert.Equal(t, "Reindex", designer.Endpoints[0].FunctionName)
+	assert.Equal(t, "ReadConfig", designer.Endpoints[1].FunctionName)
+	require.Len(t, designer.Rejected, 1)
+	assert.Equal(t, "RunCommand", designer.Rejected[0].Name)
+
+	designer = NewAPIDesigner()
+	designer.AllowRisky = true
+	designer.DesignAPI(functions)
+	assert.Len(t, designer.Endpoints, 3)
+	assert.Empty(t, designer.Rejected)
+}
+
+func TestDesignAPIMethodsFromEffects(t *testing.T) {
+	functions := []analyzer.FunctionInfo{
+		{Name: "GetOrCreateUser", Effect: analyzer.EffectNonIdempotent, EffectReason: "appends to users"},
+		{Name: "Compute", Effect: analyzer.EffectPure},
+		{Name: "Lookup", Effect: analyzer.EffectReadOnly, EffectReason: "reads cache"},
+		{Name: "SaveUser", Effect: analyzer.EffectIdempotent, EffectReason: "sets users[id]"},
+		{Name: "RemoveUser", Effect: analyzer.EffectIdempotent, EffectReason: "deletes from users"},
+		{Name: "UpdateLater"},
+	}
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	require.Len(t, designer.Endpoints, 6)
+
+	methods := make(map[string][2]string)
+	for _, endpoint := range designer.Endpoints {
+		methods[endpoint.FunctionName] = [2]string{endpoint.Method, endpoint.MethodReason}
+	}
+	assert.Equal(t, map[string][2]string{
+		"GetOrCreateUser": {"POST", "changes state on every call (appends to users)"},
+		"Compute":         {"GET", "has no side effects"},
+		"Lookup":          {"GET", "only reads state (reads cache)"},
+		"SaveUser":        {"PUT", "changes state idempotently (sets users[id])"},
+		"RemoveUser":      {"DELETE", "removes state idempotently (deletes from users)"},
+		"UpdateLater":     {"PUT", "side effects unknown, name starts with update"},
+	}, methods)
+}
+
+func TestDesignAPIParameterRoles(t *testing.T) {
+	functions := []analyzer.FunctionInfo{
+		{
+			Name:   "Upload",
+			Effect: analyzer.EffectIdempotent,
+			Parameters: []analyzer.ParameterInfo{
+				{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext},
+				{Name: "name", Type: "string"},
+				{Name: "body", Type: "io.Reader", Role: analyzer.RoleReader},
+			},
+			Results: []analyzer.ParameterInfo{
+				{Type: "int64"},
+				{Type: "error", Role: analyzer.RoleError},
+			},
+		},
+		{
+			Name:   "Export",
+			Effect: analyzer.EffectReadOnly,
+			Parameters: []analyzer.ParameterInfo{
+				{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter},
+				{Name: "opts", Type: "ExportOptions", Role: analyzer.RoleOptions},
+			},
+			Results: []analyzer.ParameterInfo{
+				{Type: "error", Role: analyzer.RoleError},
+			},
+		},
+	}
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	require.Len(t, designer.Endpoints, 2)
+
+	upload := designer.Endpoints[0]
+	assert.Equal(t, []Parameter{
+		{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext},
+		{Name: "name", Type: "string", Location: "query", Scalar: "string"},
+		{Name: "body", Type: "io.Reader", Location: "body", Role: analyzer.RoleReader},
+	}, upload.Parameters)
+	assert.Equal(t, []Response{{StatusCode: 200, Type: "int64"}, {StatusCode: 500, Type: "error"}}, upload.Responses)
+
+	export := designer.Endpoints[1]
+	assert.Equal(t, "GET", export.Method)
+	assert.Equal(t, []Parameter{
+		{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter},
+		{Name: "opts", Type: "ExportOptions", Location: "query", Role: analyzer.RoleOptions},
+	}, export.Parameters)
+	assert.Equal(t, []Response{{StatusCode: 200, Type: "stream"}, {StatusCode: 500, Type: "error"}}, export.Responses)
+}
+
+func TestDesignRoundTrip(t *testing.T) {
+	designer := NewAPIDesigner()
+	designer.DesignAPI([]analyzer.FunctionInfo{{
+		Name:       "GetUser",
+		Effect:     analyzer.EffectReadOnly,
+		Parameters: []analyzer.ParameterInfo{{Name: "id", Type: "string"}},
+	}})
+	design := designer.Design()
+
+	for _, format := range []string{analyzer.FormatJSON, analyzer.FormatYAML} {
+		var buf bytes.Buffer
+		require.NoError(t, design.Write(&buf, format))
+		read, err := ReadDesign(&buf)
+		require.NoError(t, err, format)
+		assert.Equal(t, design, read, format)
+	}
+
+	_, err := ReadDesign(strings.NewReader(`{"endpoints": []}`))
+	assert.EqualError(t, err, "not a soft-crusher design: missing version")
+}
+
+func TestDesignAPICalls(t *testing.T) {
+	designer := NewAPIDesigner()
+	designer.DesignAPI([]analyzer.FunctionInfo{
+		{Name: "Sum", Package: "calc", PackagePath: "example.com/app/calc", Effect: analyzer.EffectPure,
+			Parameters: []analyzer.ParameterInfo{{Type: "int"}, {Name: "_", Type: "int"}}, Results: []analyzer.ParameterInfo{{Type: "int"}}},
+		{Name: "helper", Package: "calc", PackagePath: "example.com/app/calc"},
+		{Name: "Run", Package: "main", PackagePath: "example.com/app"},
+		{Name: "Map", Package: "calc", PackagePath: "example.com/app/calc", IsGeneric: true},
+		{Name: "train", Language: "python", Package: "model", PackagePath: "model"},
+	})
+
+	require.Len(t, designer.Endpoints, 5)
+	sum := designer.Endpoints[0]
+	// Unnamed parameters are still sent, named after their position.
+	assert.Equal(t, []Parameter{
+		{Name: "arg0", Type: "int", Location: "query", Scalar: "int"},
+		{Name: "arg1", Type: "int", Location: "query", Scalar: "int"},
+	}, sum.Parameters)
+	require.NotNil(t, sum.Call)
+	assert.Equal(t, "example.com/app/calc", sum.Call.Package)
+	assert.Equal(t, "Sum", sum.Call.Function)
+	for _, endpoint := range designer.Endpoints[1:] {
+		assert.Nil(t, endpoint.Call, endpoint.FunctionName)
+	}
+}
+
+func TestDesignAPIParameterLocations(t *testing.T) {
+	userID := analyzer.ParameterInfo{
+		Name:     "userID",
+		Type:     "UserID",
+		Resolved: &analyzer.TypeInfo{QualifiedName: "example.com/shop.UserID", Name: "UserID", IsNamed: true, Kind: analyzer.KindBasic, Underlying: "int64"},
+	}
+	functions := []analyzer.FunctionInfo{
+		{
+			Name:   "ListOrders",
+			Effect: analyzer.EffectReadOnly,
+			Parameters: []analyzer.ParameterInfo{
+				userID,
+				{Name: "limit", Type: "int"},
+				{Name: "since", Type: "time.Time"},
+				{Name: "filter", Type: "Filter", Resolved: &analyzer.TypeInfo{QualifiedName: "example.com/shop.Filter", Kind: analyzer.KindStruct}},
+			},
+		},
+		{
+			Name:   "CreateOrder",
+			Effect: analyzer.EffectNonIdempotent,
+			Parameters: []analyzer.ParameterInfo{
+				userID,
+				{Name: "order", Type: "Order"},
+				{Name: "note", Type: "string"},
+				{Name: "token", Type: "string"},
+			},
+			Directives: analyzer.Directives{ParamLocations: map[string]string{"token": "header"}},
+		},
+	}
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	require.Len(t, designer.Endpoints, 2)
+
+	list := designer.Endpoints[0]
+	assert.Equal(t, "GET /users/{userID}/orders", list.Method+" "+list.Path)
+	assert.Equal(t, []Parameter{
+		{Name: "userID", Type: "UserID", Location: "path", Scalar: "int64"},
+		{Name: "limit", Type: "int", Location: "query", Scalar: "int"},
+		{Name: "since", Type: "time.Time", Location: "query", Scalar: "time.Time"},
+		{Name: "filter", Type: "Filter", Location: "query"},
+	}, list.Parameters)
+
+	create := designer.Endpoints[1]
+	assert.Equal(t, "POST /users/{userID}/orders", create.Method+" "+create.Path)
+	assert.Equal(t, []Parameter{
+		{Name: "userID", Type: "UserID", Location: "path", Scalar: "int64"},
+		{Name: "order", Type: "Order", Location: "body"},
+		{Name: "note", Type: "string", Location: "body", Scalar: "string"},
+		{Name: "token", Type: "string", Location: "header", Scalar: "string"},
+	}, create.Parameters)
+}
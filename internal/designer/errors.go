@@ -0,0 +1,85 @@
+package designer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// ErrorRule maps the errors it matches to the status code of their
+// response. Match is the qualified name of an error, such as
+// "example.com/shop.ErrQuota", or a part of its name within its package:
+// "NotFound" matches ErrNotFound and UserNotFoundError alike, whatever the
+// case.
+type ErrorRule struct {
+	Match  string `json:"match" yaml:"match"`
+	Status int    `json:"status" yaml:"status"`
+}
+
+// DefaultErrorRules map errors to status codes by the usual words of their
+// names. Errors none of them match answer 500 Internal Server Error.
+var DefaultErrorRules = []ErrorRule{
+	{Match: "Unauthorized", Status: 401},
+	{Match: "Unauthenticated", Status: 401},
+	{Match: "Forbidden", Status: 403},
+	{Match: "Permission", Status: 403},
+	{Match: "Denied", Status: 403},
+	{Match: "NotFound", Status: 404},
+	{Match: "NotExist", Status: 404},
+	{Match: "NoRows", Status: 404},
+	{Match: "Exists", Status: 409},
+	{Match: "Conflict", Status: 409},
+	{Match: "Duplicate", Status: 409},
+	{Match: "Invalid", Status: 400},
+	{Match: "Validation", Status: 400},
+	{Match: "BadRequest", Status: 400},
+	{Match: "Malformed", Status: 400},
+	{Match: "TooMany", Status: 429},
+	{Match: "RateLimit", Status: 429},
+	{Match: "NotImplemented", Status: 501},
+	{Match: "Unsupported", Status: 501},
+	{Match: "Unavailable", Status: 503},
+	{Match: "Timeout", Status: 504},
+	{Match: "Deadline", Status: 504},
+}
+
+func (rule ErrorRule) matches(err analyzer.ErrorInfo) bool {
+	return rule.Match == err.Name || strings.Contains(strings.ToLower(err.LocalName()), strings.ToLower(rule.Match))
+}
+
+// errorStatus returns the status code of the response to err: that of the
+// first of ErrorRules, then DefaultErrorRules, matching it, or 500.
+func (ad *APIDesigner) errorStatus(err analyzer.ErrorInfo) int {
+	for _, rules := range [][]ErrorRule{ad.ErrorRules, DefaultErrorRules} {
+		for _, rule := range rules {
+			if rule.matches(err) {
+				return rule.Status
+			}
+		}
+	}
+	return 500
+}
+
+// errorResponses describes the error responses of fn, one per status code
+// its errors map to, and always one for 500 Internal Server Error, which
+// answers the errors the analysis could not name. Every one has a problem
+// details body.
+func (ad *APIDesigner) errorResponses(fn analyzer.FunctionInfo) []Response {
+	byStatus := map[int][]analyzer.ErrorInfo{500: nil}
+	for _, err := range fn.Errors {
+		status := ad.errorStatus(err)
+		byStatus[status] = append(byStatus[status], err)
+	}
+	statuses := make([]int, 0, len(byStatus))
+	for status := range byStatus {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+
+	responses := make([]Response, len(statuses))
+	for i, status := range statuses {
+		responses[i] = Response{StatusCode: status, Type: "error", Errors: byStatus[status]}
+	}
+	return responses
+}
@@ -0,0 +1,48 @@
+package designer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+func TestDesignAPIErrorResponses(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	notFound := analyzer.ErrorInfo{Name: pkg + ".ErrNotFound", Kind: analyzer.ErrorSentinel}
+	noRows := analyzer.ErrorInfo{Name: "database/sql.ErrNoRows", Kind: analyzer.ErrorSentinel}
+	invalid := analyzer.ErrorInfo{Name: pkg + ".ValidationError", Kind: analyzer.ErrorType, Pointer: true}
+	quota := analyzer.ErrorInfo{Name: pkg + ".ErrQuota", Kind: analyzer.ErrorSentinel}
+	eof := analyzer.ErrorInfo{Name: "io.EOF", Kind: analyzer.ErrorSentinel}
+	failure := []analyzer.ParameterInfo{{Type: "error", Role: analyzer.RoleError}}
+
+	overrides, err := ReadOverrides(strings.NewReader("errors:\n  - match: " + pkg + ".ErrQuota\n    status: 429\n"))
+	require.NoError(t, err)
+
+	designer := NewAPIDesigner()
+	designer.ErrorRules = overrides.Errors
+	designer.DesignAPI([]analyzer.FunctionInfo{
+		{Name: "UpdateUser", Package: "users", PackagePath: pkg, Results: failure,
+			Errors: []analyzer.ErrorInfo{noRows, eof, notFound, quota, invalid}},
+		{Name: "Ping", Package: "users", PackagePath: pkg, Results: failure},
+		{Name: "Version", Package: "users", PackagePath: pkg, Results: []analyzer.ParameterInfo{{Type: "string"}}},
+	})
+	require.Len(t, designer.Endpoints, 3)
+
+	assert.Equal(t, []Response{
+		{StatusCode: 200, Type: "OK"},
+		{StatusCode: 400, Type: "error", Errors: []analyzer.ErrorInfo{invalid}},
+		{StatusCode: 404, Type: "error", Errors: []analyzer.ErrorInfo{noRows, notFound}},
+		{StatusCode: 429, Type: "error", Errors: []analyzer.ErrorInfo{quota}},
+		{StatusCode: 500, Type: "error", Errors: []analyzer.ErrorInfo{eof}},
+	}, designer.Endpoints[0].Responses)
+	// Errors the analysis could not name still answer 500.
+	assert.Equal(t, []Response{
+		{StatusCode: 200, Type: "OK"},
+		{StatusCode: 500, Type: "error"},
+	}, designer.Endpoints[1].Responses)
+	assert.Equal(t, []Response{{StatusCode: 200, Type: "string"}}, designer.Endpoints[2].Responses)
+}
@@ -0,0 +1,102 @@
+package designer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// DesignVersion is the version of the Design document layout. Like
+// analyzer.AnalysisVersion, it changes only when a field is renamed or
+// removed.
+const DesignVersion = 1
+
+// Design is the exported result of designing an API, so that designs can be
+// kept and compared across releases.
+type Design struct {
+	Version   int           `json:"version" yaml:"version"`
+	Services  []APIService  `json:"services,omitempty" yaml:"services,omitempty"`
+	Endpoints []APIEndpoint `json:"endpoints" yaml:"endpoints"`
+	// GraphQL is the GraphQL schema of the endpoints, when one was designed.
+	GraphQL *GraphQLDesign `json:"graphql,omitempty" yaml:"graphql,omitempty"`
+	// Proto is the proto definition of the endpoints, when one was
+	// designed.
+	Proto *ProtoDesign `json:"proto,omitempty" yaml:"proto,omitempty"`
+	// JSONRPC is the JSON-RPC methods of the endpoints, when they were
+	// designed.
+	JSONRPC *JSONRPCDesign `json:"jsonrpc,omitempty" yaml:"jsonrpc,omitempty"`
+}
+
+// Design returns the services and endpoints designed so far as a Design
+// document.
+func (ad *APIDesigner) Design() *Design {
+	return &Design{
+		Version:   DesignVersion,
+		Services:  ad.Services,
+		Endpoints: ad.Endpoints,
+		GraphQL:   ad.GraphQL,
+		Proto:     ad.Proto,
+		JSONRPC:   ad.JSONRPC,
+	}
+}
+
+// Write encodes the design to w as analyzer.FormatJSON or analyzer.FormatYAML.
+func (d *Design) Write(w io.Writer, format string) error {
+	switch format {
+	case analyzer.FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(d)
+	case analyzer.FormatYAML:
+		data, err := yaml.Marshal(d)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		return fmt.Errorf("unknown format %q, expected %s or %s", format, analyzer.FormatJSON, analyzer.FormatYAML)
+	}
+}
+
+// ReadDesign decodes a Design written in JSON or YAML.
+func ReadDesign(r io.Reader) (*Design, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var design Design
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(data, &design)
+	} else {
+		err = yaml.Unmarshal(data, &design)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error decoding design: %v", err)
+	}
+
+	switch {
+	case design.Version == 0:
+		return nil, fmt.Errorf("not a soft-crusher design: missing version")
+	case design.Version > DesignVersion:
+		return nil, fmt.Errorf("design version %d is newer than the supported version %d", design.Version, DesignVersion)
+	}
+	return &design, nil
+}
+
+// LoadDesign reads a Design from a file written by Design.Write.
+func LoadDesign(path string) (*Design, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadDesign(f)
+}
@@ -0,0 +1,470 @@
+package designer
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// GraphQLDesign is the GraphQL view of the designed endpoints: those that
+// only read become Query fields, the others Mutation fields, and the structs
+// they take and return input and object types.
+type GraphQLDesign struct {
+	Query    []GraphQLField `json:"query,omitempty" yaml:"query,omitempty"`
+	Mutation []GraphQLField `json:"mutation,omitempty" yaml:"mutation,omitempty"`
+	// Types are the object, input and scalar types the fields refer to,
+	// sorted by name.
+	Types []GraphQLType `json:"types,omitempty" yaml:"types,omitempty"`
+	// Constructors build the instances of the services whose methods
+	// fields call.
+	Constructors []GoCall `json:"constructors,omitempty" yaml:"constructors,omitempty"`
+	// Skipped lists the endpoints GraphQL cannot express, and why.
+	Skipped []string `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+}
+
+// GraphQLField is a field of the Query or Mutation type, resolved by calling
+// a Go function.
+type GraphQLField struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Args        []GraphQLArgument `json:"args,omitempty" yaml:"args,omitempty"`
+	// Type is the type of the field in SDL, e.g. "User!" or "[Order!]!".
+	Type string `json:"type" yaml:"type"`
+	Call GoCall `json:"call" yaml:"call"`
+}
+
+// GraphQLArgument is an argument of a field, passed as the Go parameter of
+// the same name.
+type GraphQLArgument struct {
+	Name string `json:"name" yaml:"name"`
+	Type string `json:"type" yaml:"type"`
+}
+
+// GraphQLType is a named type of the schema. Kind is "type" for objects,
+// "input" for input objects, or "scalar".
+type GraphQLType struct {
+	Name        string             `json:"name" yaml:"name"`
+	Kind        string             `json:"kind" yaml:"kind"`
+	Description string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Fields      []GraphQLTypeField `json:"fields,omitempty" yaml:"fields,omitempty"`
+	GoType      string             `json:"goType,omitempty" yaml:"goType,omitempty"`
+}
+
+// GraphQLTypeField is a field of an object or input type, named after the
+// JSON name of the Go struct field.
+type GraphQLTypeField struct {
+	Name        string `json:"name" yaml:"name"`
+	Type        string `json:"type" yaml:"type"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// GraphQL scalars for Go values with no closer GraphQL type: maps,
+// interfaces and types the analysis could not resolve travel as JSON, and
+// integers that may not fit the 32 bits of Int as Int64.
+const (
+	graphQLJSON  = "JSON"
+	graphQLInt64 = "Int64"
+)
+
+var graphQLScalarDescriptions = map[string]string{
+	graphQLJSON:  "Any JSON value.",
+	graphQLInt64: "A 64-bit integer, written as a string since Int has 32 bits.",
+}
+
+// DesignGraphQL derives GraphQL from the endpoints designed so far and
+// stores it in GraphQL, so that the methods, names and exclusions decided
+// for REST, overrides included, carry over. functions are the analyzed
+// functions the endpoints expose, and schemas the analyzed struct types;
+// without them, as after an analysis without type checking, structs are
+// JSON values. Functions reading or writing streams are skipped.
+func (ad *APIDesigner) DesignGraphQL(functions []analyzer.FunctionInfo, schemas map[string]*analyzer.TypeSchema) {
+	b := &graphQLBuilder{schemas: schemas, types: make(map[string]*GraphQLType), names: make(map[string]string)}
+	design := &GraphQLDesign{}
+	seen := make(map[string]bool)
+
+	for _, endpoint := range ad.Endpoints {
+		fn, ok := findExposed(functions, endpoint)
+		if !ok {
+			continue
+		}
+		if reason := unsupportedCall(fn); reason != "" {
+			design.Skipped = append(design.Skipped, fmt.Sprintf("%s: %s", fn.QualifiedName(), reason))
+			continue
+		}
+
+		field := GraphQLField{
+			Name:        graphQLFieldName(endpoint, fn),
+			Description: endpoint.Description,
+			Call: GoCall{
+				Package:    fn.PackagePath,
+				Function:   fn.Name,
+				Service:    endpoint.Service,
+				Parameters: fn.Parameters,
+				Results:    fn.Results,
+			},
+		}
+		for _, param := range fn.Parameters {
+			if param.Role == analyzer.RoleContext {
+				continue
+			}
+			argType := b.typeOf(param.Type, param.Resolved, fn.PackagePath, true)
+			// Options and variadic arguments can be left out.
+			if param.Role == analyzer.RoleOptions || strings.HasPrefix(param.Type, "...") {
+				argType = strings.TrimSuffix(argType, "!")
+			}
+			field.Args = append(field.Args, GraphQLArgument{Name: param.Name, Type: argType})
+		}
+		field.Type = b.resultType(fn)
+
+		// Two functions of the same name in different packages or
+		// services are told apart by their package.
+		if seen[field.Name] {
+			field.Name = lowerCamel(append([]string{fn.Package}, splitWords(field.Name)...))
+		}
+		seen[field.Name] = true
+
+		if endpoint.Method == "GET" || endpoint.Method == "HEAD" {
+			design.Query = append(design.Query, field)
+		} else {
+			design.Mutation = append(design.Mutation, field)
+		}
+	}
+
+	design.Constructors = ad.constructorCalls(functions)
+
+	for _, t := range b.types {
+		design.Types = append(design.Types, *t)
+	}
+	sort.Slice(design.Types, func(i, j int) bool { return design.Types[i].Name < design.Types[j].Name })
+	ad.GraphQL = design
+}
+
+// graphQLFieldName names the field of an endpoint after its operation name,
+// or its function, completed with the resource of its service when the
+// function name leaves it out: Get of UserService is getUser, and List of
+// users.Store is listUsers.
+func graphQLFieldName(endpoint APIEndpoint, fn analyzer.FunctionInfo) string {
+	if endpoint.Name != "" {
+		return lowerCamel(splitWords(endpoint.Name))
+	}
+	words := splitWords(fn.Name)
+	if endpoint.Service == "" {
+		return lowerCamel(words)
+	}
+	noun := ownerNoun(endpoint.Service[strings.LastIndex(endpoint.Service, ".")+1:], fn.Package)
+	if len(noun) == 0 {
+		return lowerCamel(words)
+	}
+	noun = append(noun[:len(noun)-1:len(noun)-1], singular(noun[len(noun)-1]))
+	if strings.Contains(strings.ToLower(fn.Name), strings.ToLower(strings.Join(noun, ""))) {
+		return lowerCamel(words)
+	}
+	if returnsList(fn) {
+		noun = pluralize(noun)
+	}
+	return lowerCamel(append(words, noun...))
+}
+
+// singular returns an English word in the singular.
+func singular(word string) string {
+	lower := strings.ToLower(word)
+	for one, many := range irregularPlurals {
+		if lower == many {
+			return one
+		}
+	}
+	switch {
+	case !isPlural(word):
+		return word
+	case strings.HasSuffix(lower, "ies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(lower, "sses"), strings.HasSuffix(lower, "xes"), strings.HasSuffix(lower, "zes"),
+		strings.HasSuffix(lower, "ches"), strings.HasSuffix(lower, "shes"):
+		return word[:len(word)-2]
+	}
+	return word[:len(word)-1]
+}
+
+func returnsList(fn analyzer.FunctionInfo) bool {
+	for _, result := range fn.Results {
+		if strings.HasPrefix(result.Type, "[]") {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerCamel joins words as a lowerCamelCase identifier.
+func lowerCamel(words []string) string {
+	var b strings.Builder
+	for i, word := range words {
+		if i == 0 {
+			b.WriteString(strings.ToLower(word))
+			continue
+		}
+		runes := []rune(strings.ToLower(word))
+		if len(runes) > 0 {
+			runes[0] = unicode.ToUpper(runes[0])
+		}
+		b.WriteString(string(runes))
+	}
+	return b.String()
+}
+
+// graphQLBuilder maps Go types to GraphQL types, declaring the object,
+// input and scalar types it needs along the way.
+type graphQLBuilder struct {
+	schemas map[string]*analyzer.TypeSchema
+	types   map[string]*GraphQLType
+	// names holds the GraphQL name given to each Go struct, keyed by its
+	// qualified name and whether it is an input.
+	names map[string]string
+}
+
+// resultType returns the type of the field calling fn: its only result
+// besides the error, Boolean when there is none, and a JSON list of the
+// results when there are several.
+func (b *graphQLBuilder) resultType(fn analyzer.FunctionInfo) string {
+	var values []analyzer.ParameterInfo
+	for _, result := range fn.Results {
+		if result.Role != analyzer.RoleError {
+			values = append(values, result)
+		}
+	}
+	switch len(values) {
+	case 0:
+		return "Boolean!"
+	case 1:
+		return b.typeOf(values[0].Type, values[0].Resolved, fn.PackagePath, false)
+	default:
+		b.scalar(graphQLJSON)
+		return "[" + graphQLJSON + "]!"
+	}
+}
+
+var graphQLScalars = map[string]string{
+	"string": "String", "bool": "Boolean",
+	"int": "Int", "int8": "Int", "int16": "Int", "int32": "Int", "int64": graphQLInt64, "rune": "Int",
+	"uint": "Int", "uint8": "Int", "uint16": "Int", "uint32": graphQLInt64, "uint64": graphQLInt64, "byte": "Int", "uintptr": graphQLInt64,
+	"float32": "Float", "float64": "Float",
+	// Both travel the way encoding/json writes them.
+	"time.Time": "String", "time.Duration": graphQLInt64,
+}
+
+// scalarType returns the GraphQL scalar of the Go type goType, declaring it
+// when it is not built in, or "" when goType has none.
+func (b *graphQLBuilder) scalarType(goType string) string {
+	name := graphQLScalars[goType]
+	if name == graphQLInt64 {
+		b.scalar(name)
+	}
+	return name
+}
+
+// typeOf returns the GraphQL type of a Go type as written in package pkg,
+// or as resolved when the analysis was type-checked. Values are non-null
+// and pointers nullable.
+func (b *graphQLBuilder) typeOf(goType string, resolved *analyzer.TypeInfo, pkg string, input bool) string {
+	if resolved != nil {
+		return b.resolvedType(resolved, input)
+	}
+
+	switch {
+	case strings.HasPrefix(goType, "*"):
+		return strings.TrimSuffix(b.typeOf(goType[1:], nil, pkg, input), "!")
+	case goType == "[]byte":
+		return "String!"
+	case strings.HasPrefix(goType, "[]"):
+		return "[" + b.typeOf(goType[2:], nil, pkg, input) + "]!"
+	case strings.HasPrefix(goType, "..."):
+		return "[" + b.typeOf(goType[3:], nil, pkg, input) + "]!"
+	case b.scalarType(goType) != "":
+		return b.scalarType(goType) + "!"
+	}
+	if !strings.ContainsAny(goType, "[]().{} ") {
+		if schema := b.schemas[pkg+"."+goType]; schema != nil {
+			return b.namedType(schema, input)
+		}
+	}
+	b.scalar(graphQLJSON)
+	return graphQLJSON + "!"
+}
+
+func (b *graphQLBuilder) resolvedType(ti *analyzer.TypeInfo, input bool) string {
+	if name := b.scalarType(ti.QualifiedName); name != "" {
+		return name + "!"
+	}
+	if ti.IsNamed {
+		if schema := b.schemas[ti.QualifiedName]; schema != nil {
+			switch {
+			case schema.Kind == analyzer.KindStruct:
+				return b.namedType(schema, input)
+			case schema.Elem != nil && (schema.Kind == analyzer.KindSlice || schema.Kind == analyzer.KindArray):
+				return "[" + b.resolvedType(schema.Elem, input) + "]!"
+			case schema.Elem != nil && schema.Kind == analyzer.KindPointer:
+				return strings.TrimSuffix(b.resolvedType(schema.Elem, input), "!")
+			}
+		}
+		if ti.Kind == analyzer.KindBasic && graphQLScalars[ti.Underlying] != "" {
+			return b.scalarType(ti.Underlying) + "!"
+		}
+		b.scalar(graphQLJSON)
+		return graphQLJSON + "!"
+	}
+
+	switch ti.Kind {
+	case analyzer.KindBasic:
+		if name := b.scalarType(ti.Underlying); name != "" {
+			return name + "!"
+		}
+	case analyzer.KindPointer:
+		if ti.Elem != nil {
+			return strings.TrimSuffix(b.resolvedType(ti.Elem, input), "!")
+		}
+	case analyzer.KindSlice, analyzer.KindArray:
+		if ti.Elem != nil && ti.Elem.QualifiedName == "byte" {
+			return "String!"
+		}
+		if ti.Elem != nil {
+			return "[" + b.resolvedType(ti.Elem, input) + "]!"
+		}
+	}
+	b.scalar(graphQLJSON)
+	return graphQLJSON + "!"
+}
+
+// namedType declares the object or input type of a struct, named after the
+// Go type, and returns it.
+func (b *graphQLBuilder) namedType(schema *analyzer.TypeSchema, input bool) string {
+	key := fmt.Sprintf("%s %t", schema.Name, input)
+	if name, ok := b.names[key]; ok {
+		return name + "!"
+	}
+
+	name := schema.TypeName
+	if name == "" {
+		name = schema.Name[strings.LastIndex(schema.Name, ".")+1:]
+	}
+	if input {
+		name += "Input"
+	}
+	if _, taken := b.types[name]; taken {
+		pkg := schema.PkgPath[strings.LastIndex(schema.PkgPath, "/")+1:]
+		name = strings.ToUpper(pkg[:min(len(pkg), 1)]) + pkg[min(len(pkg), 1):] + name
+	}
+	kind := "type"
+	if input {
+		kind = "input"
+	}
+	t := &GraphQLType{Name: name, Kind: kind, Description: schema.Doc, GoType: schema.Name}
+	// Declared before the fields, so that recursive types end.
+	b.names[key] = name
+	b.types[name] = t
+	t.Fields = b.fields(schema, input)
+	return name + "!"
+}
+
+// fields returns the fields of a struct as encoding/json sees them, with
+// those of embedded structs promoted.
+func (b *graphQLBuilder) fields(schema *analyzer.TypeSchema, input bool) []GraphQLTypeField {
+	var fields []GraphQLTypeField
+	for _, field := range schema.Fields {
+		if promoted(field) {
+			if embedded := b.schemas[strings.TrimPrefix(field.Type.QualifiedName, "*")]; embedded != nil && embedded.Kind == analyzer.KindStruct {
+				fields = append(fields, b.fields(embedded, input)...)
+				continue
+			}
+		}
+		name := field.JSONName
+		if name == "" {
+			name = field.Name
+		}
+		fieldType := b.resolvedType(field.Type, input)
+		if field.OmitEmpty && !field.Required() {
+			fieldType = strings.TrimSuffix(fieldType, "!")
+		}
+		fields = append(fields, GraphQLTypeField{Name: name, Type: fieldType, Description: field.Doc})
+	}
+	if len(fields) == 0 {
+		// GraphQL types need a field; an empty struct is an empty object.
+		b.scalar(graphQLJSON)
+		fields = append(fields, GraphQLTypeField{Name: "_empty", Type: graphQLJSON})
+	}
+	return fields
+}
+
+// promoted reports whether encoding/json promotes the fields of an embedded
+// field, which it does unless a tag names the field.
+func promoted(field analyzer.FieldSchema) bool {
+	name, _, _ := strings.Cut(reflect.StructTag(field.Tag).Get("json"), ",")
+	return field.Embedded && name == ""
+}
+
+func (b *graphQLBuilder) scalar(name string) {
+	if _, ok := b.types[name]; !ok {
+		b.types[name] = &GraphQLType{Name: name, Kind: "scalar", Description: graphQLScalarDescriptions[name]}
+	}
+}
+
+// SDL writes the schema in the GraphQL schema definition language.
+func (g *GraphQLDesign) SDL() string {
+	var b strings.Builder
+	writeDescription := func(indent, description string) {
+		if description = strings.TrimSpace(description); description != "" {
+			fmt.Fprintf(&b, "%s\"\"\"\n%s%s\n%s\"\"\"\n", indent, indent,
+				strings.ReplaceAll(strings.ReplaceAll(description, `"""`, `\"""`), "\n", "\n"+indent), indent)
+		}
+	}
+
+	b.WriteString("schema {\n")
+	if len(g.Query) > 0 {
+		b.WriteString("  query: Query\n")
+	}
+	if len(g.Mutation) > 0 {
+		b.WriteString("  mutation: Mutation\n")
+	}
+	b.WriteString("}\n")
+
+	for _, root := range []struct {
+		name   string
+		fields []GraphQLField
+	}{{"Query", g.Query}, {"Mutation", g.Mutation}} {
+		if len(root.fields) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\ntype %s {\n", root.name)
+		for _, field := range root.fields {
+			writeDescription("  ", field.Description)
+			args := make([]string, len(field.Args))
+			for i, arg := range field.Args {
+				args[i] = arg.Name + ": " + arg.Type
+			}
+			if len(args) > 0 {
+				fmt.Fprintf(&b, "  %s(%s): %s\n", field.Name, strings.Join(args, ", "), field.Type)
+			} else {
+				fmt.Fprintf(&b, "  %s: %s\n", field.Name, field.Type)
+			}
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, t := range g.Types {
+		b.WriteString("\n")
+		writeDescription("", t.Description)
+		if t.Kind == "scalar" {
+			fmt.Fprintf(&b, "scalar %s\n", t.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s {\n", t.Kind, t.Name)
+		for _, field := range t.Fields {
+			writeDescription("  ", field.Description)
+			fmt.Fprintf(&b, "  %s: %s\n", field.Name, field.Type)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package designer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+func TestDesignGraphQL(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	user := &analyzer.TypeInfo{QualifiedName: pkg + ".User", Name: "User", PkgPath: pkg, Kind: analyzer.KindStruct, IsNamed: true}
+	text := &analyzer.TypeInfo{QualifiedName: "string", Name: "string", Kind: analyzer.KindBasic, Underlying: "string", IsNamed: true}
+	schemas := map[string]*analyzer.TypeSchema{
+		pkg + ".User": {Name: pkg + ".User", TypeName: "User", PkgPath: pkg, Kind: analyzer.KindStruct, Doc: "User is a customer.",
+			Fields: []analyzer.FieldSchema{
+				{Name: "ID", Type: text, JSONName: "id"},
+				{Name: "Email", Type: text, JSONName: "email", OmitEmpty: true},
+				// Int has 32 bits, too few for an int64.
+				{Name: "Visits", Type: &analyzer.TypeInfo{QualifiedName: "int64", Name: "int64", Kind: analyzer.KindBasic, Underlying: "int64", IsNamed: true}, JSONName: "visits"},
+				{Name: "Friends", JSONName: "friends", Type: &analyzer.TypeInfo{QualifiedName: "[]*" + pkg + ".User", Kind: analyzer.KindSlice,
+					Elem: &analyzer.TypeInfo{QualifiedName: "*" + pkg + ".User", Kind: analyzer.KindPointer, Elem: user}}},
+				{Name: "Address", Embedded: true, Type: &analyzer.TypeInfo{QualifiedName: pkg + ".Address", Name: "Address", PkgPath: pkg, Kind: analyzer.KindStruct, IsNamed: true}},
+			}},
+		pkg + ".Address": {Name: pkg + ".Address", TypeName: "Address", PkgPath: pkg, Kind: analyzer.KindStruct,
+			Fields: []analyzer.FieldSchema{{Name: "City", Type: text, JSONName: "city"}}},
+	}
+
+	method := func(name string, params, results []analyzer.ParameterInfo) analyzer.FunctionInfo {
+		return analyzer.FunctionInfo{Name: name, Receiver: "*Store", IsMethod: true, Package: "users", PackagePath: pkg,
+			Parameters: params, Results: results}
+	}
+	failure := analyzer.ParameterInfo{Type: "error", Role: analyzer.RoleError}
+	get := method("Get", []analyzer.ParameterInfo{{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext}, {Name: "id", Type: "string"}},
+		[]analyzer.ParameterInfo{{Type: "*User"}, failure})
+	get.Effect = analyzer.EffectReadOnly
+	list := method("List", []analyzer.ParameterInfo{{Name: "limit", Type: "int"}, {Name: "tags", Type: "...string"}},
+		[]analyzer.ParameterInfo{{Type: "[]User"}})
+	list.Effect = analyzer.EffectReadOnly
+	save := method("Save", []analyzer.ParameterInfo{{Name: "user", Type: "User"}}, []analyzer.ParameterInfo{failure})
+	newStore := analyzer.FunctionInfo{Name: "NewStore", Package: "users", PackagePath: pkg, Results: []analyzer.ParameterInfo{{Type: "*Store"}}}
+	version := analyzer.FunctionInfo{Name: "Version", Package: "users", PackagePath: pkg, Results: []analyzer.ParameterInfo{{Type: "string"}}}
+	stats := analyzer.FunctionInfo{Name: "GetStats", Package: "users", PackagePath: pkg, Results: []analyzer.ParameterInfo{{Type: "int"}, {Type: "map[string]int"}}}
+	export := analyzer.FunctionInfo{Name: "Export", Package: "users", PackagePath: pkg,
+		Parameters: []analyzer.ParameterInfo{{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter}}, Results: []analyzer.ParameterInfo{failure}}
+	functions := []analyzer.FunctionInfo{newStore, get, list, save, version, stats, export}
+
+	designer := NewAPIDesigner()
+	designer.DesignServices([]analyzer.ServiceInfo{{Name: "Store", Package: "users", PackagePath: pkg,
+		Methods: []analyzer.FunctionInfo{get, list, save}, Constructors: []analyzer.FunctionInfo{newStore}}})
+	designer.DesignAPI(functions)
+	designer.DesignGraphQL(functions, schemas)
+	design := designer.GraphQL
+	require.NotNil(t, design)
+
+	fieldNames := func(fields []GraphQLField) []string {
+		var names []string
+		for _, field := range fields {
+			names = append(names, field.Name)
+		}
+		return names
+	}
+	// Methods are named after their service's resource.
+	assert.Equal(t, []string{"getUser", "listUsers", "getStats"}, fieldNames(design.Query))
+	assert.Equal(t, []string{"saveUser", "version"}, fieldNames(design.Mutation))
+	assert.Equal(t, []string{pkg + ".Export: parameter w is written as a stream"}, design.Skipped)
+	require.Len(t, design.Constructors, 1)
+	assert.Equal(t, "NewStore", design.Constructors[0].Function)
+	assert.Equal(t, pkg+".Store", design.Constructors[0].Service)
+	assert.Equal(t, pkg+".Store", design.Query[0].Call.Service)
+
+	assert.Equal(t, `schema {
+  query: Query
+  mutation: Mutation
+}
+
+type Query {
+  getUser(id: String!): User
+  listUsers(limit: Int!, tags: [String!]): [User!]!
+  getStats: [JSON]!
+}
+
+type Mutation {
+  saveUser(user: UserInput!): Boolean!
+  version: String!
+}
+
+"""
+A 64-bit integer, written as a string since Int has 32 bits.
+"""
+scalar Int64
+
+"""
+Any JSON value.
+"""
+scalar JSON
+
+"""
+User is a customer.
+"""
+type User {
+  id: String!
+  email: String
+  visits: Int64!
+  friends: [User]!
+  city: String!
+}
+
+"""
+User is a customer.
+"""
+input UserInput {
+  id: String!
+  email: String
+  visits: Int64!
+  friends: [UserInput]!
+  city: String!
+}
+`, design.SDL())
+}
@@ -0,0 +1,453 @@
+package designer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// JSONRPCDesign is the JSON-RPC 2.0 view of the designed endpoints: every
+// function is a method named after its package, and the structs it takes
+// and returns are JSON schemas, from which OpenRPC describes the API.
+type JSONRPCDesign struct {
+	Methods []JSONRPCMethod `json:"methods,omitempty" yaml:"methods,omitempty"`
+	// Schemas are the schemas of the structs the methods refer to, by
+	// name.
+	Schemas map[string]*JSONSchema `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+	// Constructors build the instances of the services whose methods are
+	// called.
+	Constructors []GoCall `json:"constructors,omitempty" yaml:"constructors,omitempty"`
+	// Skipped lists the endpoints JSON-RPC cannot express, and why.
+	Skipped []string `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+}
+
+// JSONRPCMethod is a method calling a Go function. Its params can be sent by
+// name or by position, in the order of Params.
+type JSONRPCMethod struct {
+	// Name is "package.Function", or "package.Type.Method" for the methods
+	// of services.
+	Name        string         `json:"name" yaml:"name"`
+	Description string         `json:"description,omitempty" yaml:"description,omitempty"`
+	Params      []JSONRPCParam `json:"params,omitempty" yaml:"params,omitempty"`
+	// Result is the schema of the result: null when the function returns
+	// no value besides an error, and an object of Results, named after the
+	// results, when it returns several.
+	Result  *JSONSchema    `json:"result" yaml:"result"`
+	Results []string       `json:"results,omitempty" yaml:"results,omitempty"`
+	Errors  []JSONRPCError `json:"errors,omitempty" yaml:"errors,omitempty"`
+	Call    GoCall         `json:"call" yaml:"call"`
+}
+
+// JSONRPCParam is a param of a method, passed as the Go parameter of the
+// same name.
+type JSONRPCParam struct {
+	Name     string      `json:"name" yaml:"name"`
+	Required bool        `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema   *JSONSchema `json:"schema" yaml:"schema"`
+}
+
+// JSONRPCError is the error object code answering Errors.
+type JSONRPCError struct {
+	Code    int                  `json:"code" yaml:"code"`
+	Message string               `json:"message" yaml:"message"`
+	Errors  []analyzer.ErrorInfo `json:"errors,omitempty" yaml:"errors,omitempty"`
+}
+
+// Error codes JSON-RPC 2.0 defines.
+const (
+	JSONRPCParseError     = -32700
+	JSONRPCInvalidRequest = -32600
+	JSONRPCMethodNotFound = -32601
+	JSONRPCInvalidParams  = -32602
+	JSONRPCInternalError  = -32603
+)
+
+// JSONSchema is the JSON Schema of a value, as OpenRPC describes params and
+// results. The empty schema accepts any value.
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string                 `json:"format,omitempty" yaml:"format,omitempty"`
+	ContentEncoding      string                 `json:"contentEncoding,omitempty" yaml:"contentEncoding,omitempty"`
+	Description          string                 `json:"description,omitempty" yaml:"description,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty" yaml:"items,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty" yaml:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+}
+
+// jsonRPCSchemaPrefix is where the schemas of structs are referred to.
+const jsonRPCSchemaPrefix = "#/components/schemas/"
+
+// DesignJSONRPC derives JSON-RPC methods from the endpoints designed so far
+// and stores them in JSONRPC, so that the exclusions decided for REST,
+// overrides included, carry over, and errors map to codes by their status
+// codes. functions are the analyzed functions the endpoints expose, and
+// schemas the analyzed struct types; without them, structs accept any JSON
+// value. Functions reading or writing streams are skipped.
+func (ad *APIDesigner) DesignJSONRPC(functions []analyzer.FunctionInfo, schemas map[string]*analyzer.TypeSchema) {
+	b := &jsonSchemaBuilder{schemas: schemas, named: make(map[string]*JSONSchema), names: make(map[string]string)}
+	design := &JSONRPCDesign{}
+	seen := make(map[string]bool)
+
+	for _, endpoint := range ad.Endpoints {
+		fn, ok := findExposed(functions, endpoint)
+		if !ok {
+			continue
+		}
+		if reason := unsupportedCall(fn); reason != "" {
+			design.Skipped = append(design.Skipped, fmt.Sprintf("%s: %s", fn.QualifiedName(), reason))
+			continue
+		}
+
+		method := JSONRPCMethod{
+			Name:        jsonRPCMethodName(endpoint, fn),
+			Description: endpoint.Description,
+			Errors:      ad.jsonRPCErrors(endpoint),
+			Call: GoCall{
+				Package:    fn.PackagePath,
+				Function:   fn.Name,
+				Service:    endpoint.Service,
+				Parameters: fn.Parameters,
+				Results:    fn.Results,
+			},
+		}
+		// Packages of the same name are told apart by number.
+		for i := 2; seen[method.Name]; i++ {
+			method.Name = fmt.Sprintf("%s%d", jsonRPCMethodName(endpoint, fn), i)
+		}
+		seen[method.Name] = true
+
+		for _, param := range fn.Parameters {
+			if param.Role == analyzer.RoleContext {
+				continue
+			}
+			// Options, variadic arguments and pointers can be left out.
+			optional := param.Role == analyzer.RoleOptions || strings.HasPrefix(param.Type, "...") || strings.HasPrefix(param.Type, "*")
+			method.Params = append(method.Params, JSONRPCParam{
+				Name:     param.Name,
+				Required: !optional,
+				Schema:   b.schemaOf(param.Type, param.Resolved, fn.PackagePath),
+			})
+		}
+		method.Result, method.Results = b.result(fn)
+		design.Methods = append(design.Methods, method)
+	}
+
+	design.Constructors = ad.constructorCalls(functions)
+	if len(b.named) > 0 {
+		design.Schemas = b.named
+	}
+	ad.JSONRPC = design
+}
+
+// jsonRPCMethodName names the method of an endpoint after the package of
+// its function, then its service type, if any, then its operation name or
+// function.
+func jsonRPCMethodName(endpoint APIEndpoint, fn analyzer.FunctionInfo) string {
+	name := fn.Name
+	if endpoint.Name != "" {
+		name = endpoint.Name
+	}
+	if endpoint.Service != "" {
+		name = endpoint.Service[strings.LastIndex(endpoint.Service, ".")+1:] + "." + name
+	}
+	if fn.Package == "" {
+		return name
+	}
+	return fn.Package + "." + name
+}
+
+// jsonRPCErrors returns the error codes of the errors of an endpoint: those
+// answering 400 Bad Request or 422 Unprocessable Entity are invalid params,
+// and the others take the status code of their response as an application
+// code. Unnamed errors are internal errors, which need no listing.
+func (ad *APIDesigner) jsonRPCErrors(endpoint APIEndpoint) []JSONRPCError {
+	var errs []JSONRPCError
+	index := make(map[int]int)
+	for _, response := range endpoint.Responses {
+		if response.Type != "error" || len(response.Errors) == 0 {
+			continue
+		}
+		code, message := response.StatusCode, http.StatusText(response.StatusCode)
+		switch code {
+		case 400, 422:
+			code, message = JSONRPCInvalidParams, "Invalid params"
+		case 500:
+			code, message = JSONRPCInternalError, "Internal error"
+		}
+		if i, ok := index[code]; ok {
+			errs[i].Errors = append(errs[i].Errors, response.Errors...)
+			continue
+		}
+		index[code] = len(errs)
+		errs = append(errs, JSONRPCError{Code: code, Message: message, Errors: append([]analyzer.ErrorInfo(nil), response.Errors...)})
+	}
+	return errs
+}
+
+// jsonSchemaBuilder maps Go types to JSON schemas, declaring the schemas of
+// the structs it meets along the way.
+type jsonSchemaBuilder struct {
+	schemas map[string]*analyzer.TypeSchema
+	named   map[string]*JSONSchema
+	// names holds the schema name given to each Go struct, keyed by its
+	// qualified name.
+	names map[string]string
+}
+
+// result returns the schema of the result of the method calling fn: its
+// only result besides the error, null when there is none, and an object of
+// its results, and their names, when there are several.
+func (b *jsonSchemaBuilder) result(fn analyzer.FunctionInfo) (*JSONSchema, []string) {
+	var values []analyzer.ParameterInfo
+	for _, result := range fn.Results {
+		if result.Role != analyzer.RoleError {
+			values = append(values, result)
+		}
+	}
+	switch len(values) {
+	case 0:
+		return &JSONSchema{Type: "null"}, nil
+	case 1:
+		return b.schemaOf(values[0].Type, values[0].Resolved, fn.PackagePath), nil
+	}
+
+	schema := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+	var names []string
+	for i, value := range values {
+		name := value.Name
+		if name == "" || name == "_" || schema.Properties[name] != nil {
+			name = fmt.Sprintf("result%d", i+1)
+		}
+		schema.Properties[name] = b.schemaOf(value.Type, value.Resolved, fn.PackagePath)
+		schema.Required = append(schema.Required, name)
+		names = append(names, name)
+	}
+	return schema, names
+}
+
+// jsonScalars are the schemas of the Go types encoding/json writes as JSON
+// scalars.
+var jsonScalars = map[string]JSONSchema{
+	"string": {Type: "string"}, "bool": {Type: "boolean"},
+	"int": {Type: "integer"}, "int8": {Type: "integer"}, "int16": {Type: "integer"}, "int32": {Type: "integer"}, "int64": {Type: "integer"}, "rune": {Type: "integer"},
+	"uint": {Type: "integer"}, "uint8": {Type: "integer"}, "uint16": {Type: "integer"}, "uint32": {Type: "integer"}, "uint64": {Type: "integer"}, "byte": {Type: "integer"}, "uintptr": {Type: "integer"},
+	"float32": {Type: "number"}, "float64": {Type: "number"},
+	"time.Time": {Type: "string", Format: "date-time"}, "time.Duration": {Type: "integer"},
+}
+
+func scalarSchema(name string) *JSONSchema {
+	schema, ok := jsonScalars[name]
+	if !ok {
+		return nil
+	}
+	return &schema
+}
+
+// schemaOf returns the schema of a Go type as written in package pkg, or as
+// resolved when the analysis was type-checked.
+func (b *jsonSchemaBuilder) schemaOf(goType string, resolved *analyzer.TypeInfo, pkg string) *JSONSchema {
+	if resolved != nil {
+		return b.resolvedSchema(resolved)
+	}
+
+	switch {
+	case strings.HasPrefix(goType, "*"):
+		return b.schemaOf(goType[1:], nil, pkg)
+	case goType == "[]byte":
+		return &JSONSchema{Type: "string", ContentEncoding: "base64"}
+	case strings.HasPrefix(goType, "[]"):
+		return &JSONSchema{Type: "array", Items: b.schemaOf(goType[2:], nil, pkg)}
+	case strings.HasPrefix(goType, "..."):
+		return &JSONSchema{Type: "array", Items: b.schemaOf(goType[3:], nil, pkg)}
+	case strings.HasPrefix(goType, "map[string]"):
+		return &JSONSchema{Type: "object", AdditionalProperties: b.schemaOf(goType[len("map[string]"):], nil, pkg)}
+	}
+	if schema := scalarSchema(goType); schema != nil {
+		return schema
+	}
+	if !strings.ContainsAny(goType, "[]().{} ") {
+		if schema := b.schemas[pkg+"."+goType]; schema != nil && schema.Kind == analyzer.KindStruct {
+			return b.namedSchema(schema)
+		}
+	}
+	return &JSONSchema{}
+}
+
+func (b *jsonSchemaBuilder) resolvedSchema(ti *analyzer.TypeInfo) *JSONSchema {
+	if schema := scalarSchema(ti.QualifiedName); schema != nil {
+		return schema
+	}
+	if ti.IsNamed {
+		if schema := b.schemas[ti.QualifiedName]; schema != nil {
+			switch {
+			case schema.Kind == analyzer.KindStruct:
+				return b.namedSchema(schema)
+			case schema.Elem != nil && (schema.Kind == analyzer.KindSlice || schema.Kind == analyzer.KindArray):
+				return &JSONSchema{Type: "array", Items: b.resolvedSchema(schema.Elem)}
+			case schema.Elem != nil && schema.Kind == analyzer.KindMap:
+				return &JSONSchema{Type: "object", AdditionalProperties: b.resolvedSchema(schema.Elem)}
+			case schema.Elem != nil && schema.Kind == analyzer.KindPointer:
+				return b.resolvedSchema(schema.Elem)
+			}
+		}
+		if ti.Kind == analyzer.KindBasic {
+			if schema := scalarSchema(ti.Underlying); schema != nil {
+				return schema
+			}
+		}
+		return &JSONSchema{}
+	}
+
+	switch ti.Kind {
+	case analyzer.KindBasic:
+		if schema := scalarSchema(ti.Underlying); schema != nil {
+			return schema
+		}
+	case analyzer.KindPointer:
+		if ti.Elem != nil {
+			return b.resolvedSchema(ti.Elem)
+		}
+	case analyzer.KindSlice, analyzer.KindArray:
+		if ti.Elem != nil && ti.Elem.QualifiedName == "byte" {
+			return &JSONSchema{Type: "string", ContentEncoding: "base64"}
+		}
+		if ti.Elem != nil {
+			return &JSONSchema{Type: "array", Items: b.resolvedSchema(ti.Elem)}
+		}
+	case analyzer.KindMap:
+		if ti.Elem != nil {
+			return &JSONSchema{Type: "object", AdditionalProperties: b.resolvedSchema(ti.Elem)}
+		}
+	}
+	return &JSONSchema{}
+}
+
+// namedSchema declares the schema of a struct, named after the Go type, and
+// returns a reference to it.
+func (b *jsonSchemaBuilder) namedSchema(schema *analyzer.TypeSchema) *JSONSchema {
+	if name, ok := b.names[schema.Name]; ok {
+		return &JSONSchema{Ref: jsonRPCSchemaPrefix + name}
+	}
+
+	name := schema.TypeName
+	if name == "" {
+		name = schema.Name[strings.LastIndex(schema.Name, ".")+1:]
+	}
+	if _, taken := b.named[name]; taken {
+		pkg := schema.PkgPath[strings.LastIndex(schema.PkgPath, "/")+1:]
+		name = upperCamel(splitWords(pkg)) + name
+	}
+	object := &JSONSchema{Type: "object", Description: schema.Doc, Properties: make(map[string]*JSONSchema)}
+	// Declared before the properties, so that recursive types end.
+	b.names[schema.Name] = name
+	b.named[name] = object
+	b.properties(object, schema)
+	return &JSONSchema{Ref: jsonRPCSchemaPrefix + name}
+}
+
+// properties adds the fields of a struct, as encoding/json sees them, to
+// object, with those of embedded structs promoted. Fields without
+// omitempty are always written, so they are required.
+func (b *jsonSchemaBuilder) properties(object *JSONSchema, schema *analyzer.TypeSchema) {
+	for _, field := range schema.Fields {
+		if promoted(field) {
+			if embedded := b.schemas[strings.TrimPrefix(field.Type.QualifiedName, "*")]; embedded != nil && embedded.Kind == analyzer.KindStruct {
+				b.properties(object, embedded)
+				continue
+			}
+		}
+		name := field.JSONName
+		if name == "" {
+			name = field.Name
+		}
+		property := b.resolvedSchema(field.Type)
+		if field.Doc != "" && property.Ref == "" {
+			property.Description = field.Doc
+		}
+		object.Properties[name] = property
+		if !field.OmitEmpty || field.Required() {
+			object.Required = append(object.Required, name)
+		}
+	}
+}
+
+// OpenRPC is the OpenRPC document describing a JSON-RPC API.
+type OpenRPC struct {
+	OpenRPC    string             `json:"openrpc"`
+	Info       OpenRPCInfo        `json:"info"`
+	Methods    []OpenRPCMethod    `json:"methods"`
+	Components *OpenRPCComponents `json:"components,omitempty"`
+}
+
+type OpenRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenRPCMethod struct {
+	Name           string                     `json:"name"`
+	Description    string                     `json:"description,omitempty"`
+	ParamStructure string                     `json:"paramStructure"`
+	Params         []OpenRPCContentDescriptor `json:"params"`
+	Result         OpenRPCContentDescriptor   `json:"result"`
+	Errors         []OpenRPCError             `json:"errors,omitempty"`
+}
+
+// OpenRPCContentDescriptor describes a param or a result.
+type OpenRPCContentDescriptor struct {
+	Name     string      `json:"name"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *JSONSchema `json:"schema"`
+}
+
+type OpenRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type OpenRPCComponents struct {
+	Schemas map[string]*JSONSchema `json:"schemas,omitempty"`
+}
+
+// OpenRPC describes the methods in an OpenRPC document. The errors of a
+// method list the names of the Go errors answered with each code.
+func (j *JSONRPCDesign) OpenRPC() *OpenRPC {
+	doc := &OpenRPC{
+		OpenRPC: "1.2.6",
+		Info: OpenRPCInfo{
+			Title:   "Soft-Crusher Generated API",
+			Version: "1.0.0",
+		},
+		Methods: make([]OpenRPCMethod, len(j.Methods)),
+	}
+	for i, method := range j.Methods {
+		m := OpenRPCMethod{
+			Name:           method.Name,
+			Description:    method.Description,
+			ParamStructure: "either",
+			Params:         make([]OpenRPCContentDescriptor, len(method.Params)),
+			Result:         OpenRPCContentDescriptor{Name: "result", Schema: method.Result},
+		}
+		for k, param := range method.Params {
+			m.Params[k] = OpenRPCContentDescriptor{Name: param.Name, Required: param.Required, Schema: param.Schema}
+		}
+		for _, rpcErr := range method.Errors {
+			names := make([]string, len(rpcErr.Errors))
+			for k, err := range rpcErr.Errors {
+				names[k] = err.LocalName()
+			}
+			sort.Strings(names)
+			m.Errors = append(m.Errors, OpenRPCError{Code: rpcErr.Code, Message: rpcErr.Message + ": " + strings.Join(names, ", ")})
+		}
+		doc.Methods[i] = m
+	}
+	if len(j.Schemas) > 0 {
+		doc.Components = &OpenRPCComponents{Schemas: j.Schemas}
+	}
+	return doc
+}
@@ -0,0 +1,129 @@
+package designer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+func TestDesignJSONRPC(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	user := &analyzer.TypeInfo{QualifiedName: pkg + ".User", Name: "User", PkgPath: pkg, Kind: analyzer.KindStruct, IsNamed: true}
+	text := &analyzer.TypeInfo{QualifiedName: "string", Name: "string", Kind: analyzer.KindBasic, Underlying: "string", IsNamed: true}
+	schemas := map[string]*analyzer.TypeSchema{
+		pkg + ".User": {Name: pkg + ".User", TypeName: "User", PkgPath: pkg, Kind: analyzer.KindStruct, Doc: "User is a customer.",
+			Fields: []analyzer.FieldSchema{
+				{Name: "ID", Type: text, JSONName: "id"},
+				{Name: "Email", Type: text, JSONName: "email", OmitEmpty: true},
+				{Name: "Friends", JSONName: "friends", OmitEmpty: true, Type: &analyzer.TypeInfo{QualifiedName: "[]*" + pkg + ".User", Kind: analyzer.KindSlice,
+					Elem: &analyzer.TypeInfo{QualifiedName: "*" + pkg + ".User", Kind: analyzer.KindPointer, Elem: user}}},
+				{Name: "Address", Embedded: true, Type: &analyzer.TypeInfo{QualifiedName: pkg + ".Address", Name: "Address", PkgPath: pkg, Kind: analyzer.KindStruct, IsNamed: true}},
+			}},
+		pkg + ".Address": {Name: pkg + ".Address", TypeName: "Address", PkgPath: pkg, Kind: analyzer.KindStruct,
+			Fields: []analyzer.FieldSchema{{Name: "City", Type: text, JSONName: "city"}}},
+	}
+
+	failure := analyzer.ParameterInfo{Type: "error", Role: analyzer.RoleError}
+	get := analyzer.FunctionInfo{Name: "Get", Receiver: "*Store", IsMethod: true, Package: "users", PackagePath: pkg, Effect: analyzer.EffectReadOnly,
+		Doc:        "Get returns a user.",
+		Parameters: []analyzer.ParameterInfo{{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext}, {Name: "id", Type: "string"}},
+		Results:    []analyzer.ParameterInfo{{Type: "*User"}, failure},
+		Errors: []analyzer.ErrorInfo{{Name: pkg + ".ErrNotFound", Kind: analyzer.ErrorSentinel},
+			{Name: pkg + ".ValidationError", Kind: analyzer.ErrorType, Pointer: true}}}
+	newStore := analyzer.FunctionInfo{Name: "NewStore", Package: "users", PackagePath: pkg, Results: []analyzer.ParameterInfo{{Type: "*Store"}}}
+	save := analyzer.FunctionInfo{Name: "SaveUser", Package: "users", PackagePath: pkg,
+		Parameters: []analyzer.ParameterInfo{{Name: "user", Type: "User"}, {Name: "tags", Type: "...string"}}, Results: []analyzer.ParameterInfo{failure}}
+	stats := analyzer.FunctionInfo{Name: "Stats", Package: "users", PackagePath: pkg,
+		Results: []analyzer.ParameterInfo{{Name: "count", Type: "int"}, {Type: "map[string]float64"}}}
+	export := analyzer.FunctionInfo{Name: "Export", Package: "users", PackagePath: pkg,
+		Parameters: []analyzer.ParameterInfo{{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter}}, Results: []analyzer.ParameterInfo{failure}}
+	functions := []analyzer.FunctionInfo{newStore, get, save, stats, export}
+
+	designer := NewAPIDesigner()
+	designer.DesignServices([]analyzer.ServiceInfo{{Name: "Store", Package: "users", PackagePath: pkg,
+		Methods: []analyzer.FunctionInfo{get}, Constructors: []analyzer.FunctionInfo{newStore}}})
+	designer.DesignAPI(functions)
+	designer.DesignJSONRPC(functions, schemas)
+	design := designer.JSONRPC
+	require.NotNil(t, design)
+
+	var names []string
+	for _, method := range design.Methods {
+		names = append(names, method.Name)
+	}
+	assert.Equal(t, []string{"users.Store.Get", "users.SaveUser", "users.Stats"}, names)
+	assert.Equal(t, []string{pkg + ".Export: parameter w is written as a stream"}, design.Skipped)
+	require.Len(t, design.Constructors, 1)
+	assert.Equal(t, pkg+".Store", design.Methods[0].Call.Service)
+	assert.Equal(t, []JSONRPCError{
+		{Code: JSONRPCInvalidParams, Message: "Invalid params", Errors: get.Errors[1:]},
+		{Code: 404, Message: "Not Found", Errors: get.Errors[:1]},
+	}, design.Methods[0].Errors)
+	assert.Equal(t, []JSONRPCParam{
+		{Name: "user", Required: true, Schema: &JSONSchema{Ref: "#/components/schemas/User"}},
+		{Name: "tags", Schema: &JSONSchema{Type: "array", Items: &JSONSchema{Type: "string"}}},
+	}, design.Methods[1].Params)
+	assert.Equal(t, &JSONSchema{Type: "null"}, design.Methods[1].Result)
+	assert.Equal(t, []string{"count", "result2"}, design.Methods[2].Results)
+
+	doc, err := json.MarshalIndent(design.OpenRPC(), "", "  ")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "openrpc": "1.2.6",
+  "info": {"title": "Soft-Crusher Generated API", "version": "1.0.0"},
+  "methods": [
+    {
+      "name": "users.Store.Get",
+      "description": "Get returns a user.",
+      "paramStructure": "either",
+      "params": [{"name": "id", "required": true, "schema": {"type": "string"}}],
+      "result": {"name": "result", "schema": {"$ref": "#/components/schemas/User"}},
+      "errors": [
+        {"code": -32602, "message": "Invalid params: ValidationError"},
+        {"code": 404, "message": "Not Found: ErrNotFound"}
+      ]
+    },
+    {
+      "name": "users.SaveUser",
+      "paramStructure": "either",
+      "params": [
+        {"name": "user", "required": true, "schema": {"$ref": "#/components/schemas/User"}},
+        {"name": "tags", "schema": {"type": "array", "items": {"type": "string"}}}
+      ],
+      "result": {"name": "result", "schema": {"type": "null"}}
+    },
+    {
+      "name": "users.Stats",
+      "paramStructure": "either",
+      "params": [],
+      "result": {"name": "result", "schema": {
+        "type": "object",
+        "properties": {
+          "count": {"type": "integer"},
+          "result2": {"type": "object", "additionalProperties": {"type": "number"}}
+        },
+        "required": ["count", "result2"]
+      }}
+    }
+  ],
+  "components": {
+    "schemas": {
+      "User": {
+        "type": "object",
+        "description": "User is a customer.",
+        "properties": {
+          "id": {"type": "string"},
+          "email": {"type": "string"},
+          "friends": {"type": "array", "items": {"$ref": "#/components/schemas/User"}},
+          "city": {"type": "string"}
+        },
+        "required": ["id", "city"]
+      }
+    }
+  }
+}`, string(doc))
+}
@@ -0,0 +1,410 @@
+package designer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// OverridesFile is the file, at the root of the analyzed code, holding the
+// Overrides of its API design.
+const OverridesFile = "soft-crusher.api.yaml"
+
+// Overrides corrects an inferred design where its heuristics are wrong,
+// without touching the code the way directives do. Functions are keyed by
+// name, qualified as much as needed to be unambiguous: "GetUser",
+// "users.GetUser", "UserService.Get" or "example.com/shop/users.GetUser".
+//
+//	functions:
+//	  GetUser:
+//	    method: GET
+//	    path: /accounts/{id}
+//	    parameters:
+//	      fields: query
+//	  Watch:
+//	    stream: websocket
+//	  Reindex:
+//	    exclude: true
+//	errors:
+//	  - match: ErrQuota
+//	    status: 429
+//
+// Errors map the errors of functions to status codes ahead of
+// DefaultErrorRules; apply them by setting APIDesigner.ErrorRules before
+// designing.
+type Overrides struct {
+	Functions map[string]EndpointOverride `yaml:"functions"`
+	Errors    []ErrorRule                 `yaml:"errors,omitempty"`
+}
+
+// EndpointOverride replaces parts of the endpoint exposing one function;
+// fields left empty keep the inferred values.
+type EndpointOverride struct {
+	// Exclude leaves the function out of the API.
+	Exclude bool     `yaml:"exclude,omitempty"`
+	Method  string   `yaml:"method,omitempty"`
+	Path    string   `yaml:"path,omitempty"`
+	Name    string   `yaml:"name,omitempty"`
+	Tags    []string `yaml:"tags,omitempty"`
+	Auth    string   `yaml:"auth,omitempty"`
+	// Status is the status code of the success response.
+	Status int `yaml:"status,omitempty"`
+	// Responses adds responses, or describes existing ones anew, by status
+	// code.
+	Responses map[int]string `yaml:"responses,omitempty"`
+	// Parameters maps parameter names to "path", "query", "header" or
+	// "body".
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+	// Stream is the transport of a streamed response: "sse", "websocket"
+	// or "chunked".
+	Stream string `yaml:"stream,omitempty"`
+}
+
+var overrideLocations = map[string]bool{"path": true, "query": true, "header": true, "body": true}
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// ReadOverrides decodes Overrides written in YAML, rejecting unknown fields
+// and invalid values.
+func ReadOverrides(r io.Reader) (*Overrides, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var overrides Overrides
+	if err := yaml.UnmarshalStrict(data, &overrides); err != nil {
+		return nil, fmt.Errorf("error decoding overrides: %v", err)
+	}
+
+	for _, key := range overrides.keys() {
+		override := overrides.Functions[key]
+		if override.Method != "" {
+			override.Method = strings.ToUpper(override.Method)
+			if !analyzer.HTTPMethods[override.Method] {
+				return nil, fmt.Errorf("%s: unknown method %s", key, override.Method)
+			}
+		}
+		if override.Path != "" && !strings.HasPrefix(override.Path, "/") {
+			return nil, fmt.Errorf("%s: path %s does not start with /", key, override.Path)
+		}
+		if override.Status != 0 && (override.Status < 100 || override.Status > 599) {
+			return nil, fmt.Errorf("%s: invalid status %d", key, override.Status)
+		}
+		for status := range override.Responses {
+			if status < 100 || status > 599 {
+				return nil, fmt.Errorf("%s: invalid response status %d", key, status)
+			}
+		}
+		if override.Stream != "" && !streamTransports[override.Stream] {
+			return nil, fmt.Errorf("%s: stream %s is not one of sse, websocket or chunked", key, override.Stream)
+		}
+		for name, location := range override.Parameters {
+			if !overrideLocations[location] {
+				return nil, fmt.Errorf("%s: parameter %s: location %s is not one of path, query, header or body", key, name, location)
+			}
+		}
+		overrides.Functions[key] = override
+	}
+	for _, rule := range overrides.Errors {
+		if rule.Match == "" {
+			return nil, fmt.Errorf("errors: rule without match")
+		}
+		if rule.Status < 400 || rule.Status > 599 {
+			return nil, fmt.Errorf("errors: %s: invalid status %d", rule.Match, rule.Status)
+		}
+	}
+	return &overrides, nil
+}
+
+// LoadOverrides reads Overrides from a file.
+func LoadOverrides(path string) (*Overrides, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	overrides, err := ReadOverrides(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return overrides, nil
+}
+
+func (o *Overrides) keys() []string {
+	keys := make([]string, 0, len(o.Functions))
+	for key := range o.Functions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ApplyOverrides merges overrides onto the endpoints designed so far.
+// functions are all the analyzed functions, exposed or not: an override
+// naming none of them, or more than one, is an error, as is a path naming no
+// parameter or two endpoints ending up on the same route. Stale entries,
+// which override functions that are not exposed, parameters that no longer
+// exist or values the design already has, are recorded in Warnings. Excluded
+// functions are also dropped from Rejected.
+func (ad *APIDesigner) ApplyOverrides(overrides *Overrides, functions []analyzer.FunctionInfo) error {
+	for _, key := range overrides.keys() {
+		override := overrides.Functions[key]
+		fn, err := findFunction(functions, key)
+		if err != nil {
+			return err
+		}
+
+		if override.Exclude {
+			excluded := ad.exclude(fn)
+			if !excluded {
+				ad.warnf("%s: excluded function is not exposed anyway", key)
+			}
+			continue
+		}
+		i := ad.endpointOf(fn)
+		if i < 0 {
+			ad.warnf("%s: function is not exposed, so its override has no effect", key)
+			continue
+		}
+		if err := ad.applyOverride(key, fn, &ad.Endpoints[i], override); err != nil {
+			return err
+		}
+	}
+
+	routes := make(map[string]string)
+	for _, endpoint := range ad.Endpoints {
+		name := endpoint.FunctionName
+		switch {
+		case endpoint.Service != "":
+			name = endpoint.Service + "." + name
+		case endpoint.Package != "":
+			name = endpoint.Package + "." + name
+		}
+		if other, ok := routes[routeKey(endpoint)]; ok {
+			return fmt.Errorf("%s and %s are both served at %s %s", other, name, endpoint.Method, endpoint.Path)
+		}
+		routes[routeKey(endpoint)] = name
+	}
+	return nil
+}
+
+// placeParameters moves the parameters that generateParameters placed by
+// method alone between the query and the body after the method of endpoint
+// changed: requests without a body carry them in the query, the others in
+// the body unless a reader takes it. Parameters placed by directives stay.
+func placeParameters(endpoint *APIEndpoint, directives map[string]string) {
+	bodyless := endpoint.Method == "GET" || endpoint.Method == "HEAD" || endpoint.Method == "DELETE"
+	streamed := false
+	for _, param := range endpoint.Parameters {
+		streamed = streamed || param.Role == analyzer.RoleReader
+	}
+	for i, param := range endpoint.Parameters {
+		if directives[param.Name] != "" || param.Role == analyzer.RoleReader {
+			continue
+		}
+		switch {
+		case param.Location == "body" && (bodyless || streamed):
+			endpoint.Parameters[i].Location = "query"
+		case param.Location == "query" && !bodyless && !streamed:
+			endpoint.Parameters[i].Location = "body"
+		}
+	}
+}
+
+func (ad *APIDesigner) applyOverride(key string, fn analyzer.FunctionInfo, endpoint *APIEndpoint, override EndpointOverride) error {
+	if override.Method != "" {
+		if override.Method == endpoint.Method {
+			ad.warnf("%s: method is already %s", key, endpoint.Method)
+		}
+		endpoint.Method, endpoint.MethodReason = override.Method, "set in "+OverridesFile
+		placeParameters(endpoint, fn.Directives.ParamLocations)
+	}
+	if override.Name != "" {
+		endpoint.Name = override.Name
+	}
+	if len(override.Tags) > 0 {
+		endpoint.Tags = override.Tags
+	}
+	if override.Auth != "" {
+		if override.Auth == endpoint.Auth {
+			ad.warnf("%s: auth is already %s", key, endpoint.Auth)
+		}
+		endpoint.Auth = override.Auth
+	}
+	if override.Stream != "" {
+		switch {
+		case endpoint.Stream == nil:
+			ad.warnf("%s: response is not streamed, so stream has no effect", key)
+		case override.Stream == endpoint.Stream.Transport:
+			ad.warnf("%s: stream is already %s", key, override.Stream)
+		default:
+			stream := *endpoint.Stream
+			stream.Transport = override.Stream
+			endpoint.Stream = &stream
+			if stream.Transport != StreamChunked && endpoint.Method != "GET" {
+				ad.warnf("%s: streaming over %s needs GET, not %s", key, transportNames[stream.Transport], endpoint.Method)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(override.Parameters))
+	for name := range override.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	locations := make(map[string]string)
+	for _, name := range names {
+		if !hasParameter(endpoint.Parameters, name) {
+			ad.warnf("%s: parameter %s no longer exists", key, name)
+			continue
+		}
+		locations[name] = override.Parameters[name]
+	}
+	if override.Path != "" {
+		if override.Path == endpoint.Path {
+			ad.warnf("%s: path is already %s", key, endpoint.Path)
+		}
+		inPath := make(map[string]bool)
+		for _, match := range pathParamPattern.FindAllStringSubmatch(override.Path, -1) {
+			if !hasParameter(endpoint.Parameters, match[1]) {
+				return fmt.Errorf("%s: path %s names no parameter %s", key, override.Path, match[1])
+			}
+			inPath[match[1]] = true
+		}
+		// Parameters move in and out of the path along with it.
+		for _, param := range endpoint.Parameters {
+			switch {
+			case locations[param.Name] != "":
+			case inPath[param.Name]:
+				locations[param.Name] = "path"
+			case param.Location == "path":
+				locations[param.Name] = "query"
+			}
+		}
+		endpoint.Path = override.Path
+	}
+	for i, param := range endpoint.Parameters {
+		location, ok := locations[param.Name]
+		if !ok {
+			continue
+		}
+		if location == param.Location && override.Parameters[param.Name] != "" {
+			ad.warnf("%s: parameter %s is already in the %s", key, param.Name, location)
+		}
+		endpoint.Parameters[i].Location = location
+	}
+
+	if override.Status != 0 && len(endpoint.Responses) > 0 {
+		if override.Status == endpoint.Responses[0].StatusCode {
+			ad.warnf("%s: status is already %d", key, override.Status)
+		}
+		endpoint.Responses[0].StatusCode = override.Status
+	}
+	statuses := make([]int, 0, len(override.Responses))
+	for status := range override.Responses {
+		statuses = append(statuses, status)
+	}
+	sort.Ints(statuses)
+	for _, status := range statuses {
+		endpoint.Responses = setResponse(endpoint.Responses, Response{StatusCode: status, Type: override.Responses[status]})
+	}
+	return nil
+}
+
+// findFunction returns the one function of functions that key names.
+func findFunction(functions []analyzer.FunctionInfo, key string) (analyzer.FunctionInfo, error) {
+	var found []analyzer.FunctionInfo
+	for _, fn := range functions {
+		if matchesKey(fn, key) {
+			found = append(found, fn)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return analyzer.FunctionInfo{}, fmt.Errorf("%s: no such function", key)
+	case 1:
+		return found[0], nil
+	default:
+		names := make([]string, len(found))
+		for i, fn := range found {
+			names[i] = fn.QualifiedName()
+		}
+		return analyzer.FunctionInfo{}, fmt.Errorf("%s is ambiguous, qualify it as one of %s", key, strings.Join(names, ", "))
+	}
+}
+
+func matchesKey(fn analyzer.FunctionInfo, key string) bool {
+	qualified := fn.QualifiedName()
+	// Without the package path, the name is "Func" or "Type.Func".
+	local := strings.TrimPrefix(qualified, fn.PackagePath+".")
+	return key == qualified || key == local || key == fn.Name || (fn.Package != "" && key == fn.Package+"."+local)
+}
+
+// endpointOf returns the index of the endpoint exposing fn, or -1.
+func (ad *APIDesigner) endpointOf(fn analyzer.FunctionInfo) int {
+	for i, endpoint := range ad.Endpoints {
+		if exposes(endpoint, fn) {
+			return i
+		}
+	}
+	return -1
+}
+
+func exposes(endpoint APIEndpoint, fn analyzer.FunctionInfo) bool {
+	if endpoint.FunctionName != fn.Name || endpoint.Package != fn.PackagePath || endpoint.Source != fn.Source {
+		return false
+	}
+	if endpoint.Service != "" {
+		return fn.IsMethod && endpoint.Service == strings.TrimSuffix(fn.QualifiedName(), "."+fn.Name)
+	}
+	return true
+}
+
+// exclude removes the endpoint exposing fn, or its entry in Rejected,
+// reporting whether there was one.
+func (ad *APIDesigner) exclude(fn analyzer.FunctionInfo) bool {
+	if i := ad.endpointOf(fn); i >= 0 {
+		ad.Endpoints = append(ad.Endpoints[:i], ad.Endpoints[i+1:]...)
+		return true
+	}
+	for i, rejected := range ad.Rejected {
+		if rejected.QualifiedName() == fn.QualifiedName() {
+			ad.Rejected = append(ad.Rejected[:i], ad.Rejected[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (ad *APIDesigner) warnf(format string, args ...interface{}) {
+	ad.Warnings = append(ad.Warnings, fmt.Sprintf(format, args...))
+}
+
+func hasParameter(params []Parameter, name string) bool {
+	for _, param := range params {
+		if param.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// setResponse replaces the response with the status of response, keeping
+// the errors it answers, or adds it.
+func setResponse(responses []Response, response Response) []Response {
+	for i := range responses {
+		if responses[i].StatusCode == response.StatusCode {
+			response.Errors = responses[i].Errors
+			responses[i] = response
+			return responses
+		}
+	}
+	return append(responses, response)
+}
@@ -0,0 +1,146 @@
+package designer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+const overridesYAML = `
+functions:
+  users.GetUser:
+    method: post
+    path: /accounts/{id}/lookup
+    name: lookupAccount
+    tags: [accounts]
+    auth: bearer
+    status: 203
+    responses:
+      404: not found
+    parameters:
+      fields: header
+      gone: body
+  CreateUser:
+    method: POST
+  Reindex:
+    exclude: true
+  UserService.Delete:
+    exclude: true
+  Helper:
+    path: /helper
+  Legacy:
+    exclude: true
+`
+
+func TestApplyOverrides(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	id := analyzer.ParameterInfo{Name: "id", Type: "string"}
+	functions := []analyzer.FunctionInfo{
+		{Name: "GetUser", Package: "users", PackagePath: pkg, Parameters: []analyzer.ParameterInfo{id, {Name: "fields", Type: "[]string"}}},
+		{Name: "CreateUser", Package: "users", PackagePath: pkg, Parameters: []analyzer.ParameterInfo{{Name: "user", Type: "User"}}},
+		{Name: "Reindex", Package: "users", PackagePath: pkg, RiskScore: 60},
+		{Name: "Delete", Receiver: "*UserService", IsMethod: true, Package: "users", PackagePath: pkg, Parameters: []analyzer.ParameterInfo{id}},
+		{Name: "Helper", Package: "users", PackagePath: pkg, Directives: analyzer.Directives{Ignore: true}},
+		{Name: "Legacy", Package: "users", PackagePath: pkg, Directives: analyzer.Directives{Ignore: true}},
+	}
+
+	overrides, err := ReadOverrides(strings.NewReader(overridesYAML))
+	require.NoError(t, err)
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	require.Len(t, designer.Rejected, 1)
+	require.NoError(t, designer.ApplyOverrides(overrides, functions))
+
+	assert.Empty(t, designer.Rejected)
+	require.Len(t, designer.Endpoints, 2)
+	assert.Equal(t, APIEndpoint{
+		Method:       "POST",
+		MethodReason: "set in soft-crusher.api.yaml",
+		Path:         "/accounts/{id}/lookup",
+		FunctionName: "GetUser",
+		Name:         "lookupAccount",
+		Resource:     "users",
+		Package:      pkg,
+		Tags:         []string{"accounts"},
+		Auth:         "bearer",
+		Parameters: []Parameter{
+			{Name: "id", Type: "string", Location: "path", Scalar: "string"},
+			{Name: "fields", Type: "[]string", Location: "header"},
+		},
+		Responses: []Response{{StatusCode: 203, Type: "OK"}, {StatusCode: 404, Type: "not found"}},
+		Call:      &GoCall{Package: pkg, Function: "GetUser", Parameters: functions[0].Parameters},
+	}, designer.Endpoints[0])
+	assert.Equal(t, []string{
+		"CreateUser: method is already POST",
+		"Helper: function is not exposed, so its override has no effect",
+		"Legacy: excluded function is not exposed anyway",
+		"users.GetUser: parameter gone no longer exists",
+	}, designer.Warnings)
+}
+
+func TestApplyOverridesMethodPlacesParameters(t *testing.T) {
+	functions := []analyzer.FunctionInfo{
+		{Name: "CreateUser", Package: "users", PackagePath: "example.com/shop/users",
+			Parameters: []analyzer.ParameterInfo{{Name: "user", Type: "User"}, {Name: "tenant", Type: "string"}},
+			Directives: analyzer.Directives{ParamLocations: map[string]string{"tenant": "body"}}},
+		{Name: "ListUsers", Package: "users", PackagePath: "example.com/shop/users",
+			Parameters: []analyzer.ParameterInfo{{Name: "filter", Type: "Filter"}}},
+	}
+	overrides, err := ReadOverrides(strings.NewReader("functions:\n  CreateUser: {method: GET}\n  ListUsers: {method: PUT}\n"))
+	require.NoError(t, err)
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	require.NoError(t, designer.ApplyOverrides(overrides, functions))
+
+	require.Len(t, designer.Endpoints, 2)
+	// Parameters placed by a directive stay where it put them.
+	assert.Equal(t, []Parameter{
+		{Name: "user", Type: "User", Location: "query"},
+		{Name: "tenant", Type: "string", Location: "body", Scalar: "string"},
+	}, designer.Endpoints[0].Parameters)
+	assert.Equal(t, []Parameter{{Name: "filter", Type: "Filter", Location: "body"}}, designer.Endpoints[1].Parameters)
+}
+
+func TestApplyOverridesErrors(t *testing.T) {
+	functions := []analyzer.FunctionInfo{
+		{Name: "Get", Package: "users", PackagePath: "example.com/shop/users", Parameters: []analyzer.ParameterInfo{{Name: "id", Type: "string"}}},
+		{Name: "Get", Package: "orders", PackagePath: "example.com/shop/orders", Parameters: []analyzer.ParameterInfo{{Name: "key", Type: "string"}}},
+		{Name: "Ping", Package: "health", PackagePath: "example.com/shop/health"},
+	}
+	for _, tt := range []struct {
+		yaml, err string
+	}{
+		{"functions:\n  Missing: {method: GET}\n", "Missing: no such function"},
+		{"functions:\n  Get: {method: GET}\n", "Get is ambiguous, qualify it as one of example.com/shop/users.Get, example.com/shop/orders.Get"},
+		{"functions:\n  Ping: {path: \"/ping/{id}\"}\n", "Ping: path /ping/{id} names no parameter id"},
+		{"functions:\n  orders.Get: {path: /users/get}\n", "example.com/shop/users.Get and example.com/shop/orders.Get are both served at GET /users/get"},
+		{"functions:\n  users.Get: {path: \"/carts/{id}\"}\n  orders.Get: {path: \"/carts/{key}\"}\n", "example.com/shop/users.Get and example.com/shop/orders.Get are both served at GET /carts/{key}"},
+	} {
+		overrides, err := ReadOverrides(strings.NewReader(tt.yaml))
+		require.NoError(t, err)
+		designer := NewAPIDesigner()
+		designer.DesignAPI(functions)
+		err = designer.ApplyOverrides(overrides, functions)
+		assert.EqualError(t, err, tt.err, tt.yaml)
+	}
+
+	for _, invalid := range []string{
+		"functions:\n  Ping: {method: FETCH}\n",
+		"functions:\n  Ping: {path: ping}\n",
+		"functions:\n  Ping: {status: 42}\n",
+		"functions:\n  Ping: {parameters: {id: cookie}}\n",
+		"functions:\n  Ping: {methd: GET}\n",
+		"functions:\n  Ping: {stream: grpc}\n",
+		"errors:\n  - {match: ErrQuota, status: 200}\n",
+		"errors:\n  - {status: 429}\n",
+	} {
+		_, err := ReadOverrides(strings.NewReader(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,726 @@
+package designer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// ProtoDesign is the Protocol Buffers view of the designed endpoints: a
+// gRPC service per Go package, whose RPCs call the exposed functions, and
+// the messages their parameters and results travel in.
+type ProtoDesign struct {
+	Package  string         `json:"package" yaml:"package"`
+	Services []ProtoService `json:"services,omitempty" yaml:"services,omitempty"`
+	// Messages are sorted by name.
+	Messages []ProtoMessage `json:"messages,omitempty" yaml:"messages,omitempty"`
+	// Imports are the well-known types files the messages need.
+	Imports []string `json:"imports,omitempty" yaml:"imports,omitempty"`
+	// Constructors build the instances of the services whose methods RPCs
+	// call.
+	Constructors []GoCall `json:"constructors,omitempty" yaml:"constructors,omitempty"`
+	// Skipped lists the endpoints gRPC cannot express, and why.
+	Skipped []string `json:"skipped,omitempty" yaml:"skipped,omitempty"`
+	// Numbers are the field numbers of the messages, removed fields
+	// included, for the next design to keep.
+	Numbers *ProtoNumbers `json:"-" yaml:"-"`
+}
+
+// ProtoService is a gRPC service serving the functions of one Go package.
+type ProtoService struct {
+	Name        string     `json:"name" yaml:"name"`
+	Package     string     `json:"package" yaml:"package"`
+	Description string     `json:"description,omitempty" yaml:"description,omitempty"`
+	RPCs        []ProtoRPC `json:"rpcs" yaml:"rpcs"`
+}
+
+// ProtoRPC is an RPC calling a Go function. Its Request message has a field
+// per parameter, named like the parameter in JSON. Its Response is
+// google.protobuf.Empty when the function only returns an error, the
+// message of its result when that is a single struct, and otherwise a
+// message whose Results fields hold the results in order.
+type ProtoRPC struct {
+	Name        string       `json:"name" yaml:"name"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	Request     string       `json:"request" yaml:"request"`
+	Response    string       `json:"response" yaml:"response"`
+	Results     []string     `json:"results,omitempty" yaml:"results,omitempty"`
+	Errors      []ProtoError `json:"errors,omitempty" yaml:"errors,omitempty"`
+	Call        GoCall       `json:"call" yaml:"call"`
+}
+
+// ProtoError maps the errors of a function to the gRPC status code
+// answering them, such as "NotFound". Other errors are "Internal".
+type ProtoError struct {
+	Code   string               `json:"code" yaml:"code"`
+	Errors []analyzer.ErrorInfo `json:"errors" yaml:"errors"`
+}
+
+// ProtoMessage is a message of the definition: the request or response of
+// an RPC, or a Go struct, named by GoType.
+type ProtoMessage struct {
+	Name        string       `json:"name" yaml:"name"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	GoType      string       `json:"goType,omitempty" yaml:"goType,omitempty"`
+	Fields      []ProtoField `json:"fields" yaml:"fields"`
+	// Reserved holds the numbers of removed fields by name, so that no
+	// other field reuses them.
+	Reserved map[string]int `json:"reserved,omitempty" yaml:"reserved,omitempty"`
+}
+
+// ProtoField is a field of a message. Name is its name in snake case and
+// JSONName the name encoding/json gives the Go value it carries.
+type ProtoField struct {
+	Name        string `json:"name" yaml:"name"`
+	JSONName    string `json:"jsonName" yaml:"jsonName"`
+	Type        string `json:"type" yaml:"type"`
+	Repeated    bool   `json:"repeated,omitempty" yaml:"repeated,omitempty"`
+	Optional    bool   `json:"optional,omitempty" yaml:"optional,omitempty"`
+	Number      int    `json:"number" yaml:"number"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// ProtoNumbersFile is the file, at the root of the analyzed code next to
+// OverridesFile, keeping the field numbers of generated messages.
+const ProtoNumbersFile = "soft-crusher.proto.lock"
+
+// ProtoNumbers records the field numbers of proto messages, so that
+// regenerating a definition never renumbers a field or reuses the number
+// of a removed one, either of which would break existing clients. Messages
+// are keyed by name and fields by their name in snake case.
+//
+//	messages:
+//	  User:
+//	    fields:
+//	      id: 1
+//	      name: 2
+//	    reserved:
+//	      email: 3
+type ProtoNumbers struct {
+	Messages map[string]MessageNumbers `json:"messages" yaml:"messages"`
+}
+
+// MessageNumbers are the numbers of the fields of a message, and those of
+// its removed fields.
+type MessageNumbers struct {
+	Fields   map[string]int `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Reserved map[string]int `json:"reserved,omitempty" yaml:"reserved,omitempty"`
+}
+
+// ReadProtoNumbers decodes ProtoNumbers written in YAML.
+func ReadProtoNumbers(r io.Reader) (*ProtoNumbers, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	numbers := &ProtoNumbers{}
+	if err := yaml.UnmarshalStrict(data, numbers); err != nil {
+		return nil, fmt.Errorf("error decoding proto numbers: %v", err)
+	}
+	for name, message := range numbers.Messages {
+		seen := make(map[int]string)
+		for _, fields := range []map[string]int{message.Fields, message.Reserved} {
+			for field, number := range fields {
+				if number < 1 || number > maxProtoNumber || (number >= firstReservedProtoNumber && number <= lastReservedProtoNumber) {
+					return nil, fmt.Errorf("%s.%s: invalid field number %d", name, field, number)
+				}
+				if other, ok := seen[number]; ok {
+					return nil, fmt.Errorf("%s: fields %s and %s share number %d", name, other, field, number)
+				}
+				seen[number] = field
+			}
+		}
+	}
+	return numbers, nil
+}
+
+// LoadProtoNumbers reads the ProtoNumbers file at path.
+func LoadProtoNumbers(path string) (*ProtoNumbers, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	numbers, err := ReadProtoNumbers(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return numbers, nil
+}
+
+// Write encodes the numbers to w in YAML.
+func (n *ProtoNumbers) Write(w io.Writer) error {
+	data, err := yaml.Marshal(n)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, "# Field numbers of the generated proto messages. Keep this file\n# under version control so that regenerating keeps them.\n"); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Field numbers protobuf allows, and the range it reserves for itself.
+const (
+	maxProtoNumber           = 1<<29 - 1
+	firstReservedProtoNumber = 19000
+	lastReservedProtoNumber  = 19999
+)
+
+// number gives the fields of message the numbers they had in n, and new
+// fields the numbers after every one the message ever used, then records
+// the numbers of the message in n: those of fields no longer there are
+// reserved, and come back with their fields.
+func (n *ProtoNumbers) number(message *ProtoMessage) {
+	previous := n.Messages[message.Name]
+	next := 1
+	for _, numbers := range []map[string]int{previous.Fields, previous.Reserved} {
+		for _, number := range numbers {
+			next = max(next, number+1)
+		}
+	}
+
+	current := MessageNumbers{Fields: make(map[string]int)}
+	for i, field := range message.Fields {
+		number, ok := previous.Fields[field.Name]
+		if !ok {
+			number, ok = previous.Reserved[field.Name]
+		}
+		if !ok {
+			if next >= firstReservedProtoNumber && next <= lastReservedProtoNumber {
+				next = lastReservedProtoNumber + 1
+			}
+			number = next
+			next++
+		}
+		message.Fields[i].Number = number
+		current.Fields[field.Name] = number
+	}
+	for _, numbers := range []map[string]int{previous.Fields, previous.Reserved} {
+		for name, number := range numbers {
+			if _, ok := current.Fields[name]; !ok {
+				if current.Reserved == nil {
+					current.Reserved = make(map[string]int)
+				}
+				current.Reserved[name] = number
+			}
+		}
+	}
+	sort.SliceStable(message.Fields, func(i, j int) bool { return message.Fields[i].Number < message.Fields[j].Number })
+	message.Reserved = current.Reserved
+	n.Messages[message.Name] = current
+}
+
+// grpcCodes are the gRPC status codes of the error responses.
+var grpcCodes = map[int]string{
+	400: "InvalidArgument",
+	401: "Unauthenticated",
+	403: "PermissionDenied",
+	404: "NotFound",
+	409: "AlreadyExists",
+	422: "InvalidArgument",
+	429: "ResourceExhausted",
+	501: "Unimplemented",
+	503: "Unavailable",
+	504: "DeadlineExceeded",
+}
+
+// DesignProto derives a proto definition from the endpoints designed so far
+// and stores it in Proto, so that the names and exclusions decided for
+// REST, overrides included, carry over, and errors map to the gRPC codes
+// matching their status codes. functions are the analyzed functions the
+// endpoints expose, and schemas the analyzed struct types; without them,
+// structs are google.protobuf.Value. Fields keep the numbers numbers gives
+// them, and numbers, updated, becomes the Numbers of the definition.
+// Functions reading or writing streams are skipped.
+func (ad *APIDesigner) DesignProto(functions []analyzer.FunctionInfo, schemas map[string]*analyzer.TypeSchema, numbers *ProtoNumbers) {
+	b := &protoBuilder{schemas: schemas, messages: make(map[string]*ProtoMessage), names: make(map[string]string), imports: make(map[string]bool)}
+	design := &ProtoDesign{Package: "api"}
+	services := make(map[string]*ProtoService)
+
+	for _, endpoint := range ad.Endpoints {
+		fn, ok := findExposed(functions, endpoint)
+		if !ok {
+			continue
+		}
+		if reason := unsupportedCall(fn); reason != "" {
+			design.Skipped = append(design.Skipped, fmt.Sprintf("%s: %s", fn.QualifiedName(), reason))
+			continue
+		}
+
+		service := services[fn.PackagePath]
+		if service == nil {
+			name := upperCamel(splitWords(fn.Package)) + "Service"
+			service = &ProtoService{Name: name, Package: fn.PackagePath,
+				Description: fmt.Sprintf("%s serves the functions of package %s.", name, fn.PackagePath)}
+			services[fn.PackagePath] = service
+		}
+		rpc := ProtoRPC{
+			Name:        upperCamel(splitWords(graphQLFieldName(endpoint, fn))),
+			Description: endpoint.Description,
+			Errors:      protoErrors(endpoint),
+			Call: GoCall{
+				Package:    fn.PackagePath,
+				Function:   fn.Name,
+				Service:    endpoint.Service,
+				Parameters: fn.Parameters,
+				Results:    fn.Results,
+			},
+		}
+		for i := 2; hasRPC(service, rpc.Name); i++ {
+			rpc.Name = upperCamel(splitWords(graphQLFieldName(endpoint, fn))) + fmt.Sprint(i)
+		}
+
+		request := &ProtoMessage{}
+		for _, param := range fn.Parameters {
+			if param.Role == analyzer.RoleContext {
+				continue
+			}
+			request.Fields = append(request.Fields, b.field(param.Name, b.typeOf(param.Type, param.Resolved, fn.PackagePath), ""))
+		}
+		rpc.Request = b.claim(request, rpc.Name+"Request", service.Name+rpc.Name+"Request")
+		request.Description = fmt.Sprintf("%s is the request of %s.", rpc.Request, rpc.Name)
+		rpc.Response, rpc.Results = b.response(fn, rpc.Name, service.Name)
+		service.RPCs = append(service.RPCs, rpc)
+	}
+
+	for _, service := range services {
+		design.Services = append(design.Services, *service)
+	}
+	sort.Slice(design.Services, func(i, j int) bool { return design.Services[i].Name < design.Services[j].Name })
+	design.Constructors = ad.constructorCalls(functions)
+
+	if numbers == nil {
+		numbers = &ProtoNumbers{}
+	}
+	if numbers.Messages == nil {
+		numbers.Messages = make(map[string]MessageNumbers)
+	}
+	for _, message := range b.messages {
+		numbers.number(message)
+		design.Messages = append(design.Messages, *message)
+	}
+	sort.Slice(design.Messages, func(i, j int) bool { return design.Messages[i].Name < design.Messages[j].Name })
+	for file := range b.imports {
+		design.Imports = append(design.Imports, file)
+	}
+	sort.Strings(design.Imports)
+	design.Numbers = numbers
+	ad.Proto = design
+}
+
+func hasRPC(service *ProtoService, name string) bool {
+	for _, rpc := range service.RPCs {
+		if rpc.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// protoErrors maps the error responses of an endpoint to gRPC codes.
+func protoErrors(endpoint APIEndpoint) []ProtoError {
+	var errs []ProtoError
+	index := make(map[string]int)
+	for _, response := range endpoint.Responses {
+		if response.Type != "error" || len(response.Errors) == 0 {
+			continue
+		}
+		code := grpcCodes[response.StatusCode]
+		if code == "" {
+			code = "Internal"
+		}
+		if i, ok := index[code]; ok {
+			errs[i].Errors = append(errs[i].Errors, response.Errors...)
+			continue
+		}
+		index[code] = len(errs)
+		errs = append(errs, ProtoError{Code: code, Errors: append([]analyzer.ErrorInfo(nil), response.Errors...)})
+	}
+	return errs
+}
+
+// upperCamel joins words as an UpperCamelCase identifier.
+func upperCamel(words []string) string {
+	name := []rune(lowerCamel(words))
+	if len(name) > 0 {
+		name[0] = unicode.ToUpper(name[0])
+	}
+	return string(name)
+}
+
+// protoType is the type of a field: a scalar, message or map type name, and
+// whether the field repeats it or tracks its presence.
+type protoType struct {
+	name     string
+	repeated bool
+	optional bool
+}
+
+// Well-known types of the messages.
+const (
+	protoTimestamp = "google.protobuf.Timestamp"
+	protoValue     = "google.protobuf.Value"
+	protoEmpty     = "google.protobuf.Empty"
+)
+
+var protoImports = map[string]string{
+	protoTimestamp: "google/protobuf/timestamp.proto",
+	protoValue:     "google/protobuf/struct.proto",
+	protoEmpty:     "google/protobuf/empty.proto",
+}
+
+var protoScalars = map[string]string{
+	"string": "string", "bool": "bool",
+	"int": "int64", "int64": "int64", "int8": "int32", "int16": "int32", "int32": "int32", "rune": "int32",
+	"uint": "uint64", "uint64": "uint64", "uintptr": "uint64", "uint8": "uint32", "byte": "uint32", "uint16": "uint32", "uint32": "uint32",
+	"float32": "float", "float64": "double",
+	// Both travel the way encoding/json writes them: durations in
+	// nanoseconds.
+	"time.Time": protoTimestamp, "time.Duration": "int64",
+}
+
+// protoMapKeys are the scalars maps can be keyed by.
+var protoMapKeys = map[string]bool{
+	"string": true, "bool": true, "int32": true, "int64": true, "uint32": true, "uint64": true,
+}
+
+// protoBuilder maps Go types to proto types, declaring the messages it
+// needs along the way.
+type protoBuilder struct {
+	schemas  map[string]*analyzer.TypeSchema
+	messages map[string]*ProtoMessage
+	// names holds the message name given to each Go struct, keyed by its
+	// qualified name.
+	names   map[string]string
+	imports map[string]bool
+}
+
+// claim declares message under name, or under alternative when a message
+// of another Go type already has that name, and returns the name used.
+func (b *protoBuilder) claim(message *ProtoMessage, name, alternative string) string {
+	if _, taken := b.messages[name]; taken {
+		name = alternative
+	}
+	for i := 2; b.messages[name] != nil; i++ {
+		name = alternative + fmt.Sprint(i)
+	}
+	message.Name = name
+	b.messages[name] = message
+	return name
+}
+
+// response returns the response message of the RPC calling fn, and the
+// JSON names of the fields of its results unless the message is that of
+// its only result.
+func (b *protoBuilder) response(fn analyzer.FunctionInfo, rpc, service string) (string, []string) {
+	var values []analyzer.ParameterInfo
+	for _, result := range fn.Results {
+		if result.Role != analyzer.RoleError {
+			values = append(values, result)
+		}
+	}
+	if len(values) == 0 {
+		b.use(protoEmpty)
+		return protoEmpty, nil
+	}
+	types := make([]protoType, len(values))
+	for i, value := range values {
+		types[i] = b.typeOf(value.Type, value.Resolved, fn.PackagePath)
+	}
+	if len(values) == 1 && !types[0].repeated {
+		if message := b.messages[types[0].name]; message != nil && message.GoType != "" {
+			return types[0].name, nil
+		}
+	}
+
+	response := &ProtoMessage{}
+	var names []string
+	for i, value := range values {
+		name := value.Name
+		switch {
+		case name != "" && name != "_":
+		case len(values) == 1:
+			name = "result"
+		default:
+			name = fmt.Sprintf("result%d", i+1)
+		}
+		field := b.field(name, types[i], "")
+		response.Fields = append(response.Fields, field)
+		names = append(names, field.JSONName)
+	}
+	name := b.claim(response, rpc+"Response", service+rpc+"Response")
+	response.Description = fmt.Sprintf("%s is the response of %s.", name, rpc)
+	return name, names
+}
+
+func (b *protoBuilder) use(wellKnown string) {
+	if file := protoImports[wellKnown]; file != "" {
+		b.imports[file] = true
+	}
+}
+
+func (b *protoBuilder) value() protoType {
+	b.use(protoValue)
+	return protoType{name: protoValue}
+}
+
+func (b *protoBuilder) scalar(goType string) protoType {
+	name := protoScalars[goType]
+	b.use(name)
+	return protoType{name: name}
+}
+
+// typeOf returns the proto type of a Go type as written in package pkg, or
+// as resolved when the analysis was type-checked.
+func (b *protoBuilder) typeOf(goType string, resolved *analyzer.TypeInfo, pkg string) protoType {
+	if resolved != nil {
+		return b.resolvedType(resolved)
+	}
+
+	switch {
+	case strings.HasPrefix(goType, "*"):
+		return b.optional(b.typeOf(goType[1:], nil, pkg))
+	case goType == "[]byte":
+		return protoType{name: "bytes"}
+	case strings.HasPrefix(goType, "[]"):
+		return b.list(b.typeOf(goType[2:], nil, pkg))
+	case strings.HasPrefix(goType, "..."):
+		return b.list(b.typeOf(goType[3:], nil, pkg))
+	case strings.HasPrefix(goType, "map["):
+		if key, elem, ok := strings.Cut(goType[len("map["):], "]"); ok && !strings.ContainsAny(key, "[]") {
+			return b.mapOf(b.typeOf(key, nil, pkg), b.typeOf(elem, nil, pkg))
+		}
+	case protoScalars[goType] != "":
+		return b.scalar(goType)
+	}
+	if !strings.ContainsAny(goType, "[]().{} ") {
+		if schema := b.schemas[pkg+"."+goType]; schema != nil && schema.Kind == analyzer.KindStruct {
+			return protoType{name: b.namedMessage(schema)}
+		}
+	}
+	return b.value()
+}
+
+func (b *protoBuilder) resolvedType(ti *analyzer.TypeInfo) protoType {
+	if protoScalars[ti.QualifiedName] != "" {
+		return b.scalar(ti.QualifiedName)
+	}
+	if ti.IsNamed {
+		if schema := b.schemas[ti.QualifiedName]; schema != nil {
+			switch {
+			case schema.Kind == analyzer.KindStruct:
+				return protoType{name: b.namedMessage(schema)}
+			case schema.Elem != nil && (schema.Kind == analyzer.KindSlice || schema.Kind == analyzer.KindArray):
+				return b.list(b.resolvedType(schema.Elem))
+			case schema.Elem != nil && schema.Key != nil && schema.Kind == analyzer.KindMap:
+				return b.mapOf(b.resolvedType(schema.Key), b.resolvedType(schema.Elem))
+			case schema.Elem != nil && schema.Kind == analyzer.KindPointer:
+				return b.optional(b.resolvedType(schema.Elem))
+			}
+		}
+		if ti.Kind == analyzer.KindBasic && protoScalars[ti.Underlying] != "" {
+			return b.scalar(ti.Underlying)
+		}
+		return b.value()
+	}
+
+	switch ti.Kind {
+	case analyzer.KindBasic:
+		if protoScalars[ti.Underlying] != "" {
+			return b.scalar(ti.Underlying)
+		}
+	case analyzer.KindPointer:
+		if ti.Elem != nil {
+			return b.optional(b.resolvedType(ti.Elem))
+		}
+	case analyzer.KindSlice, analyzer.KindArray:
+		if ti.Elem != nil && ti.Elem.QualifiedName == "byte" {
+			return protoType{name: "bytes"}
+		}
+		if ti.Elem != nil {
+			return b.list(b.resolvedType(ti.Elem))
+		}
+	case analyzer.KindMap:
+		if ti.Key != nil && ti.Elem != nil {
+			return b.mapOf(b.resolvedType(ti.Key), b.resolvedType(ti.Elem))
+		}
+	}
+	return b.value()
+}
+
+// optional tracks the presence of scalars; messages have it already.
+func (b *protoBuilder) optional(t protoType) protoType {
+	if !t.repeated && (protoMapKeys[t.name] || t.name == "float" || t.name == "double" || t.name == "bytes") {
+		t.optional = true
+	}
+	return t
+}
+
+// list repeats t. Lists of lists and of maps are not fields protobuf can
+// repeat, so they are values.
+func (b *protoBuilder) list(t protoType) protoType {
+	if t.repeated || strings.HasPrefix(t.name, "map<") {
+		return b.value()
+	}
+	return protoType{name: t.name, repeated: true}
+}
+
+func (b *protoBuilder) mapOf(key, elem protoType) protoType {
+	if !protoMapKeys[key.name] || key.repeated || elem.repeated || strings.HasPrefix(elem.name, "map<") {
+		return b.value()
+	}
+	return protoType{name: "map<" + key.name + ", " + elem.name + ">"}
+}
+
+// namedMessage declares the message of a struct, named after the Go type,
+// and returns its name.
+func (b *protoBuilder) namedMessage(schema *analyzer.TypeSchema) string {
+	if name, ok := b.names[schema.Name]; ok {
+		return name
+	}
+	name := schema.TypeName
+	if name == "" {
+		name = schema.Name[strings.LastIndex(schema.Name, ".")+1:]
+	}
+	pkg := schema.PkgPath[strings.LastIndex(schema.PkgPath, "/")+1:]
+	message := &ProtoMessage{Description: schema.Doc, GoType: schema.Name}
+	name = b.claim(message, name, upperCamel(splitWords(pkg))+name)
+	// Named before the fields, so that recursive types end.
+	b.names[schema.Name] = name
+	message.Fields = b.fields(schema)
+	return name
+}
+
+// fields returns the fields of a struct as encoding/json sees them, with
+// those of embedded structs promoted.
+func (b *protoBuilder) fields(schema *analyzer.TypeSchema) []ProtoField {
+	var fields []ProtoField
+	for _, field := range schema.Fields {
+		if promoted(field) {
+			if embedded := b.schemas[strings.TrimPrefix(field.Type.QualifiedName, "*")]; embedded != nil && embedded.Kind == analyzer.KindStruct {
+				fields = append(fields, b.fields(embedded)...)
+				continue
+			}
+		}
+		name := field.JSONName
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, b.field(name, b.resolvedType(field.Type), field.Doc))
+	}
+	return fields
+}
+
+var nonProtoIdent = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// field returns the field carrying the JSON value called jsonName, named
+// in snake case.
+func (b *protoBuilder) field(jsonName string, t protoType, description string) ProtoField {
+	var words []string
+	for _, part := range nonProtoIdent.Split(jsonName, -1) {
+		words = append(words, splitWords(part)...)
+	}
+	name := strings.ToLower(strings.Join(words, "_"))
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "field_" + name
+	}
+	return ProtoField{Name: name, JSONName: jsonName, Type: t.name, Repeated: t.repeated, Optional: t.optional, Description: description}
+}
+
+// defaultJSONName is the JSON name protoc gives a field: its name in lower
+// camel case.
+func defaultJSONName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// File writes the definition as a .proto file whose Go code is generated
+// in goPackage.
+func (p *ProtoDesign) File(goPackage string) string {
+	var b strings.Builder
+	writeComment := func(indent, comment string) {
+		if comment = strings.TrimSpace(comment); comment != "" {
+			for _, line := range strings.Split(comment, "\n") {
+				fmt.Fprintf(&b, "%s// %s\n", indent, strings.TrimRight(line, " \t"))
+			}
+		}
+	}
+
+	fmt.Fprintf(&b, "syntax = \"proto3\";\n\npackage %s;\n\n", p.Package)
+	for _, file := range p.Imports {
+		fmt.Fprintf(&b, "import %q;\n", file)
+	}
+	if len(p.Imports) > 0 {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "option go_package = %q;\n", goPackage)
+
+	for _, service := range p.Services {
+		b.WriteString("\n")
+		writeComment("", service.Description)
+		fmt.Fprintf(&b, "service %s {\n", service.Name)
+		for _, rpc := range service.RPCs {
+			writeComment("  ", rpc.Description)
+			fmt.Fprintf(&b, "  rpc %s(%s) returns (%s);\n", rpc.Name, rpc.Request, rpc.Response)
+		}
+		b.WriteString("}\n")
+	}
+
+	for _, message := range p.Messages {
+		b.WriteString("\n")
+		writeComment("", message.Description)
+		fmt.Fprintf(&b, "message %s {\n", message.Name)
+		if len(message.Reserved) > 0 {
+			names := make([]string, 0, len(message.Reserved))
+			for name := range message.Reserved {
+				names = append(names, name)
+			}
+			sort.Slice(names, func(i, j int) bool { return message.Reserved[names[i]] < message.Reserved[names[j]] })
+			numbers := make([]string, len(names))
+			for i, name := range names {
+				numbers[i] = fmt.Sprint(message.Reserved[name])
+				names[i] = fmt.Sprintf("%q", name)
+			}
+			fmt.Fprintf(&b, "  reserved %s;\n  reserved %s;\n\n", strings.Join(numbers, ", "), strings.Join(names, ", "))
+		}
+		for _, field := range message.Fields {
+			writeComment("  ", field.Description)
+			label := ""
+			switch {
+			case field.Repeated:
+				label = "repeated "
+			case field.Optional:
+				label = "optional "
+			}
+			options := ""
+			if field.JSONName != defaultJSONName(field.Name) {
+				options = fmt.Sprintf(" [json_name = %q]", field.JSONName)
+			}
+			fmt.Fprintf(&b, "  %s%s %s = %d%s;\n", label, field.Type, field.Name, field.Number, options)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package designer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+func protoUserSchemas(pkg string, fields ...analyzer.FieldSchema) map[string]*analyzer.TypeSchema {
+	return map[string]*analyzer.TypeSchema{
+		pkg + ".User": {Name: pkg + ".User", TypeName: "User", PkgPath: pkg, Kind: analyzer.KindStruct, Doc: "User is a customer.", Fields: fields},
+	}
+}
+
+func TestDesignProto(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	text := &analyzer.TypeInfo{QualifiedName: "string", Name: "string", Kind: analyzer.KindBasic, Underlying: "string", IsNamed: true}
+	user := &analyzer.TypeInfo{QualifiedName: pkg + ".User", Name: "User", PkgPath: pkg, Kind: analyzer.KindStruct, IsNamed: true}
+	schemas := protoUserSchemas(pkg,
+		analyzer.FieldSchema{Name: "ID", Type: text, JSONName: "id"},
+		analyzer.FieldSchema{Name: "CreatedAt", JSONName: "createdAt",
+			Type: &analyzer.TypeInfo{QualifiedName: "time.Time", Name: "Time", PkgPath: "time", Kind: analyzer.KindStruct, IsNamed: true}},
+		analyzer.FieldSchema{Name: "Nickname", JSONName: "nickname",
+			Type: &analyzer.TypeInfo{QualifiedName: "*string", Kind: analyzer.KindPointer, Elem: text}},
+		analyzer.FieldSchema{Name: "Friends", JSONName: "friends",
+			Type: &analyzer.TypeInfo{QualifiedName: "[]*" + pkg + ".User", Kind: analyzer.KindSlice,
+				Elem: &analyzer.TypeInfo{QualifiedName: "*" + pkg + ".User", Kind: analyzer.KindPointer, Elem: user}}},
+		analyzer.FieldSchema{Name: "Scores", JSONName: "scores",
+			Type: &analyzer.TypeInfo{QualifiedName: "map[string]float64", Kind: analyzer.KindMap, Key: text,
+				Elem: &analyzer.TypeInfo{QualifiedName: "float64", Name: "float64", Kind: analyzer.KindBasic, Underlying: "float64", IsNamed: true}}},
+		analyzer.FieldSchema{Name: "Extra", JSONName: "extra",
+			Type: &analyzer.TypeInfo{QualifiedName: "interface{}", Kind: analyzer.KindInterface}},
+	)
+
+	failure := analyzer.ParameterInfo{Type: "error", Role: analyzer.RoleError}
+	get := analyzer.FunctionInfo{Name: "GetUser", Package: "users", PackagePath: pkg, Effect: analyzer.EffectReadOnly, Doc: "GetUser returns a user.",
+		Parameters: []analyzer.ParameterInfo{{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext}, {Name: "userID", Type: "string"}},
+		Results:    []analyzer.ParameterInfo{{Type: "*User"}, failure},
+		Errors:     []analyzer.ErrorInfo{{Name: pkg + ".ErrNotFound", Kind: analyzer.ErrorSentinel}}}
+	list := analyzer.FunctionInfo{Name: "ListUsers", Package: "users", PackagePath: pkg, Effect: analyzer.EffectReadOnly,
+		Parameters: []analyzer.ParameterInfo{{Name: "tags", Type: "...string"}},
+		Results:    []analyzer.ParameterInfo{{Type: "[]User"}, {Name: "total", Type: "int"}}}
+	save := analyzer.FunctionInfo{Name: "SaveUser", Package: "users", PackagePath: pkg,
+		Parameters: []analyzer.ParameterInfo{{Name: "user", Type: "User"}}, Results: []analyzer.ParameterInfo{failure}}
+	export := analyzer.FunctionInfo{Name: "Export", Package: "users", PackagePath: pkg,
+		Parameters: []analyzer.ParameterInfo{{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter}}, Results: []analyzer.ParameterInfo{failure}}
+	functions := []analyzer.FunctionInfo{get, list, save, export}
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	designer.DesignProto(functions, schemas, nil)
+	design := designer.Proto
+	require.NotNil(t, design)
+	assert.Equal(t, []string{pkg + ".Export: parameter w is written as a stream"}, design.Skipped)
+	require.Len(t, design.Services, 1)
+	require.Len(t, design.Services[0].RPCs, 3)
+	assert.Equal(t, []ProtoError{{Code: "NotFound", Errors: get.Errors}}, design.Services[0].RPCs[0].Errors)
+	assert.Equal(t, []string{"result1", "total"}, design.Services[0].RPCs[1].Results)
+
+	assert.Equal(t, `syntax = "proto3";
+
+package api;
+
+import "google/protobuf/empty.proto";
+import "google/protobuf/struct.proto";
+import "google/protobuf/timestamp.proto";
+
+option go_package = "example.com/api/pb";
+
+// UsersService serves the functions of package example.com/shop/users.
+service UsersService {
+  // GetUser returns a user.
+  rpc GetUser(GetUserRequest) returns (User);
+  rpc ListUsers(ListUsersRequest) returns (ListUsersResponse);
+  rpc SaveUser(SaveUserRequest) returns (google.protobuf.Empty);
+}
+
+// GetUserRequest is the request of GetUser.
+message GetUserRequest {
+  string user_id = 1 [json_name = "userID"];
+}
+
+// ListUsersRequest is the request of ListUsers.
+message ListUsersRequest {
+  repeated string tags = 1;
+}
+
+// ListUsersResponse is the response of ListUsers.
+message ListUsersResponse {
+  repeated User result1 = 1;
+  int64 total = 2;
+}
+
+// SaveUserRequest is the request of SaveUser.
+message SaveUserRequest {
+  User user = 1;
+}
+
+// User is a customer.
+message User {
+  string id = 1;
+  google.protobuf.Timestamp created_at = 2;
+  optional string nickname = 3;
+  repeated User friends = 4;
+  map<string, double> scores = 5;
+  google.protobuf.Value extra = 6;
+}
+`, design.File("example.com/api/pb"))
+
+	// Regenerating keeps the numbers of the fields left, and reserves those
+	// of removed fields.
+	var saved bytes.Buffer
+	require.NoError(t, design.Numbers.Write(&saved))
+	numbers, err := ReadProtoNumbers(&saved)
+	require.NoError(t, err)
+	schemas = protoUserSchemas(pkg,
+		analyzer.FieldSchema{Name: "Email", Type: text, JSONName: "email"},
+		analyzer.FieldSchema{Name: "ID", Type: text, JSONName: "id"},
+		analyzer.FieldSchema{Name: "Extra", JSONName: "extra", Type: &analyzer.TypeInfo{QualifiedName: "interface{}", Kind: analyzer.KindInterface}},
+	)
+	designer.DesignProto(functions, schemas, numbers)
+	file := designer.Proto.File("example.com/api/pb")
+	assert.Contains(t, file, `// User is a customer.
+message User {
+  reserved 2, 3, 4, 5;
+  reserved "created_at", "nickname", "friends", "scores";
+
+  string id = 1;
+  google.protobuf.Value extra = 6;
+  string email = 7;
+}
+`)
+	assert.Equal(t, MessageNumbers{
+		Fields:   map[string]int{"id": 1, "extra": 6, "email": 7},
+		Reserved: map[string]int{"created_at": 2, "nickname": 3, "friends": 4, "scores": 5},
+	}, numbers.Messages["User"])
+}
+
+func TestReadProtoNumbersInvalid(t *testing.T) {
+	for input, message := range map[string]string{
+		"messages:\n  User:\n    fields:\n      id: 0\n":                               "User.id: invalid field number 0",
+		"messages:\n  User:\n    fields:\n      id: 19500\n":                           "User.id: invalid field number 19500",
+		"messages:\n  User:\n    fields:\n      id: 1\n    reserved:\n      name: 1\n": "User: fields id and name share number 1",
+		"messages:\n  User:\n    numbers: {}\n":                                        "error decoding proto numbers",
+	} {
+		_, err := ReadProtoNumbers(strings.NewReader(input))
+		if assert.Error(t, err, input) {
+			assert.Contains(t, err.Error(), message)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package designer
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// operation is what a function does to its resource, judging by the verb
+// starting its name.
+type operation string
+
+const (
+	opRead   operation = "read"
+	opList   operation = "list"
+	opCreate operation = "create"
+	opUpdate operation = "update"
+	opDelete operation = "delete"
+	// opAction is any other verb, exposed below the item it acts on.
+	opAction operation = "action"
+)
+
+var operationVerbs = map[string]operation{
+	"get": opRead, "find": opRead, "fetch": opRead, "load": opRead, "read": opRead,
+	"lookup": opRead, "show": opRead, "describe": opRead,
+	"list": opList, "search": opList, "browse": opList,
+	"create": opCreate, "add": opCreate, "insert": opCreate, "register": opCreate,
+	"update": opUpdate, "set": opUpdate, "save": opUpdate, "put": opUpdate, "edit": opUpdate,
+	"modify": opUpdate, "replace": opUpdate, "patch": opUpdate, "upsert": opUpdate,
+	"delete": opDelete, "remove": opDelete, "destroy": opDelete, "drop": opDelete,
+}
+
+// conventionalMethods are the HTTP methods REST uses for each operation.
+var conventionalMethods = map[operation]string{
+	opRead:   "GET",
+	opList:   "GET",
+	opCreate: "POST",
+	opUpdate: "PUT",
+	opDelete: "DELETE",
+}
+
+var operationGerunds = map[operation]string{
+	opRead:   "reading",
+	opList:   "listing",
+	opCreate: "creating",
+	opUpdate: "updating",
+	opDelete: "deleting",
+}
+
+// nounEnds are the words ending the noun of a name, as in GetUserByID or
+// ListOrdersForUser.
+var nounEnds = map[string]bool{"By": true, "For": true, "With": true, "From": true, "In": true}
+
+// ownerSuffixes are left out of service names to find the resource they
+// manage, so that UserService and UserStore both manage users.
+var ownerSuffixes = []string{"Service", "Store", "Repository", "Repo", "Manager", "Handler", "Controller", "API", "Server", "Client"}
+
+var irregularPlurals = map[string]string{
+	"person": "people",
+	"child":  "children",
+	"man":    "men",
+	"woman":  "women",
+}
+
+// resourceRoute is where a function lives among the resources of the API.
+type resourceRoute struct {
+	Path string
+	Op   operation
+	// Resource is the kebab-case name of the collection, e.g. "users".
+	Resource string
+	// PathParams are the parameters appearing in Path, outermost first.
+	PathParams []string
+}
+
+// routeResource maps fn onto a resource. The verb starting the name of fn
+// gives the operation and the rest, up to a word such as By, the noun naming
+// the resource; names made of a verb alone act on owner, the resource of the
+// service declaring fn. A parameter identifying an item, such as id or
+// userID, turns the collection path into an item path, one a word such as
+// By names looks the item up by that field, and one identifying another
+// resource nests the collection below it:
+//
+//	ListUsers()                 GET    /users
+//	CreateUser(user)            POST   /users
+//	GetUser(id)                 GET    /users/{id}
+//	GetUserByEmail(email)       GET    /users/by-email/{email}
+//	ListOrders(userID)          GET    /users/{userID}/orders
+//	ActivateUser(id)            POST   /users/{id}/activate
+//	GetStatus()                 GET    /status
+//
+// It returns false when fn does not fit, as with GetOrCreateUser, or with
+// actions not naming an item.
+func routeResource(fn analyzer.FunctionInfo, owner []string) (resourceRoute, bool) {
+	words := splitWords(fn.Name)
+	if len(words) == 0 {
+		return resourceRoute{}, false
+	}
+	verb := strings.ToLower(words[0])
+	op, ok := operationVerbs[verb]
+	if !ok {
+		op = opAction
+	}
+
+	var noun []string
+	qualifier := ""
+	for i, word := range words[1:] {
+		if word == "Or" || word == "And" {
+			return resourceRoute{}, false
+		}
+		if nounEnds[word] {
+			if word == "By" {
+				qualifier = strings.Join(words[i+2:], "")
+			}
+			break
+		}
+		noun = append(noun, word)
+	}
+	if len(noun) == 0 {
+		noun = owner
+	}
+	if len(noun) == 0 {
+		return resourceRoute{}, false
+	}
+
+	plural := isPlural(noun[len(noun)-1])
+	collection := kebab(pluralize(noun))
+	item := itemParameter(fn, collection, qualifier)
+	parent := parentParameter(fn, collection, item)
+	if op == opRead && plural && item == nil {
+		op = opList
+	}
+
+	route := resourceRoute{Op: op, Resource: collection}
+	if parent != nil {
+		parentNoun := idPrefix(parent.Name)
+		route.Path = "/" + kebab(pluralize(parentNoun)) + "/{" + parent.Name + "}"
+		route.PathParams = append(route.PathParams, parent.Name)
+	}
+	switch {
+	case op == opList || op == opCreate:
+		route.Path += "/" + collection
+	case item != nil:
+		route.Path += "/" + collection
+		if qualifier != "" && !isIDLike(item.Name) {
+			// A field other than the identifier gets a path of its own, lest
+			// GetUserByEmail be routed as GetUser.
+			route.Path += "/by-" + kebab(splitWords(item.Name))
+		}
+		route.Path += "/{" + item.Name + "}"
+		route.PathParams = append(route.PathParams, item.Name)
+		if op == opAction {
+			route.Path += "/" + verb
+		}
+	case op == opAction:
+		return resourceRoute{}, false
+	case plural:
+		route.Path += "/" + collection
+	default:
+		// Without an identifier, a singular noun names the one resource
+		// of its kind, as with GetStatus or UpdateConfig.
+		route.Path += "/" + kebab(noun)
+	}
+	return route, true
+}
+
+// itemParameter returns the parameter of fn identifying one item of
+// collection: the one named by the qualifier of the name, as email in
+// GetUserByEmail, or else one named like id or userID.
+func itemParameter(fn analyzer.FunctionInfo, collection string, qualifier string) *analyzer.ParameterInfo {
+	var byPrefix *analyzer.ParameterInfo
+	for i := range fn.Parameters {
+		param := &fn.Parameters[i]
+		if !pathEligible(fn, *param) {
+			continue
+		}
+		name := strings.ToLower(param.Name)
+		if qualifier != "" && (name == strings.ToLower(qualifier) || (strings.EqualFold(qualifier, "id") && isIDLike(param.Name))) {
+			return param
+		}
+		switch {
+		case name == "id" || name == "uuid" || name == "key" || name == "slug":
+			if qualifier == "" {
+				return param
+			}
+		case identifies(param.Name, collection):
+			if qualifier == "" && byPrefix == nil {
+				byPrefix = param
+			}
+		}
+	}
+	return byPrefix
+}
+
+// parentParameter returns the first parameter of fn, other than item,
+// identifying an item of a resource other than collection.
+func parentParameter(fn analyzer.FunctionInfo, collection string, item *analyzer.ParameterInfo) *analyzer.ParameterInfo {
+	for i := range fn.Parameters {
+		param := &fn.Parameters[i]
+		if param == item || !pathEligible(fn, *param) || len(idPrefix(param.Name)) == 0 {
+			continue
+		}
+		if !identifies(param.Name, collection) {
+			return param
+		}
+	}
+	return nil
+}
+
+// identifies reports whether the parameter named name identifies an item of
+// collection, as userID does for users.
+func identifies(name, collection string) bool {
+	prefix := idPrefix(name)
+	return len(prefix) > 0 && kebab(pluralize(prefix)) == collection
+}
+
+// pathEligible reports whether param can be sent as part of the path: it
+// plays no special role, has a scalar or identifier type, and no directive
+// places it elsewhere.
+func pathEligible(fn analyzer.FunctionInfo, param analyzer.ParameterInfo) bool {
+	if param.Name == "" || param.Role != "" {
+		return false
+	}
+	if location := fn.Directives.ParamLocations[param.Name]; location != "" && location != "path" {
+		return false
+	}
+	if param.Resolved != nil {
+		return scalarType(param) != ""
+	}
+	typeName := param.Type
+	if i := strings.LastIndex(typeName, "."); i >= 0 {
+		typeName = typeName[i+1:]
+	}
+	switch {
+	case typeName == "string",
+		strings.HasPrefix(typeName, "int"),
+		strings.HasPrefix(typeName, "uint"),
+		strings.HasSuffix(typeName, "ID"),
+		strings.HasSuffix(typeName, "Id"),
+		strings.HasSuffix(typeName, "UUID"):
+		return true
+	}
+	return false
+}
+
+// isIDLike reports whether name is an identifier's name: id, key, userID,
+// user_id and the like.
+func isIDLike(name string) bool {
+	switch strings.ToLower(name) {
+	case "id", "uuid", "key", "slug":
+		return true
+	}
+	for _, suffix := range []string{"ID", "Id", "UUID", "_id"} {
+		if len(name) > len(suffix) && strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// idPrefix returns the words of an identifier's name before its id suffix,
+// e.g. [order Item] for orderItemID.
+func idPrefix(name string) []string {
+	for _, suffix := range []string{"UUID", "ID", "Id", "_id"} {
+		if len(name) > len(suffix) && strings.HasSuffix(name, suffix) {
+			return splitWords(strings.TrimSuffix(name, suffix))
+		}
+	}
+	return nil
+}
+
+// ownerNoun returns the resource managed by a service named name, or else,
+// for a service named Service alone, the one its package pkg is about.
+func ownerNoun(name, pkg string) []string {
+	for _, suffix := range ownerSuffixes {
+		if trimmed := strings.TrimSuffix(name, suffix); trimmed != name {
+			name = trimmed
+			break
+		}
+	}
+	if name != "" {
+		return splitWords(name)
+	}
+	if pkg == "" || pkg == "main" {
+		return nil
+	}
+	return []string{pkg}
+}
+
+// splitWords splits a Go identifier into its words, keeping acronyms whole:
+// GetHTTPConfigByID becomes [Get HTTP Config By ID].
+func splitWords(name string) []string {
+	runes := []rune(name)
+	var words []string
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == '_':
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i + 1
+		case unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1]) && runes[i-1] != '_',
+			unicode.IsUpper(runes[i]) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) && i > start:
+			if i > start {
+				words = append(words, string(runes[start:i]))
+			}
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// isPlural guesses whether an English word is plural.
+func isPlural(word string) bool {
+	word = strings.ToLower(word)
+	for _, plural := range irregularPlurals {
+		if word == plural {
+			return true
+		}
+	}
+	for _, suffix := range []string{"ss", "us", "is"} {
+		if strings.HasSuffix(word, suffix) {
+			return false
+		}
+	}
+	return strings.HasSuffix(word, "s")
+}
+
+// pluralize returns words with the last one in the plural.
+func pluralize(words []string) []string {
+	last := words[len(words)-1]
+	lower := strings.ToLower(last)
+	switch {
+	case isPlural(last):
+	case irregularPlurals[lower] != "":
+		last = irregularPlurals[lower]
+	case strings.HasSuffix(lower, "y") && len(lower) > 1 && !strings.ContainsRune("aeiou", rune(lower[len(lower)-2])):
+		last = last[:len(last)-1] + "ies"
+	case strings.HasSuffix(lower, "s"), strings.HasSuffix(lower, "x"), strings.HasSuffix(lower, "z"),
+		strings.HasSuffix(lower, "ch"), strings.HasSuffix(lower, "sh"):
+		last += "es"
+	default:
+		last += "s"
+	}
+	return append(append([]string(nil), words[:len(words)-1]...), last)
+}
+
+func kebab(words []string) string {
+	lower := make([]string, len(words))
+	for i, word := range words {
+		lower[i] = strings.ToLower(word)
+	}
+	return strings.Join(lower, "-")
+}
+
+// restMethod chooses the HTTP method of fn served at route. The method REST
+// conventionally uses for the operation wins over the one inferHTTPMethod
+// chose unless a directive sets the method, or the side effects of fn rule
+// the conventional one out, as with an update that is not idempotent.
+func (ad *APIDesigner) restMethod(fn analyzer.FunctionInfo, route resourceRoute) (string, string) {
+	method, reason := ad.inferHTTPMethod(fn)
+	conventional, ok := conventionalMethods[route.Op]
+	if _, streams := streamsOverGET(fn); fn.Directives.Method != "" || streams || !ok || conventional == method {
+		return method, reason
+	}
+	switch conventional {
+	case "GET":
+		if fn.Effect != "" && fn.Effect != analyzer.EffectPure && fn.Effect != analyzer.EffectReadOnly {
+			return method, reason
+		}
+	case "PUT", "DELETE":
+		if fn.Effect == analyzer.EffectNonIdempotent {
+			return method, reason
+		}
+	}
+	return conventional, "REST convention for " + operationGerunds[route.Op] + " " + route.Resource
+}
+
+// placePathParameters moves the parameters appearing in route to the path.
+func placePathParameters(parameters []Parameter, route resourceRoute) {
+	for _, name := range route.PathParams {
+		for i := range parameters {
+			if parameters[i].Name == name {
+				parameters[i].Location = "path"
+			}
+		}
+	}
+}
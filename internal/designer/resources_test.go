@@ -0,0 +1,81 @@
+package designer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+func TestDesignAPIResources(t *testing.T) {
+	id := analyzer.ParameterInfo{Name: "id", Type: "string"}
+	functions := []analyzer.FunctionInfo{
+		{Name: "ListUsers", Effect: analyzer.EffectReadOnly},
+		{Name: "CreateUser", Effect: analyzer.EffectIdempotent, Parameters: []analyzer.ParameterInfo{{Name: "user", Type: "User"}}},
+		{Name: "GetUser", Parameters: []analyzer.ParameterInfo{id}},
+		{Name: "UpdateUser", Effect: analyzer.EffectNonIdempotent, Parameters: []analyzer.ParameterInfo{id, {Name: "user", Type: "User"}}},
+		{Name: "DeleteUser", Parameters: []analyzer.ParameterInfo{{Name: "userID", Type: "int64"}}},
+		{Name: "GetUserByEmail", Parameters: []analyzer.ParameterInfo{{Name: "email", Type: "string"}}},
+		{Name: "ActivateUser", Parameters: []analyzer.ParameterInfo{id}},
+		{Name: "ListOrders", Parameters: []analyzer.ParameterInfo{{Name: "userID", Type: "UserID"}}},
+		{Name: "GetOrderItem", Parameters: []analyzer.ParameterInfo{{Name: "orderID", Type: "string"}, {Name: "orderItemID", Type: "string"}}},
+		{Name: "GetStatus"},
+		{Name: "AddCategory", Parameters: []analyzer.ParameterInfo{{Name: "name", Type: "string"}}},
+		{Name: "GetOrCreateUser", Parameters: []analyzer.ParameterInfo{id}},
+		{Name: "SendEmail", Parameters: []analyzer.ParameterInfo{{Name: "to", Type: "string"}}},
+		{Name: "Get", Package: "accounts", Parameters: []analyzer.ParameterInfo{id}},
+		{Name: "Add", Package: "shop", Parameters: []analyzer.ParameterInfo{{Name: "a", Type: "int"}, {Name: "b", Type: "int"}}},
+	}
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+
+	routes := make(map[string]string)
+	for _, endpoint := range designer.Endpoints {
+		routes[endpoint.FunctionName] = endpoint.Method + " " + endpoint.Path
+	}
+	assert.Equal(t, map[string]string{
+		"ListUsers":       "GET /users",
+		"CreateUser":      "POST /users",
+		"GetUser":         "GET /users/{id}",
+		"UpdateUser":      "POST /users/{id}",
+		"DeleteUser":      "DELETE /users/{userID}",
+		"GetUserByEmail":  "GET /users/by-email/{email}",
+		"ActivateUser":    "POST /users/{id}/activate",
+		"ListOrders":      "GET /users/{userID}/orders",
+		"GetOrderItem":    "GET /orders/{orderID}/order-items/{orderItemID}",
+		"GetStatus":       "GET /status",
+		"AddCategory":     "POST /categories",
+		"GetOrCreateUser": "GET /get-or-create-user",
+		"SendEmail":       "POST /send-email",
+		"Get":             "GET /get",
+		"Add":             "POST /add",
+	}, routes)
+
+	create := designer.Endpoints[1]
+	assert.Equal(t, "users", create.Resource)
+	assert.Equal(t, "REST convention for creating users", create.MethodReason)
+	// An update that is not idempotent cannot use PUT.
+	assert.Equal(t, "changes state on every call", designer.Endpoints[3].MethodReason)
+
+	orderItem := designer.Endpoints[8]
+	assert.Equal(t, []Parameter{
+		{Name: "orderID", Type: "string", Location: "path", Scalar: "string"},
+		{Name: "orderItemID", Type: "string", Location: "path", Scalar: "string"},
+	}, orderItem.Parameters)
+	assert.Empty(t, designer.Endpoints[11].Resource)
+}
+
+func TestSplitWordsAndPluralize(t *testing.T) {
+	assert.Equal(t, []string{"Get", "HTTP", "Config", "By", "ID"}, splitWords("GetHTTPConfigByID"))
+	assert.Equal(t, []string{"user", "ID"}, splitWords("userID"))
+	assert.Equal(t, []string{"list", "users"}, splitWords("list_users"))
+
+	for singular, plural := range map[string]string{
+		"User": "Users", "Category": "Categories", "Key": "Keys", "Box": "Boxes",
+		"Address": "Addresses", "Person": "people", "Users": "Users", "Status": "Statuses",
+	} {
+		assert.Equal(t, []string{"Order", plural}, pluralize([]string{"Order", singular}), singular)
+	}
+}
@@ -0,0 +1,101 @@
+package designer
+
+import (
+	"strings"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+// Transports of a streamed response.
+const (
+	// StreamSSE sends each value as a Server-Sent Event.
+	StreamSSE = "sse"
+	// StreamWebSocket sends each value as a WebSocket message.
+	StreamWebSocket = "websocket"
+	// StreamChunked sends each value as a line of JSON, or writes the bytes
+	// as they come, in a chunked response.
+	StreamChunked = "chunked"
+)
+
+// Sources of a streamed response.
+const (
+	StreamChannel  = "channel"
+	StreamIterator = "iterator"
+	StreamWriter   = "writer"
+)
+
+var streamTransports = map[string]bool{StreamSSE: true, StreamWebSocket: true, StreamChunked: true}
+
+var transportNames = map[string]string{
+	StreamSSE:       "Server-Sent Events",
+	StreamWebSocket: "a WebSocket",
+	StreamChunked:   "a chunked response",
+}
+
+// Stream describes a response sent piece by piece while the function runs,
+// rather than once it returns. The function's context is cancelled when the
+// client goes away, and a client reading slowly holds up the function, as
+// every value waits for the previous one to be written.
+type Stream struct {
+	// Source is how the function produces the response: the values of the
+	// channel or iter.Seq it returns, or the bytes written to its writer
+	// parameter.
+	Source string `json:"source" yaml:"source"`
+	// Elem is the type of the values, as written; each is sent as JSON.
+	// It is empty for writers.
+	Elem string `json:"elem,omitempty" yaml:"elem,omitempty"`
+	// Transport is StreamSSE, StreamWebSocket or StreamChunked.
+	Transport string `json:"transport" yaml:"transport"`
+}
+
+// ContentType returns the media type of the streamed response; WebSocket
+// messages have none.
+func (s *Stream) ContentType() string {
+	switch {
+	case s.Transport == StreamSSE:
+		return "text/event-stream"
+	case s.Transport == StreamWebSocket:
+		return ""
+	case s.Source == StreamWriter:
+		return "application/octet-stream"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// designStream returns how fn streams its response, or nil when it returns
+// it whole. The stream directive chooses the transport; values go over
+// Server-Sent Events by default and writers to a chunked response, as they
+// did before they were streams.
+func designStream(fn analyzer.FunctionInfo) *Stream {
+	stream := &Stream{Transport: fn.Directives.Stream}
+	switch {
+	case len(fn.Results) > 0 && fn.Results[0].Role == analyzer.RoleStream:
+		stream.Elem = analyzer.StreamElem(fn.Results[0])
+		stream.Source = StreamIterator
+		if strings.Contains(fn.Results[0].Type, "chan ") {
+			stream.Source = StreamChannel
+		}
+	case hasRole(fn.Parameters, analyzer.RoleWriter):
+		stream.Source = StreamWriter
+	default:
+		return nil
+	}
+	if stream.Transport == "" {
+		stream.Transport = StreamSSE
+		if stream.Source == StreamWriter {
+			stream.Transport = StreamChunked
+		}
+	}
+	return stream
+}
+
+// streamsOverGET reports whether fn streams over a transport that clients
+// open with GET: EventSource and WebSocket handshakes send no other method.
+func streamsOverGET(fn analyzer.FunctionInfo) (string, bool) {
+	stream := designStream(fn)
+	if stream == nil || stream.Transport == StreamChunked {
+		return "", false
+	}
+	return "streams over " + transportNames[stream.Transport] + ", which clients open with GET", true
+}
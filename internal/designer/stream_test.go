@@ -0,0 +1,98 @@
+package designer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+func TestDesignAPIStreams(t *testing.T) {
+	const pkg = "example.com/shop/events"
+	failure := analyzer.ParameterInfo{Type: "error", Role: analyzer.RoleError}
+	functions := []analyzer.FunctionInfo{
+		{Name: "Watch", Package: "events", PackagePath: pkg, Effect: analyzer.EffectNonIdempotent,
+			Parameters: []analyzer.ParameterInfo{{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext}, {Name: "prefix", Type: "string"}},
+			Results:    []analyzer.ParameterInfo{{Type: "<-chan Event", Role: analyzer.RoleStream}, failure}},
+		{Name: "Replay", Package: "events", PackagePath: pkg, Directives: analyzer.Directives{Stream: "websocket"},
+			Parameters: []analyzer.ParameterInfo{{Name: "since", Type: "int"}},
+			Results:    []analyzer.ParameterInfo{{Type: "iter.Seq[Event]", Role: analyzer.RoleStream}}},
+		{Name: "Export", Package: "events", PackagePath: pkg, Effect: analyzer.EffectNonIdempotent,
+			Parameters: []analyzer.ParameterInfo{{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter}, {Name: "filter", Type: "Filter"}},
+			Results:    []analyzer.ParameterInfo{failure}},
+		{Name: "Count", Package: "events", PackagePath: pkg, Results: []analyzer.ParameterInfo{{Type: "int"}}},
+	}
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	require.Len(t, designer.Endpoints, 4)
+
+	watch := designer.Endpoints[0]
+	assert.Equal(t, &Stream{Source: StreamChannel, Elem: "Event", Transport: StreamSSE}, watch.Stream)
+	assert.Equal(t, "GET", watch.Method)
+	assert.Equal(t, "streams over Server-Sent Events, which clients open with GET", watch.MethodReason)
+	assert.Equal(t, "query", watch.Parameters[1].Location)
+	assert.Equal(t, []Response{{StatusCode: 200, Type: "stream of Event"}, {StatusCode: 500, Type: "error"}}, watch.Responses)
+	assert.Equal(t, "text/event-stream", watch.Stream.ContentType())
+
+	replay := designer.Endpoints[1]
+	assert.Equal(t, &Stream{Source: StreamIterator, Elem: "Event", Transport: StreamWebSocket}, replay.Stream)
+	assert.Equal(t, "GET", replay.Method)
+	assert.Empty(t, replay.Stream.ContentType())
+
+	// Writers keep their method, as chunked responses answer any request.
+	export := designer.Endpoints[2]
+	assert.Equal(t, &Stream{Source: StreamWriter, Transport: StreamChunked}, export.Stream)
+	assert.Equal(t, "POST", export.Method)
+	assert.Equal(t, "body", export.Parameters[1].Location)
+	assert.Equal(t, "application/octet-stream", export.Stream.ContentType())
+
+	assert.Nil(t, designer.Endpoints[3].Stream)
+
+	designer.DesignJSONRPC(functions, nil)
+	assert.Equal(t, []string{
+		pkg + ".Watch: result <-chan Event is streamed",
+		pkg + ".Replay: result iter.Seq[Event] is streamed",
+		pkg + ".Export: parameter w is written as a stream",
+	}, designer.JSONRPC.Skipped)
+}
+
+func TestApplyOverridesStream(t *testing.T) {
+	const pkg = "example.com/shop/events"
+	functions := []analyzer.FunctionInfo{
+		{Name: "Watch", Package: "events", PackagePath: pkg,
+			Results: []analyzer.ParameterInfo{{Type: "<-chan Event", Role: analyzer.RoleStream}}},
+		{Name: "Tail", Package: "events", PackagePath: pkg, Directives: analyzer.Directives{Method: "POST", Stream: "chunked"},
+			Results: []analyzer.ParameterInfo{{Type: "chan Line", Role: analyzer.RoleStream}}},
+		{Name: "Count", Package: "events", PackagePath: pkg, Results: []analyzer.ParameterInfo{{Type: "int"}}},
+	}
+	overrides, err := ReadOverrides(strings.NewReader(`
+functions:
+  Watch:
+    stream: chunked
+  Tail:
+    stream: sse
+  Count:
+    stream: websocket
+  events.Watch:
+    stream: chunked
+`))
+	require.NoError(t, err)
+
+	designer := NewAPIDesigner()
+	designer.DesignAPI(functions)
+	sse := designer.Endpoints[0].Stream
+	require.NoError(t, designer.ApplyOverrides(overrides, functions))
+
+	assert.Equal(t, &Stream{Source: StreamChannel, Elem: "Event", Transport: StreamChunked}, designer.Endpoints[0].Stream)
+	assert.Equal(t, "application/x-ndjson", designer.Endpoints[0].Stream.ContentType())
+	assert.Equal(t, StreamSSE, sse.Transport)
+	assert.Equal(t, []string{
+		"Count: response is not streamed, so stream has no effect",
+		"Tail: streaming over Server-Sent Events needs GET, not POST",
+		"events.Watch: stream is already chunked",
+	}, designer.Warnings)
+}
@@ -0,0 +1,348 @@
+// Package diff compares two API designs, or the designs of two analyses, and
+// classifies every difference by how it affects existing clients.
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+// Severity says whether a change can break existing clients.
+type Severity string
+
+const (
+	// Breaking changes make some requests that used to work fail.
+	Breaking Severity = "breaking"
+	// NonBreaking changes alter the API without failing existing requests.
+	NonBreaking Severity = "non-breaking"
+	// Additive changes only add to the API.
+	Additive Severity = "additive"
+)
+
+// Kinds of changes.
+const (
+	EndpointRemoved          = "endpoint-removed"
+	EndpointAdded            = "endpoint-added"
+	MethodChanged            = "method-changed"
+	PathChanged              = "path-changed"
+	ParameterRemoved         = "parameter-removed"
+	ParameterAdded           = "parameter-added"
+	ParameterRenamed         = "parameter-renamed"
+	ParameterTypeChanged     = "parameter-type-changed"
+	ParameterLocationChanged = "parameter-location-changed"
+	ResponseChanged          = "response-changed"
+	ResponseAdded            = "response-added"
+	ResponseRemoved          = "response-removed"
+	AuthChanged              = "auth-changed"
+	StreamChanged            = "stream-changed"
+)
+
+// Change is one difference between two designs.
+type Change struct {
+	Severity Severity `json:"severity" yaml:"severity"`
+	Kind     string   `json:"kind" yaml:"kind"`
+	// Endpoint is the endpoint concerned as "METHOD path", in the old design
+	// unless it was added.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Function is the qualified name of the function behind the endpoint.
+	Function string `json:"function,omitempty" yaml:"function,omitempty"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+// Report lists the changes from one design to another, breaking ones first.
+type Report struct {
+	Changes []Change `json:"changes" yaml:"changes"`
+}
+
+// Breaking returns the breaking changes of the report.
+func (r *Report) Breaking() []Change {
+	var breaking []Change
+	for _, change := range r.Changes {
+		if change.Severity == Breaking {
+			breaking = append(breaking, change)
+		}
+	}
+	return breaking
+}
+
+// Compare reports how the updated design differs from the old one. Endpoints
+// are matched by method and path first, then by the function they expose, so
+// that a moved endpoint shows as such rather than as removed and added.
+func Compare(old, updated *designer.Design) *Report {
+	report := &Report{}
+	matched := make(map[int]bool)
+	var unmatched []designer.APIEndpoint
+
+	byRoute := make(map[string]int)
+	byFunction := make(map[string]int)
+	for i, endpoint := range updated.Endpoints {
+		byRoute[route(endpoint)] = i
+		byFunction[function(endpoint)] = i
+	}
+	for _, endpoint := range old.Endpoints {
+		if i, ok := byRoute[route(endpoint)]; ok && !matched[i] {
+			matched[i] = true
+			report.compareEndpoints(endpoint, updated.Endpoints[i])
+			continue
+		}
+		unmatched = append(unmatched, endpoint)
+	}
+	for _, endpoint := range unmatched {
+		if i, ok := byFunction[function(endpoint)]; ok && !matched[i] {
+			matched[i] = true
+			report.compareEndpoints(endpoint, updated.Endpoints[i])
+			continue
+		}
+		report.add(Breaking, EndpointRemoved, endpoint, "endpoint removed")
+	}
+	for i, endpoint := range updated.Endpoints {
+		if !matched[i] {
+			report.add(Additive, EndpointAdded, endpoint, "endpoint added")
+		}
+	}
+
+	order := map[Severity]int{Breaking: 0, NonBreaking: 1, Additive: 2}
+	sort.SliceStable(report.Changes, func(i, j int) bool {
+		return order[report.Changes[i].Severity] < order[report.Changes[j].Severity]
+	})
+	return report
+}
+
+func (r *Report) add(severity Severity, kind string, endpoint designer.APIEndpoint, format string, args ...interface{}) {
+	r.Changes = append(r.Changes, Change{
+		Severity: severity,
+		Kind:     kind,
+		Endpoint: route(endpoint),
+		Function: function(endpoint),
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (r *Report) compareEndpoints(old, updated designer.APIEndpoint) {
+	if old.Method != updated.Method {
+		r.add(Breaking, MethodChanged, old, "method changed from %s to %s", old.Method, updated.Method)
+	}
+	if old.Path != updated.Path {
+		r.add(Breaking, PathChanged, old, "path changed from %s to %s", old.Path, updated.Path)
+	}
+	switch {
+	case old.Auth == updated.Auth:
+	case old.Auth == "":
+		r.add(Breaking, AuthChanged, old, "now requires %s authentication", updated.Auth)
+	case updated.Auth == "":
+		r.add(NonBreaking, AuthChanged, old, "no longer requires %s authentication", old.Auth)
+	default:
+		r.add(Breaking, AuthChanged, old, "authentication changed from %s to %s", old.Auth, updated.Auth)
+	}
+	switch {
+	case old.Stream == nil && updated.Stream == nil:
+	case old.Stream == nil:
+		r.add(Breaking, StreamChanged, old, "response is now streamed over %s", updated.Stream.Transport)
+	case updated.Stream == nil:
+		r.add(Breaking, StreamChanged, old, "response is no longer streamed over %s", old.Stream.Transport)
+	case old.Stream.Transport != updated.Stream.Transport:
+		r.add(Breaking, StreamChanged, old, "stream transport changed from %s to %s", old.Stream.Transport, updated.Stream.Transport)
+	}
+	r.compareParameters(old, updated)
+	r.compareResponses(old, updated)
+}
+
+// compareParameters compares the parameters clients send. A parameter that
+// disappears while one of the same type and location appears in its place is
+// taken for renamed.
+func (r *Report) compareParameters(old, updated designer.APIEndpoint) {
+	oldParams, newParams := sent(old.Parameters), sent(updated.Parameters)
+	newByName := make(map[string]designer.Parameter)
+	for _, param := range newParams {
+		newByName[param.Name] = param
+	}
+	oldByName := make(map[string]bool)
+	var removed []designer.Parameter
+	for _, param := range oldParams {
+		oldByName[param.Name] = true
+		changed, ok := newByName[param.Name]
+		if !ok {
+			removed = append(removed, param)
+			continue
+		}
+		if param.Type != changed.Type {
+			r.add(Breaking, ParameterTypeChanged, old, "parameter %s changed type from %s to %s", param.Name, param.Type, changed.Type)
+		}
+		if param.Location != changed.Location {
+			r.add(Breaking, ParameterLocationChanged, old, "parameter %s moved from %s to %s", param.Name, param.Location, changed.Location)
+		}
+	}
+
+	var added []designer.Parameter
+	for _, param := range newParams {
+		if !oldByName[param.Name] {
+			added = append(added, param)
+		}
+	}
+	for _, param := range removed {
+		if i := indexOfSameKind(added, param); i >= 0 {
+			r.add(Breaking, ParameterRenamed, old, "parameter %s renamed to %s", param.Name, added[i].Name)
+			added = append(added[:i], added[i+1:]...)
+			continue
+		}
+		r.add(NonBreaking, ParameterRemoved, old, "parameter %s removed", param.Name)
+	}
+	for _, param := range added {
+		if param.Role == analyzer.RoleOptions {
+			r.add(Additive, ParameterAdded, old, "optional parameter %s (%s) added", param.Name, param.Type)
+			continue
+		}
+		r.add(Breaking, ParameterAdded, old, "required parameter %s (%s) added", param.Name, param.Type)
+	}
+}
+
+func (r *Report) compareResponses(old, updated designer.APIEndpoint) {
+	newByStatus := make(map[int]designer.Response)
+	for _, response := range updated.Responses {
+		newByStatus[response.StatusCode] = response
+	}
+	oldByStatus := make(map[int]bool)
+	for _, response := range old.Responses {
+		oldByStatus[response.StatusCode] = true
+		changed, ok := newByStatus[response.StatusCode]
+		switch {
+		case !ok:
+			r.add(NonBreaking, ResponseRemoved, old, "no longer responds with %d", response.StatusCode)
+		case changed.Type != response.Type:
+			r.add(Breaking, ResponseChanged, old, "response %d changed from %s to %s", response.StatusCode, response.Type, changed.Type)
+		}
+	}
+	for _, response := range updated.Responses {
+		if !oldByStatus[response.StatusCode] {
+			r.add(NonBreaking, ResponseAdded, old, "may now respond with %d (%s)", response.StatusCode, response.Type)
+		}
+	}
+}
+
+// sent returns the parameters that are part of requests.
+func sent(params []designer.Parameter) []designer.Parameter {
+	var result []designer.Parameter
+	for _, param := range params {
+		if param.Location != "" {
+			result = append(result, param)
+		}
+	}
+	return result
+}
+
+func indexOfSameKind(params []designer.Parameter, param designer.Parameter) int {
+	for i, candidate := range params {
+		if candidate.Type == param.Type && candidate.Location == param.Location {
+			return i
+		}
+	}
+	return -1
+}
+
+func route(endpoint designer.APIEndpoint) string {
+	return endpoint.Method + " " + endpoint.Path
+}
+
+// function names the function behind endpoint, qualified by its service type
+// or else its package.
+func function(endpoint designer.APIEndpoint) string {
+	switch {
+	case endpoint.Service != "":
+		return endpoint.Service + "." + endpoint.FunctionName
+	case endpoint.Package != "":
+		return endpoint.Package + "." + endpoint.FunctionName
+	default:
+		return endpoint.FunctionName
+	}
+}
+
+// Write lists the changes as a table, after a summary line.
+func (r *Report) Write(w io.Writer) error {
+	counts := make(map[Severity]int)
+	for _, change := range r.Changes {
+		counts[change.Severity]++
+	}
+	fmt.Fprintf(w, "%d breaking, %d non-breaking and %d additive changes.\n", counts[Breaking], counts[NonBreaking], counts[Additive])
+	if len(r.Changes) == 0 {
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nSEVERITY\tCHANGE\tENDPOINT\tDETAIL")
+	for _, change := range r.Changes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", change.Severity, change.Kind, change.Endpoint, change.Message)
+	}
+	return tw.Flush()
+}
+
+// Load reads a design saved with designer.Design.Write, or an analysis saved
+// with analyzer.Analysis.Write, which it designs the way the generate command
+// does by default.
+func Load(path string) (*designer.Design, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only analyses record the analyzer version.
+	var probe struct {
+		AnalyzerVersion string `json:"analyzerVersion" yaml:"analyzerVersion"`
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		err = json.Unmarshal(data, &probe)
+	} else {
+		err = yaml.Unmarshal(data, &probe)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if probe.AnalyzerVersion == "" {
+		design, err := designer.ReadDesign(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return design, nil
+	}
+
+	analysis, err := analyzer.ReadAnalysis(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	apiDesigner := designer.NewAPIDesigner()
+	apiDesigner.DesignServices(analysis.Services)
+	apiDesigner.DesignAPI(analysis.Functions)
+	return apiDesigner.Design(), nil
+}
+
+// Files compares the designs saved at oldPath and newPath; see Load.
+func Files(oldPath, newPath string) (*Report, error) {
+	old, err := Load(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := Load(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(old, updated), nil
+}
+
+// Summary joins the messages of changes for an error message.
+func Summary(changes []Change) string {
+	messages := make([]string, len(changes))
+	for i, change := range changes {
+		messages[i] = change.Endpoint + ": " + change.Message
+	}
+	return strings.Join(messages, "; ")
+}
@@ -0,0 +1,145 @@
+package diff
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+func endpoint(method, path, function string, params ...designer.Parameter) designer.APIEndpoint {
+	return designer.APIEndpoint{
+		Method:       method,
+		Path:         path,
+		FunctionName: function,
+		Package:      "example.com/shop/users",
+		Parameters:   params,
+		Responses:    []designer.Response{{StatusCode: 200, Type: "*User"}},
+	}
+}
+
+func kinds(changes []Change) []string {
+	result := make([]string, len(changes))
+	for i, change := range changes {
+		result[i] = string(change.Severity) + " " + change.Kind
+	}
+	return result
+}
+
+func TestCompare(t *testing.T) {
+	name := designer.Parameter{Name: "name", Type: "string", Location: "query"}
+	old := &designer.Design{Endpoints: []designer.APIEndpoint{
+		endpoint("GET", "/get-user", "GetUser", name),
+		endpoint("POST", "/save-user", "SaveUser", name),
+		endpoint("GET", "/count", "Count"),
+		endpoint("DELETE", "/purge", "Purge"),
+		endpoint("GET", "/list", "List", designer.Parameter{Name: "limit", Type: "int", Location: "query"}),
+	}}
+
+	getUser := endpoint("GET", "/get-user", "GetUser", designer.Parameter{Name: "fullName", Type: "string", Location: "query"})
+	saveUser := endpoint("PUT", "/save-user", "SaveUser", name)
+	count := endpoint("GET", "/count", "Count", designer.Parameter{Name: "opts", Type: "CountOptions", Location: "query", Role: analyzer.RoleOptions})
+	count.Responses = append(count.Responses, designer.Response{StatusCode: 500, Type: "error"})
+	list := endpoint("GET", "/list", "List",
+		designer.Parameter{Name: "limit", Type: "int64", Location: "query"},
+		designer.Parameter{Name: "tenant", Type: "string", Location: "header"},
+		designer.Parameter{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext})
+	updated := &designer.Design{Endpoints: []designer.APIEndpoint{
+		getUser, saveUser, count, list,
+		endpoint("GET", "/version", "Version"),
+	}}
+
+	report := Compare(old, updated)
+	assert.Equal(t, []string{
+		"breaking parameter-renamed",
+		"breaking parameter-type-changed",
+		"breaking parameter-added",
+		"breaking method-changed",
+		"breaking endpoint-removed",
+		"non-breaking response-added",
+		"additive parameter-added",
+		"additive endpoint-added",
+	}, kinds(report.Changes))
+
+	breaking := report.Breaking()
+	require.Len(t, breaking, 5)
+	assert.Equal(t, Change{
+		Severity: Breaking,
+		Kind:     ParameterRenamed,
+		Endpoint: "GET /get-user",
+		Function: "example.com/shop/users.GetUser",
+		Message:  "parameter name renamed to fullName",
+	}, breaking[0])
+	assert.Equal(t, "required parameter tenant (string) added", breaking[2].Message)
+	assert.Equal(t, "method changed from POST to PUT", breaking[3].Message)
+	assert.Equal(t, "DELETE /purge", breaking[4].Endpoint)
+
+	assert.Empty(t, Compare(old, old).Changes)
+}
+
+func TestCompareStreams(t *testing.T) {
+	watch := endpoint("GET", "/watch", "Watch")
+	watch.Stream = &designer.Stream{Source: designer.StreamChannel, Elem: "Event", Transport: designer.StreamSSE}
+	tail := endpoint("GET", "/tail", "Tail")
+	tail.Stream = &designer.Stream{Source: designer.StreamIterator, Elem: "string", Transport: designer.StreamSSE}
+	old := &designer.Design{Endpoints: []designer.APIEndpoint{watch, tail, endpoint("GET", "/count", "Count")}}
+
+	updatedWatch, updatedTail := watch, endpoint("GET", "/tail", "Tail")
+	updatedWatch.Stream = &designer.Stream{Source: designer.StreamChannel, Elem: "Event", Transport: designer.StreamWebSocket}
+	count := endpoint("GET", "/count", "Count")
+	count.Stream = &designer.Stream{Source: designer.StreamWriter, Transport: designer.StreamChunked}
+	updated := &designer.Design{Endpoints: []designer.APIEndpoint{updatedWatch, updatedTail, count}}
+
+	var messages []string
+	for _, change := range Compare(old, updated).Breaking() {
+		assert.Equal(t, StreamChanged, change.Kind)
+		messages = append(messages, change.Message)
+	}
+	assert.Equal(t, []string{
+		"stream transport changed from sse to websocket",
+		"response is no longer streamed over sse",
+		"response is now streamed over chunked",
+	}, messages)
+}
+
+func TestFilesFromDesignAndAnalysis(t *testing.T) {
+	dir := t.TempDir()
+
+	// The old release was saved as a design, the new one as an analysis.
+	oldDesign := &designer.Design{
+		Version:   designer.DesignVersion,
+		Endpoints: []designer.APIEndpoint{endpoint("GET", "/users/{id}", "GetUser", designer.Parameter{Name: "id", Type: "string", Location: "path"})},
+	}
+	oldPath := filepath.Join(dir, "old.yaml")
+	f, err := os.Create(oldPath)
+	require.NoError(t, err)
+	require.NoError(t, oldDesign.Write(f, analyzer.FormatYAML))
+	require.NoError(t, f.Close())
+
+	fa := analyzer.NewFunctionAnalyzer()
+	fa.Functions = []analyzer.FunctionInfo{{
+		Name:        "GetUser",
+		PackagePath: "example.com/shop/users",
+		Effect:      analyzer.EffectReadOnly,
+		Parameters:  []analyzer.ParameterInfo{{Name: "id", Type: "int"}},
+		Results:     []analyzer.ParameterInfo{{Type: "*User"}},
+	}}
+	newPath := filepath.Join(dir, "new.json")
+	f, err = os.Create(newPath)
+	require.NoError(t, err)
+	require.NoError(t, fa.Analysis().Write(f, analyzer.FormatJSON))
+	require.NoError(t, f.Close())
+
+	report, err := Files(oldPath, newPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"breaking parameter-type-changed"}, kinds(report.Changes))
+	assert.Equal(t, "GET /users/{id}: parameter id changed type from string to int", Summary(report.Breaking()))
+
+	_, err = Files(filepath.Join(dir, "missing.json"), newPath)
+	assert.Error(t, err)
+}
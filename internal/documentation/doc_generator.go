@@ -1,101 +1,227 @@
-package documentation
+// Package docs writes the OpenAPI description of a designed API. It lives in
+// internal/documentation but is named docs because the go tool ignores
+// packages named documentation.
+package docs
 
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
 )
 
 type DocumentationGenerator struct {
-	APIDesign *APIDesigner
+	Design *designer.Design
+	// Dir is where GenerateSwaggerDoc writes swagger.json; empty means the
+	// current directory.
+	Dir string
 }
 
-func NewDocumentationGenerator(apiDesign *APIDesigner) *DocumentationGenerator {
+func NewDocumentationGenerator(design *designer.Design) *DocumentationGenerator {
 	return &DocumentationGenerator{
-		APIDesign: apiDesign,
+		Design: design,
 	}
 }
 
-func (dg *DocumentationGenerator) GenerateSwaggerDoc() error {
+// Document describes every endpoint of the design as an OpenAPI operation.
+// Parameters in the body become the properties of a JSON request body, the
+// request struct the generated handler binds, and those the transport
+// supplies, such as contexts, are left out.
+func (dg *DocumentationGenerator) Document() *openapi3.T {
 	swagger := &openapi3.T{
 		OpenAPI: "3.0.0",
 		Info: &openapi3.Info{
 			Title:   "Soft-Crusher Generated API",
 			Version: "1.0.0",
 		},
-		Paths: openapi3.Paths{},
+		Paths: openapi3.NewPaths(),
 	}
 
-	for _, endpoint := range dg.APIDesign.Endpoints {
-		path := endpoint.Path
-		method := strings.ToLower(endpoint.Method)
-
+	for _, endpoint := range dg.Design.Endpoints {
+		description := endpoint.Description
+		if description == "" {
+			description = fmt.Sprintf("Endpoint for %s", endpoint.FunctionName)
+		}
+		// Endpoints without tags of their own are grouped by resource.
+		tags := endpoint.Tags
+		if len(tags) == 0 && endpoint.Resource != "" {
+			tags = []string{endpoint.Resource}
+		}
 		operation := &openapi3.Operation{
+			OperationID: endpoint.Name,
 			Summary:     fmt.Sprintf("%s operation", endpoint.FunctionName),
-			Description: fmt.Sprintf("Endpoint for %s", endpoint.FunctionName),
-			Parameters:  []*openapi3.ParameterRef{},
-			Responses:   openapi3.Responses{},
+			Description: description,
+			Tags:        tags,
+			Parameters:  openapi3.Parameters{},
+			Responses:   openapi3.NewResponsesWithCapacity(len(endpoint.Responses)),
+		}
+		if endpoint.Package != "" {
+			operation.Extensions = map[string]interface{}{
+				"x-go-package": endpoint.Package,
+				"x-go-source":  endpoint.Source.String(),
+			}
 		}
 
+		var body *openapi3.Schema
 		for _, param := range endpoint.Parameters {
-			paramLocation := openapi3.ParameterInQuery
-			if param.Location == "path" {
-				paramLocation = openapi3.ParameterInPath
+			goType := param.Type
+			if param.Scalar != "" {
+				goType = param.Scalar
+			}
+			schema := dg.convertGoTypeToSchema(goType)
+			switch param.Location {
+			case "":
+				// Contexts and writers are not part of the request.
+				continue
+			case "body":
+				if param.Role == analyzer.RoleReader {
+					body = openapi3.NewStringSchema().WithFormat("binary")
+					continue
+				}
+				if body == nil {
+					body = openapi3.NewObjectSchema()
+				}
+				// Fields of the request body are decoded as JSON, which
+				// writes durations in nanoseconds.
+				if goType == "time.Duration" {
+					schema = openapi3.NewInt64Schema()
+					schema.Description = "nanoseconds"
+				}
+				body.WithProperty(param.Name, schema)
+				// Options and variadic parameters can be left out.
+				if param.Role != analyzer.RoleOptions && !strings.HasPrefix(param.Type, "...") {
+					body.Required = append(body.Required, param.Name)
+				}
+				continue
 			}
 
 			parameter := &openapi3.Parameter{
 				Name:        param.Name,
-				In:          paramLocation,
+				In:          param.Location,
 				Description: fmt.Sprintf("Parameter %s", param.Name),
-				Required:    paramLocation == openapi3.ParameterInPath,
-				Schema: &openapi3.SchemaRef{
-					Value: &openapi3.Schema{
-						Type: dg.convertGoTypeToSwaggerType(param.Type),
-					},
-				},
+				Required:    param.Location == openapi3.ParameterInPath,
+				Schema:      schema.NewRef(),
 			}
 			operation.Parameters = append(operation.Parameters, &openapi3.ParameterRef{Value: parameter})
 		}
+		if body != nil {
+			contentType := "application/json"
+			if body.Type.Is(openapi3.TypeString) {
+				contentType = "application/octet-stream"
+			}
+			operation.RequestBody = &openapi3.RequestBodyRef{
+				Value: openapi3.NewRequestBody().WithRequired(true).WithContent(openapi3.NewContentWithSchema(body, []string{contentType})),
+			}
+		}
 
-		for _, response := range endpoint.Responses {
-			operation.Responses[fmt.Sprintf("%d", response.StatusCode)] = &openapi3.ResponseRef{
-				Value: &openapi3.Response{
-					Description: &response.Type,
-				},
+		for i, response := range endpoint.Responses {
+			value := openapi3.NewResponse().WithDescription(response.Type)
+			if i == 0 && endpoint.Stream != nil {
+				value = dg.streamResponse(endpoint.Stream, response)
+				if operation.Extensions == nil {
+					operation.Extensions = make(map[string]interface{})
+				}
+				operation.Extensions["x-stream"] = endpoint.Stream.Transport
+			}
+			if response.Type == "error" {
+				value = problemResponse(response)
+				if swagger.Components == nil {
+					swagger.Components = &openapi3.Components{Schemas: openapi3.Schemas{"Problem": problemSchema.NewRef()}}
+				}
 			}
+			operation.Responses.Set(strconv.Itoa(response.StatusCode), &openapi3.ResponseRef{Value: value})
 		}
 
-		if swagger.Paths[path] == nil {
-			swagger.Paths[path] = &openapi3.PathItem{}
+		pathItem := swagger.Paths.Value(endpoint.Path)
+		if pathItem == nil {
+			pathItem = &openapi3.PathItem{}
+			swagger.Paths.Set(endpoint.Path, pathItem)
 		}
-		switch method {
-		case "get":
-			swagger.Paths[path].Get = operation
-		case "post":
-			swagger.Paths[path].Post = operation
-		case "put":
-			swagger.Paths[path].Put = operation
-		case "delete":
-			swagger.Paths[path].Delete = operation
+		pathItem.SetOperation(strings.ToUpper(endpoint.Method), operation)
+	}
+
+	return swagger
+}
+
+// streamResponse describes the success response of a streaming endpoint by
+// the schema of each value, or of the bytes a writer sends. WebSocket
+// messages have no media type to describe them under, so only the
+// x-stream extension of the operation tells them apart.
+func (dg *DocumentationGenerator) streamResponse(stream *designer.Stream, response designer.Response) *openapi3.Response {
+	value := openapi3.NewResponse().WithDescription(response.Type)
+	if stream.Transport == designer.StreamWebSocket {
+		return value
+	}
+	schema := openapi3.NewStringSchema().WithFormat("binary")
+	if stream.Source != designer.StreamWriter {
+		schema = dg.convertGoTypeToSchema(stream.Elem)
+	}
+	return value.WithContent(openapi3.NewContentWithSchema(schema, []string{stream.ContentType()}))
+}
+
+// problemResponse describes an error response by its status and the errors
+// it answers. Its body holds the problem details of RFC 9457.
+func problemResponse(response designer.Response) *openapi3.Response {
+	description := http.StatusText(response.StatusCode)
+	if len(response.Errors) > 0 {
+		names := make([]string, len(response.Errors))
+		for i, err := range response.Errors {
+			names[i] = err.LocalName()
 		}
+		description += ": " + strings.Join(names, ", ")
 	}
+	content := openapi3.NewContentWithSchemaRef(openapi3.NewSchemaRef("#/components/schemas/Problem", problemSchema), []string{"application/problem+json"})
+	return openapi3.NewResponse().WithDescription(description).WithContent(content)
+}
+
+// problemSchema describes the problem details every error response carries.
+var problemSchema = openapi3.NewObjectSchema().
+	WithProperty("type", openapi3.NewStringSchema().WithFormat("uri-reference")).
+	WithProperty("title", openapi3.NewStringSchema()).
+	WithProperty("status", openapi3.NewIntegerSchema()).
+	WithProperty("detail", openapi3.NewStringSchema())
 
-	return dg.writeSwaggerJSON(swagger)
+func (dg *DocumentationGenerator) GenerateSwaggerDoc() error {
+	return dg.writeSwaggerJSON(dg.Document())
 }
 
-func (dg *DocumentationGenerator) convertGoTypeToSwaggerType(goType string) string {
-	switch goType {
-	case "int", "int32", "int64":
-		return "integer"
-	case "float32", "float64":
-		return "number"
-	case "bool":
-		return "boolean"
+// convertGoTypeToSchema maps a Go type as written, or the Scalar underlying
+// it, to the closest JSON schema; other named types are described as
+// objects.
+func (dg *DocumentationGenerator) convertGoTypeToSchema(goType string) *openapi3.Schema {
+	goType = strings.TrimPrefix(goType, "*")
+	if elem, ok := strings.CutPrefix(goType, "..."); ok {
+		goType = "[]" + elem
+	}
+	switch {
+	case goType == "string":
+		return openapi3.NewStringSchema()
+	case goType == "bool":
+		return openapi3.NewBoolSchema()
+	case strings.HasPrefix(goType, "int") || strings.HasPrefix(goType, "uint") || goType == "byte" || goType == "rune":
+		return openapi3.NewIntegerSchema()
+	case goType == "time.Time":
+		return openapi3.NewDateTimeSchema()
+	case goType == "time.Duration":
+		return openapi3.NewStringSchema().WithFormat("duration")
+	case goType == "float32" || goType == "float64":
+		return openapi3.NewFloat64Schema()
+	case goType == "[]byte":
+		return openapi3.NewBytesSchema()
+	case strings.HasPrefix(goType, "[]"):
+		return openapi3.NewArraySchema().WithItems(dg.convertGoTypeToSchema(goType[2:]))
+	case strings.HasPrefix(goType, "map["):
+		return openapi3.NewObjectSchema().WithAnyAdditionalProperties()
 	default:
-		return "string"
+		return openapi3.NewObjectSchema()
 	}
 }
 
@@ -105,11 +231,9 @@ func (dg *DocumentationGenerator) writeSwaggerJSON(swagger *openapi3.T) error {
 		return fmt.Errorf("error marshaling Swagger JSON: %v", err)
 	}
 
-	err = os.WriteFile("swagger.json", data, 0644)
+	err = os.WriteFile(filepath.Join(dg.Dir, "swagger.json"), data, 0644)
 	if err != nil {
 		return fmt.Errorf("error writing Swagger JSON file: %v", err)
 	}
-
-	fmt.Println("Swagger documentation generated successfully: swagger.json")
 	return nil
 }
@@ -0,0 +1,106 @@
+package docs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+func TestDocument(t *testing.T) {
+	generator := NewDocumentationGenerator(&designer.Design{Endpoints: []designer.APIEndpoint{
+		{
+			Method:       "GET",
+			Path:         "/users/{name}",
+			FunctionName: "GetUser",
+			Description:  "GetUser returns the named user.",
+			Parameters: []designer.Parameter{
+				{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext},
+				{Name: "name", Type: "string", Location: "path"},
+				{Name: "limit", Type: "Limit", Location: "query", Scalar: "int"},
+			},
+			Responses: []designer.Response{
+				{StatusCode: 200, Type: "*User"},
+				{StatusCode: 404, Type: "error", Errors: []analyzer.ErrorInfo{{Name: "example.com/shop/users.ErrNotFound", Kind: analyzer.ErrorSentinel}}},
+				{StatusCode: 500, Type: "error"},
+			},
+		},
+		{
+			Method:       "PUT",
+			Path:         "/users/{name}",
+			FunctionName: "SaveUser",
+			Resource:     "users",
+			Parameters: []designer.Parameter{
+				{Name: "name", Type: "string", Location: "path"},
+				{Name: "tags", Type: "[]string", Location: "body"},
+				{Name: "ttl", Type: "time.Duration", Location: "body", Scalar: "time.Duration"},
+				{Name: "labels", Type: "...string", Location: "body"},
+				{Name: "opts", Type: "*SaveOptions", Location: "body", Role: analyzer.RoleOptions},
+			},
+			Responses: []designer.Response{{StatusCode: 200, Type: "OK"}},
+		},
+		{
+			Method:       "POST",
+			Path:         "/upload",
+			FunctionName: "Upload",
+			Parameters:   []designer.Parameter{{Name: "body", Type: "io.Reader", Location: "body", Role: analyzer.RoleReader}},
+			Responses:    []designer.Response{{StatusCode: 200, Type: "OK"}},
+		},
+		{
+			Method:       "GET",
+			Path:         "/events",
+			FunctionName: "Watch",
+			Responses:    []designer.Response{{StatusCode: 200, Type: "stream of []string"}},
+			Stream:       &designer.Stream{Source: designer.StreamChannel, Elem: "[]string", Transport: designer.StreamSSE},
+		},
+		{
+			Method:       "GET",
+			Path:         "/export",
+			FunctionName: "Export",
+			Parameters:   []designer.Parameter{{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter}},
+			Responses:    []designer.Response{{StatusCode: 200, Type: "stream"}},
+			Stream:       &designer.Stream{Source: designer.StreamWriter, Transport: designer.StreamChunked},
+		},
+	}})
+
+	doc := generator.Document()
+	require.NoError(t, doc.Validate(context.Background()))
+
+	users := doc.Paths.Value("/users/{name}")
+	require.NotNil(t, users)
+	require.Len(t, users.Get.Parameters, 2)
+	assert.Equal(t, "path", users.Get.Parameters[0].Value.In)
+	assert.Equal(t, "query", users.Get.Parameters[1].Value.In)
+	assert.True(t, users.Get.Parameters[1].Value.Schema.Value.Type.Is("integer"))
+	assert.Equal(t, "Not Found: ErrNotFound", *users.Get.Responses.Value("404").Value.Description)
+	assert.Equal(t, "Internal Server Error", *users.Get.Responses.Value("500").Value.Description)
+	problem := users.Get.Responses.Value("404").Value.Content.Get("application/problem+json")
+	require.NotNil(t, problem)
+	assert.Equal(t, "#/components/schemas/Problem", problem.Schema.Ref)
+	assert.Contains(t, doc.Components.Schemas["Problem"].Value.Properties, "detail")
+
+	assert.Empty(t, users.Get.Tags)
+	assert.Equal(t, []string{"users"}, users.Put.Tags)
+
+	body := users.Put.RequestBody.Value.Content.Get("application/json").Schema.Value
+	assert.Equal(t, []string{"tags", "ttl"}, body.Required)
+	assert.True(t, body.Properties["tags"].Value.Type.Is("array"))
+	assert.True(t, body.Properties["labels"].Value.Type.Is("array"))
+	// Durations in JSON are nanoseconds, as the handler decodes them.
+	assert.True(t, body.Properties["ttl"].Value.Type.Is("integer"))
+
+	upload := doc.Paths.Value("/upload").Post.RequestBody.Value
+	assert.NotNil(t, upload.Content.Get("application/octet-stream"))
+
+	events := doc.Paths.Value("/events").Get
+	assert.Equal(t, "sse", events.Extensions["x-stream"])
+	sse := events.Responses.Value("200").Value.Content.Get("text/event-stream")
+	require.NotNil(t, sse)
+	assert.True(t, sse.Schema.Value.Type.Is("array"))
+	export := doc.Paths.Value("/export").Get.Responses.Value("200").Value
+	assert.Equal(t, "binary", export.Content.Get("application/octet-stream").Schema.Value.Format)
+}
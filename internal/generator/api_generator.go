@@ -37,13 +37,23 @@ func init() {
 {{range .Functions}}
 type {{.Name}}Request struct {
 	{{range .Parameters}}
-	{{.Name}} {{.Type}} ` + "`" + `json:"{{.Name | toLower}}" validate:"required"` + "`" + `
+	{{if eq .Role "options"}}
+	{{.Name}} {{.Type}} ` + "`" + `json:"{{.Name | toLower}},omitempty" form:"{{.Name | toLower}}"` + "`" + `
+	{{else if not .Role}}
+	{{.Name}} {{.Type}} ` + "`" + `json:"{{.Name | toLower}}" form:"{{.Name | toLower}}" validate:"required"` + "`" + `
+	{{end}}
 	{{end}}
 }
 
 func {{.Name}}Handler(c *gin.Context) {
 	var req {{.Name}}Request
+	{{if hasRole .Parameters "reader"}}
+	// The request body is streamed to {{.Name}}, so the other parameters
+	// come from the query.
+	if err := c.ShouldBindQuery(&req); err != nil {
+	{{else}}
 	if err := c.ShouldBindJSON(&req); err != nil {
+	{{end}}
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -54,8 +64,28 @@ func {{.Name}}Handler(c *gin.Context) {
 	}
 
 	// TODO: Implement {{.Name}} logic here
+	{{range .Parameters}}
+	{{if eq .Role "context"}}
+	// Pass c.Request.Context() as {{.Name}}.
+	{{else if eq .Role "reader"}}
+	// Pass c.Request.Body as {{.Name}}.
+	{{else if eq .Role "writer"}}
+	// Pass c.Writer as {{.Name}}.
+	{{end}}
+	{{end}}
+	{{if hasRole .Results "error"}}
+	var err error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	{{end}}
 
+	{{if hasRole .Parameters "writer"}}
+	c.Status(http.StatusOK)
+	{{else}}
 	c.JSON(http.StatusOK, gin.H{"message": "{{.Name}} executed successfully"})
+	{{end}}
 }
 {{end}}
 
@@ -77,6 +107,7 @@ func main() {
 
 	funcMap := template.FuncMap{
 		"toLower": strings.ToLower,
+		"hasRole": hasRole,
 	}
 
 	tmpl, err := template.New("api").Funcs(funcMap).Parse(apiTemplate)
@@ -92,3 +123,13 @@ func main() {
 
 	return result.String(), nil
 }
+
+// hasRole reports whether one of params plays role.
+func hasRole(params []analyzer.ParameterInfo, role analyzer.Role) bool {
+	for _, param := range params {
+		if param.Role == role {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+)
+
+func TestGenerateAPIParameterRoles(t *testing.T) {
+	generator := NewAPIGenerator([]analyzer.FunctionInfo{{
+		Name: "Upload",
+		Parameters: []analyzer.ParameterInfo{
+			{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext},
+			{Name: "name", Type: "string"},
+			{Name: "body", Type: "io.Reader", Role: analyzer.RoleReader},
+			{Name: "opts", Type: "*UploadOptions", Role: analyzer.RoleOptions},
+		},
+		Results: []analyzer.ParameterInfo{
+			{Type: "int64"},
+			{Type: "error", Role: analyzer.RoleError},
+		},
+	}})
+
+	code, err := generator.GenerateAPI()
+	require.NoError(t, err)
+
+	// Only plain data and options reach the request struct.
+	assert.Contains(t, code, "name string `json:\"name\" form:\"name\" validate:\"required\"`")
+	assert.Contains(t, code, "opts *UploadOptions `json:\"opts,omitempty\" form:\"opts\"`")
+	assert.NotContains(t, code, "ctx context.Context")
+	assert.NotContains(t, code, "body io.Reader")
+
+	assert.Contains(t, code, "c.ShouldBindQuery(&req)")
+	assert.Contains(t, code, "// Pass c.Request.Context() as ctx.")
+	assert.Contains(t, code, "// Pass c.Request.Body as body.")
+	assert.Contains(t, code, "http.StatusInternalServerError")
+}
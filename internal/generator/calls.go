@@ -0,0 +1,334 @@
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+// servicesTemplate declares the services of the servers calling analyzed
+// functions, built by newServices, and is executed with a Services list of
+// serviceField.
+const servicesTemplate = `// services holds the instances whose methods are called.
+type services struct {
+	{{range .Services}}
+	{{.Field}} {{.Type}}
+	{{end}}
+}
+
+func newServices() (*services, error) {
+	s := &services{}
+	{{range .Services}}
+	{{.Build}}
+	{{end}}
+	return s, nil
+}
+
+`
+
+// decodeArgHelper sets the parameters of calls from JSON-like arguments.
+const decodeArgHelper = `// decodeArg sets target, a parameter of a Go function, to the argument
+// called name, converting it through JSON the way the function's types
+// expect. Missing arguments leave target at its zero value.
+func decodeArg(args map[string]interface{}, name string, target interface{}) error {
+	value, ok := args[name]
+	if !ok || value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
+`
+
+type goImport struct {
+	Alias, Path string
+}
+
+// goImports assigns package names to the import paths generated code
+// refers to.
+type goImports struct {
+	aliases map[string]string
+	taken   map[string]bool
+}
+
+func newGoImports(reserved ...string) *goImports {
+	imports := &goImports{aliases: make(map[string]string), taken: make(map[string]bool)}
+	for _, name := range reserved {
+		imports.taken[name] = true
+	}
+	return imports
+}
+
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// alias returns the name code refers to path by, adding the import.
+func (gi *goImports) alias(path string) string {
+	if alias, ok := gi.aliases[path]; ok {
+		return alias
+	}
+	base := nonIdentifier.ReplaceAllString(path[strings.LastIndex(path, "/")+1:], "_")
+	alias := base
+	for i := 2; gi.taken[alias]; i++ {
+		alias = base + strconv.Itoa(i)
+	}
+	gi.aliases[path] = alias
+	gi.taken[alias] = true
+	return alias
+}
+
+func (gi *goImports) list() []goImport {
+	var imports []goImport
+	for path, alias := range gi.aliases {
+		imports = append(imports, goImport{Alias: alias, Path: path})
+	}
+	sort.Slice(imports, func(i, j int) bool { return imports[i].Path < imports[j].Path })
+	return imports
+}
+
+var (
+	qualifiedType = regexp.MustCompile(`((?:[\w\-~]+[./])*[\w\-~]+)\.([A-Za-z_]\w*)`)
+	exportedIdent = regexp.MustCompile(`(^|[^.\w])([A-Z]\w*)`)
+	packageIdent  = regexp.MustCompile(`(^|[^.\w])([a-z]\w*)\.`)
+)
+
+// goType returns the Go expression of a parameter or result type of a
+// function of package pkg, qualified for use outside it. Type-checked types
+// name their packages; otherwise exported names are taken to be declared in
+// pkg, and time, context and io are the only other packages recognized.
+func (gi *goImports) goType(param analyzer.ParameterInfo, pkg string) string {
+	if param.Resolved != nil {
+		return qualifiedType.ReplaceAllStringFunc(param.Resolved.QualifiedName, func(match string) string {
+			parts := qualifiedType.FindStringSubmatch(match)
+			return gi.alias(parts[1]) + "." + parts[2]
+		})
+	}
+	written := packageIdent.ReplaceAllStringFunc(param.Type, func(match string) string {
+		parts := packageIdent.FindStringSubmatch(match)
+		if parts[2] == "time" || parts[2] == "context" || parts[2] == "io" {
+			return parts[1] + gi.alias(parts[2]) + "."
+		}
+		return match
+	})
+	return exportedIdent.ReplaceAllString(written, "${1}"+gi.alias(pkg)+".$2")
+}
+
+// serviceField is a field of the services struct and the statements
+// building it.
+type serviceField struct {
+	Field, Type, Build string
+}
+
+// buildServices returns the fields of the services struct, built by
+// constructors, and the field of each service by its type.
+func buildServices(imports *goImports, constructors []designer.GoCall) ([]serviceField, map[string]string) {
+	var services []serviceField
+	fields := make(map[string]string)
+	for _, constructor := range constructors {
+		name := constructor.Service[strings.LastIndex(constructor.Service, ".")+1:]
+		field := lowerFirst(name)
+		for i := 2; fieldTaken(fields, field); i++ {
+			field = lowerFirst(name) + strconv.Itoa(i)
+		}
+		fields[constructor.Service] = field
+		service := serviceField{Field: field}
+		if len(constructor.Results) > 0 {
+			service.Type = imports.goType(constructor.Results[0], constructor.Package)
+		}
+		service.Build = buildService(imports, constructor, field)
+		services = append(services, service)
+	}
+
+	return services, fields
+}
+
+func fieldTaken(fields map[string]string, field string) bool {
+	for _, taken := range fields {
+		if taken == field {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerFirst(name string) string {
+	runes := []rune(name)
+	if len(runes) > 0 {
+		runes[0] = unicode.ToLower(runes[0])
+	}
+	return string(runes)
+}
+
+// callArguments returns the statements declaring the parameters of call,
+// and the arguments passing them. Contexts are ctx, and the statements
+// decode returns set the variable of every other parameter.
+func callArguments(imports *goImports, call designer.GoCall, ctx string, decode func(param, variable string) string) (string, string) {
+	var stmts strings.Builder
+	args := make([]string, len(call.Parameters))
+	for i, param := range call.Parameters {
+		if param.Role == analyzer.RoleContext {
+			args[i] = ctx
+			continue
+		}
+		name := argVariable(i, param)
+		// Type-checked variadic parameters are slices already.
+		goType := imports.goType(param, call.Package)
+		args[i] = name
+		if strings.HasPrefix(param.Type, "...") {
+			if variadic, ok := strings.CutPrefix(goType, "..."); ok {
+				goType = "[]" + variadic
+			}
+			args[i] += "..."
+		}
+		fmt.Fprintf(&stmts, "var %s %s\n", name, goType)
+		if decode != nil {
+			stmts.WriteString(decode(param.Name, name))
+		}
+	}
+	return stmts.String(), strings.Join(args, ", ")
+}
+
+// argVariable returns the variable of the i-th parameter of a call.
+// Variables are prefixed so that they cannot shadow the packages and
+// variables of the generated code.
+func argVariable(i int, param analyzer.ParameterInfo) string {
+	if param.Name == "" || param.Name == "_" {
+		return fmt.Sprintf("arg%d", i)
+	}
+	return "arg" + strings.ToUpper(param.Name[:1]) + param.Name[1:]
+}
+
+// callResults returns the variables the results of call are assigned to,
+// and that of its error result, if any.
+func callResults(call designer.GoCall) (names []string, values []string, errName string) {
+	for _, result := range call.Results {
+		if result.Role == analyzer.RoleError {
+			names = append(names, "err")
+			errName = "err"
+			continue
+		}
+		name := fmt.Sprintf("v%d", len(values))
+		names = append(names, name)
+		values = append(values, name)
+	}
+	return names, values, errName
+}
+
+// buildService returns the statements calling the constructor of a service
+// and storing the instance in the field of s. Its parameters are left at
+// their zero values for the developer to supply.
+func buildService(imports *goImports, constructor designer.GoCall, field string) string {
+	ctx := ""
+	for _, param := range constructor.Parameters {
+		if param.Role == analyzer.RoleContext {
+			ctx = imports.alias("context") + ".Background()"
+		}
+	}
+	stmts, args := callArguments(imports, constructor, ctx, nil)
+	names, _, errName := callResults(constructor)
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("{\n")
+	if stmts != "" {
+		fmt.Fprintf(&b, "// TODO: Supply the parameters of %s.\n%s", constructor.Function, stmts)
+	}
+	names[0] = "instance"
+	for i := 1; i < len(names); i++ {
+		if names[i] != errName {
+			names[i] = "_"
+		}
+	}
+	fmt.Fprintf(&b, "%s := %s.%s(%s)\n", strings.Join(names, ", "), imports.alias(constructor.Package), constructor.Function, args)
+	if errName != "" {
+		b.WriteString("if err != nil {\nreturn nil, err\n}\n")
+	}
+	fmt.Fprintf(&b, "s.%s = instance\n}", field)
+	return b.String()
+}
+
+// errorCase is the statement answering the errors of a function that match
+// Errors.
+type errorCase struct {
+	Errors []analyzer.ErrorInfo
+	Answer string
+}
+
+// errorSwitch returns the statements answering err by the first of cases
+// matching it, and by fallback when none does: sentinels are recognized
+// with errors.Is and error types with errors.As.
+func errorSwitch(imports *goImports, cases []errorCase, fallback string) string {
+	var b strings.Builder
+	for _, c := range cases {
+		for _, err := range c.Errors {
+			value := err.LocalName()
+			if pkg := strings.TrimSuffix(err.Name, "."+value); pkg != err.Name {
+				value = imports.alias(pkg) + "." + value
+			}
+			if err.Kind == analyzer.ErrorType {
+				if err.Pointer {
+					value = "*" + value
+				}
+				fmt.Fprintf(&b, "case %s.As(err, new(%s)):\n", imports.alias("errors"), value)
+			} else {
+				fmt.Fprintf(&b, "case %s.Is(err, %s):\n", imports.alias("errors"), value)
+			}
+			b.WriteString(c.Answer + "\n")
+		}
+	}
+	if b.Len() == 0 {
+		return fallback
+	}
+	return "switch {\n" + b.String() + "default:\n" + fallback + "\n}"
+}
+
+// goMod returns the go.mod of a generated server requiring requires, and
+// the analyzed module at source, if it is one, replaced by its directory so
+// that the server builds against the code it calls.
+func goMod(source string, requires ...string) []byte {
+	var b strings.Builder
+	b.WriteString("module soft-crusher-api\n\ngo 1.21\n\nrequire (\n")
+	for _, require := range requires {
+		fmt.Fprintf(&b, "\t%s\n", require)
+	}
+	module, dir := sourceModule(source)
+	if module != "" {
+		fmt.Fprintf(&b, "\t%s v0.0.0\n", module)
+	}
+	b.WriteString(")\n")
+	if module != "" {
+		fmt.Fprintf(&b, "\nreplace %s => %s\n", module, dir)
+	}
+	return []byte(b.String())
+}
+
+// sourceModule returns the path of the module at source and its absolute
+// directory, or "" when source is not a module root.
+func sourceModule(source string) (string, string) {
+	if source == "" {
+		return "", ""
+	}
+	data, err := os.ReadFile(filepath.Join(source, "go.mod"))
+	if err != nil {
+		return "", ""
+	}
+	path := modfile.ModulePath(data)
+	dir, err := filepath.Abs(source)
+	if path == "" || err != nil {
+		return "", ""
+	}
+	return path, filepath.ToSlash(dir)
+}
@@ -1,50 +1,91 @@
 package generator
 
 import (
+	"bytes"
 	"fmt"
+	"go/format"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"text/template"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
 )
 
 type CodeGenerator struct {
-	APIDesign *APIDesigner
+	Design *designer.Design
+	// Dir is where the generated files are written; empty means the current
+	// directory.
+	Dir string
+	// Source is the root of the analyzed module. When set, go.mod requires
+	// the module and replaces it with Source, so that the server builds
+	// against the code it exposes.
+	Source string
 }
 
-func NewCodeGenerator(apiDesign *APIDesigner) *CodeGenerator {
+func NewCodeGenerator(design *designer.Design) *CodeGenerator {
 	return &CodeGenerator{
-		APIDesign: apiDesign,
+		Design: design,
 	}
 }
 
 func (cg *CodeGenerator) GenerateAPICode() error {
+	handlers := handlerNames(cg.Design.Endpoints)
+
 	// Generate main.go
-	if err := cg.generateMainFile(); err != nil {
+	if err := cg.generateMainFile(handlers); err != nil {
 		return fmt.Errorf("error generating main.go: %v", err)
 	}
 
 	// Generate handlers.go
-	if err := cg.generateHandlersFile(); err != nil {
+	code, err := cg.handlers(handlers)
+	if err != nil {
+		return fmt.Errorf("error generating handlers.go: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cg.Dir, "generated_handlers.go"), code, 0644); err != nil {
 		return fmt.Errorf("error generating handlers.go: %v", err)
 	}
 
+	if err := cg.generateStreamFile(); err != nil {
+		return fmt.Errorf("error generating stream helpers: %v", err)
+	}
+
 	return nil
 }
 
-func (cg *CodeGenerator) generateMainFile() error {
+// route is an endpoint as the router of the generated server serves it.
+type route struct {
+	Method, Path, Handler string
+}
+
+func (cg *CodeGenerator) generateMainFile(handlers []string) error {
 	mainTemplate := `package main
 
 import (
+	"log"
+
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	r := gin.Default()
+	s, err := newServices()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	{{range .Endpoints}}
-	r.{{.Method}}("{{.Path}}", {{.FunctionName}}Handler)
-	{{end}}
+	newRouter(s).Run(":8080")
+}
 
-	r.Run(":8080")
+// newRouter routes the endpoints of the API to the handlers of s.
+func newRouter(s *services) *gin.Engine {
+	r := gin.Default()
+	{{range .}}
+	r.{{.Method}}("{{.Path}}", s.{{.Handler}})
+	{{end}}
+	return r
 }
 `
 
@@ -52,72 +93,360 @@ func main() {
 	if err != nil {
 		return err
 	}
+	routes := make([]route, len(cg.Design.Endpoints))
+	for i, endpoint := range cg.Design.Endpoints {
+		routes[i] = route{Method: endpoint.Method, Path: GinPath(endpoint.Path), Handler: handlers[i]}
+	}
 
-	f, err := os.Create("generated_main.go")
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, routes); err != nil {
+		return err
+	}
+	code, err := format.Source(buf.Bytes())
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	return tmpl.Execute(f, cg.APIDesign)
+	return os.WriteFile(filepath.Join(cg.Dir, "generated_main.go"), code, 0644)
 }
 
-func (cg *CodeGenerator) generateHandlersFile() error {
-	handlersTemplate := `package main
+const handlersTemplate = `package main
 
 import (
-	"net/http"
+	"net/http"{{range .Imports}}
+	{{.Alias}} "{{.Path}}"{{end}}
+
 	"github.com/gin-gonic/gin"
 )
 
-{{range .Endpoints}}
-func {{.FunctionName}}Handler(c *gin.Context) {
-	{{range .Parameters}}
-	var {{.Name}} {{.Type}}
-	{{if eq .Location "body"}}
-	if err := c.ShouldBindJSON(&{{.Name}}); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	{{else if eq .Location "path"}}
-	{{.Name}} = c.Param("{{.Name}}")
-	{{else if eq .Location "query"}}
-	{{.Name}} = c.Query("{{.Name}}")
-	{{end}}
-	{{end}}
-
-	// TODO: Implement {{.FunctionName}} logic here
-
-	c.JSON(http.StatusOK, gin.H{
-		"message": "{{.FunctionName}} executed successfully",
-	})
+` + servicesTemplate + `{{range .Handlers}}
+func (s *services) {{.Name}}(c *gin.Context) {
+	{{.Body}}
 }
 {{end}}
-`
+` + problemHelper
+
+type handler struct {
+	Name, Body string
+}
+
+// handlers returns generated_handlers.go: a method of services per
+// endpoint, named after handlers, calling the function of the endpoint.
+func (cg *CodeGenerator) handlers(handlers []string) ([]byte, error) {
+	// Imports share the package block with the declarations of the
+	// generated files, and the handlers' scope with their variables.
+	imports := newGoImports("http", "gin", "log", "main", "services", "newServices", "newRouter", "problem",
+		"stream", "openStream", "writeEvent", "forward", "forwardSeq", "upgrader", "streamWriteTimeout",
+		"s", "c", "ctx", "cancel", "req", "out", "ok", "err", "v", "raw", "values", "instance")
+
+	var constructors []designer.GoCall
+	for _, service := range cg.Design.Services {
+		if service.Call != nil {
+			constructors = append(constructors, *service.Call)
+		}
+	}
+	services, fields := buildServices(imports, constructors)
+
+	bodies := make([]handler, len(cg.Design.Endpoints))
+	for i, endpoint := range cg.Design.Endpoints {
+		bodies[i] = handler{Name: handlers[i], Body: handlerBody(imports, endpoint, fields)}
+	}
 
 	tmpl, err := template.New("handlers").Parse(handlersTemplate)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	f, err := os.Create("generated_handlers.go")
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Imports  []goImport
+		Services []serviceField
+		Handlers []handler
+	}{imports.list(), services, bodies})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, buf.Bytes())
+	}
+	return code, nil
+}
+
+// handlerNames names the handler of each endpoint after its function,
+// numbering those of functions of the same name.
+func handlerNames(endpoints []designer.APIEndpoint) []string {
+	names := make([]string, len(endpoints))
+	taken := make(map[string]bool)
+	for i, endpoint := range endpoints {
+		name := endpoint.FunctionName + "Handler"
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%sHandler%d", endpoint.FunctionName, n)
+		}
+		taken[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+// handlerBody returns the body of the handler of endpoint: it binds the
+// parameters of the function from the request, calls it, on the service
+// field of fields when it is a method, and answers with its results. The
+// parameters sent in the body are the fields of a single JSON object.
+// Endpoints whose function cannot be called answer 501 Not Implemented.
+func handlerBody(imports *goImports, endpoint designer.APIEndpoint, fields map[string]string) string {
+	call := endpoint.Call
+	if call == nil || (call.Service != "" && fields[call.Service] == "") {
+		return fmt.Sprintf("problem(c, http.StatusNotImplemented, %q)", endpoint.FunctionName+" cannot be called by the generated server")
+	}
+
+	var b strings.Builder
+	switch {
+	case endpoint.Stream != nil:
+		// The function's context ends when the client goes away.
+		fmt.Fprintf(&b, "ctx, cancel := %s.WithCancel(c.Request.Context())\ndefer cancel()\n", imports.alias("context"))
+	case hasRole(call.Parameters, analyzer.RoleContext):
+		b.WriteString("ctx := c.Request.Context()\n")
+	}
+
+	params := make(map[string]designer.Parameter)
+	for _, param := range endpoint.Parameters {
+		params[param.Name] = param
+	}
+	// The parameters of the call by their variables, and the field of the
+	// request body of those sent in it.
+	byVariable := make(map[string]designer.Parameter)
+	bodyFields := make(map[string]string)
+	var request strings.Builder
+	for i, callParam := range call.Parameters {
+		name := callParam.Name
+		if name == "" || name == "_" {
+			name = fmt.Sprintf("arg%d", i)
+		}
+		param, ok := params[name]
+		if !ok {
+			continue
+		}
+		variable := argVariable(i, callParam)
+		byVariable[variable] = param
+		if param.Location != "body" || param.Role == analyzer.RoleReader {
+			continue
+		}
+		field := strings.ToUpper(name[:1]) + name[1:]
+		for n := 2; fieldTaken(bodyFields, field); n++ {
+			field = fmt.Sprintf("%s%d", strings.ToUpper(name[:1])+name[1:], n)
+		}
+		bodyFields[variable] = field
+		fmt.Fprintf(&request, "%s %s `json:%q`\n", field, sliceType(imports.goType(callParam, call.Package)), name)
+	}
+	if request.Len() > 0 {
+		fmt.Fprintf(&b, "var req struct {\n%s}\n", request.String())
+		b.WriteString("if err := c.ShouldBindJSON(&req); err != nil {\nproblem(c, http.StatusBadRequest, err.Error())\nreturn\n}\n")
+	}
+
+	writer := ""
+	stmts, args := callArguments(imports, *call, "ctx", func(_, variable string) string {
+		param, ok := byVariable[variable]
+		switch {
+		case !ok:
+			return ""
+		case param.Role == analyzer.RoleReader:
+			return variable + " = c.Request.Body\n"
+		case param.Role == analyzer.RoleWriter && endpoint.Stream != nil:
+			// The writer is the stream, opened once the request is bound.
+			writer = variable
+			return ""
+		case param.Role == analyzer.RoleWriter:
+			return variable + " = c.Writer\n"
+		case bodyFields[variable] != "":
+			return fmt.Sprintf("%s = req.%s\n", variable, bodyFields[variable])
+		case param.Location == "path" || param.Location == "query" || param.Location == "header":
+			return bindParameter(imports, param, variable, sliceType(declaredType(imports, *call, variable))) + "\n"
+		}
+		return ""
+	})
+	b.WriteString(stmts)
+
+	function := imports.alias(call.Package) + "." + call.Function
+	if call.Service != "" {
+		function = "s." + fields[call.Service] + "." + call.Function
+	}
+	expr := function + "(" + args + ")"
+	names, values, errName := callResults(*call)
+	if endpoint.Stream != nil {
+		b.WriteString(streamCall(imports, endpoint, expr, writer, names, errName))
+		return b.String()
+	}
+	switch {
+	case len(names) == 0:
+		b.WriteString(expr + "\n")
+	case len(values) == 0:
+		fmt.Fprintf(&b, "if err := %s; err != nil {\n%s\nreturn\n}\n", expr, respondError(imports, endpoint))
+	default:
+		fmt.Fprintf(&b, "%s := %s\n", strings.Join(names, ", "), expr)
+		if errName != "" {
+			fmt.Fprintf(&b, "if err != nil {\n%s\nreturn\n}\n", respondError(imports, endpoint))
+		}
+	}
+
+	switch {
+	case len(values) == 0 || streams(endpoint):
+		fmt.Fprintf(&b, "c.Status(%s)", SuccessStatus(endpoint))
+	case len(values) == 1:
+		fmt.Fprintf(&b, "c.JSON(%s, %s)", SuccessStatus(endpoint), values[0])
+	default:
+		// Several results are answered as an object, named after them.
+		var entries []string
+		for i, result := range call.Results {
+			if result.Role == analyzer.RoleError {
+				continue
+			}
+			name := result.Name
+			if name == "" || name == "_" {
+				name = fmt.Sprintf("result%d", i+1)
+			}
+			entries = append(entries, fmt.Sprintf("%q: %s", name, values[len(entries)]))
+		}
+		fmt.Fprintf(&b, "c.JSON(%s, gin.H{%s})", SuccessStatus(endpoint), strings.Join(entries, ", "))
+	}
+	return b.String()
+}
+
+// declaredType returns the type callArguments declares variable with.
+func declaredType(imports *goImports, call designer.GoCall, variable string) string {
+	for i, param := range call.Parameters {
+		if argVariable(i, param) == variable {
+			return imports.goType(param, call.Package)
+		}
+	}
+	return ""
+}
+
+// sliceType returns the slice type of a variadic parameter type, and any
+// other type unchanged.
+func sliceType(goType string) string {
+	if elem, ok := strings.CutPrefix(goType, "..."); ok {
+		return "[]" + elem
+	}
+	return goType
+}
+
+// streamCall returns the statements of the handler of a streaming endpoint
+// calling expr, whose results are names, and streaming its response. A
+// function returning a channel or an iterator is called before the stream
+// opens, so that its error is answered with an error response. The stream
+// is the writer of a function writing its response; its error then ends
+// the stream, unless nothing was written yet.
+func streamCall(imports *goImports, endpoint designer.APIEndpoint, expr, writer string, names []string, errName string) string {
+	var b strings.Builder
+	open := fmt.Sprintf("out, ok := openStream(c, ctx, cancel, %q, %q)\nif !ok {\nreturn\n}\ndefer out.close()\n", endpoint.Stream.Transport, endpoint.Stream.ContentType())
+	if endpoint.Stream.Source == designer.StreamWriter {
+		b.WriteString(open)
+		if writer != "" {
+			fmt.Fprintf(&b, "%s = out\n", writer)
+		}
+		if errName == "" {
+			b.WriteString(expr)
+			return b.String()
+		}
+		fail := fmt.Sprintf("if !out.fail(err) {\n%s\n}", respondError(imports, endpoint))
+		if len(names) == 1 {
+			fmt.Fprintf(&b, "if err := %s; err != nil {\n%s\n}", expr, fail)
+			return b.String()
+		}
+		for i, name := range names {
+			if name != errName {
+				names[i] = "_"
+			}
+		}
+		fmt.Fprintf(&b, "%s := %s\nif err != nil {\n%s\n}", strings.Join(names, ", "), expr, fail)
+		return b.String()
 	}
-	defer f.Close()
 
-	return tmpl.Execute(f, cg.APIDesign)
+	// The values are the first result.
+	for i := 1; i < len(names); i++ {
+		if names[i] != errName {
+			names[i] = "_"
+		}
+	}
+	fmt.Fprintf(&b, "%s := %s\n", strings.Join(names, ", "), expr)
+	if errName != "" {
+		fmt.Fprintf(&b, "if err != nil {\n%s\nreturn\n}\n", respondError(imports, endpoint))
+	}
+	b.WriteString(open)
+	if endpoint.Stream.Source == designer.StreamChannel {
+		fmt.Fprintf(&b, "forward(out, %s)", names[0])
+	} else {
+		fmt.Fprintf(&b, "forwardSeq(out, %s)", names[0])
+	}
+	return b.String()
 }
 
+// GenerateGoModFile writes the go.mod of the server and its tests.
 func (cg *CodeGenerator) GenerateGoModFile() error {
-	goModContent := `module soft-crusher-api
+	return os.WriteFile(filepath.Join(cg.Dir, "go.mod"), goMod(cg.Source, restRequires(cg.Design.Endpoints)...), 0644)
+}
 
-go 1.16
+// restRequires returns the modules the server and its tests need:
+// WebSockets take gorilla/websocket.
+func restRequires(endpoints []designer.APIEndpoint) []string {
+	requires := []string{"github.com/gin-gonic/gin v1.7.7", "github.com/stretchr/testify v1.7.0"}
+	if usesWebSocket(endpoints) {
+		requires = append(requires, webSocketModule)
+	}
+	return requires
+}
 
-require (
-	github.com/gin-gonic/gin v1.7.7
-)
-`
+var pathParameter = regexp.MustCompile(`\{([^}]+)\}`)
 
-	return os.WriteFile("go.mod", []byte(goModContent), 0644)
+// GinPath turns the {name} path parameters of a designed path into the
+// :name form of gin routes.
+func GinPath(path string) string {
+	return pathParameter.ReplaceAllString(path, ":$1")
+}
+
+// streams reports whether the endpoint writes its response to a writer
+// parameter rather than returning it, in a design made before writers were
+// given a Stream.
+func streams(endpoint designer.APIEndpoint) bool {
+	for _, param := range endpoint.Parameters {
+		if param.Role == analyzer.RoleWriter {
+			return true
+		}
+	}
+	return false
+}
+
+var statusConstants = map[int]string{
+	200: "http.StatusOK",
+	201: "http.StatusCreated",
+	202: "http.StatusAccepted",
+	204: "http.StatusNoContent",
+	400: "http.StatusBadRequest",
+	401: "http.StatusUnauthorized",
+	403: "http.StatusForbidden",
+	404: "http.StatusNotFound",
+	409: "http.StatusConflict",
+	422: "http.StatusUnprocessableEntity",
+	429: "http.StatusTooManyRequests",
+	500: "http.StatusInternalServerError",
+	501: "http.StatusNotImplemented",
+	503: "http.StatusServiceUnavailable",
+	504: "http.StatusGatewayTimeout",
+}
+
+// SuccessStatus returns the Go expression of the status code the endpoint
+// responds with on success, its first response.
+func SuccessStatus(endpoint designer.APIEndpoint) string {
+	status := 200
+	if len(endpoint.Responses) > 0 {
+		status = endpoint.Responses[0].StatusCode
+	}
+	return StatusExpr(status)
+}
+
+// StatusExpr returns the net/http constant of a status code, or the number.
+func StatusExpr(status int) string {
+	if constant, ok := statusConstants[status]; ok {
+		return constant
+	}
+	return strconv.Itoa(status)
 }
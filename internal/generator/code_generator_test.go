@@ -0,0 +1,196 @@
+package generator
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+func TestGenerateHandlersBindParameters(t *testing.T) {
+	const pkg = "example.com/shop/orders"
+	parameters := []designer.Parameter{
+		{Name: "userID", Type: "UserID", Location: "path", Scalar: "int64"},
+		{Name: "limit", Type: "int", Location: "query", Scalar: "int"},
+		{Name: "since", Type: "time.Time", Location: "query", Scalar: "time.Time"},
+		{Name: "ids", Type: "[]uint32", Location: "query"},
+		{Name: "tags", Type: "[]string", Location: "query"},
+		{Name: "filter", Type: "Filter", Location: "query"},
+		{Name: "tenant", Type: "TenantID", Location: "header"},
+		{Name: "token", Type: "string", Location: "header", Scalar: "string"},
+		{Name: "scopes", Type: "[]Scope", Location: "header"},
+	}
+	call := &designer.GoCall{Package: pkg, Function: "ListOrders",
+		Results: []analyzer.ParameterInfo{{Type: "[]Order"}, {Type: "error", Role: analyzer.RoleError}}}
+	for _, param := range parameters {
+		call.Parameters = append(call.Parameters, analyzer.ParameterInfo{Name: param.Name, Type: param.Type})
+	}
+	generator := NewCodeGenerator(&designer.Design{Endpoints: []designer.APIEndpoint{{
+		Method:       "GET",
+		Path:         "/users/{userID}/orders",
+		FunctionName: "ListOrders",
+		Parameters:   parameters,
+		Responses:    []designer.Response{{StatusCode: 200, Type: "[]Order"}},
+		Call:         call,
+	}}})
+	generator.Dir = t.TempDir()
+	require.NoError(t, generator.GenerateAPICode())
+
+	path := filepath.Join(generator.Dir, "generated_handlers.go")
+	code, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, err := parser.ParseFile(token.NewFileSet(), path, code, parser.ImportsOnly)
+	require.NoError(t, err)
+	var imports []string
+	for _, spec := range file.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	assert.Equal(t, []string{`"encoding/json"`, `"example.com/shop/orders"`, `"net/http"`, `"strconv"`, `"time"`, `"github.com/gin-gonic/gin"`}, imports)
+
+	for _, snippet := range []string{
+		`if raw := c.Param("userID"); raw != "" {`,
+		`v, err := strconv.ParseInt(raw, 10, 64)`,
+		`problem(c, http.StatusBadRequest, "invalid userID: "+err.Error())`,
+		`argUserID = orders.UserID(v)`,
+		`v, err := strconv.ParseInt(raw, 10, 0)`,
+		`argLimit = int(v)`,
+		`v, err := time.Parse(time.RFC3339, raw)`,
+		`argSince = v`,
+		`for _, raw := range c.QueryArray("ids") {`,
+		`argIds = append(argIds, uint32(v))`,
+		`argTags = c.QueryArray("tags")`,
+		`c.ShouldBindQuery(&argFilter)`,
+		`argTenant = orders.TenantID(c.GetHeader("tenant"))`,
+		`argToken = raw`,
+		`if raw := c.GetHeader("scopes"); raw != "" {`,
+		`if err := json.Unmarshal([]byte(raw), &argScopes); err != nil {`,
+		`problem(c, http.StatusBadRequest, "invalid scopes: "+err.Error())`,
+		"v0, err := orders.ListOrders(argUserID, argLimit, argSince, argIds, argTags, argFilter, argTenant, argToken, argScopes)",
+		"c.JSON(http.StatusOK, v0)",
+	} {
+		assert.Contains(t, string(code), snippet)
+	}
+	assert.NotContains(t, string(code), "TODO")
+
+	main, err := os.ReadFile(filepath.Join(generator.Dir, "generated_main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(main), `r.GET("/users/:userID/orders", s.ListOrdersHandler)`)
+}
+
+func TestGenerateHandlersCalls(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	failure := analyzer.ParameterInfo{Type: "error", Role: analyzer.RoleError}
+	endpoints := []designer.APIEndpoint{
+		{Method: "POST", Path: "/users", FunctionName: "SaveUser",
+			Parameters: []designer.Parameter{
+				{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext},
+				{Name: "user", Type: "User", Location: "body"},
+				{Name: "tags", Type: "...string", Location: "body"},
+			},
+			Responses: []designer.Response{{StatusCode: 201, Type: "OK"}, {StatusCode: 500, Type: "error"}},
+			Call: &designer.GoCall{Package: pkg, Function: "SaveUser",
+				Parameters: []analyzer.ParameterInfo{{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext}, {Name: "user", Type: "User"}, {Name: "tags", Type: "...string"}},
+				Results:    []analyzer.ParameterInfo{failure}}},
+		{Method: "GET", Path: "/users/{id}", FunctionName: "Get", Service: pkg + ".Store",
+			Parameters: []designer.Parameter{{Name: "id", Type: "string", Location: "path", Scalar: "string"}},
+			Responses:  []designer.Response{{StatusCode: 200, Type: "*User"}},
+			Call: &designer.GoCall{Package: pkg, Function: "Get", Service: pkg + ".Store",
+				Parameters: []analyzer.ParameterInfo{{Name: "id", Type: "string"}}, Results: []analyzer.ParameterInfo{{Type: "*User"}}}},
+		{Method: "GET", Path: "/stats", FunctionName: "Stats",
+			Responses: []designer.Response{{StatusCode: 200, Type: "int, float64"}},
+			Call: &designer.GoCall{Package: pkg, Function: "Stats",
+				Results: []analyzer.ParameterInfo{{Name: "count", Type: "int"}, {Type: "float64"}}}},
+		{Method: "POST", Path: "/sum", FunctionName: "Sum",
+			Parameters: []designer.Parameter{{Name: "arg0", Type: "int", Location: "body", Scalar: "int"}},
+			Call: &designer.GoCall{Package: pkg, Function: "Sum",
+				Parameters: []analyzer.ParameterInfo{{Type: "int"}}}},
+		{Method: "GET", Path: "/stats", FunctionName: "Stats"},
+	}
+	generator := NewCodeGenerator(&designer.Design{
+		Services: []designer.APIService{{Name: "Store", Type: pkg + ".Store", Package: pkg, Constructor: "NewStore", Instance: "*Store",
+			Call: &designer.GoCall{Package: pkg, Function: "NewStore", Service: pkg + ".Store", Results: []analyzer.ParameterInfo{{Type: "*Store"}}}}},
+		Endpoints: endpoints,
+	})
+	generator.Dir = t.TempDir()
+	require.NoError(t, generator.GenerateAPICode())
+
+	path := filepath.Join(generator.Dir, "generated_handlers.go")
+	code, err := os.ReadFile(path)
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), path, code, 0)
+	require.NoError(t, err)
+
+	for _, snippet := range []string{
+		"store *users.Store",
+		"func (s *services) SaveUserHandler(c *gin.Context) {\n\tctx := c.Request.Context()",
+		"var req struct {\n\t\tUser users.User `json:\"user\"`\n\t\tTags []string   `json:\"tags\"`\n\t}",
+		"if err := c.ShouldBindJSON(&req); err != nil {",
+		"argUser = req.User",
+		"if err := users.SaveUser(ctx, argUser, argTags...); err != nil {",
+		"c.Status(http.StatusCreated)",
+		"v0 := s.store.Get(argId)",
+		`c.JSON(http.StatusOK, gin.H{"count": v0, "result2": v1})`,
+		"var arg0 int",
+		"arg0 = req.Arg0",
+		"users.Sum(arg0)",
+		`func (s *services) StatsHandler2(c *gin.Context) {` + "\n\t" + `problem(c, http.StatusNotImplemented, "Stats cannot be called by the generated server")`,
+	} {
+		assert.Contains(t, string(code), snippet)
+	}
+
+	main, err := os.ReadFile(filepath.Join(generator.Dir, "generated_main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(main), `r.GET("/users/:id", s.GetHandler)`)
+	assert.Contains(t, string(main), `r.GET("/stats", s.StatsHandler2)`)
+}
+
+func TestGenerateHandlersErrorResponses(t *testing.T) {
+	generator := NewCodeGenerator(&designer.Design{Endpoints: []designer.APIEndpoint{{
+		Method:       "PUT",
+		Path:         "/users/{id}",
+		FunctionName: "UpdateUser",
+		Parameters:   []designer.Parameter{{Name: "id", Type: "string", Location: "path", Scalar: "string"}},
+		Call: &designer.GoCall{Package: "example.com/shop/users", Function: "UpdateUser",
+			Parameters: []analyzer.ParameterInfo{{Name: "id", Type: "string"}}, Results: []analyzer.ParameterInfo{{Type: "error", Role: analyzer.RoleError}}},
+		Responses: []designer.Response{
+			{StatusCode: 200, Type: "OK"},
+			{StatusCode: 400, Type: "error", Errors: []analyzer.ErrorInfo{{Name: "example.com/shop/users.ValidationError", Kind: analyzer.ErrorType, Pointer: true}}},
+			{StatusCode: 404, Type: "error", Errors: []analyzer.ErrorInfo{
+				{Name: "database/sql.ErrNoRows", Kind: analyzer.ErrorSentinel},
+				{Name: "example.com/shop/users.ErrNotFound", Kind: analyzer.ErrorSentinel},
+			}},
+			{StatusCode: 500, Type: "error"},
+		},
+	}}})
+	generator.Dir = t.TempDir()
+	require.NoError(t, generator.GenerateAPICode())
+
+	path := filepath.Join(generator.Dir, "generated_handlers.go")
+	code, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, err := parser.ParseFile(token.NewFileSet(), path, code, 0)
+	require.NoError(t, err)
+	var imports []string
+	for _, spec := range file.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	assert.Equal(t, []string{`"database/sql"`, `"errors"`, `"example.com/shop/users"`, `"net/http"`, `"github.com/gin-gonic/gin"`}, imports)
+
+	for _, snippet := range []string{
+		"if err := users.UpdateUser(argId); err != nil {",
+		"case errors.As(err, new(*users.ValidationError)):\n\t\t\tproblem(c, http.StatusBadRequest, err.Error())",
+		"case errors.Is(err, sql.ErrNoRows):\n\t\t\tproblem(c, http.StatusNotFound, err.Error())",
+		"case errors.Is(err, users.ErrNotFound):\n\t\t\tproblem(c, http.StatusNotFound, err.Error())",
+		"default:\n\t\t\tproblem(c, http.StatusInternalServerError, err.Error())",
+		`c.Header("Content-Type", "application/problem+json")`,
+	} {
+		assert.Contains(t, string(code), snippet)
+	}
+}
@@ -0,0 +1,35 @@
+package generator
+
+import (
+	"fmt"
+
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+// problemHelper is appended to the handlers: every error response carries
+// the same problem details body.
+const problemHelper = `
+// problem answers with the problem details of RFC 9457.
+func problem(c *gin.Context, status int, detail string) {
+	c.Header("Content-Type", "application/problem+json")
+	c.JSON(status, gin.H{
+		"type":   "about:blank",
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	})
+}
+`
+
+// respondError returns the statements of a gin handler answering err with
+// the error response of the endpoint it maps to: sentinels are recognized
+// with errors.Is, error types with errors.As, and anything else is a 500.
+func respondError(imports *goImports, endpoint designer.APIEndpoint) string {
+	var cases []errorCase
+	for _, response := range endpoint.Responses {
+		if response.Type == "error" && len(response.Errors) > 0 {
+			cases = append(cases, errorCase{Errors: response.Errors, Answer: fmt.Sprintf("problem(c, %s, err.Error())", StatusExpr(response.StatusCode))})
+		}
+	}
+	return errorSwitch(imports, cases, "problem(c, http.StatusInternalServerError, err.Error())")
+}
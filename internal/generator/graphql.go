@@ -0,0 +1,385 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+// GraphQLGenerator writes a GraphQL server for the GraphQL part of a design:
+// its schema in SDL, and a graphql-go server whose resolvers call the
+// analyzed functions.
+type GraphQLGenerator struct {
+	Design *designer.Design
+	// Dir is where the generated files are written; empty means the current
+	// directory.
+	Dir string
+	// Source is the root of the analyzed module. When set, go.mod requires
+	// the module and replaces it with Source, so that the server builds
+	// against the code it exposes.
+	Source string
+}
+
+func NewGraphQLGenerator(design *designer.Design) *GraphQLGenerator {
+	return &GraphQLGenerator{
+		Design: design,
+	}
+}
+
+// GenerateGraphQL writes schema.graphql, the server and its go.mod.
+func (gg *GraphQLGenerator) GenerateGraphQL() error {
+	schema := gg.Design.GraphQL
+	if schema == nil {
+		return fmt.Errorf("the design has no GraphQL schema")
+	}
+	if len(schema.Query) == 0 {
+		// A GraphQL schema needs a query type.
+		return fmt.Errorf("no function can be a GraphQL query")
+	}
+	if err := os.WriteFile(filepath.Join(gg.Dir, "schema.graphql"), []byte(schema.SDL()), 0644); err != nil {
+		return fmt.Errorf("error writing schema.graphql: %v", err)
+	}
+
+	code, err := gg.server()
+	if err != nil {
+		return fmt.Errorf("error generating GraphQL server: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(gg.Dir, "generated_graphql.go"), code, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(gg.Dir, "generated_main.go"), []byte(graphQLMain), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(gg.Dir, "go.mod"), goMod(gg.Source,
+		"github.com/graphql-go/graphql v0.8.1",
+		"github.com/graphql-go/handler v0.2.4"), 0644)
+}
+
+const graphQLMain = `package main
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/graphql-go/handler"
+)
+
+func main() {
+	s, err := newServices()
+	if err != nil {
+		log.Fatal(err)
+	}
+	schema, err := newSchema(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.Handle("/graphql", handler.New(&handler.Config{Schema: &schema, Pretty: true, GraphiQL: true}))
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+`
+
+const graphQLTemplate = `package main
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	{{range .Imports}}
+	{{.Alias}} "{{.Path}}"
+	{{end}}
+)
+
+` + servicesTemplate + `func newSchema(s *services) (graphql.Schema, error) {
+	typeJSON := graphql.NewScalar(graphql.ScalarConfig{
+		Name:         "JSON",
+		Description:  "Any JSON value.",
+		Serialize:    func(value interface{}) interface{} { return value },
+		ParseValue:   func(value interface{}) interface{} { return value },
+		ParseLiteral: parseJSONLiteral,
+	})
+	typeInt64 := graphql.NewScalar(graphql.ScalarConfig{
+		Name:         "Int64",
+		Description:  "A 64-bit integer, written as a string since Int has 32 bits.",
+		Serialize:    serializeInt64,
+		ParseValue:   parseInt64,
+		ParseLiteral: parseInt64Literal,
+	})
+	{{range .Types}}
+	{{if eq .Kind "type"}}
+	var {{typeVar .Name}} *graphql.Object
+	{{else if eq .Kind "input"}}
+	var {{typeVar .Name}} *graphql.InputObject
+	{{end}}
+	{{end}}
+	{{range .Types}}
+	{{if eq .Kind "type"}}
+	{{typeVar .Name}} = graphql.NewObject(graphql.ObjectConfig{
+		Name:        {{printf "%q" .Name}},
+		Description: {{printf "%q" .Description}},
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				{{range .Fields}}
+				{{printf "%q" .Name}}: &graphql.Field{Type: {{gqlType .Type}}, Description: {{printf "%q" .Description}}},
+				{{end}}
+			}
+		}),
+	})
+	{{else if eq .Kind "input"}}
+	{{typeVar .Name}} = graphql.NewInputObject(graphql.InputObjectConfig{
+		Name:        {{printf "%q" .Name}},
+		Description: {{printf "%q" .Description}},
+		Fields: graphql.InputObjectConfigFieldMapThunk(func() graphql.InputObjectConfigFieldMap {
+			return graphql.InputObjectConfigFieldMap{
+				{{range .Fields}}
+				{{printf "%q" .Name}}: &graphql.InputObjectFieldConfig{Type: {{gqlType .Type}}, Description: {{printf "%q" .Description}}},
+				{{end}}
+			}
+		}),
+	})
+	{{end}}
+	{{end}}
+
+	config := graphql.SchemaConfig{}
+	{{range .Roots}}
+	config.{{.Root}} = graphql.NewObject(graphql.ObjectConfig{
+		Name: {{printf "%q" .Root}},
+		Fields: graphql.Fields{
+			{{range .Fields}}
+			{{printf "%q" .Name}}: &graphql.Field{
+				Type:        {{gqlType .Type}},
+				Description: {{printf "%q" .Description}},
+				Args: graphql.FieldConfigArgument{
+					{{range .Args}}
+					{{printf "%q" .Name}}: &graphql.ArgumentConfig{Type: {{gqlType .Type}}},
+					{{end}}
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					{{.Resolve}}
+				},
+			},
+			{{end}}
+		},
+	})
+	{{end}}
+	_, _ = typeJSON, typeInt64
+	return graphql.NewSchema(config)
+}
+
+` + decodeArgHelper + `
+// encodeResult turns the result of a Go function into the JSON values
+// GraphQL resolves fields from, named as encoding/json names them.
+func encodeResult(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var result interface{}
+	err = json.Unmarshal(data, &result)
+	return result, err
+}
+
+// serializeInt64 writes an integer result, which encodeResult made a
+// float64, as a string.
+func serializeInt64(value interface{}) interface{} {
+	switch value := value.(type) {
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case json.Number:
+		return value.String()
+	case string:
+		return value
+	}
+	return nil
+}
+
+// parseInt64 reads an Int64 variable, a string or a number, as a
+// json.Number, which decodeArg decodes into any integer type.
+func parseInt64(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return int64Number(value)
+	case float64:
+		return int64Number(strconv.FormatFloat(value, 'f', -1, 64))
+	case int:
+		return json.Number(strconv.Itoa(value))
+	}
+	return nil
+}
+
+func parseInt64Literal(value ast.Value) interface{} {
+	switch value := value.(type) {
+	case *ast.StringValue:
+		return int64Number(value.Value)
+	case *ast.IntValue:
+		return int64Number(value.Value)
+	}
+	return nil
+}
+
+// int64Number returns s as a json.Number, or nil when s is not an integer.
+func int64Number(s string) interface{} {
+	if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+		if _, err := strconv.ParseUint(s, 10, 64); err != nil {
+			return nil
+		}
+	}
+	return json.Number(s)
+}
+
+func parseJSONLiteral(value ast.Value) interface{} {
+	switch value := value.(type) {
+	case *ast.ObjectValue:
+		object := make(map[string]interface{})
+		for _, field := range value.Fields {
+			object[field.Name.Value] = parseJSONLiteral(field.Value)
+		}
+		return object
+	case *ast.ListValue:
+		list := make([]interface{}, len(value.Values))
+		for i, item := range value.Values {
+			list[i] = parseJSONLiteral(item)
+		}
+		return list
+	case *ast.IntValue:
+		i, _ := strconv.ParseInt(value.Value, 10, 64)
+		return i
+	case *ast.FloatValue:
+		f, _ := strconv.ParseFloat(value.Value, 64)
+		return f
+	default:
+		return value.GetValue()
+	}
+}
+`
+
+type graphQLRoot struct {
+	Root   string
+	Fields []graphQLResolver
+}
+
+type graphQLResolver struct {
+	designer.GraphQLField
+	Resolve string
+}
+
+func (gg *GraphQLGenerator) server() ([]byte, error) {
+	schema := gg.Design.GraphQL
+	// Imports share the package block with the declarations of the
+	// generated files, and the resolvers' scope with their variables.
+	imports := newGoImports("json", "strconv", "graphql", "ast", "log", "http", "handler",
+		"main", "services", "newServices", "newSchema", "decodeArg", "encodeResult", "parseJSONLiteral",
+		"serializeInt64", "parseInt64", "parseInt64Literal", "int64Number",
+		"s", "p", "err", "config", "instance")
+
+	services, fields := buildServices(imports, schema.Constructors)
+
+	var roots []graphQLRoot
+	for _, root := range []struct {
+		name   string
+		fields []designer.GraphQLField
+	}{{"Query", schema.Query}, {"Mutation", schema.Mutation}} {
+		if len(root.fields) == 0 {
+			continue
+		}
+		generated := graphQLRoot{Root: root.name}
+		for _, field := range root.fields {
+			receiver := ""
+			if field.Call.Service != "" {
+				receiver = "s." + fields[field.Call.Service]
+			}
+			generated.Fields = append(generated.Fields, graphQLResolver{GraphQLField: field, Resolve: resolveCall(imports, field.Call, receiver)})
+		}
+		roots = append(roots, generated)
+	}
+
+	tmpl, err := template.New("graphql").Funcs(template.FuncMap{"typeVar": graphQLTypeVar, "gqlType": graphQLTypeExpr}).Parse(graphQLTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Imports  []goImport
+		Services []serviceField
+		Types    []designer.GraphQLType
+		Roots    []graphQLRoot
+	}{imports.list(), services, schema.Types, roots})
+	if err != nil {
+		return nil, err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, buf.Bytes())
+	}
+	return code, nil
+}
+
+// graphQLTypeVar names the variable holding a GraphQL type in generated
+// code.
+func graphQLTypeVar(name string) string {
+	return "type" + name
+}
+
+var graphQLBuiltins = map[string]string{
+	"String": "graphql.String", "Int": "graphql.Int", "Float": "graphql.Float", "Boolean": "graphql.Boolean", "ID": "graphql.ID",
+}
+
+// graphQLTypeExpr returns the graphql-go expression of a type written in
+// SDL.
+func graphQLTypeExpr(sdl string) string {
+	switch {
+	case strings.HasSuffix(sdl, "!"):
+		return "graphql.NewNonNull(" + graphQLTypeExpr(sdl[:len(sdl)-1]) + ")"
+	case strings.HasPrefix(sdl, "["):
+		return "graphql.NewList(" + graphQLTypeExpr(sdl[1:len(sdl)-1]) + ")"
+	case graphQLBuiltins[sdl] != "":
+		return graphQLBuiltins[sdl]
+	default:
+		return graphQLTypeVar(sdl)
+	}
+}
+
+// resolveCall returns the body of the resolver of a field calling call,
+// on receiver when it is a method.
+func resolveCall(imports *goImports, call designer.GoCall, receiver string) string {
+	stmts, args := callArguments(imports, call, "p.Context", func(param, variable string) string {
+		return fmt.Sprintf("if err := decodeArg(p.Args, %q, &%s); err != nil {\nreturn nil, err\n}\n", param, variable)
+	})
+	function := imports.alias(call.Package) + "." + call.Function
+	if receiver != "" {
+		function = receiver + "." + call.Function
+	}
+	expr := function + "(" + args + ")"
+
+	names, values, errName := callResults(call)
+	var b strings.Builder
+	b.WriteString(stmts)
+	switch {
+	case len(names) == 0:
+		b.WriteString(expr + "\n")
+	case len(values) == 0:
+		fmt.Fprintf(&b, "if err := %s; err != nil {\nreturn nil, err\n}\n", expr)
+	default:
+		fmt.Fprintf(&b, "%s := %s\n", strings.Join(names, ", "), expr)
+		if errName != "" {
+			b.WriteString("if err != nil {\nreturn nil, err\n}\n")
+		}
+	}
+	switch len(values) {
+	case 0:
+		b.WriteString("return true, nil")
+	case 1:
+		fmt.Fprintf(&b, "return encodeResult(%s)", values[0])
+	default:
+		fmt.Fprintf(&b, "return encodeResult([]interface{}{%s})", strings.Join(values, ", "))
+	}
+	return b.String()
+}
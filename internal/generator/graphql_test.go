@@ -0,0 +1,93 @@
+package generator
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+func TestGenerateGraphQL(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	failure := analyzer.ParameterInfo{Type: "error", Role: analyzer.RoleError}
+	store := analyzer.ParameterInfo{Type: "*Store"}
+	schema := &designer.GraphQLDesign{
+		Query: []designer.GraphQLField{
+			{Name: "getUser", Type: "User", Args: []designer.GraphQLArgument{{Name: "id", Type: "String!"}},
+				Call: designer.GoCall{Package: pkg, Function: "Get", Service: pkg + ".Store",
+					Parameters: []analyzer.ParameterInfo{{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext}, {Name: "id", Type: "string"}},
+					Results:    []analyzer.ParameterInfo{{Type: "*User"}, failure}}},
+			{Name: "listUsers", Type: "[User!]!", Args: []designer.GraphQLArgument{{Name: "tags", Type: "[String!]"}},
+				Call: designer.GoCall{Package: pkg, Function: "List", Service: pkg + ".Store",
+					Parameters: []analyzer.ParameterInfo{{Name: "tags", Type: "...string"}},
+					Results:    []analyzer.ParameterInfo{{Type: "[]User"}}}},
+		},
+		Mutation: []designer.GraphQLField{
+			{Name: "saveUser", Type: "Boolean!", Args: []designer.GraphQLArgument{{Name: "user", Type: "UserInput!"}},
+				Call: designer.GoCall{Package: pkg, Function: "Save", Service: pkg + ".Store",
+					Parameters: []analyzer.ParameterInfo{{Name: "user", Type: "User"}}, Results: []analyzer.ParameterInfo{failure}}},
+		},
+		Types: []designer.GraphQLType{
+			{Name: "User", Kind: "type", Fields: []designer.GraphQLTypeField{{Name: "id", Type: "String!"}, {Name: "friends", Type: "[User]"}}},
+			{Name: "UserInput", Kind: "input", Fields: []designer.GraphQLTypeField{{Name: "id", Type: "String!"}}},
+		},
+		Constructors: []designer.GoCall{{Package: pkg, Function: "NewStore", Service: pkg + ".Store",
+			Parameters: []analyzer.ParameterInfo{{Name: "dsn", Type: "string"}}, Results: []analyzer.ParameterInfo{store, failure}}},
+	}
+
+	source := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "go.mod"), []byte("module example.com/shop\n\ngo 1.22\n"), 0644))
+	generator := NewGraphQLGenerator(&designer.Design{GraphQL: schema})
+	generator.Dir = t.TempDir()
+	generator.Source = source
+	require.NoError(t, generator.GenerateGraphQL())
+
+	sdl, err := os.ReadFile(filepath.Join(generator.Dir, "schema.graphql"))
+	require.NoError(t, err)
+	assert.Equal(t, schema.SDL(), string(sdl))
+
+	mod, err := os.ReadFile(filepath.Join(generator.Dir, "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mod), "\texample.com/shop v0.0.0\n")
+	assert.Contains(t, string(mod), "replace example.com/shop => "+filepath.ToSlash(source)+"\n")
+
+	path := filepath.Join(generator.Dir, "generated_graphql.go")
+	code, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, err := parser.ParseFile(token.NewFileSet(), path, code, 0)
+	require.NoError(t, err)
+	var imports []string
+	for _, spec := range file.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	assert.Equal(t, []string{`"encoding/json"`, `"strconv"`, `"github.com/graphql-go/graphql"`,
+		`"github.com/graphql-go/graphql/language/ast"`, `"example.com/shop/users"`}, imports)
+
+	for _, snippet := range []string{
+		"store *users.Store",
+		"// TODO: Supply the parameters of NewStore.\n\t\tvar argDsn string\n\t\tinstance, err := users.NewStore(argDsn)",
+		`if err := decodeArg(p.Args, "id", &argId); err != nil {`,
+		"v0, err := s.store.Get(p.Context, argId)",
+		"var argTags []string",
+		"v0 := s.store.List(argTags...)",
+		"var argUser users.User",
+		"if err := s.store.Save(argUser); err != nil {",
+		"return true, nil",
+		`"friends": &graphql.Field{Type: graphql.NewList(typeUser), Description: ""}`,
+		`"user": &graphql.ArgumentConfig{Type: graphql.NewNonNull(typeUserInput)}`,
+	} {
+		assert.Contains(t, string(code), snippet)
+	}
+	assert.FileExists(t, filepath.Join(generator.Dir, "generated_main.go"))
+
+	// A schema needs a query type.
+	schema.Query = nil
+	assert.EqualError(t, generator.GenerateGraphQL(), "no function can be a GraphQL query")
+}
@@ -0,0 +1,361 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+// GRPCGenerator writes a gRPC server for the proto part of a design: its
+// .proto definition, and a server implementing its services by calling the
+// analyzed functions. The Go code of the messages and services is left to
+// protoc, run by go generate.
+type GRPCGenerator struct {
+	Design *designer.Design
+	// Dir is where the generated files are written; empty means the current
+	// directory.
+	Dir string
+	// Source is the root of the analyzed module. When set, go.mod requires
+	// the module and replaces it with Source, so that the server builds
+	// against the code it exposes.
+	Source string
+}
+
+func NewGRPCGenerator(design *designer.Design) *GRPCGenerator {
+	return &GRPCGenerator{
+		Design: design,
+	}
+}
+
+// ProtoPath is where GenerateGRPC writes the proto definition, relative to
+// Dir. protoc generates its Go code in the pb package next to it.
+const ProtoPath = "pb/api.proto"
+
+// protoGoPackage is the import path of the Go code protoc generates.
+const protoGoPackage = "soft-crusher-api/pb"
+
+// GenerateGRPC writes the proto definition, the server and its go.mod.
+func (gg *GRPCGenerator) GenerateGRPC() error {
+	proto := gg.Design.Proto
+	if proto == nil {
+		return fmt.Errorf("the design has no proto definition")
+	}
+	if len(proto.Services) == 0 {
+		return fmt.Errorf("no function can be an RPC")
+	}
+	path := filepath.Join(gg.Dir, filepath.FromSlash(ProtoPath))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, []byte(proto.File(protoGoPackage)), 0644); err != nil {
+		return fmt.Errorf("error writing %s: %v", ProtoPath, err)
+	}
+
+	code, err := gg.server()
+	if err != nil {
+		return fmt.Errorf("error generating gRPC server: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(gg.Dir, "generated_grpc.go"), code, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(gg.Dir, "generated_main.go"), []byte(grpcMain), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(gg.Dir, "go.mod"), goMod(gg.Source,
+		"google.golang.org/grpc v1.64.0",
+		"google.golang.org/protobuf v1.34.2"), 0644)
+}
+
+const grpcMain = `package main
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ` + ProtoPath + `
+
+import (
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+func main() {
+	s, err := newServices()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", ":50051")
+	if err != nil {
+		log.Fatal(err)
+	}
+	server := grpc.NewServer()
+	registerServices(server, s)
+	reflection.Register(server)
+	log.Fatal(server.Serve(listener))
+}
+`
+
+const grpcTemplate = `package main
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	{{if .Empty}}
+	"google.golang.org/protobuf/types/known/emptypb"
+	{{end}}
+
+	"` + protoGoPackage + `"
+	{{range .Imports}}
+	{{.Alias}} "{{.Path}}"
+	{{end}}
+)
+
+` + servicesTemplate + `func registerServices(server *grpc.Server, s *services) {
+	{{range .Servers}}
+	pb.Register{{.Name}}Server(server, &{{.Type}}{s: s})
+	{{end}}
+}
+{{range .Servers}}
+// {{.Type}} implements {{.Name}}.
+type {{.Type}} struct {
+	pb.Unimplemented{{.Name}}Server
+	s *services
+}
+{{$server := .}}
+{{range .Methods}}
+{{with .Description}}{{comment .}}{{end}}
+func (srv *{{$server.Type}}) {{.Name}}(ctx context.Context, req *pb.{{.Request}}) ({{.Response}}, error) {
+	{{.Body}}
+}
+{{end}}
+{{end}}
+
+// statusError answers err with code, unless it carries a gRPC status
+// already.
+func statusError(code codes.Code, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(code, err.Error())
+}
+
+` + decodeArgHelper + `
+// messageFields returns the fields of a request by JSON name, as the JSON
+// values of the Go parameters they carry.
+func messageFields(m proto.Message) map[string]interface{} {
+	fields, _ := messageValue(m.ProtoReflect()).(map[string]interface{})
+	return fields
+}
+
+func messageValue(m protoreflect.Message) interface{} {
+	if m.Descriptor().ParentFile().Package() == "google.protobuf" {
+		// Well-known types have the JSON form of the Go values they carry.
+		data, err := protojson.Marshal(m.Interface())
+		if err != nil {
+			return nil
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil
+		}
+		return value
+	}
+	fields := make(map[string]interface{})
+	m.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		fields[field.JSONName()] = fieldValue(field, value)
+		return true
+	})
+	return fields
+}
+
+func fieldValue(field protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+	switch {
+	case field.IsList():
+		list := make([]interface{}, value.List().Len())
+		for i := range list {
+			list[i] = singularValue(field, value.List().Get(i))
+		}
+		return list
+	case field.IsMap():
+		entries := make(map[string]interface{})
+		value.Map().Range(func(key protoreflect.MapKey, value protoreflect.Value) bool {
+			entries[key.String()] = singularValue(field.MapValue(), value)
+			return true
+		})
+		return entries
+	}
+	return singularValue(field, value)
+}
+
+func singularValue(field protoreflect.FieldDescriptor, value protoreflect.Value) interface{} {
+	if field.Message() != nil {
+		return messageValue(value.Message())
+	}
+	return value.Interface()
+}
+
+// encodeMessage sets m from the JSON form of value, the results of a Go
+// function named as encoding/json names them. A nil value leaves m empty.
+func encodeMessage(value interface{}, m proto.Message) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if string(data) == "null" {
+		return nil
+	}
+	return protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, m)
+}
+`
+
+type grpcServer struct {
+	Name, Type string
+	Methods    []grpcMethod
+}
+
+type grpcMethod struct {
+	Name, Description, Request, Response, Body string
+}
+
+func (gg *GRPCGenerator) server() ([]byte, error) {
+	proto := gg.Design.Proto
+	// Imports share the package block with the declarations of the
+	// generated files, and the methods' scope with their variables.
+	reserved := []string{"json", "grpc", "codes", "status", "protojson", "proto", "protoreflect", "emptypb", "pb", "log", "net", "reflection",
+		"main", "services", "newServices", "registerServices", "statusError", "decodeArg", "messageFields", "messageValue", "fieldValue",
+		"singularValue", "encodeMessage", "s", "srv", "ctx", "req", "args", "resp", "err", "instance"}
+	servers := make([]grpcServer, len(proto.Services))
+	for i, service := range proto.Services {
+		servers[i] = grpcServer{Name: service.Name, Type: lowerFirst(service.Name) + "Server"}
+		reserved = append(reserved, servers[i].Type)
+	}
+	imports := newGoImports(reserved...)
+	// Methods take a context.Context.
+	imports.alias("context")
+
+	services, fields := buildServices(imports, proto.Constructors)
+	empty := false
+	for i, service := range proto.Services {
+		for _, rpc := range service.RPCs {
+			receiver := ""
+			if rpc.Call.Service != "" {
+				receiver = "srv.s." + fields[rpc.Call.Service]
+			}
+			response := "*pb." + rpc.Response
+			if rpc.Response == "google.protobuf.Empty" {
+				response = "*emptypb.Empty"
+				empty = true
+			}
+			servers[i].Methods = append(servers[i].Methods, grpcMethod{
+				Name:        rpc.Name,
+				Description: rpc.Description,
+				Request:     rpc.Request,
+				Response:    response,
+				Body:        rpcBody(imports, rpc, receiver, strings.TrimPrefix(response, "*")),
+			})
+		}
+	}
+
+	tmpl, err := template.New("grpc").Funcs(template.FuncMap{"comment": goComment}).Parse(grpcTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Imports  []goImport
+		Services []serviceField
+		Servers  []grpcServer
+		Empty    bool
+	}{imports.list(), services, servers, empty})
+	if err != nil {
+		return nil, err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, buf.Bytes())
+	}
+	return code, nil
+}
+
+// goComment writes text as a Go comment.
+func goComment(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("// "+line, " \t")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// rpcBody returns the body of the method implementing rpc, calling its
+// function on receiver when it is a method and answering with a response
+// of type response.
+func rpcBody(imports *goImports, rpc designer.ProtoRPC, receiver, response string) string {
+	stmts, args := callArguments(imports, rpc.Call, "ctx", func(param, variable string) string {
+		return fmt.Sprintf("if err := decodeArg(args, %q, &%s); err != nil {\nreturn nil, status.Error(codes.InvalidArgument, err.Error())\n}\n", param, variable)
+	})
+	function := imports.alias(rpc.Call.Package) + "." + rpc.Call.Function
+	if receiver != "" {
+		function = receiver + "." + rpc.Call.Function
+	}
+	expr := function + "(" + args + ")"
+
+	var b strings.Builder
+	for _, param := range rpc.Call.Parameters {
+		if param.Role != analyzer.RoleContext {
+			b.WriteString("args := messageFields(req)\n")
+			break
+		}
+	}
+	b.WriteString(stmts)
+	names, values, errName := callResults(rpc.Call)
+	failed := "if err != nil {\n" + grpcErrors(imports, rpc) + "\n}\n"
+	switch {
+	case len(names) == 0:
+		b.WriteString(expr + "\n")
+	case len(values) == 0:
+		fmt.Fprintf(&b, "if err := %s; err != nil {\n%s\n}\n", expr, grpcErrors(imports, rpc))
+	default:
+		fmt.Fprintf(&b, "%s := %s\n", strings.Join(names, ", "), expr)
+		if errName != "" {
+			b.WriteString(failed)
+		}
+	}
+
+	if len(values) == 0 {
+		fmt.Fprintf(&b, "return &%s{}, nil", response)
+		return b.String()
+	}
+	value := values[0]
+	if len(rpc.Results) > 0 {
+		entries := make([]string, len(values))
+		for i, name := range rpc.Results {
+			entries[i] = fmt.Sprintf("%q: %s", name, values[i])
+		}
+		value = "map[string]interface{}{" + strings.Join(entries, ", ") + "}"
+	}
+	fmt.Fprintf(&b, "resp := &%s{}\nif err := encodeMessage(%s, resp); err != nil {\nreturn nil, status.Error(codes.Internal, err.Error())\n}\nreturn resp, nil", response, value)
+	return b.String()
+}
+
+// grpcErrors returns the statements answering err with the gRPC status
+// code of the errors of rpc it matches, and Internal otherwise.
+func grpcErrors(imports *goImports, rpc designer.ProtoRPC) string {
+	var cases []errorCase
+	for _, protoErr := range rpc.Errors {
+		cases = append(cases, errorCase{Errors: protoErr.Errors, Answer: fmt.Sprintf("return nil, statusError(codes.%s, err)", protoErr.Code)})
+	}
+	return errorSwitch(imports, cases, "return nil, statusError(codes.Internal, err)")
+}
@@ -0,0 +1,102 @@
+package generator
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+func TestGenerateGRPC(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	failure := analyzer.ParameterInfo{Type: "error", Role: analyzer.RoleError}
+	notFound := analyzer.ErrorInfo{Name: pkg + ".ErrNotFound", Kind: analyzer.ErrorSentinel}
+	proto := &designer.ProtoDesign{
+		Package: "api",
+		Services: []designer.ProtoService{{Name: "UsersService", Package: pkg, RPCs: []designer.ProtoRPC{
+			{Name: "GetUser", Description: "GetUser returns a user.", Request: "GetUserRequest", Response: "User",
+				Errors: []designer.ProtoError{{Code: "NotFound", Errors: []analyzer.ErrorInfo{notFound}}},
+				Call: designer.GoCall{Package: pkg, Function: "Get", Service: pkg + ".Store",
+					Parameters: []analyzer.ParameterInfo{{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext}, {Name: "id", Type: "string"}},
+					Results:    []analyzer.ParameterInfo{{Type: "*User"}, failure}}},
+			{Name: "ListUsers", Request: "ListUsersRequest", Response: "ListUsersResponse", Results: []string{"result1", "total"},
+				Call: designer.GoCall{Package: pkg, Function: "List", Service: pkg + ".Store",
+					Parameters: []analyzer.ParameterInfo{{Name: "tags", Type: "...string"}},
+					Results:    []analyzer.ParameterInfo{{Type: "[]User"}, {Name: "total", Type: "int"}}}},
+			{Name: "SaveUser", Request: "SaveUserRequest", Response: "google.protobuf.Empty",
+				Call: designer.GoCall{Package: pkg, Function: "Save", Service: pkg + ".Store",
+					Parameters: []analyzer.ParameterInfo{{Name: "user", Type: "User"}}, Results: []analyzer.ParameterInfo{failure}}},
+		}}},
+		Messages: []designer.ProtoMessage{
+			{Name: "GetUserRequest", Fields: []designer.ProtoField{{Name: "id", JSONName: "id", Type: "string", Number: 1}}},
+			{Name: "ListUsersRequest", Fields: []designer.ProtoField{{Name: "tags", JSONName: "tags", Type: "string", Repeated: true, Number: 1}}},
+			{Name: "ListUsersResponse", Fields: []designer.ProtoField{
+				{Name: "result1", JSONName: "result1", Type: "User", Repeated: true, Number: 1},
+				{Name: "total", JSONName: "total", Type: "int64", Number: 2}}},
+			{Name: "SaveUserRequest", Fields: []designer.ProtoField{{Name: "user", JSONName: "user", Type: "User", Number: 1}}},
+			{Name: "User", GoType: pkg + ".User", Fields: []designer.ProtoField{{Name: "id", JSONName: "id", Type: "string", Number: 1}}},
+		},
+		Imports: []string{"google/protobuf/empty.proto"},
+		Constructors: []designer.GoCall{{Package: pkg, Function: "NewStore", Service: pkg + ".Store",
+			Results: []analyzer.ParameterInfo{{Type: "*Store"}}}},
+	}
+
+	source := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "go.mod"), []byte("module example.com/shop\n\ngo 1.22\n"), 0644))
+	generator := NewGRPCGenerator(&designer.Design{Proto: proto})
+	generator.Dir = t.TempDir()
+	generator.Source = source
+	require.NoError(t, generator.GenerateGRPC())
+
+	definition, err := os.ReadFile(filepath.Join(generator.Dir, "pb", "api.proto"))
+	require.NoError(t, err)
+	assert.Equal(t, proto.File("soft-crusher-api/pb"), string(definition))
+
+	mod, err := os.ReadFile(filepath.Join(generator.Dir, "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mod), "\tgoogle.golang.org/grpc v1.64.0\n")
+	assert.Contains(t, string(mod), "replace example.com/shop => "+filepath.ToSlash(source)+"\n")
+
+	main, err := os.ReadFile(filepath.Join(generator.Dir, "generated_main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(main), "//go:generate protoc ")
+
+	path := filepath.Join(generator.Dir, "generated_grpc.go")
+	code, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, err := parser.ParseFile(token.NewFileSet(), path, code, 0)
+	require.NoError(t, err)
+	var imports []string
+	for _, spec := range file.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	assert.Contains(t, imports, `"google.golang.org/protobuf/types/known/emptypb"`)
+	assert.Contains(t, imports, `"soft-crusher-api/pb"`)
+	assert.Contains(t, imports, `"example.com/shop/users"`)
+
+	for _, snippet := range []string{
+		"pb.RegisterUsersServiceServer(server, &usersServiceServer{s: s})",
+		"// GetUser returns a user.\nfunc (srv *usersServiceServer) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {",
+		"v0, err := srv.s.store.Get(ctx, argId)",
+		"case errors.Is(err, users.ErrNotFound):\n\t\t\treturn nil, statusError(codes.NotFound, err)",
+		`if err := decodeArg(args, "tags", &argTags); err != nil {`,
+		`encodeMessage(map[string]interface{}{"result1": v0, "total": v1}, resp)`,
+		"func (srv *usersServiceServer) SaveUser(ctx context.Context, req *pb.SaveUserRequest) (*emptypb.Empty, error) {",
+		"return &emptypb.Empty{}, nil",
+	} {
+		assert.Contains(t, string(code), snippet)
+	}
+
+	// A server needs a service.
+	proto.Services = nil
+	assert.EqualError(t, generator.GenerateGRPC(), "no function can be an RPC")
+	generator.Design.Proto = nil
+	assert.EqualError(t, generator.GenerateGRPC(), "the design has no proto definition")
+}
@@ -0,0 +1,423 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+// JSONRPCGenerator writes a JSON-RPC 2.0 server for the JSON-RPC part of a
+// design: its OpenRPC document, and a server whose methods call the
+// analyzed functions.
+type JSONRPCGenerator struct {
+	Design *designer.Design
+	// Dir is where the generated files are written; empty means the current
+	// directory.
+	Dir string
+	// Source is the root of the analyzed module. When set, go.mod requires
+	// the module and replaces it with Source, so that the server builds
+	// against the code it exposes.
+	Source string
+}
+
+func NewJSONRPCGenerator(design *designer.Design) *JSONRPCGenerator {
+	return &JSONRPCGenerator{
+		Design: design,
+	}
+}
+
+// GenerateJSONRPC writes openrpc.json, the server and its go.mod.
+func (jg *JSONRPCGenerator) GenerateJSONRPC() error {
+	design := jg.Design.JSONRPC
+	if design == nil {
+		return fmt.Errorf("the design has no JSON-RPC methods")
+	}
+	if len(design.Methods) == 0 {
+		return fmt.Errorf("no function can be a JSON-RPC method")
+	}
+	doc, err := json.MarshalIndent(design.OpenRPC(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling OpenRPC document: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(jg.Dir, "openrpc.json"), doc, 0644); err != nil {
+		return fmt.Errorf("error writing openrpc.json: %v", err)
+	}
+
+	code, err := jg.server()
+	if err != nil {
+		return fmt.Errorf("error generating JSON-RPC server: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(jg.Dir, "generated_jsonrpc.go"), code, 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(jg.Dir, "generated_main.go"), []byte(jsonRPCMain), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(jg.Dir, "go.mod"), goMod(jg.Source), 0644)
+}
+
+const jsonRPCMain = `package main
+
+import (
+	"log"
+	"net/http"
+)
+
+func main() {
+	s, err := newServices()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	http.Handle("/rpc", newRPCServer(s))
+	log.Fatal(http.ListenAndServe(":8080", nil))
+}
+`
+
+const jsonRPCTemplate = `package main
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	{{range .Imports}}
+	{{.Alias}} "{{.Path}}"
+	{{end}}
+)
+
+` + servicesTemplate + `// openRPC is the OpenRPC document of the API, answering rpc.discover.
+//
+//go:embed openrpc.json
+var openRPC []byte
+
+// rpcMethod is a method of the API: call calls its function with args,
+// the params by name, once those in required are checked. Params sent by
+// position are named after params.
+type rpcMethod struct {
+	params   []string
+	required []string
+	call     func(ctx context.Context, args map[string]interface{}) (interface{}, error)
+}
+
+func newMethods(s *services) map[string]rpcMethod {
+	return map[string]rpcMethod{
+		{{range .Methods}}
+		{{printf "%q" .Name}}: {
+			params:   {{.Params}},
+			required: {{.Required}},
+			call: func(ctx context.Context, args map[string]interface{}) (interface{}, error) {
+				{{.Body}}
+			},
+		},
+		{{end}}
+	}
+}
+
+// rpcServer serves the methods over HTTP as JSON-RPC 2.0, answering single
+// requests and batches, and nothing to notifications.
+type rpcServer struct {
+	methods map[string]rpcMethod
+}
+
+func newRPCServer(s *services) *rpcServer {
+	return &rpcServer{methods: newMethods(s)}
+}
+
+type rpcRequest struct {
+	JSONRPC string          ` + "`json:\"jsonrpc\"`" + `
+	Method  string          ` + "`json:\"method\"`" + `
+	Params  json.RawMessage ` + "`json:\"params\"`" + `
+	// ID is nil for notifications, which have none.
+	ID json.RawMessage ` + "`json:\"id\"`" + `
+}
+
+type rpcResponse struct {
+	JSONRPC string          ` + "`json:\"jsonrpc\"`" + `
+	Result  json.RawMessage ` + "`json:\"result,omitempty\"`" + `
+	Error   *rpcError       ` + "`json:\"error,omitempty\"`" + `
+	ID      json.RawMessage ` + "`json:\"id\"`" + `
+}
+
+// rpcError is the error object of a response.
+type rpcError struct {
+	Code    int    ` + "`json:\"code\"`" + `
+	Message string ` + "`json:\"message\"`" + `
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+// Error codes JSON-RPC 2.0 defines.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// codeError answers err with code, unless it is an error object already.
+func codeError(code int, err error) error {
+	if _, ok := err.(*rpcError); ok {
+		return err
+	}
+	return &rpcError{Code: code, Message: err.Error()}
+}
+
+func (srv *rpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests are POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var reply interface{}
+	if !json.Valid(body) {
+		reply = &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: codeParseError, Message: "Parse error"}}
+	} else if trimmed := bytes.TrimSpace(body); trimmed[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(trimmed, &batch); err != nil || len(batch) == 0 {
+			reply = &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: codeInvalidRequest, Message: "Invalid Request"}}
+		} else {
+			var responses []*rpcResponse
+			for _, raw := range batch {
+				if response := srv.handle(r.Context(), raw); response != nil {
+					responses = append(responses, response)
+				}
+			}
+			// A batch of notifications is answered with nothing.
+			if len(responses) > 0 {
+				reply = responses
+			}
+		}
+	} else if response := srv.handle(r.Context(), trimmed); response != nil {
+		reply = response
+	}
+
+	if reply == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reply)
+}
+
+// handle answers a request, or returns nil for a notification.
+func (srv *rpcServer) handle(ctx context.Context, raw json.RawMessage) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(raw, &req); err != nil || req.JSONRPC != "2.0" || req.Method == "" || !validID(req.ID) {
+		return &rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: codeInvalidRequest, Message: "Invalid Request"}}
+	}
+
+	result, err := srv.call(ctx, req.Method, req.Params)
+	if req.ID == nil {
+		return nil
+	}
+	response := &rpcResponse{JSONRPC: "2.0", ID: req.ID}
+	if err == nil {
+		response.Result, err = json.Marshal(result)
+	}
+	if err != nil {
+		response.Result = nil
+		response.Error = codeError(codeInternalError, err).(*rpcError)
+	}
+	return response
+}
+
+// validID reports whether id is absent, null, a string or a number.
+func validID(id json.RawMessage) bool {
+	return id == nil || (len(id) > 0 && id[0] != '{' && id[0] != '[' && id[0] != 't' && id[0] != 'f')
+}
+
+func (srv *rpcServer) call(ctx context.Context, name string, params json.RawMessage) (interface{}, error) {
+	if name == "rpc.discover" {
+		return json.RawMessage(openRPC), nil
+	}
+	method, ok := srv.methods[name]
+	if !ok {
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "Method not found"}
+	}
+	args, err := method.args(params)
+	if err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	for _, param := range method.required {
+		if args[param] == nil {
+			return nil, &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("missing param %s", param)}
+		}
+	}
+	return method.call(ctx, args)
+}
+
+// args returns the params of a request by name, whether they were sent by
+// name or by position. Numbers are kept as written, so that large integers
+// keep their precision.
+func (method rpcMethod) args(params json.RawMessage) (map[string]interface{}, error) {
+	args := make(map[string]interface{})
+	params = bytes.TrimSpace(params)
+	if len(params) == 0 || string(params) == "null" {
+		return args, nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.UseNumber()
+	switch params[0] {
+	case '{':
+		err := decoder.Decode(&args)
+		return args, err
+	case '[':
+		var values []interface{}
+		if err := decoder.Decode(&values); err != nil {
+			return nil, err
+		}
+		if len(values) > len(method.params) {
+			return nil, fmt.Errorf("too many params: expected at most %d", len(method.params))
+		}
+		for i, value := range values {
+			args[method.params[i]] = value
+		}
+		return args, nil
+	}
+	return nil, fmt.Errorf("params must be an array or an object")
+}
+
+` + decodeArgHelper
+
+type jsonRPCMethod struct {
+	Name, Params, Required, Body string
+}
+
+func (jg *JSONRPCGenerator) server() ([]byte, error) {
+	design := jg.Design.JSONRPC
+	// Imports share the package block with the declarations of the
+	// generated files, and the methods' scope with their variables.
+	imports := newGoImports("bytes", "context", "json", "fmt", "io", "http", "log",
+		"main", "services", "newServices", "openRPC", "rpcMethod", "newMethods", "rpcServer", "newRPCServer", "rpcRequest", "rpcResponse",
+		"rpcError", "codeError", "validID", "decodeArg", "codeParseError", "codeInvalidRequest", "codeMethodNotFound", "codeInvalidParams",
+		"codeInternalError", "s", "ctx", "args", "err", "instance")
+
+	services, fields := buildServices(imports, design.Constructors)
+	methods := make([]jsonRPCMethod, len(design.Methods))
+	for i, method := range design.Methods {
+		receiver := ""
+		if method.Call.Service != "" {
+			receiver = "s." + fields[method.Call.Service]
+		}
+		var params, required []string
+		for _, param := range method.Params {
+			params = append(params, fmt.Sprintf("%q", param.Name))
+			if param.Required {
+				required = append(required, fmt.Sprintf("%q", param.Name))
+			}
+		}
+		methods[i] = jsonRPCMethod{
+			Name:     method.Name,
+			Params:   goStrings(params),
+			Required: goStrings(required),
+			Body:     jsonRPCBody(imports, method, receiver),
+		}
+	}
+
+	tmpl, err := template.New("jsonrpc").Parse(jsonRPCTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Imports  []goImport
+		Services []serviceField
+		Methods  []jsonRPCMethod
+	}{imports.list(), services, methods})
+	if err != nil {
+		return nil, err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%v\n%s", err, buf.Bytes())
+	}
+	return code, nil
+}
+
+// goStrings returns the []string literal of quoted, or nil when it is
+// empty.
+func goStrings(quoted []string) string {
+	if len(quoted) == 0 {
+		return "nil"
+	}
+	return "[]string{" + strings.Join(quoted, ", ") + "}"
+}
+
+// jsonRPCBody returns the body of the function calling the function of
+// method, on receiver when it is a method, and returning its result.
+func jsonRPCBody(imports *goImports, method designer.JSONRPCMethod, receiver string) string {
+	stmts, args := callArguments(imports, method.Call, "ctx", func(param, variable string) string {
+		return fmt.Sprintf("if err := decodeArg(args, %q, &%s); err != nil {\nreturn nil, codeError(codeInvalidParams, fmt.Errorf(\"param %s: %%v\", err))\n}\n", param, variable, param)
+	})
+	function := imports.alias(method.Call.Package) + "." + method.Call.Function
+	if receiver != "" {
+		function = receiver + "." + method.Call.Function
+	}
+	expr := function + "(" + args + ")"
+
+	var b strings.Builder
+	b.WriteString(stmts)
+	names, values, errName := callResults(method.Call)
+	switch {
+	case len(names) == 0:
+		b.WriteString(expr + "\n")
+	case len(values) == 0:
+		fmt.Fprintf(&b, "if err := %s; err != nil {\n%s\n}\n", expr, jsonRPCErrors(imports, method))
+	default:
+		fmt.Fprintf(&b, "%s := %s\n", strings.Join(names, ", "), expr)
+		if errName != "" {
+			fmt.Fprintf(&b, "if err != nil {\n%s\n}\n", jsonRPCErrors(imports, method))
+		}
+	}
+
+	switch {
+	case len(values) == 0:
+		b.WriteString("return nil, nil")
+	case len(method.Results) > 0:
+		entries := make([]string, len(values))
+		for i, name := range method.Results {
+			entries[i] = fmt.Sprintf("%q: %s", name, values[i])
+		}
+		fmt.Fprintf(&b, "return map[string]interface{}{%s}, nil", strings.Join(entries, ", "))
+	default:
+		fmt.Fprintf(&b, "return %s, nil", values[0])
+	}
+	return b.String()
+}
+
+// jsonRPCErrors returns the statements answering err with the code of the
+// errors of method it matches, and an internal error otherwise.
+func jsonRPCErrors(imports *goImports, method designer.JSONRPCMethod) string {
+	var cases []errorCase
+	for _, rpcErr := range method.Errors {
+		code := fmt.Sprint(rpcErr.Code)
+		switch rpcErr.Code {
+		case designer.JSONRPCInvalidParams:
+			code = "codeInvalidParams"
+		case designer.JSONRPCInternalError:
+			code = "codeInternalError"
+		}
+		cases = append(cases, errorCase{Errors: rpcErr.Errors, Answer: fmt.Sprintf("return nil, codeError(%s, err)", code)})
+	}
+	return errorSwitch(imports, cases, "return nil, codeError(codeInternalError, err)")
+}
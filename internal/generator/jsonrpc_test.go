@@ -0,0 +1,99 @@
+package generator
+
+import (
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+func TestGenerateJSONRPC(t *testing.T) {
+	const pkg = "example.com/shop/users"
+	failure := analyzer.ParameterInfo{Type: "error", Role: analyzer.RoleError}
+	notFound := analyzer.ErrorInfo{Name: pkg + ".ErrNotFound", Kind: analyzer.ErrorSentinel}
+	invalid := analyzer.ErrorInfo{Name: pkg + ".ValidationError", Kind: analyzer.ErrorType, Pointer: true}
+	design := &designer.JSONRPCDesign{
+		Methods: []designer.JSONRPCMethod{
+			{Name: "users.Store.Get", Description: "Get returns a user.",
+				Params: []designer.JSONRPCParam{{Name: "id", Required: true, Schema: &designer.JSONSchema{Type: "string"}}},
+				Result: &designer.JSONSchema{Ref: "#/components/schemas/User"},
+				Errors: []designer.JSONRPCError{{Code: designer.JSONRPCInvalidParams, Message: "Invalid params", Errors: []analyzer.ErrorInfo{invalid}},
+					{Code: 404, Message: "Not Found", Errors: []analyzer.ErrorInfo{notFound}}},
+				Call: designer.GoCall{Package: pkg, Function: "Get", Service: pkg + ".Store",
+					Parameters: []analyzer.ParameterInfo{{Name: "ctx", Type: "context.Context", Role: analyzer.RoleContext}, {Name: "id", Type: "string"}},
+					Results:    []analyzer.ParameterInfo{{Type: "*User"}, failure}}},
+			{Name: "users.SaveUser",
+				Params: []designer.JSONRPCParam{{Name: "user", Required: true, Schema: &designer.JSONSchema{}},
+					{Name: "tags", Schema: &designer.JSONSchema{Type: "array", Items: &designer.JSONSchema{Type: "string"}}}},
+				Result: &designer.JSONSchema{Type: "null"},
+				Call: designer.GoCall{Package: pkg, Function: "SaveUser",
+					Parameters: []analyzer.ParameterInfo{{Name: "user", Type: "User"}, {Name: "tags", Type: "...string"}}, Results: []analyzer.ParameterInfo{failure}}},
+			{Name: "users.Stats", Result: &designer.JSONSchema{Type: "object"}, Results: []string{"count", "result2"},
+				Call: designer.GoCall{Package: pkg, Function: "Stats",
+					Results: []analyzer.ParameterInfo{{Name: "count", Type: "int"}, {Type: "float64"}}}},
+		},
+		Constructors: []designer.GoCall{{Package: pkg, Function: "NewStore", Service: pkg + ".Store",
+			Results: []analyzer.ParameterInfo{{Type: "*Store"}}}},
+	}
+
+	source := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(source, "go.mod"), []byte("module example.com/shop\n\ngo 1.22\n"), 0644))
+	generator := NewJSONRPCGenerator(&designer.Design{JSONRPC: design})
+	generator.Dir = t.TempDir()
+	generator.Source = source
+	require.NoError(t, generator.GenerateJSONRPC())
+
+	doc, err := os.ReadFile(filepath.Join(generator.Dir, "openrpc.json"))
+	require.NoError(t, err)
+	expected, err := json.Marshal(design.OpenRPC())
+	require.NoError(t, err)
+	assert.JSONEq(t, string(expected), string(doc))
+
+	mod, err := os.ReadFile(filepath.Join(generator.Dir, "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mod), "replace example.com/shop => "+filepath.ToSlash(source)+"\n")
+
+	path := filepath.Join(generator.Dir, "generated_jsonrpc.go")
+	code, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, err := parser.ParseFile(token.NewFileSet(), path, code, 0)
+	require.NoError(t, err)
+	var imports []string
+	for _, spec := range file.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	assert.Contains(t, imports, `"errors"`)
+	assert.Contains(t, imports, `"example.com/shop/users"`)
+
+	for _, snippet := range []string{
+		"//go:embed openrpc.json\nvar openRPC []byte",
+		"store *users.Store",
+		`"users.Store.Get": {
+			params:   []string{"id"},
+			required: []string{"id"},`,
+		"v0, err := s.store.Get(ctx, argId)",
+		"case errors.As(err, new(*users.ValidationError)):\n\t\t\t\t\t\treturn nil, codeError(codeInvalidParams, err)",
+		"case errors.Is(err, users.ErrNotFound):\n\t\t\t\t\t\treturn nil, codeError(404, err)",
+		"return nil, codeError(codeInternalError, err)",
+		`if err := decodeArg(args, "tags", &argTags); err != nil {`,
+		"if err := users.SaveUser(argUser, argTags...); err != nil {",
+		`params:   nil,`,
+		`return map[string]interface{}{"count": v0, "result2": v1}, nil`,
+	} {
+		assert.Contains(t, string(code), snippet)
+	}
+	assert.FileExists(t, filepath.Join(generator.Dir, "generated_main.go"))
+
+	design.Methods = nil
+	assert.EqualError(t, generator.GenerateJSONRPC(), "no function can be a JSON-RPC method")
+	generator.Design.JSONRPC = nil
+	assert.EqualError(t, generator.GenerateJSONRPC(), "the design has no JSON-RPC methods")
+}
@@ -0,0 +1,139 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+// ScalarKind classifies a designer.Parameter Scalar by how it is parsed from
+// text: "string", "int", "uint", "float", "bool", "duration" or "time", and
+// "" for anything else.
+func ScalarKind(scalar string) string {
+	switch {
+	case scalar == "string":
+		return "string"
+	case scalar == "bool":
+		return "bool"
+	case scalar == "time.Duration":
+		return "duration"
+	case scalar == "time.Time":
+		return "time"
+	case scalar == "rune" || strings.HasPrefix(scalar, "int"):
+		return "int"
+	case scalar == "byte" || strings.HasPrefix(scalar, "uint"):
+		return "uint"
+	case strings.HasPrefix(scalar, "float"):
+		return "float"
+	}
+	return ""
+}
+
+// bitSize returns the bit size strconv parses a sized scalar with, 0 for int
+// and uint.
+func bitSize(scalar string) int {
+	switch scalar {
+	case "byte":
+		return 8
+	case "rune":
+		return 32
+	case "uintptr":
+		return 64
+	}
+	var bits int
+	fmt.Sscanf(strings.TrimLeft(scalar, "uintfloa"), "%d", &bits)
+	return bits
+}
+
+// requestValue returns the expression reading the raw text of param from a
+// request.
+func requestValue(param designer.Parameter) string {
+	switch param.Location {
+	case "path":
+		return fmt.Sprintf("c.Param(%q)", param.Name)
+	case "header":
+		return fmt.Sprintf("c.GetHeader(%q)", param.Name)
+	default:
+		return fmt.Sprintf("c.Query(%q)", param.Name)
+	}
+}
+
+// bindParameter returns the statements of a gin handler setting variable,
+// of type goType, to param from the path, query or header of the request.
+// Values that do not parse are answered with 400 Bad Request, and missing
+// ones leave the variable at its zero value.
+func bindParameter(imports *goImports, param designer.Parameter, variable, goType string) string {
+	if kind := ScalarKind(param.Scalar); kind != "" {
+		return fmt.Sprintf("if raw := %s; raw != \"\" {\n%s}", requestValue(param), parseValue(imports, param.Name, goType, param.Scalar, "raw", variable+" = %s"))
+	}
+
+	written := sliceType(param.Type)
+	switch {
+	case param.Location == "query" && written == "[]string":
+		return fmt.Sprintf("%s = c.QueryArray(%q)", variable, param.Name)
+	case param.Location == "query" && written == "map[string]string":
+		return fmt.Sprintf("%s = c.QueryMap(%q)", variable, param.Name)
+	case param.Location == "query" && strings.HasPrefix(written, "[]") && strings.HasPrefix(goType, "[]") && ScalarKind(written[2:]) != "":
+		return fmt.Sprintf("for _, raw := range c.QueryArray(%q) {\n%s}", param.Name,
+			parseValue(imports, param.Name, goType[2:], written[2:], "raw", variable+" = append("+variable+", %s)"))
+	case param.Role == analyzer.RoleOptions || (param.Location == "query" && !strings.HasPrefix(written, "[]") && !strings.HasPrefix(written, "map[")):
+		// Structs are bound field by field from the query.
+		return fmt.Sprintf("if err := c.ShouldBindQuery(&%s); err != nil {\n"+
+			"problem(c, http.StatusBadRequest, err.Error())\n"+
+			"return\n"+
+			"}", variable)
+	case strings.ContainsAny(written, "[]*.") || strings.HasPrefix(written, "map"):
+		// Anything else in the path or a header is written as JSON.
+		return fmt.Sprintf("if raw := %s; raw != \"\" {\n"+
+			"if err := %s.Unmarshal([]byte(raw), &%s); err != nil {\n"+
+			"problem(c, http.StatusBadRequest, \"invalid %s: \"+err.Error())\n"+
+			"return\n"+
+			"}\n"+
+			"}", requestValue(param), imports.alias("encoding/json"), variable, param.Name)
+	default:
+		// Without type information, a named type in the path or a header
+		// is most likely a string identifier.
+		return fmt.Sprintf("%s = %s(%s)", variable, goType, requestValue(param))
+	}
+}
+
+// parseValue returns the statements parsing the text in the variable raw as
+// goType, whose underlying type is scalar, and then running assign, a format
+// taking the parsed value. name names the parameter in errors.
+func parseValue(imports *goImports, name, goType, scalar, raw, assign string) string {
+	var parse, result string
+	switch ScalarKind(scalar) {
+	case "string":
+		value := raw
+		if goType != "string" {
+			value = goType + "(" + raw + ")"
+		}
+		return fmt.Sprintf(assign, value) + "\n"
+	case "int":
+		parse, result = fmt.Sprintf("%s.ParseInt(%s, 10, %d)", imports.alias("strconv"), raw, bitSize(scalar)), "int64"
+	case "uint":
+		parse, result = fmt.Sprintf("%s.ParseUint(%s, 10, %d)", imports.alias("strconv"), raw, bitSize(scalar)), "uint64"
+	case "float":
+		parse, result = fmt.Sprintf("%s.ParseFloat(%s, %d)", imports.alias("strconv"), raw, bitSize(scalar)), "float64"
+	case "bool":
+		parse, result = fmt.Sprintf("%s.ParseBool(%s)", imports.alias("strconv"), raw), "bool"
+	case "duration":
+		time := imports.alias("time")
+		parse, result = fmt.Sprintf("%s.ParseDuration(%s)", time, raw), time+".Duration"
+	case "time":
+		time := imports.alias("time")
+		parse, result = fmt.Sprintf("%s.Parse(%s.RFC3339, %s)", time, time, raw), time+".Time"
+	}
+	value := "v"
+	if goType != result {
+		value = goType + "(v)"
+	}
+	return fmt.Sprintf("v, err := %s\n"+
+		"if err != nil {\n"+
+		"problem(c, http.StatusBadRequest, \"invalid %s: \"+err.Error())\n"+
+		"return\n"+
+		"}\n"+
+		"%s\n", parse, name, fmt.Sprintf(assign, value))
+}
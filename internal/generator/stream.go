@@ -0,0 +1,299 @@
+package generator
+
+import (
+	"bytes"
+	"go/format"
+	"os"
+	"path/filepath"
+	"text/template"
+
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+// webSocketModule is required by the generated API when an endpoint streams
+// over a WebSocket.
+const webSocketModule = "github.com/gorilla/websocket v1.5.3"
+
+// streamTemplate is generated_stream.go, written next to the handlers when
+// an endpoint streams. Sends block until the value is written, so a slow
+// client slows the function down instead of values piling up in memory,
+// and the function's context is cancelled as soon as the client goes away
+// or a write fails.
+const streamTemplate = `package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	{{- if .WebSocket}}
+	"time"
+	{{- end}}
+
+	"github.com/gin-gonic/gin"
+	{{- if .WebSocket}}
+	"github.com/gorilla/websocket"
+	{{- end}}
+)
+{{- if .WebSocket}}
+
+// streamWriteTimeout bounds how long a WebSocket client may keep a message
+// waiting: one that stops reading without going away would otherwise hold
+// the function forever.
+const streamWriteTimeout = 30 * time.Second
+
+var upgrader = websocket.Upgrader{}
+{{- end}}
+
+// stream sends a response piece by piece while the function runs.
+type stream struct {
+	c           *gin.Context
+	ctx         context.Context
+	cancel      context.CancelFunc
+	transport   string
+	contentType string
+	started     bool
+	closed      bool
+	{{- if .WebSocket}}
+	conn *websocket.Conn
+	{{- end}}
+}
+
+// openStream prepares the response of c to be streamed over transport,
+// "sse", "websocket" or "chunked". cancel cancels ctx, the context passed to
+// the function, and is called when the client goes away. It reports false
+// when the request could not be answered with a stream, in which case the
+// response has been sent already.
+func openStream(c *gin.Context, ctx context.Context, cancel context.CancelFunc, transport, contentType string) (*stream, bool) {
+	s := &stream{c: c, ctx: ctx, cancel: cancel, transport: transport, contentType: contentType}
+	{{- if .WebSocket}}
+	if transport == "websocket" {
+		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return nil, false
+		}
+		s.conn = conn
+		s.started = true
+		// Reading is how a closed connection is noticed; whatever the
+		// client sends is discarded.
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	{{- end}}
+	return s, true
+}
+
+// start sends the headers of the response, before the first value.
+func (s *stream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	header := s.c.Writer.Header()
+	header.Set("Content-Type", s.contentType)
+	if s.transport == "sse" {
+		header.Set("Cache-Control", "no-cache")
+		// Keeps proxies such as nginx from holding events back.
+		header.Set("X-Accel-Buffering", "no")
+	}
+	s.c.Status(http.StatusOK)
+	s.c.Writer.WriteHeaderNow()
+	s.c.Writer.Flush()
+}
+
+// send sends value as JSON: an event, a line or a text message.
+func (s *stream) send(value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.fail(err)
+		return err
+	}
+	if s.transport == "chunked" {
+		data = append(data, '\n')
+	}
+	return s.write(data, false)
+}
+
+// Write sends p as it comes: an event, bytes of the body or a binary
+// message. It makes the stream the io.Writer of functions writing their
+// response.
+func (s *stream) Write(p []byte) (int, error) {
+	if err := s.write(p, true); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *stream) write(data []byte, binary bool) error {
+	if err := s.ctx.Err(); err != nil {
+		return err
+	}
+	s.start()
+	var err error
+	switch s.transport {
+	{{- if .WebSocket}}
+	case "websocket":
+		kind := websocket.TextMessage
+		if binary {
+			kind = websocket.BinaryMessage
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		err = s.conn.WriteMessage(kind, data)
+	{{- end}}
+	case "sse":
+		err = writeEvent(s.c.Writer, "", data)
+	default:
+		_, err = s.c.Writer.Write(data)
+	}
+	if err != nil {
+		s.cancel()
+		return err
+	}
+	if s.transport != "websocket" {
+		s.c.Writer.Flush()
+	}
+	return nil
+}
+
+// writeEvent writes a Server-Sent Event, one data field per line of data.
+func writeEvent(w http.ResponseWriter, event string, data []byte) error {
+	var buf bytes.Buffer
+	if event != "" {
+		buf.WriteString("event: " + event + "\n")
+	}
+	for _, line := range bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// fail ends the stream with err: an "error" event, a last line holding the
+// problem or a close message. A chunked body of raw bytes has no room for
+// it and just ends. fail reports false when nothing was sent yet, leaving
+// the caller to answer with an error response instead.
+func (s *stream) fail(err error) bool {
+	if s.closed {
+		return true
+	}
+	s.closed = true
+	s.cancel()
+	if !s.started {
+		return false
+	}
+	problem, _ := json.Marshal(gin.H{
+		"type":   "about:blank",
+		"title":  http.StatusText(http.StatusInternalServerError),
+		"status": http.StatusInternalServerError,
+		"detail": err.Error(),
+	})
+	switch {
+	{{- if .WebSocket}}
+	case s.transport == "websocket":
+		// Close reasons are limited to 123 bytes.
+		reason := err.Error()
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+		s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseInternalServerErr, reason), time.Now().Add(time.Second))
+		s.conn.Close()
+		return true
+	{{- end}}
+	case s.transport == "sse":
+		writeEvent(s.c.Writer, "error", problem)
+	case s.contentType == "application/x-ndjson":
+		s.c.Writer.Write(append(append([]byte(` + "`" + `{"error":` + "`" + `), problem...), '}', '\n'))
+	}
+	s.c.Writer.Flush()
+	return true
+}
+
+// close ends the stream once the function is done; a stream without values
+// still answers with its headers.
+func (s *stream) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	{{- if .WebSocket}}
+	if s.transport == "websocket" {
+		s.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+		s.conn.Close()
+		return
+	}
+	{{- end}}
+	s.start()
+}
+
+// forward sends the values of a channel until the function closes it, the
+// client goes away or a send fails. The next value is only received once
+// the previous one is written.
+func forward[T any](s *stream, values <-chan T) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case value, ok := <-values:
+			if !ok || s.send(value) != nil {
+				return
+			}
+		}
+	}
+}
+
+// forwardSeq sends the values of an iterator until it ends or a send
+// fails, which stops it.
+func forwardSeq[T any](s *stream, values func(yield func(T) bool)) {
+	values(func(value T) bool {
+		return s.send(value) == nil
+	})
+}
+`
+
+func hasStreams(endpoints []designer.APIEndpoint) bool {
+	for _, endpoint := range endpoints {
+		if endpoint.Stream != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func usesWebSocket(endpoints []designer.APIEndpoint) bool {
+	for _, endpoint := range endpoints {
+		if endpoint.Stream != nil && endpoint.Stream.Transport == designer.StreamWebSocket {
+			return true
+		}
+	}
+	return false
+}
+
+// generateStreamFile writes the stream helpers when an endpoint streams.
+func (cg *CodeGenerator) generateStreamFile() error {
+	if !hasStreams(cg.Design.Endpoints) {
+		return nil
+	}
+	tmpl, err := template.New("stream").Parse(streamTemplate)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct{ WebSocket bool }{usesWebSocket(cg.Design.Endpoints)}); err != nil {
+		return err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(cg.Dir, "generated_stream.go"), code, 0644)
+}
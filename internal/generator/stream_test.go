@@ -0,0 +1,113 @@
+package generator
+
+import (
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+)
+
+func TestGenerateStreamingHandlers(t *testing.T) {
+	const pkg = "example.com/shop/events"
+	failure := designer.Response{StatusCode: 500, Type: "error"}
+	endpoints := []designer.APIEndpoint{
+		{Method: "GET", Path: "/events", FunctionName: "Watch",
+			Parameters: []designer.Parameter{{Name: "reqCtx", Type: "context.Context", Role: analyzer.RoleContext}},
+			Responses:  []designer.Response{{StatusCode: 200, Type: "stream of Event"}, failure},
+			Stream:     &designer.Stream{Source: designer.StreamChannel, Elem: "Event", Transport: designer.StreamSSE},
+			Call: &designer.GoCall{Package: pkg, Function: "Watch",
+				Parameters: []analyzer.ParameterInfo{{Name: "reqCtx", Type: "context.Context", Role: analyzer.RoleContext}},
+				Results:    []analyzer.ParameterInfo{{Type: "<-chan Event"}, {Type: "error", Role: analyzer.RoleError}}}},
+		{Method: "GET", Path: "/replay", FunctionName: "Replay",
+			Responses: []designer.Response{{StatusCode: 200, Type: "stream of Event"}},
+			Stream:    &designer.Stream{Source: designer.StreamIterator, Elem: "Event", Transport: designer.StreamChunked},
+			Call: &designer.GoCall{Package: pkg, Function: "Replay",
+				Results: []analyzer.ParameterInfo{{Type: "iter.Seq[Event]"}}}},
+		{Method: "GET", Path: "/export", FunctionName: "Export",
+			Parameters: []designer.Parameter{{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter}},
+			Responses:  []designer.Response{{StatusCode: 200, Type: "stream"}, failure},
+			Stream:     &designer.Stream{Source: designer.StreamWriter, Transport: designer.StreamChunked},
+			Call: &designer.GoCall{Package: pkg, Function: "Export",
+				Parameters: []analyzer.ParameterInfo{{Name: "w", Type: "io.Writer", Role: analyzer.RoleWriter}},
+				Results:    []analyzer.ParameterInfo{{Type: "error", Role: analyzer.RoleError}}}},
+	}
+	generator := NewCodeGenerator(&designer.Design{Endpoints: endpoints})
+	generator.Dir = t.TempDir()
+	require.NoError(t, generator.GenerateAPICode())
+
+	path := filepath.Join(generator.Dir, "generated_handlers.go")
+	code, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, err := parser.ParseFile(token.NewFileSet(), path, code, 0)
+	require.NoError(t, err)
+	var imports []string
+	for _, spec := range file.Imports {
+		imports = append(imports, spec.Path.Value)
+	}
+	assert.Equal(t, []string{`"context"`, `"example.com/shop/events"`, `"io"`, `"net/http"`, `"github.com/gin-gonic/gin"`}, imports)
+
+	for _, snippet := range []string{
+		"ctx, cancel := context.WithCancel(c.Request.Context())\n\tdefer cancel()",
+		// Errors before the stream opens are error responses.
+		"v0, err := events.Watch(ctx)\n\tif err != nil {",
+		`out, ok := openStream(c, ctx, cancel, "sse", "text/event-stream")`,
+		"forward(out, v0)",
+		"v0 := events.Replay()",
+		`out, ok := openStream(c, ctx, cancel, "chunked", "application/x-ndjson")`,
+		"forwardSeq(out, v0)",
+		// The writer is the stream, which ends with the function's error.
+		`out, ok := openStream(c, ctx, cancel, "chunked", "application/octet-stream")`,
+		"argW = out\n\tif err := events.Export(argW); err != nil {\n\t\tif !out.fail(err) {",
+	} {
+		assert.Contains(t, string(code), snippet)
+	}
+	assert.NotContains(t, string(code), "ctx := c.Request.Context()")
+	assert.NotContains(t, string(code), "TODO")
+
+	// Without WebSockets, the helpers leave gorilla/websocket out.
+	path = filepath.Join(generator.Dir, "generated_stream.go")
+	helpers, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, err = parser.ParseFile(token.NewFileSet(), path, helpers, 0)
+	require.NoError(t, err)
+	formatted, err := format.Source(helpers)
+	require.NoError(t, err)
+	assert.Equal(t, string(formatted), string(helpers))
+	for _, spec := range file.Imports {
+		assert.NotContains(t, spec.Path.Value, "websocket")
+	}
+	assert.NotContains(t, restRequires(endpoints), webSocketModule)
+
+	endpoints[1].Stream.Transport = designer.StreamWebSocket
+	require.NoError(t, generator.GenerateAPICode())
+	helpers, err = os.ReadFile(path)
+	require.NoError(t, err)
+	_, err = parser.ParseFile(token.NewFileSet(), path, helpers, 0)
+	require.NoError(t, err)
+	formatted, err = format.Source(helpers)
+	require.NoError(t, err)
+	assert.Equal(t, string(formatted), string(helpers))
+	assert.Contains(t, string(helpers), `"github.com/gorilla/websocket"`)
+	assert.Contains(t, string(helpers), "upgrader.Upgrade(c.Writer, c.Request, nil)")
+	assert.Contains(t, restRequires(endpoints), webSocketModule)
+
+	require.NoError(t, generator.GenerateGoModFile())
+	mod, err := os.ReadFile(filepath.Join(generator.Dir, "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mod), "\tgithub.com/gin-gonic/gin v1.7.7\n")
+	assert.Contains(t, string(mod), "\tgithub.com/gorilla/websocket v1.5.3\n")
+
+	// Designs without streams need no helpers.
+	generator = NewCodeGenerator(&designer.Design{Endpoints: []designer.APIEndpoint{{Method: "GET", Path: "/ping", FunctionName: "Ping"}}})
+	generator.Dir = t.TempDir()
+	require.NoError(t, generator.GenerateAPICode())
+	assert.NoFileExists(t, filepath.Join(generator.Dir, "generated_stream.go"))
+}
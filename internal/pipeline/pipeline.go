@@ -0,0 +1,277 @@
+// Package pipeline runs the stages of soft-crusher one after the other:
+// analyzing source code, designing an API from the analysis and generating
+// the server, its documentation and its tests from the design. The stages
+// share two documents, analyzer.Analysis and designer.Design, which can also
+// be saved and loaded in between.
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chenxingqiang/soft-crusher/internal/analyzer"
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+	docs "github.com/chenxingqiang/soft-crusher/internal/documentation"
+	"github.com/chenxingqiang/soft-crusher/internal/generator"
+	"github.com/chenxingqiang/soft-crusher/internal/testing"
+)
+
+// Styles of generated APIs.
+const (
+	StyleREST    = "rest"
+	StyleGraphQL = "graphql"
+	StyleGRPC    = "grpc"
+	StyleJSONRPC = "jsonrpc"
+)
+
+// Options configures the design and generation stages.
+type Options struct {
+	// Style is the kind of API designed and generated: StyleREST, the
+	// default when empty, StyleGraphQL, StyleGRPC or StyleJSONRPC.
+	Style string
+	// ExposeOnly and AllowRisky are passed on to the designer.APIDesigner.
+	ExposeOnly bool
+	AllowRisky bool
+	// OutputDir is where the generated files are written; it is created if
+	// needed, and empty means the current directory.
+	OutputDir string
+	// Overrides are merged onto the inferred design; see
+	// designer.APIDesigner.ApplyOverrides.
+	Overrides *designer.Overrides
+	// Source is the root of the analyzed module, which servers calling the
+	// analyzed functions build against. Run sets it to the analyzed
+	// directory.
+	Source string
+	// ProtoNumbers is the file keeping the field numbers of proto messages
+	// across generations: the numbers it holds are kept, and Generate
+	// writes it back with those of new fields. Run sets it to the
+	// designer.ProtoNumbersFile of the analyzed directory, and empty means
+	// the numbers are not kept.
+	ProtoNumbers string
+}
+
+// Result holds the documents the stages produced, and the warnings about
+// stale overrides.
+type Result struct {
+	Analysis *analyzer.Analysis
+	Design   *designer.Design
+	Warnings []string
+}
+
+// Run analyzes dir with fa, or a new FunctionAnalyzer when fa is nil, then
+// designs and generates the API. A Go module is loaded with full type
+// information, so that its structs get types of their own in GraphQL, gRPC
+// and JSON-RPC. Without options.Overrides, the overrides file of dir is used
+// if there is one.
+func Run(ctx context.Context, fa *analyzer.FunctionAnalyzer, dir string, options Options) (*Result, error) {
+	if fa == nil {
+		fa = analyzer.NewFunctionAnalyzer()
+	}
+	if options.Overrides == nil {
+		overrides, err := LoadOverrides(dir)
+		if err != nil {
+			return nil, err
+		}
+		options.Overrides = overrides
+	}
+	if options.Source == "" {
+		options.Source = dir
+	}
+	if options.ProtoNumbers == "" {
+		options.ProtoNumbers = filepath.Join(dir, designer.ProtoNumbersFile)
+	}
+	analyze := func() error { return fa.AnalyzeDirectoryContext(ctx, dir) }
+	if IsModule(dir) {
+		analyze = func() error { return fa.AnalyzePackagesContext(ctx, dir) }
+	}
+	if err := analyze(); err != nil {
+		return nil, fmt.Errorf("error analyzing %s: %v", dir, err)
+	}
+	result := &Result{Analysis: fa.Analysis()}
+
+	design, warnings, err := Design(result.Analysis, options)
+	result.Warnings = warnings
+	if err != nil {
+		return result, err
+	}
+	result.Design = design
+	return result, Generate(design, options)
+}
+
+// IsModule reports whether dir is the root of a Go module.
+func IsModule(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "go.mod"))
+	return err == nil
+}
+
+// LoadOverrides reads the designer.OverridesFile of dir, returning nil when
+// there is none.
+func LoadOverrides(dir string) (*designer.Overrides, error) {
+	overrides, err := designer.LoadOverrides(filepath.Join(dir, designer.OverridesFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return overrides, err
+}
+
+// Design designs the API of analysis, exposing its services first and then
+// the remaining functions, and merges options.Overrides onto it. It fails
+// when an override is invalid or high-risk functions would be exposed
+// without being allowed, and returns warnings about stale overrides.
+func Design(analysis *analyzer.Analysis, options Options) (*designer.Design, []string, error) {
+	if err := checkStyle(options.Style); err != nil {
+		return nil, nil, err
+	}
+	apiDesigner := designer.NewAPIDesigner()
+	apiDesigner.ExposeOnly = options.ExposeOnly
+	apiDesigner.AllowRisky = options.AllowRisky
+	if options.Overrides != nil {
+		apiDesigner.ErrorRules = options.Overrides.Errors
+	}
+	apiDesigner.DesignServices(analysis.Services)
+	apiDesigner.DesignAPI(analysis.Functions)
+	if options.Overrides != nil {
+		if err := apiDesigner.ApplyOverrides(options.Overrides, analysis.Functions); err != nil {
+			return nil, apiDesigner.Warnings, fmt.Errorf("error applying %s: %v", designer.OverridesFile, err)
+		}
+	}
+	if len(apiDesigner.Rejected) > 0 {
+		names := make([]string, len(apiDesigner.Rejected))
+		for i, fn := range apiDesigner.Rejected {
+			names[i] = fmt.Sprintf("%s (risk %d)", fn.QualifiedName(), fn.RiskScore)
+		}
+		return nil, apiDesigner.Warnings, fmt.Errorf("refusing to expose high-risk functions: %s; review them with analyze --security, "+
+			"then add a soft-crusher:allow-risk directive, exclude them in %s or pass --allow-risky", strings.Join(names, ", "), designer.OverridesFile)
+	}
+	warnings := apiDesigner.Warnings
+	if options.Style == StyleGraphQL {
+		apiDesigner.DesignGraphQL(analysis.Functions, analysis.Schemas)
+		for _, skipped := range apiDesigner.GraphQL.Skipped {
+			warnings = append(warnings, "not in the GraphQL schema: "+skipped)
+		}
+	}
+	if options.Style == StyleGRPC {
+		var numbers *designer.ProtoNumbers
+		if options.ProtoNumbers != "" {
+			loaded, err := designer.LoadProtoNumbers(options.ProtoNumbers)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, warnings, err
+			}
+			numbers = loaded
+		}
+		apiDesigner.DesignProto(analysis.Functions, analysis.Schemas, numbers)
+		for _, skipped := range apiDesigner.Proto.Skipped {
+			warnings = append(warnings, "not in the gRPC services: "+skipped)
+		}
+	}
+	if options.Style == StyleJSONRPC {
+		apiDesigner.DesignJSONRPC(analysis.Functions, analysis.Schemas)
+		for _, skipped := range apiDesigner.JSONRPC.Skipped {
+			warnings = append(warnings, "not in the JSON-RPC methods: "+skipped)
+		}
+	}
+	return apiDesigner.Design(), warnings, nil
+}
+
+func checkStyle(style string) error {
+	switch style {
+	case "", StyleREST, StyleGraphQL, StyleGRPC, StyleJSONRPC:
+		return nil
+	}
+	return fmt.Errorf("unknown API style %q, expected %s, %s, %s or %s", style, StyleREST, StyleGraphQL, StyleGRPC, StyleJSONRPC)
+}
+
+// Generate writes the server code, the OpenAPI document, the test suite and
+// the go.mod file of design to options.OutputDir. With StyleGraphQL, it
+// writes the GraphQL schema and server instead, with StyleGRPC the proto
+// definition and gRPC server, saving its field numbers to
+// options.ProtoNumbers, and with StyleJSONRPC the OpenRPC document and
+// JSON-RPC server.
+func Generate(design *designer.Design, options Options) error {
+	if err := checkStyle(options.Style); err != nil {
+		return err
+	}
+	if options.OutputDir != "" {
+		if err := os.MkdirAll(options.OutputDir, 0755); err != nil {
+			return fmt.Errorf("error creating output directory: %v", err)
+		}
+	}
+
+	if options.Style == StyleGraphQL {
+		if design.GraphQL == nil {
+			return fmt.Errorf("the design has no GraphQL schema; design it with the %s style", StyleGraphQL)
+		}
+		graphQLGenerator := generator.NewGraphQLGenerator(design)
+		graphQLGenerator.Dir = options.OutputDir
+		graphQLGenerator.Source = options.Source
+		if err := graphQLGenerator.GenerateGraphQL(); err != nil {
+			return fmt.Errorf("error generating GraphQL API: %v", err)
+		}
+		return nil
+	}
+
+	if options.Style == StyleGRPC {
+		if design.Proto == nil {
+			return fmt.Errorf("the design has no proto definition; design it with the %s style", StyleGRPC)
+		}
+		grpcGenerator := generator.NewGRPCGenerator(design)
+		grpcGenerator.Dir = options.OutputDir
+		grpcGenerator.Source = options.Source
+		if err := grpcGenerator.GenerateGRPC(); err != nil {
+			return fmt.Errorf("error generating gRPC API: %v", err)
+		}
+		if options.ProtoNumbers != "" && design.Proto.Numbers != nil {
+			var buf bytes.Buffer
+			if err := design.Proto.Numbers.Write(&buf); err != nil {
+				return err
+			}
+			if err := os.WriteFile(options.ProtoNumbers, buf.Bytes(), 0644); err != nil {
+				return fmt.Errorf("error writing proto field numbers: %v", err)
+			}
+		}
+		return nil
+	}
+
+	if options.Style == StyleJSONRPC {
+		if design.JSONRPC == nil {
+			return fmt.Errorf("the design has no JSON-RPC methods; design it with the %s style", StyleJSONRPC)
+		}
+		jsonRPCGenerator := generator.NewJSONRPCGenerator(design)
+		jsonRPCGenerator.Dir = options.OutputDir
+		jsonRPCGenerator.Source = options.Source
+		if err := jsonRPCGenerator.GenerateJSONRPC(); err != nil {
+			return fmt.Errorf("error generating JSON-RPC API: %v", err)
+		}
+		return nil
+	}
+
+	codeGenerator := generator.NewCodeGenerator(design)
+	codeGenerator.Dir = options.OutputDir
+	codeGenerator.Source = options.Source
+	if err := codeGenerator.GenerateAPICode(); err != nil {
+		return fmt.Errorf("error generating API code: %v", err)
+	}
+
+	docGenerator := docs.NewDocumentationGenerator(design)
+	docGenerator.Dir = options.OutputDir
+	if err := docGenerator.GenerateSwaggerDoc(); err != nil {
+		return fmt.Errorf("error generating Swagger documentation: %v", err)
+	}
+
+	testGenerator := testing.NewTestingSuiteGenerator(design)
+	testGenerator.Dir = options.OutputDir
+	testGenerator.Source = options.Source
+	if err := testGenerator.GenerateTests(); err != nil {
+		return fmt.Errorf("error generating test suite: %v", err)
+	}
+	if err := testGenerator.UpdateGoModFile(); err != nil {
+		return fmt.Errorf("error updating go.mod file: %v", err)
+	}
+	return nil
+}
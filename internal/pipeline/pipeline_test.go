@@ -0,0 +1,327 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var shop = map[string]string{
+	"go.mod": "module example.com/shop\n\ngo 1.22\n",
+	"shop.go": `package shop
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+)
+
+var users = map[string]string{}
+
+var ErrNotFound = errors.New("user not found")
+
+// GetUser returns the named user.
+//
+//soft-crusher:path /users/{name}
+//soft-crusher:param name path
+func GetUser(ctx context.Context, name string) (string, error) {
+	email, ok := users[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return email, nil
+}
+
+func SaveUser(name, email string) {
+	users[name] = email
+}
+
+func Reindex() error {
+	return exec.Command("reindex").Run()
+}
+`,
+}
+
+var catalog = map[string]string{
+	"go.mod": "module example.com/catalog\n\ngo 1.22\n",
+	"catalog.go": `package catalog
+
+// Product is an item for sale.
+type Product struct {
+	Name  string ` + "`json:\"name\"`" + `
+	Stock int64  ` + "`json:\"stock\"`" + `
+}
+
+// GetProduct returns the named product.
+func GetProduct(name string) (*Product, error) {
+	return &Product{Name: name}, nil
+}
+
+// AddProduct adds a product and returns its ID.
+func AddProduct(product Product) (int64, error) {
+	return 1, nil
+}
+`,
+}
+
+func writeSource(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestRun(t *testing.T) {
+	src := writeSource(t, shop)
+	out := filepath.Join(t.TempDir(), "api")
+
+	_, err := Run(context.Background(), nil, src, Options{OutputDir: out})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "refusing to expose high-risk functions: example.com/shop.Reindex (risk 60)")
+
+	result, err := Run(context.Background(), nil, src, Options{OutputDir: out, AllowRisky: true})
+	require.NoError(t, err)
+	assert.Len(t, result.Analysis.Functions, 3)
+	require.Len(t, result.Design.Endpoints, 3)
+
+	get := result.Design.Endpoints[0]
+	assert.Equal(t, "GET", get.Method)
+	assert.Equal(t, "/users/{name}", get.Path)
+	assert.Equal(t, "ctx", get.Parameters[0].Name)
+	assert.Empty(t, get.Parameters[0].Location)
+
+	for _, name := range []string{"generated_main.go", "generated_handlers.go", "generated_handlers_test.go", "swagger.json", "go.mod"} {
+		assert.FileExists(t, filepath.Join(out, name))
+	}
+	main, err := os.ReadFile(filepath.Join(out, "generated_main.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(main), `r.GET("/users/:name", s.GetUserHandler)`)
+	assert.Contains(t, string(main), `r.PUT("/user", s.SaveUserHandler)`)
+	handlers, err := os.ReadFile(filepath.Join(out, "generated_handlers.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(handlers), "v0, err := shop.GetUser(ctx, argName)")
+	assert.Contains(t, string(handlers), "case errors.Is(err, shop.ErrNotFound):")
+	mod, err := os.ReadFile(filepath.Join(out, "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mod), "replace example.com/shop => ")
+
+	// The generated tests send the request bodies the handlers bind.
+	goVet(t, out, true)
+}
+
+// goVet type-checks the server generated in dir and its tests, which
+// builds them against the analyzed module, and runs the tests with test.
+// It skips when the modules the server needs cannot be downloaded.
+func goVet(t *testing.T, dir string, test bool) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("type-checking the generated server downloads its modules")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command to type-check the generated server with")
+	}
+	run := func(args ...string) ([]byte, error) {
+		cmd := exec.Command(goTool, args...)
+		cmd.Dir = dir
+		return cmd.CombinedOutput()
+	}
+	if output, err := run("mod", "download"); err != nil {
+		t.Skipf("cannot download the modules of the generated server: %v\n%s", err, output)
+	}
+	output, err := run("mod", "tidy")
+	require.NoError(t, err, string(output))
+	output, err = run("vet", ".")
+	require.NoError(t, err, string(output))
+	if test {
+		output, err = run("test", ".")
+		require.NoError(t, err, string(output))
+	}
+}
+
+func TestRunWithOverrides(t *testing.T) {
+	files := map[string]string{
+		"soft-crusher.api.yaml": `functions:
+  Reindex:
+    exclude: true
+  SaveUser:
+    method: POST
+    path: /users/{name}
+  GetUser:
+    tags: [users]
+    parameters:
+      email: query
+`,
+	}
+	for name, content := range shop {
+		files[name] = content
+	}
+	src := writeSource(t, files)
+
+	result, err := Run(context.Background(), nil, src, Options{OutputDir: t.TempDir()})
+	require.NoError(t, err)
+	require.Len(t, result.Design.Endpoints, 2)
+	save := result.Design.Endpoints[1]
+	assert.Equal(t, "POST /users/{name}", save.Method+" "+save.Path)
+	assert.Equal(t, "path", save.Parameters[0].Location)
+	assert.Equal(t, []string{"GetUser: parameter email no longer exists"}, result.Warnings)
+}
+
+func TestRunGraphQL(t *testing.T) {
+	src := writeSource(t, shop)
+	out := filepath.Join(t.TempDir(), "api")
+
+	result, err := Run(context.Background(), nil, src, Options{OutputDir: out, AllowRisky: true, Style: StyleGraphQL})
+	require.NoError(t, err)
+	require.NotNil(t, result.Design.GraphQL)
+	require.Len(t, result.Design.GraphQL.Query, 1)
+	assert.Equal(t, "getUser", result.Design.GraphQL.Query[0].Name)
+	assert.Len(t, result.Design.GraphQL.Mutation, 2)
+
+	for _, name := range []string{"schema.graphql", "generated_graphql.go", "generated_main.go", "go.mod"} {
+		assert.FileExists(t, filepath.Join(out, name))
+	}
+	assert.NoFileExists(t, filepath.Join(out, "swagger.json"))
+	mod, err := os.ReadFile(filepath.Join(out, "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mod), "replace example.com/shop => ")
+
+	_, err = Run(context.Background(), nil, src, Options{OutputDir: out, Style: "soap"})
+	assert.EqualError(t, err, `unknown API style "soap", expected rest, graphql, grpc or jsonrpc`)
+}
+
+func TestRunGraphQLTypes(t *testing.T) {
+	src := writeSource(t, catalog)
+	out := filepath.Join(t.TempDir(), "api")
+
+	_, err := Run(context.Background(), nil, src, Options{OutputDir: out, Style: StyleGraphQL})
+	require.NoError(t, err)
+	schema, err := os.ReadFile(filepath.Join(out, "schema.graphql"))
+	require.NoError(t, err)
+	// Modules are type-checked, so structs are types rather than JSON, and
+	// int64 does not fit Int.
+	assert.Contains(t, string(schema), "addProduct(product: ProductInput!): Int64!")
+	assert.Contains(t, string(schema), "getProduct(name: String!): Product\n")
+	assert.Contains(t, string(schema), "type Product {\n  name: String!\n  stock: Int64!\n}")
+	assert.Contains(t, string(schema), "input ProductInput {\n  name: String!\n  stock: Int64!\n}")
+	assert.NotContains(t, string(schema), "scalar JSON")
+	goVet(t, out, false)
+}
+
+func TestRunGRPC(t *testing.T) {
+	src := writeSource(t, shop)
+	out := filepath.Join(t.TempDir(), "api")
+
+	result, err := Run(context.Background(), nil, src, Options{OutputDir: out, AllowRisky: true, Style: StyleGRPC})
+	require.NoError(t, err)
+	require.NotNil(t, result.Design.Proto)
+	require.Len(t, result.Design.Proto.Services, 1)
+	assert.Len(t, result.Design.Proto.Services[0].RPCs, 3)
+
+	for _, name := range []string{"pb/api.proto", "generated_grpc.go", "generated_main.go", "go.mod"} {
+		assert.FileExists(t, filepath.Join(out, filepath.FromSlash(name)))
+	}
+	assert.NoFileExists(t, filepath.Join(out, "swagger.json"))
+	lock, err := os.ReadFile(filepath.Join(src, "soft-crusher.proto.lock"))
+	require.NoError(t, err)
+	definition, err := os.ReadFile(filepath.Join(out, "pb", "api.proto"))
+	require.NoError(t, err)
+
+	// A second run reads the numbers back and keeps them.
+	_, err = Run(context.Background(), nil, src, Options{OutputDir: out, AllowRisky: true, Style: StyleGRPC})
+	require.NoError(t, err)
+	again, err := os.ReadFile(filepath.Join(src, "soft-crusher.proto.lock"))
+	require.NoError(t, err)
+	assert.Equal(t, string(lock), string(again))
+	regenerated, err := os.ReadFile(filepath.Join(out, "pb", "api.proto"))
+	require.NoError(t, err)
+	assert.Equal(t, string(definition), string(regenerated))
+}
+
+func TestRunGRPCMessages(t *testing.T) {
+	src := writeSource(t, catalog)
+	out := filepath.Join(t.TempDir(), "api")
+
+	_, err := Run(context.Background(), nil, src, Options{OutputDir: out, Style: StyleGRPC})
+	require.NoError(t, err)
+	definition, err := os.ReadFile(filepath.Join(out, "pb", "api.proto"))
+	require.NoError(t, err)
+	// Structs are messages of their own rather than google.protobuf.Value.
+	assert.Contains(t, string(definition), "message Product {")
+	assert.Contains(t, string(definition), "Product product = 1;")
+	assert.NotContains(t, string(definition), "google.protobuf.Value")
+}
+
+func TestRunJSONRPC(t *testing.T) {
+	src := writeSource(t, shop)
+	out := filepath.Join(t.TempDir(), "api")
+
+	result, err := Run(context.Background(), nil, src, Options{OutputDir: out, AllowRisky: true, Style: StyleJSONRPC})
+	require.NoError(t, err)
+	require.NotNil(t, result.Design.JSONRPC)
+	var names []string
+	for _, method := range result.Design.JSONRPC.Methods {
+		names = append(names, method.Name)
+	}
+	assert.ElementsMatch(t, []string{"shop.GetUser", "shop.SaveUser", "shop.Reindex"}, names)
+
+	for _, name := range []string{"openrpc.json", "generated_jsonrpc.go", "generated_main.go", "go.mod"} {
+		assert.FileExists(t, filepath.Join(out, name))
+	}
+	assert.NoFileExists(t, filepath.Join(out, "swagger.json"))
+}
+
+func TestRunStreams(t *testing.T) {
+	src := writeSource(t, map[string]string{
+		"go.mod": "module example.com/feed\n\ngo 1.23\n",
+		"feed.go": `package feed
+
+import (
+	"context"
+	"iter"
+)
+
+func WatchPrices(ctx context.Context, symbol string) (<-chan float64, error) {
+	prices := make(chan float64, 1)
+	prices <- 1.5
+	close(prices)
+	return prices, nil
+}
+
+//soft-crusher:stream websocket
+func ReplayTrades(since int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		yield("trade")
+	}
+}
+`,
+	})
+	out := filepath.Join(t.TempDir(), "api")
+
+	result, err := Run(context.Background(), nil, src, Options{OutputDir: out})
+	require.NoError(t, err)
+	require.Len(t, result.Design.Endpoints, 2)
+	for _, endpoint := range result.Design.Endpoints {
+		require.NotNil(t, endpoint.Stream, endpoint.FunctionName)
+		assert.Equal(t, "GET", endpoint.Method)
+	}
+	assert.Equal(t, "sse", result.Design.Endpoints[0].Stream.Transport)
+	assert.Equal(t, "websocket", result.Design.Endpoints[1].Stream.Transport)
+
+	assert.FileExists(t, filepath.Join(out, "generated_stream.go"))
+	mod, err := os.ReadFile(filepath.Join(out, "go.mod"))
+	require.NoError(t, err)
+	assert.Contains(t, string(mod), "github.com/gorilla/websocket")
+
+	handlers, err := os.ReadFile(filepath.Join(out, "generated_handlers.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(handlers), "v0, err := feed.WatchPrices(ctx, argSymbol)")
+	assert.Contains(t, string(handlers), "forwardSeq(out, v0)")
+	goVet(t, out, true)
+}
@@ -1,106 +1,282 @@
 package testing
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"go/format"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/chenxingqiang/soft-crusher/internal/designer"
+	docs "github.com/chenxingqiang/soft-crusher/internal/documentation"
+	"github.com/chenxingqiang/soft-crusher/internal/generator"
 )
 
 type TestingSuiteGenerator struct {
-	APIDesign *APIDesigner
+	Design *designer.Design
+	// Dir is where the generated files are written; empty means the current
+	// directory.
+	Dir string
+	// Source is the root of the analyzed module, which go.mod replaces; see
+	// generator.CodeGenerator.
+	Source string
 }
 
-func NewTestingSuiteGenerator(apiDesign *APIDesigner) *TestingSuiteGenerator {
+func NewTestingSuiteGenerator(design *designer.Design) *TestingSuiteGenerator {
 	return &TestingSuiteGenerator{
-		APIDesign: apiDesign,
+		Design: design,
 	}
 }
 
+// endpointTest is the test of an endpoint: Body is the sample request body
+// of ContentType, and Statuses the status codes the endpoint documents.
+type endpointTest struct {
+	designer.APIEndpoint
+	Test, Body, ContentType, Statuses string
+}
+
 func (tsg *TestingSuiteGenerator) GenerateTests() error {
 	testTemplate := `package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
+	{{- if webSocket .Endpoints}}
+	"github.com/gorilla/websocket"
+	{{- end}}
 	"github.com/stretchr/testify/assert"
 )
 
-func SetupRouter() *gin.Engine {
-	r := gin.Default()
-	{{range .Endpoints}}
-	r.{{.Method}}("{{.Path}}", {{.FunctionName}}Handler)
-	{{end}}
-	return r
+// setupRouter routes the API to the services the server builds.
+func setupRouter(t *testing.T) *gin.Engine {
+	s, err := newServices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRouter(s)
 }
-
-{{range .Endpoints}}
-func Test{{.FunctionName}}(t *testing.T) {
-	router := SetupRouter()
-
-	{{if eq .Method "GET"}}
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("{{.Method}}", "{{.Path}}", nil)
-	router.ServeHTTP(w, req)
-
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "{{.FunctionName}} executed successfully")
-	{{else}}
-	// Sample request body
-	body := map[string]interface{}{
-		{{range .Parameters}}
-		"{{.Name}}": "sample_{{.Name}}",
-		{{end}}
+{{range .Tests}}
+func {{.Test}}(t *testing.T) {
+	router := setupRouter(t)
+	{{if and .Stream (eq .Stream.Transport "websocket")}}
+	server := httptest.NewServer(router)
+	defer server.Close()
+	header := http.Header{}
+	{{- range .Parameters}}
+	{{- if eq .Location "header"}}
+	header.Set("{{.Name}}", "{{sampleValue .}}")
+	{{- end}}
+	{{- end}}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"{{samplePath .APIEndpoint}}", header)
+	if !assert.NoError(t, err) {
+		return
 	}
-	jsonBody, _ := json.Marshal(body)
-
+	defer conn.Close()
+	// The stream ends with a normal close once the function is done.
+	for err == nil {
+		_, _, err = conn.ReadMessage()
+	}
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+	{{- else}}
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("{{.Method}}", "{{.Path}}", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
+	{{- if .Body}}
+	// Sample request body, as the API documents it
+	{{- end}}
+	req, _ := http.NewRequest("{{.Method}}", "{{samplePath .APIEndpoint}}", strings.NewReader({{goString .Body}}))
+	{{- if .Body}}
+	req.Header.Set("Content-Type", "{{.ContentType}}")
+	{{- end}}
+	{{- range .Parameters}}
+	{{- if eq .Location "header"}}
+	req.Header.Set("{{.Name}}", "{{sampleValue .}}")
+	{{- end}}
+	{{- end}}
 	router.ServeHTTP(w, req)
 
+	{{if .Stream -}}
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "{{.FunctionName}} executed successfully")
-	{{end}}
+	assert.Equal(t, "{{.Stream.ContentType}}", w.Header().Get("Content-Type"))
+	{{- else -}}
+	// Sample values may well fail, but only as the API documents.
+	assert.Contains(t, {{.Statuses}}, w.Code, w.Body.String())
+	{{- end}}
+	{{- end}}
 }
-{{end}}
-`
+{{end}}`
 
-	tmpl, err := template.New("tests").Parse(testTemplate)
+	funcMap := template.FuncMap{
+		"samplePath":  samplePath,
+		"sampleValue": sampleValue,
+		"webSocket":   webSocket,
+		"goString":    goString,
+	}
+	tmpl, err := template.New("tests").Funcs(funcMap).Parse(testTemplate)
 	if err != nil {
 		return fmt.Errorf("error parsing test template: %v", err)
 	}
 
-	f, err := os.Create("generated_handlers_test.go")
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, struct {
+		Endpoints []designer.APIEndpoint
+		Tests     []endpointTest
+	}{tsg.Design.Endpoints, tsg.tests()})
+	if err != nil {
+		return fmt.Errorf("error executing test template: %v", err)
+	}
+	code, err := format.Source(buf.Bytes())
 	if err != nil {
+		return fmt.Errorf("error formatting tests: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tsg.Dir, "generated_handlers_test.go"), code, 0644); err != nil {
 		return fmt.Errorf("error creating test file: %v", err)
 	}
-	defer f.Close()
+	return nil
+}
 
-	err = tmpl.Execute(f, tsg.APIDesign)
-	if err != nil {
-		return fmt.Errorf("error executing test template: %v", err)
+// tests returns the test of each endpoint, named after its function and
+// numbered when functions share a name. Request bodies are sampled from
+// the OpenAPI document, so that they take the shape the handlers bind.
+func (tsg *TestingSuiteGenerator) tests() []endpointTest {
+	doc := docs.NewDocumentationGenerator(tsg.Design).Document()
+	tests := make([]endpointTest, len(tsg.Design.Endpoints))
+	taken := make(map[string]bool)
+	for i, endpoint := range tsg.Design.Endpoints {
+		test := endpointTest{APIEndpoint: endpoint, Test: "Test" + endpoint.FunctionName}
+		for n := 2; taken[test.Test]; n++ {
+			test.Test = fmt.Sprintf("Test%s%d", endpoint.FunctionName, n)
+		}
+		taken[test.Test] = true
+
+		var statuses []string
+		for _, response := range endpoint.Responses {
+			statuses = append(statuses, generator.StatusExpr(response.StatusCode))
+		}
+		if len(statuses) == 0 {
+			statuses = append(statuses, "http.StatusOK")
+		}
+		test.Statuses = "[]int{" + strings.Join(statuses, ", ") + "}"
+
+		if item := doc.Paths.Value(endpoint.Path); item != nil {
+			if operation := item.GetOperation(strings.ToUpper(endpoint.Method)); operation != nil && operation.RequestBody != nil {
+				for contentType, media := range operation.RequestBody.Value.Content {
+					test.ContentType = contentType
+					test.Body = sampleBody(media.Schema.Value)
+				}
+			}
+		}
+		tests[i] = test
+	}
+	return tests
+}
+
+// goString returns the Go literal of s, raw when it can be.
+func goString(s string) string {
+	if strings.ContainsAny(s, "`\r") {
+		return strconv.Quote(s)
 	}
+	return "`" + s + "`"
+}
 
-	fmt.Println("Test suite generated successfully: generated_handlers_test.go")
-	return nil
+// sampleBody returns a request body of schema: raw bytes, or a JSON object
+// with a sample value for each property.
+func sampleBody(schema *openapi3.Schema) string {
+	if !schema.Type.Is(openapi3.TypeObject) {
+		return "sample"
+	}
+	body := make(map[string]interface{})
+	for name, property := range schema.Properties {
+		body[name] = sampleJSON(name, property.Value)
+	}
+	data, _ := json.Marshal(body)
+	return string(data)
 }
 
+// sampleJSON returns a JSON value of schema for the property name.
+func sampleJSON(name string, schema *openapi3.Schema) interface{} {
+	switch {
+	case schema.Type.Is(openapi3.TypeString) && schema.Format == "date-time":
+		return "2024-01-01T00:00:00Z"
+	case schema.Type.Is(openapi3.TypeString) && schema.Format == "duration":
+		return "1s"
+	case schema.Type.Is(openapi3.TypeString):
+		return "sample_" + name
+	case schema.Type.Is(openapi3.TypeInteger) || schema.Type.Is(openapi3.TypeNumber):
+		return 1
+	case schema.Type.Is(openapi3.TypeBoolean):
+		return true
+	case schema.Type.Is(openapi3.TypeArray):
+		return []interface{}{}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// UpdateGoModFile writes the go.mod of the server, which the tests share.
 func (tsg *TestingSuiteGenerator) UpdateGoModFile() error {
-	goModContent := `module soft-crusher-api
+	codeGenerator := generator.NewCodeGenerator(tsg.Design)
+	codeGenerator.Dir = tsg.Dir
+	codeGenerator.Source = tsg.Source
+	return codeGenerator.GenerateGoModFile()
+}
 
-go 1.16
+// webSocket reports whether one of endpoints streams over a WebSocket, which
+// its test dials.
+func webSocket(endpoints []designer.APIEndpoint) bool {
+	for _, endpoint := range endpoints {
+		if endpoint.Stream != nil && endpoint.Stream.Transport == designer.StreamWebSocket {
+			return true
+		}
+	}
+	return false
+}
 
-require (
-	github.com/gin-gonic/gin v1.7.7
-	github.com/stretchr/testify v1.7.0
-)
-`
+// samplePath fills the path parameters of endpoint with sample values and
+// adds its query parameters.
+func samplePath(endpoint designer.APIEndpoint) string {
+	path := endpoint.Path
+	query := url.Values{}
+	for _, param := range endpoint.Parameters {
+		switch param.Location {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+param.Name+"}", url.PathEscape(sampleValue(param)))
+		case "query":
+			query.Set(param.Name, sampleValue(param))
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path
+}
 
-	return os.WriteFile("go.mod", []byte(goModContent), 0644)
+// sampleValue returns a value of param, or of its elements, that the
+// generated handler parses.
+func sampleValue(param designer.Parameter) string {
+	scalar := param.Scalar
+	if scalar == "" && strings.HasPrefix(param.Type, "[]") {
+		scalar = param.Type[2:]
+	}
+	switch generator.ScalarKind(scalar) {
+	case "int", "uint", "float":
+		return "1"
+	case "bool":
+		return "true"
+	case "duration":
+		return "1s"
+	case "time":
+		return "2024-01-01T00:00:00Z"
+	default:
+		return "sample_" + param.Name
+	}
 }